@@ -0,0 +1,93 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// The declarations below pin the v1 API listed in the package documentation, a change that breaks one of them does
+// not compile. Interfaces are assigned both ways so that methods cannot be added to them either.
+var (
+	_ func(*xml.Decoder, xmlpicker.Selector) *xmlpicker.Parser          = xmlpicker.NewParser
+	_ func(xmlpicker.TokenReader, xmlpicker.Selector) *xmlpicker.Parser = xmlpicker.NewTokenParser
+	_ func(*xmlpicker.Parser) (*xmlpicker.Node, error)                  = (*xmlpicker.Parser).Next
+	_                                                                   = xmlpicker.Parser{
+		NSFlag:             xmlpicker.NSPrefix,
+		MaxDepth:           int(0),
+		MaxChildren:        int(0),
+		MaxTokensPerRecord: int(0),
+		MaxTokensTotal:     int(0),
+		CollectDepth:       int(0),
+		PreserveSpace:      false,
+	}
+	_ = []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSPrefix, xmlpicker.NSStrip}
+	_ = []error{xmlpicker.ErrUnexpectedEOF}
+
+	_ = xmlpicker.Node{
+		StartElement: xml.StartElement{},
+		Parent:       (*xmlpicker.Node)(nil),
+		Namespaces:   xmlpicker.Namespaces(nil),
+		Children:     []*xmlpicker.Node(nil),
+	}
+	_ func(*xmlpicker.Node) (string, bool)         = (*xmlpicker.Node).Text
+	_ func(*xmlpicker.Node, string)                = (*xmlpicker.Node).SetText
+	_ func(*xmlpicker.Node) string                 = (*xmlpicker.Node).Path
+	_ func(*xmlpicker.Node) []xml.Name             = (*xmlpicker.Node).PathNames
+	_ func(*xmlpicker.Node) int                    = (*xmlpicker.Node).Depth
+	_ func(*xmlpicker.Node) xmlpicker.QName        = (*xmlpicker.Node).Name
+	_ func(*xmlpicker.Node) []xmlpicker.Attr       = (*xmlpicker.Node).Attrs
+	_ func(*xmlpicker.Node, string) (string, bool) = (*xmlpicker.Node).LookupPrefix
+	_ func(*xmlpicker.Node) *xmlpicker.Node        = (*xmlpicker.Node).Detach
+	_ func(*xmlpicker.Node) *xmlpicker.Node        = (*xmlpicker.Node).DeepCopy
+
+	_ interface{ Matches(*xmlpicker.Node) bool } = xmlpicker.Selector(nil)
+	_ xmlpicker.Selector                         = interface{ Matches(*xmlpicker.Node) bool }(nil)
+	_ interface {
+		Matches(*xmlpicker.Node) bool
+		MatchesSubtree(*xmlpicker.Node) bool
+	} = xmlpicker.SubtreeSelector(nil)
+	_ xmlpicker.SubtreeSelector = interface {
+		Matches(*xmlpicker.Node) bool
+		MatchesSubtree(*xmlpicker.Node) bool
+	}(nil)
+	_ interface {
+		Matches(*xmlpicker.Node) bool
+		SelectsAttribute() (string, bool)
+	} = xmlpicker.AttributeSelector(nil)
+	_ xmlpicker.AttributeSelector = interface {
+		Matches(*xmlpicker.Node) bool
+		SelectsAttribute() (string, bool)
+	}(nil)
+	_ func(string) xmlpicker.Selector                                 = xmlpicker.PathSelector
+	_ func(string) (xmlpicker.Selector, error)                        = xmlpicker.ParsePathSelector
+	_ func(string) (*xmlpicker.Path, error)                           = xmlpicker.ParsePath
+	_ func(string) (*xmlpicker.Path, error)                           = xmlpicker.ParseXPath
+	_ xmlpicker.SubtreeSelector                                       = (*xmlpicker.Path)(nil)
+	_ xmlpicker.AttributeSelector                                     = (*xmlpicker.Path)(nil)
+	_ func(*xmlpicker.Path) string                                    = (*xmlpicker.Path).String
+	_ func(*xmlpicker.Path) error                                     = (*xmlpicker.Path).Validate
+	_ func(string, string, string, bool) (xmlpicker.Predicate, error) = xmlpicker.NewPredicate
+	_                                                                 = xmlpicker.Path{Anchored: false, Steps: []xmlpicker.Step(nil), Attribute: "", ResolvePrefixes: false}
+	_                                                                 = xmlpicker.Step{Name: "", Descendant: false, Position: xmlpicker.Position{From: 0, To: 0, Last: false}, Attrs: []xmlpicker.Predicate(nil), Texts: []xmlpicker.Predicate(nil)}
+	_                                                                 = xmlpicker.Predicate{Operand: "", Op: "", Value: "", Numeric: false}
+
+	_ interface{ Process(*xmlpicker.Node) error } = xmlpicker.Processor(nil)
+	_ xmlpicker.Processor                         = interface{ Process(*xmlpicker.Node) error }(nil)
+	_ xmlpicker.Processor                         = xmlpicker.ProcessorFunc(nil)
+	_ error                                       = &xmlpicker.RecordError{Stage: "", Err: error(nil), Record: interface{}(nil)}
+
+	_ interface {
+		FromNode(*xmlpicker.Node) (map[string]interface{}, error)
+	} = xmlpicker.Mapper(nil)
+	_ xmlpicker.Mapper = interface {
+		FromNode(*xmlpicker.Node) (map[string]interface{}, error)
+	}(nil)
+	_ = []xmlpicker.Mapper{xmlpicker.SimpleMapper{}, xmlpicker.BadgerFishMapper{}, xmlpicker.ParkerMapper{}, xmlpicker.OrderedMapper{}}
+
+	_ func(io.Writer) *xmlpicker.XMLExporter              = xmlpicker.NewXMLExporter
+	_ func(*xmlpicker.XMLExporter) error                  = (*xmlpicker.XMLExporter).EncodeDeclaration
+	_ func(*xmlpicker.XMLExporter, *xmlpicker.Node) error = (*xmlpicker.XMLExporter).EncodeNode
+	_                                                     = xmlpicker.XMLExporter{Encoder: (*xml.Encoder)(nil)}
+)
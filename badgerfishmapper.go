@@ -0,0 +1,94 @@
+package xmlpicker
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BadgerFishMapper maps nodes following the BadgerFish convention. A node is mapped to an object holding the value of
+// its element under its qualified name, e.g. {"entry": {"@id": "1", "title": {"$": "Foo"}}}. The value of an element
+// is an object with its attributes prefixed by "@", its text under "$" and its children under their qualified names,
+// as a list when they are repeated. The namespaces in scope at the node, and those declared by its descendants, are
+// listed under "@xmlns" with the default namespace under "$".
+//
+// The pieces of text of an element that also has child elements are joined with the whitespace around them, which is
+// only kept with Parser.PreserveSpace, or with a space when there is none, e.g. {"$": "Hello and more"} for
+// <p>Hello <b>world</b> and more</p>. The text of other elements is trimmed.
+type BadgerFishMapper struct{}
+
+func (m BadgerFishMapper) FromNode(node *Node) (map[string]interface{}, error) {
+	if text, ok := node.Text(); ok {
+		return map[string]interface{}{"$": text}, nil
+	}
+	namespaces := node.InScopeNamespaces()
+	delete(namespaces, "xml")
+	return map[string]interface{}{qualifiedName(node.Name()): m.fromNode(node, namespaces)}, nil
+}
+
+// fromNode returns the value of the element of node, namespaces are the ones it lists.
+func (m BadgerFishMapper) fromNode(node *Node, namespaces Namespaces) map[string]interface{} {
+	out := make(map[string]interface{})
+	if len(namespaces) != 0 {
+		xmlns := make(map[string]interface{}, len(namespaces))
+		for prefix, ns := range namespaces {
+			if prefix == "" {
+				prefix = "$"
+			}
+			xmlns[prefix] = ns
+		}
+		out["@xmlns"] = xmlns
+	}
+	for _, a := range node.Attrs() {
+		out["@"+qualifiedName(a.Name)] = a.Value
+	}
+	var text bytes.Buffer
+	hasText, hasElement := false, false
+	for _, c := range node.Children {
+		if t, ok := c.Text(); ok {
+			if hasText && hasElement && !endsWithSpace(text.Bytes()) && !startsWithSpace(t) {
+				text.WriteByte(' ')
+			}
+			text.WriteString(t)
+			hasText = true
+			continue
+		}
+		hasElement = true
+		key := qualifiedName(c.Name())
+		value := m.fromNode(c, c.declarations())
+		switch prev := out[key].(type) {
+		case nil:
+			out[key] = value
+		case []interface{}:
+			out[key] = append(prev, value)
+		default:
+			out[key] = []interface{}{prev, value}
+		}
+	}
+	if hasText && hasElement {
+		out["$"] = text.String()
+	} else if hasText {
+		out["$"] = strings.TrimSpace(text.String())
+	}
+	return out
+}
+
+// startsWithSpace and endsWithSpace report whether text starts or ends with whitespace.
+func startsWithSpace(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return unicode.IsSpace(r)
+}
+
+func endsWithSpace(text []byte) bool {
+	r, _ := utf8.DecodeLastRune(text)
+	return unicode.IsSpace(r)
+}
+
+// qualifiedName returns the name with its prefix, if any, as it is written in a document.
+func qualifiedName(name QName) string {
+	if name.Prefix == "" {
+		return name.Local
+	}
+	return name.Prefix + ":" + name.Local
+}
@@ -0,0 +1,84 @@
+package xmlpicker
+
+import (
+	"sync"
+	"time"
+)
+
+// BatchingProcessor maps nodes with Mapper and hands the records to Sink in batches of Size, as bulk APIs expect.
+// When Window is set a batch is also handed over once that long has passed since its first record was added, so that
+// records read slowly, e.g. from a pipe, are not held back. Flush hands over the last, incomplete, batch and must be
+// called once the input ends.
+//
+// Sink is never called concurrently, but with a Window it may be called on another goroutine, in which case its error
+// is returned by the next call to Process, Add or Flush.
+type BatchingProcessor struct {
+	Mapper Mapper
+	Size   int
+	Window time.Duration
+	Sink   func(batch []interface{}) error
+
+	mu    sync.Mutex
+	batch []interface{}
+	timer *time.Timer
+	// seq numbers the batches so that a timer firing late does not flush a later batch
+	seq int
+	err error
+}
+
+// Process maps node and adds its record to the batch, mapping errors are returned as a RecordError.
+func (p *BatchingProcessor) Process(node *Node) error {
+	v, err := p.Mapper.FromNode(node)
+	if err != nil {
+		return &RecordError{Stage: "map", Err: err}
+	}
+	return p.Add(v)
+}
+
+// Add adds a record that is already mapped to the batch, handing the batch to Sink once it is full.
+func (p *BatchingProcessor) Add(record interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.batch = append(p.batch, record)
+	if len(p.batch) >= p.Size {
+		return p.flush()
+	}
+	if p.Window > 0 && len(p.batch) == 1 {
+		seq := p.seq
+		p.timer = time.AfterFunc(p.Window, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.seq == seq && p.err == nil {
+				p.err = p.flush()
+			}
+		})
+	}
+	return nil
+}
+
+// Flush hands the records added since the last batch to Sink, if there are any.
+func (p *BatchingProcessor) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	return p.flush()
+}
+
+func (p *BatchingProcessor) flush() error {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.seq++
+	if len(p.batch) == 0 {
+		return nil
+	}
+	batch := p.batch
+	p.batch = nil
+	return p.Sink(batch)
+}
@@ -0,0 +1,90 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestBatchingProcessor(t *testing.T) {
+	for idx, test := range []struct {
+		size     int
+		records  int
+		expected []string
+	}{
+		{size: 2, records: 5, expected: []string{"[1 2]", "[3 4]", "[5]"}},
+		{size: 3, records: 3, expected: []string{"[1 2 3]"}},
+		{size: 10, records: 2, expected: []string{"[1 2]"}},
+		{size: 1, records: 2, expected: []string{"[1]", "[2]"}},
+		{size: 2, records: 0, expected: nil},
+	} {
+		t.Run(fmt.Sprintf("%d size %d", idx, test.size), func(t *testing.T) {
+			var doc bytes.Buffer
+			doc.WriteString("<feed>")
+			for i := 1; i <= test.records; i++ {
+				fmt.Fprintf(&doc, `<entry id="%d"/>`, i)
+			}
+			doc.WriteString("</feed>")
+			var actual []string
+			p := &xmlpicker.BatchingProcessor{
+				Mapper: xmlpicker.SimpleMapper{},
+				Size:   test.size,
+				Sink: func(batch []interface{}) error {
+					var ids []string
+					for _, record := range batch {
+						ids = append(ids, record.(map[string]interface{})["@id"].(string))
+					}
+					actual = append(actual, "["+strings.Join(ids, " ")+"]")
+					return nil
+				},
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc.String())), xmlpicker.PathSelector("/feed/entry"))
+			for {
+				node, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.NoError(t, p.Process(node))
+			}
+			assert.NoError(t, p.Flush())
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestBatchingProcessor_Window(t *testing.T) {
+	batches := make(chan []interface{}, 10)
+	failure := errors.New("failure")
+	calls := 0
+	p := &xmlpicker.BatchingProcessor{
+		Size:   10,
+		Window: 20 * time.Millisecond,
+		Sink: func(batch []interface{}) error {
+			calls++
+			batches <- batch
+			if calls == 2 {
+				return failure
+			}
+			return nil
+		},
+	}
+	assert.NoError(t, p.Add(1))
+	assert.NoError(t, p.Add(2))
+	assert.Equal(t, []interface{}{1, 2}, <-batches)
+	assert.NoError(t, p.Add(3))
+	assert.Equal(t, []interface{}{3}, <-batches)
+	// the timer holds the lock until the error of Sink is recorded
+	assert.Equal(t, failure, p.Add(4))
+	assert.Equal(t, failure, p.Flush())
+}
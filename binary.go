@@ -0,0 +1,121 @@
+package xmlpicker
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BinaryEncoding describes how binary payloads are encoded as element text.
+type BinaryEncoding int
+
+const (
+	Base64Encoding BinaryEncoding = iota
+	HexEncoding
+)
+
+func (e BinaryEncoding) String() string {
+	switch e {
+	case Base64Encoding:
+		return "Base64Encoding"
+	case HexEncoding:
+		return "HexEncoding"
+	default:
+		return fmt.Sprintf("!BINARYENCODING(%d)", e)
+	}
+}
+
+// BinaryExtractor decodes the text content of nodes matched by Selector, writes it to a file in Dir named by the
+// value of the KeyAttr attribute and replaces the text with the path of the written file.
+type BinaryExtractor struct {
+	Selector Selector
+	Dir      string
+	KeyAttr  string
+	Encoding BinaryEncoding
+}
+
+// Extract walks node and its descendants, extracting the payload of every node that matches the selector.
+func (x *BinaryExtractor) Extract(node *Node) error {
+	if _, ok := node.Text(); ok {
+		return nil
+	}
+	if x.Selector.Matches(node) {
+		return x.extractNode(node)
+	}
+	for _, c := range node.Children {
+		if err := x.Extract(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *BinaryExtractor) extractNode(node *Node) error {
+	key, ok := attrValue(node, x.KeyAttr)
+	if !ok {
+		return fmt.Errorf("xmlpicker: missing key attribute %s at %s", x.KeyAttr, node.Path())
+	}
+	name := filepath.Base(key)
+	if name != key || name == "." || name == ".." {
+		return fmt.Errorf("xmlpicker: invalid key %q at %s", key, node.Path())
+	}
+	text, ok := textContent(node)
+	if !ok && len(node.Children) != 0 {
+		return fmt.Errorf("xmlpicker: unexpected element in binary payload at %s", node.Path())
+	}
+	data, err := x.decode(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return fmt.Errorf("xmlpicker: invalid binary payload at %s: %s", node.Path(), err)
+	}
+	if err := os.MkdirAll(x.Dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(x.Dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	child := &Node{Parent: node}
+	child.SetText(path)
+	node.Children = []*Node{child}
+	return nil
+}
+
+// textContent returns the concatenated text of node when it has only text children.
+func textContent(node *Node) (string, bool) {
+	if len(node.Children) == 0 {
+		return "", false
+	}
+	parts := make([]string, 0, len(node.Children))
+	for _, c := range node.Children {
+		text, ok := c.Text()
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, ""), true
+}
+
+func (x *BinaryExtractor) decode(s string) ([]byte, error) {
+	switch x.Encoding {
+	case Base64Encoding:
+		return base64.StdEncoding.DecodeString(s)
+	case HexEncoding:
+		return hex.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", x.Encoding)
+	}
+}
+
+func attrValue(node *Node, local string) (string, bool) {
+	for _, a := range node.StartElement.Attr {
+		if a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
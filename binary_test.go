@@ -0,0 +1,125 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestBinaryExtractor(t *testing.T) {
+	for idx, test := range []struct {
+		name          string
+		xml           string
+		extract       string
+		encoding      xmlpicker.BinaryEncoding
+		expected      string
+		expectedFiles map[string]string
+		expectedErr   string
+	}{
+		{
+			name:     "control",
+			xml:      `<a><b>hello</b></a>`,
+			extract:  "/a/c",
+			expected: `{"_name":"a","b":[{"#text":["hello"]}]}`,
+		},
+		{
+			name:          "base64",
+			xml:           `<a><b id="one">aGVs` + "\n" + `bG8=</b><b id="two">d29ybGQ=</b></a>`,
+			extract:       "/a/b",
+			expected:      `{"_name":"a","b":[{"#text":["DIR/one"],"@id":"one"},{"#text":["DIR/two"],"@id":"two"}]}`,
+			expectedFiles: map[string]string{"one": "hello", "two": "world"},
+		},
+		{
+			name:          "hex",
+			xml:           `<a><b id="one">68656c6c6f</b></a>`,
+			extract:       "/a/b",
+			encoding:      xmlpicker.HexEncoding,
+			expected:      `{"_name":"a","b":[{"#text":["DIR/one"],"@id":"one"}]}`,
+			expectedFiles: map[string]string{"one": "hello"},
+		},
+		{
+			name:        "missing key",
+			xml:         `<a><b>aGVsbG8=</b></a>`,
+			extract:     "/a/b",
+			expectedErr: "xmlpicker: missing key attribute id at /a/b",
+		},
+		{
+			name:        "invalid key",
+			xml:         `<a><b id="../x">aGVsbG8=</b></a>`,
+			extract:     "/a/b",
+			expectedErr: `xmlpicker: invalid key "../x" at /a/b`,
+		},
+		{
+			name:        "invalid payload",
+			xml:         `<a><b id="one">!!!</b></a>`,
+			extract:     "/a/b",
+			expectedErr: "xmlpicker: invalid binary payload at /a/b: illegal base64 data at input byte 0",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "xmlpicker")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer os.RemoveAll(dir)
+			extractor := xmlpicker.BinaryExtractor{
+				Selector: xmlpicker.PathSelector(test.extract),
+				Dir:      dir,
+				KeyAttr:  "id",
+				Encoding: test.encoding,
+			}
+			var b bytes.Buffer
+			e := json.NewEncoder(&b)
+			e.SetEscapeHTML(false)
+			var actualErr error
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector("/"))
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					actualErr = err
+					break
+				}
+				if err := extractor.Extract(n); err != nil {
+					actualErr = err
+					break
+				}
+				v, err := xmlpicker.SimpleMapper{}.FromNode(n)
+				if err != nil {
+					actualErr = err
+					break
+				}
+				if err := e.Encode(v); err != nil {
+					actualErr = err
+					break
+				}
+			}
+			if test.expectedErr != "" {
+				assert.EqualError(t, actualErr, test.expectedErr, "%s\nXML:\n%s\n", name, test.xml)
+				return
+			}
+			assert.NoError(t, actualErr, "%s\nXML:\n%s\n", name, test.xml)
+			actual := strings.Replace(strings.TrimSuffix(b.String(), "\n"), dir, "DIR", -1)
+			assert.Equal(t, test.expected, actual, "%s\nXML:\n%s\n", name, test.xml)
+			for k, v := range test.expectedFiles {
+				data, err := ioutil.ReadFile(filepath.Join(dir, k))
+				if assert.NoError(t, err, name) {
+					assert.Equal(t, v, string(data), name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Catalog resolves the public and system identifiers of external DTDs to local files using OASIS XML catalogs, so that
+// the entities they declare can be used without network access. The public, system, rewriteSystem, systemSuffix, group
+// and nextCatalog entries are supported, entries that point to anything but local files are ignored.
+type Catalog struct {
+	public        map[string]string
+	system        map[string]string
+	rewriteSystem []catalogRewrite
+	systemSuffix  []catalogRewrite
+}
+
+type catalogRewrite struct {
+	match string
+	uri   string
+}
+
+// LoadCatalog reads the catalog files, and the catalogs they reference with nextCatalog, into a single Catalog.
+// Entries of the earlier files take precedence.
+func LoadCatalog(filenames ...string) (*Catalog, error) {
+	c := &Catalog{
+		public: make(map[string]string),
+		system: make(map[string]string),
+	}
+	loaded := make(map[string]bool)
+	for _, filename := range filenames {
+		if err := c.load(filename, loaded); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Catalog) load(filename string, loaded map[string]bool) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if loaded[abs] {
+		return nil
+	}
+	loaded[abs] = true
+	f, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	next, err := c.read(f, filepath.Dir(abs))
+	if err != nil {
+		return fmt.Errorf("xmlpicker: invalid catalog %s: %s", filename, err)
+	}
+	for _, n := range next {
+		if err := c.load(n, loaded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read adds the entries of a catalog document and returns the catalogs it references with nextCatalog.
+func (c *Catalog) read(r io.Reader, base string) ([]string, error) {
+	decoder := xml.NewDecoder(r)
+	bases := []string{base}
+	var next []string
+	for {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			return next, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			base := bases[len(bases)-1]
+			if b, ok := catalogAttr(t, xmlNamespace, "base"); ok {
+				base = resolveLocal(base, b)
+			}
+			bases = append(bases, base)
+			switch t.Name.Local {
+			case "public":
+				id, _ := catalogAttr(t, "", "publicId")
+				c.add(c.public, normalizePublicID(id), t, base)
+			case "system":
+				id, _ := catalogAttr(t, "", "systemId")
+				c.add(c.system, id, t, base)
+			case "rewriteSystem":
+				match, _ := catalogAttr(t, "", "systemIdStartString")
+				prefix, _ := catalogAttr(t, "", "rewritePrefix")
+				uri := resolveLocal(base, prefix)
+				if strings.HasSuffix(prefix, "/") && !strings.HasSuffix(uri, "/") {
+					uri = uri + string(filepath.Separator)
+				}
+				c.rewriteSystem = append(c.rewriteSystem, catalogRewrite{match: match, uri: uri})
+			case "systemSuffix":
+				match, _ := catalogAttr(t, "", "systemIdSuffix")
+				uri, _ := catalogAttr(t, "", "uri")
+				c.systemSuffix = append(c.systemSuffix, catalogRewrite{match: match, uri: resolveLocal(base, uri)})
+			case "nextCatalog":
+				if n, ok := catalogAttr(t, "", "catalog"); ok {
+					next = append(next, resolveLocal(base, n))
+				}
+			}
+		case xml.EndElement:
+			bases = bases[:len(bases)-1]
+		}
+	}
+}
+
+func (c *Catalog) add(entries map[string]string, id string, t xml.StartElement, base string) {
+	uri, ok := catalogAttr(t, "", "uri")
+	if !ok || id == "" {
+		return
+	}
+	if _, ok := entries[id]; !ok {
+		entries[id] = resolveLocal(base, uri)
+	}
+}
+
+// Resolve returns the local file for an external identifier, system identifiers take precedence over public ones.
+func (c *Catalog) Resolve(publicID, systemID string) (string, bool) {
+	if systemID != "" {
+		if uri, ok := c.system[systemID]; ok {
+			return localPath(uri)
+		}
+		if r, ok := longestMatch(c.rewriteSystem, systemID, strings.HasPrefix); ok {
+			return localPath(r.uri + systemID[len(r.match):])
+		}
+		if r, ok := longestMatch(c.systemSuffix, systemID, strings.HasSuffix); ok {
+			return localPath(r.uri)
+		}
+	}
+	if publicID != "" {
+		if uri, ok := c.public[normalizePublicID(publicID)]; ok {
+			return localPath(uri)
+		}
+	}
+	return "", false
+}
+
+// longestMatch returns the rewrite with the longest match for id, the most specific one.
+func longestMatch(rewrites []catalogRewrite, id string, matches func(s, match string) bool) (catalogRewrite, bool) {
+	best := -1
+	for i, r := range rewrites {
+		if r.match != "" && matches(id, r.match) && (best == -1 || len(r.match) > len(rewrites[best].match)) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return catalogRewrite{}, false
+	}
+	return rewrites[best], true
+}
+
+func catalogAttr(t xml.StartElement, space, local string) (string, bool) {
+	for _, a := range t.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func normalizePublicID(id string) string {
+	return strings.Join(strings.Fields(id), " ")
+}
+
+// resolveLocal resolves a relative reference against base, a directory.
+func resolveLocal(base, ref string) string {
+	if u, err := url.Parse(ref); err == nil && u.Scheme != "" {
+		return ref
+	}
+	if filepath.IsAbs(ref) || base == "" {
+		return ref
+	}
+	return filepath.Join(base, filepath.FromSlash(ref))
+}
+
+// localPath returns the file named by uri, which is either a path or a file URL.
+func localPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// a single letter is a windows drive
+		return uri, true
+	}
+	if u.Scheme == "file" {
+		return filepath.FromSlash(u.Path), true
+	}
+	return "", false
+}
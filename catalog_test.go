@@ -0,0 +1,146 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "xmlpicker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCatalogResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"catalog.xml": `<catalog xmlns="urn:oasis:names:tc:entity:xmlns:xml:catalog">
+			<public publicId="-//Example//DTD  Feed//EN" uri="dtd/feed.dtd"/>
+			<system systemId="http://example.com/feed.dtd" uri="dtd/system.dtd"/>
+			<group xml:base="rewritten/">
+				<rewriteSystem systemIdStartString="http://example.com/dtds/" rewritePrefix="./"/>
+				<rewriteSystem systemIdStartString="http://example.com/dtds/v2/" rewritePrefix="v2/"/>
+			</group>
+			<systemSuffix systemIdSuffix="/suffix.dtd" uri="dtd/suffix.dtd"/>
+			<system systemId="http://example.com/remote.dtd" uri="http://example.com/mirror.dtd"/>
+			<nextCatalog catalog="next/catalog.xml"/>
+		</catalog>`,
+		"next/catalog.xml": `<catalog xmlns="urn:oasis:names:tc:entity:xmlns:xml:catalog">
+			<system systemId="http://example.com/feed.dtd" uri="ignored.dtd"/>
+			<system systemId="http://example.com/next.dtd" uri="next.dtd"/>
+		</catalog>`,
+	})
+	defer os.RemoveAll(dir)
+	catalog, err := xmlpicker.LoadCatalog(filepath.Join(dir, "catalog.xml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for idx, test := range []struct {
+		publicID string
+		systemID string
+		expected string
+	}{
+		{"-//Example//DTD Feed//EN", "", "dtd/feed.dtd"},
+		{"-//Example//DTD Feed//EN", "http://example.com/feed.dtd", "dtd/system.dtd"},
+		{"-//Example//DTD Feed//EN", "http://example.com/unknown.dtd", "dtd/feed.dtd"},
+		{"", "http://example.com/dtds/a.dtd", "rewritten/a.dtd"},
+		{"", "http://example.com/dtds/v2/a.dtd", "rewritten/v2/a.dtd"},
+		{"", "http://example.org/x/suffix.dtd", "dtd/suffix.dtd"},
+		{"", "http://example.com/next.dtd", "next/next.dtd"},
+		{"", "http://example.com/remote.dtd", ""},
+		{"", "http://example.com/unknown.dtd", ""},
+	} {
+		t.Run(fmt.Sprintf("%d %s%s", idx, test.publicID, test.systemID), func(t *testing.T) {
+			actual, ok := catalog.Resolve(test.publicID, test.systemID)
+			if test.expected == "" {
+				assert.False(t, ok, actual)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, filepath.Join(dir, filepath.FromSlash(test.expected)), actual)
+		})
+	}
+}
+
+func TestParserCatalog(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"catalog.xml": `<catalog xmlns="urn:oasis:names:tc:entity:xmlns:xml:catalog">
+			<public publicId="-//Example//DTD Feed//EN" uri="feed.dtd"/>
+		</catalog>`,
+		"feed.dtd": `<!-- <!ENTITY commented "no"> -->
+			<!ENTITY % symbols SYSTEM "symbols.ent">
+			%symbols;
+			<!ENTITY % draft "IGNORE">
+			<![%draft;[ <!ENTITY status "draft"> ]]>
+			<![INCLUDE[ <!ENTITY status "final"> ]]>
+			<!ENTITY copy "&#169;">
+			<!ENTITY notice "&copy; &owner;">
+			<!ELEMENT feed (entry*)>
+			<!ATTLIST entry id CDATA #REQUIRED>`,
+		"symbols.ent": `<!ENTITY nbsp "&#xA0;"><!ENTITY owner "Example">`,
+	})
+	defer os.RemoveAll(dir)
+	catalog, err := xmlpicker.LoadCatalog(filepath.Join(dir, "catalog.xml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for idx, test := range []struct {
+		doc      string
+		expected string
+	}{
+		{
+			`<!DOCTYPE feed PUBLIC "-//Example//DTD Feed//EN" "http://example.com/feed.dtd"><feed><entry>a&nbsp;b &notice; &status;</entry></feed>`,
+			"a b © Example final",
+		},
+		{
+			`<!DOCTYPE feed PUBLIC "-//Example//DTD Feed//EN" "feed.dtd" [<!ENTITY owner "Someone">]><feed><entry>&notice;</entry></feed>`,
+			"© Someone",
+		},
+		{
+			`<!DOCTYPE feed [<!ENTITY % local "<!ENTITY greeting 'hello'>"> %local;]><feed><entry>&greeting;</entry></feed>`,
+			"hello",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.expected), func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(test.doc))
+			decoder.Strict = true
+			parser := xmlpicker.NewParser(decoder, xmlpicker.PathSelector("/feed/entry"))
+			parser.Catalog = catalog
+			node, err := parser.Next()
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expected, deepText(node))
+			}
+		})
+	}
+}
+
+func TestParserCatalogUnresolved(t *testing.T) {
+	catalog, err := xmlpicker.LoadCatalog()
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoder := xml.NewDecoder(strings.NewReader(`<!DOCTYPE feed SYSTEM "http://example.com/feed.dtd"><feed><entry>&nbsp;</entry></feed>`))
+	decoder.Strict = true
+	parser := xmlpicker.NewParser(decoder, xmlpicker.PathSelector("/feed/entry"))
+	parser.Catalog = catalog
+	_, err = parser.Next()
+	assert.EqualError(t, err, "XML syntax error on line 1: invalid character entity &nbsp;")
+}
@@ -0,0 +1,70 @@
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+)
+
+// RecordFingerprint is what a ChangeDetector keeps of a record between runs.
+type RecordFingerprint struct {
+	Space string `json:"space,omitempty"`
+	Name  string `json:"name"`
+	Hash  string `json:"hash"`
+}
+
+// ChangeDetector compares the fingerprints of records against those of a previous run, by key, turning full dumps
+// into a stream of changes.
+type ChangeDetector struct {
+	Key           *KeyPath
+	Fingerprinter *Fingerprinter
+	// Previous holds the fingerprints of the previous run, Current those of the records seen so far.
+	Previous map[string]RecordFingerprint
+	Current  map[string]RecordFingerprint
+}
+
+// Changed records the fingerprint of node and reports whether it is new or differs from the previous run.
+func (d *ChangeDetector) Changed(node *Node) (bool, error) {
+	key, ok := d.Key.Key(node)
+	if !ok {
+		return false, fmt.Errorf("xmlpicker: missing key %s at %s", d.Key, node.Path())
+	}
+	f := RecordFingerprint{
+		Space: node.StartElement.Name.Space,
+		Name:  node.StartElement.Name.Local,
+		Hash:  d.Fingerprinter.Fingerprint(node),
+	}
+	if d.Current == nil {
+		d.Current = make(map[string]RecordFingerprint)
+	}
+	d.Current[key] = f
+	previous, ok := d.Previous[key]
+	return !ok || previous != f, nil
+}
+
+// Removed returns a tombstone for each record of the previous run whose key was not seen since, in key order. A
+// tombstone is an empty document element named like the record with _key and _deleted="true" attributes.
+func (d *ChangeDetector) Removed() []*Node {
+	var keys []string
+	for k := range d.Previous {
+		if _, ok := d.Current[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	nodes := make([]*Node, 0, len(keys))
+	for _, k := range keys {
+		f := d.Previous[k]
+		nodes = append(nodes, &Node{
+			StartElement: xml.StartElement{
+				Name: xml.Name{Space: f.Space, Local: f.Name},
+				Attr: []xml.Attr{
+					{Name: xml.Name{Local: "_key"}, Value: k},
+					{Name: xml.Name{Local: "_deleted"}, Value: "true"},
+				},
+			},
+			Parent: &Node{},
+		})
+	}
+	return nodes
+}
@@ -0,0 +1,109 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestChangeDetector(t *testing.T) {
+	for idx, test := range []struct {
+		name            string
+		previous        string
+		current         string
+		expected        []string
+		expectedRemoved string
+		expectedErr     string
+	}{
+		{
+			name:     "first run",
+			current:  `<r><i id="1">a</i><i id="2">b</i></r>`,
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "unchanged",
+			previous: `<r><i id="1">a</i><i id="2">b</i></r>`,
+			current:  `<r><i id="2">b</i><i id="1">a</i></r>`,
+		},
+		{
+			name:     "changed and added",
+			previous: `<r><i id="1">a</i><i id="2">b</i></r>`,
+			current:  `<r><i id="1">a</i><i id="2">c</i><i id="3">d</i></r>`,
+			expected: []string{"2", "3"},
+		},
+		{
+			name:            "removed",
+			previous:        `<r><i id="1">a</i><i id="2">b</i><i id="3">c</i></r>`,
+			current:         `<r><i id="2">b</i></r>`,
+			expectedRemoved: `{"@_deleted":"true","@_key":"1","_name":"i"}` + "\n" + `{"@_deleted":"true","@_key":"3","_name":"i"}` + "\n",
+		},
+		{
+			name:        "missing key",
+			current:     `<r><i>a</i></r>`,
+			expectedErr: "xmlpicker: missing key @id at /r/i",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			key, err := xmlpicker.ParseKeyPath("@id")
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			d := &xmlpicker.ChangeDetector{Key: key, Fingerprinter: &xmlpicker.Fingerprinter{}}
+			if test.previous != "" {
+				_, err := detectChanges(d, test.previous)
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				d.Previous, d.Current = d.Current, nil
+			}
+			actual, err := detectChanges(d, test.current)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.Equal(t, test.expected, actual, name)
+			var b bytes.Buffer
+			for _, n := range d.Removed() {
+				v, err := xmlpicker.SimpleMapper{}.FromNode(n)
+				if assert.NoError(t, err, name) {
+					assert.NoError(t, json.NewEncoder(&b).Encode(v), name)
+				}
+			}
+			assert.Equal(t, test.expectedRemoved, b.String(), name)
+		})
+	}
+}
+
+// detectChanges returns the ids of the changed records of s.
+func detectChanges(d *xmlpicker.ChangeDetector, s string) ([]string, error) {
+	var changed []string
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(s)), xmlpicker.PathSelector("/r/i"))
+	for {
+		n, err := parser.Next()
+		if err == io.EOF {
+			return changed, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ok, err := d.Changed(n)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			id, _ := d.Key.Key(n)
+			changed = append(changed, id)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+)
+
+type benchSelectorCmd struct {
+	Selector  []string `short:"s" long:"selector" value-name:"SELECTOR" description:"path selector to measure, may be repeated"`
+	XPath     []string `short:"x" long:"xpath" value-name:"XPATH" description:"XPath 1.0 location path to measure, may be repeated"`
+	Namespace string   `short:"n" long:"namespace" choice:"expand" choice:"strip" choice:"prefix" default:"prefix" description:"how to handle namespaces"`
+	Runs      int      `long:"runs" value-name:"N" default:"3" description:"number of times each selector is run over the file"`
+	Args      struct {
+		Filename string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute reads the decompressed file into memory once and then parses it with each selector in turn, so that the
+// reported throughput is that of the parser and selector rather than of the disk.
+func (c *benchSelectorCmd) Execute(_ []string) error {
+	if len(c.Selector)+len(c.XPath) == 0 {
+		return fmt.Errorf("at least one --selector or --xpath is required")
+	}
+	if c.Runs < 1 {
+		return fmt.Errorf("--runs must be positive")
+	}
+	data, err := readInput(c.Args.Filename)
+	if err != nil {
+		return err
+	}
+	var benchmarks []options
+	for _, s := range c.Selector {
+		benchmarks = append(benchmarks, options{Selector: s, Namespace: c.Namespace})
+	}
+	for _, x := range c.XPath {
+		benchmarks = append(benchmarks, options{XPath: x, Namespace: c.Namespace})
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "selector\trecords\tMB/s\trecords/s\tallocs/record\tbytes/record\t")
+	for i := range benchmarks {
+		o := &benchmarks[i]
+		r, err := benchSelector(data, o, c.Runs)
+		if err != nil {
+			return err
+		}
+		name := o.Selector
+		if o.XPath != "" {
+			name = "xpath:" + o.XPath
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.0f\t%.1f\t%.0f\t\n", name, r.records, r.mbPerSecond(len(data)), r.recordsPerSecond(), r.perRecord(r.mallocs), r.perRecord(r.bytes))
+	}
+	return w.Flush()
+}
+
+type benchResult struct {
+	records int
+	runs    int
+	elapsed time.Duration
+	mallocs uint64
+	bytes   uint64
+}
+
+func (r *benchResult) mbPerSecond(size int) float64 {
+	return float64(size) * float64(r.runs) / r.elapsed.Seconds() / (1 << 20)
+}
+
+func (r *benchResult) recordsPerSecond() float64 {
+	return float64(r.records) * float64(r.runs) / r.elapsed.Seconds()
+}
+
+// perRecord returns a total of all runs per matched record, or per run when nothing matched.
+func (r *benchResult) perRecord(v uint64) float64 {
+	n := r.records * r.runs
+	if n == 0 {
+		n = r.runs
+	}
+	return float64(v) / float64(n)
+}
+
+// benchSelector parses data runs times with the selector of o, the records are counted but not mapped.
+func benchSelector(data []byte, o *options, runs int) (*benchResult, error) {
+	r := &benchResult{runs: runs}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < runs; i++ {
+		parser, err := newParser(bytes.NewReader(data), o)
+		if err != nil {
+			return nil, err
+		}
+		records := 0
+		for {
+			if _, err := parser.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			records = records + 1
+		}
+		r.records = records
+	}
+	r.elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	r.mallocs = after.Mallocs - before.Mallocs
+	r.bytes = after.TotalAlloc - before.TotalAlloc
+	return r, nil
+}
+
+// readInput reads all of filename, decompressed.
+func readInput(filename string) ([]byte, error) {
+	f, err := open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := autoDecompress(f, decompression{bufferSize: defaultReadBuffer})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
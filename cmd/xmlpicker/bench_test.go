@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBenchSelector(t *testing.T) {
+	const doc = `<r><i id="1"><t/></i><i id="2"><t/><t/></i></r>`
+	dir, ok := writeFiles(t, map[string]string{
+		"records.xml":    doc,
+		"records.xml.gz": string(gzipped([]byte(doc))),
+	})
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for idx, test := range []struct {
+		name            string
+		args            []string
+		expectedRecords map[string]string
+		expectedErr     string
+	}{
+		{
+			name:            "selectors",
+			args:            []string{"--selector=/r/i", "--selector=/r/i/t", "--xpath=//t", "records.xml"},
+			expectedRecords: map[string]string{"/r/i": "2", "/r/i/t": "3", "xpath://t": "3"},
+		},
+		{
+			name:            "compressed",
+			args:            []string{"--selector=/r/i", "--runs=1", "records.xml.gz"},
+			expectedRecords: map[string]string{"/r/i": "2"},
+		},
+		{
+			name:        "no selector",
+			args:        []string{"records.xml"},
+			expectedErr: "at least one --selector or --xpath is required",
+		},
+		{
+			name:        "no runs",
+			args:        []string{"--selector=/r/i", "--runs=0", "records.xml"},
+			expectedErr: "--runs must be positive",
+		},
+		{
+			name:        "invalid selector",
+			args:        []string{"--selector=/r/i[", "records.xml"},
+			expectedErr: `xmlpicker: unterminated [ in "/r/i["`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			stdout, _, err := runCommand(dir, &benchSelectorCmd{}, test.args...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+			if !assert.Len(t, lines, len(test.expectedRecords)+1, name) {
+				return
+			}
+			assert.Equal(t, []string{"selector", "records", "MB/s", "records/s", "allocs/record", "bytes/record"}, strings.Fields(lines[0]), name)
+			records := make(map[string]string)
+			for _, line := range lines[1:] {
+				fields := strings.Fields(line)
+				if assert.Len(t, fields, 6, name) {
+					records[fields[0]] = fields[1]
+				}
+			}
+			assert.Equal(t, test.expectedRecords, records, name)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// changedProcessor passes on the records that changed since the run that wrote the --changed-only file, followed by
+// tombstones for the records that disappeared, and updates the file once the run completes.
+type changedProcessor struct {
+	next     processor
+	detector *xmlpicker.ChangeDetector
+	filename string
+	o        *options
+}
+
+func (o *options) wrapChanged(proc processor) (processor, error) {
+	if o.ChangedOnly == "" {
+		if o.ChangedKey != "" {
+			return nil, fmt.Errorf("--changed-key requires --changed-only")
+		}
+		return proc, nil
+	}
+	if o.ChangedKey == "" {
+		return nil, fmt.Errorf("--changed-only requires --changed-key")
+	}
+	// any record that is not seen would be reported as removed
+	if o.Head != 0 || o.Tail != 0 || o.First || o.Sample != 0 || o.SampleN != 0 || o.Resume {
+		return nil, fmt.Errorf("--changed-only cannot be combined with --head, --tail, --first, --sample, --sample-n or --resume")
+	}
+	key, err := xmlpicker.ParseKeyPath(o.ChangedKey)
+	if err != nil {
+		return nil, err
+	}
+	f, err := o.newFingerprinter()
+	if err != nil {
+		return nil, err
+	}
+	p := &changedProcessor{
+		next:     proc,
+		detector: &xmlpicker.ChangeDetector{Key: key, Fingerprinter: f},
+		filename: o.ChangedOnly,
+		o:        o,
+	}
+	b, err := ioutil.ReadFile(p.filename)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &p.detector.Previous); err != nil {
+		return nil, fmt.Errorf("invalid --changed-only file %s: %s", p.filename, err)
+	}
+	return p, nil
+}
+
+func (p *changedProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *changedProcessor) Process(node *xmlpicker.Node) error {
+	changed, err := p.detector.Changed(node)
+	if err != nil {
+		return &xmlpicker.RecordError{Stage: "key", Err: err}
+	}
+	if !changed {
+		return nil
+	}
+	return p.next.Process(node)
+}
+
+func (p *changedProcessor) Finish() error {
+	// an interrupted run has not seen every record, nothing can be said about those that are missing
+	interrupted := atomic.LoadInt32(&p.o.interrupted) != 0
+	if !interrupted {
+		for _, n := range p.detector.Removed() {
+			if err := p.next.Process(n); err != nil {
+				return err
+			}
+		}
+	}
+	if err := p.next.Finish(); err != nil {
+		return err
+	}
+	if interrupted {
+		return nil
+	}
+	return p.save()
+}
+
+// save replaces the file with the fingerprints of this run.
+func (p *changedProcessor) save() error {
+	b, err := json.MarshalIndent(p.detector.Current, "", "    ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p.filename), filepath.Base(p.filename))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p.filename)
+}
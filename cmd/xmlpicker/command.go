@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// commandReader streams the output of a command that reads its input on stdin, such as a decryption or
+// decompression command.
+type commandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	err    error
+	done   bool
+}
+
+func startCommand(r io.Reader, name string, args ...string) (*commandReader, error) {
+	c := &commandReader{cmd: exec.Command(name, args...)}
+	c.cmd.Stdin = r
+	c.cmd.Stderr = &c.stderr
+	var err error
+	if c.stdout, err = c.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("running %s: %s", name, err)
+	}
+	return c, nil
+}
+
+func (c *commandReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, c.err
+	}
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		// only report the end of the input once the command has confirmed that all of it was processed
+		c.wait()
+		return n, c.err
+	}
+	return n, err
+}
+
+func (c *commandReader) wait() {
+	c.done = true
+	c.err = io.EOF
+	if err := c.cmd.Wait(); err != nil {
+		msg := strings.TrimSpace(c.stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		c.err = fmt.Errorf("running %s: %s", c.cmd.Args[0], msg)
+	}
+}
+
+// Close stops the command if the output was not read to the end, it is safe to call more than once.
+func (c *commandReader) Close() error {
+	if c.done {
+		return nil
+	}
+	c.cmd.Process.Kill()
+	c.wait()
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configOption is an option of a command as far as needed to tell flags and their values from positional arguments.
+type configOption struct {
+	long    string
+	isBool  bool
+	isSlice bool
+}
+
+// applyConfig expands --config FILE into the command, flags and inputs the YAML file describes. Its keys are the long
+// names of flags, along with command and inputs. Flags given on the command line take precedence over those of the
+// file and inputs given on the command line replace those of the file.
+func applyConfig(args []string) ([]string, error) {
+	filename, args, ok := extractConfigFlag(args)
+	if !ok {
+		return args, nil
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid --config %s: %s", filename, err)
+	}
+	commands := commandTypes()
+	var command string
+	if len(args) != 0 && commands[args[0]] != nil {
+		command, args = args[0], args[1:]
+	} else if s, ok := config["command"].(string); ok && commands[s] != nil {
+		command = s
+	} else if _, ok := config["jobs"]; ok {
+		command = "pipeline"
+	} else {
+		return nil, fmt.Errorf("invalid --config %s: a command is required", filename)
+	}
+	long, short := commandOptions(commands[command])
+	set, positional := scanArgs(args, long, short)
+	flags, err := configFlags(config, command, long, set, "command", "inputs", "jobs")
+	if err != nil {
+		return nil, fmt.Errorf("invalid --config %s: %s", filename, err)
+	}
+	expanded := append([]string{command}, flags...)
+	if command == "pipeline" {
+		// the pipeline reads its jobs from the file
+		expanded = append(expanded, "--config="+filename)
+	}
+	expanded = append(expanded, args...)
+	if !positional {
+		inputs, _ := config["inputs"].([]interface{})
+		for _, v := range inputs {
+			expanded = append(expanded, fmt.Sprint(v))
+		}
+	}
+	return expanded, nil
+}
+
+// configFlags returns the flags of a command given by the keys of config that are not already set, apart from the
+// keys to skip.
+func configFlags(config map[string]interface{}, command string, long map[string]*configOption, set map[string]bool, skip ...string) ([]string, error) {
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		if !containsString(skip, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var flags []string
+	for _, k := range keys {
+		o, ok := long[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown option %q for %s", k, command)
+		}
+		if set[k] {
+			continue
+		}
+		values, ok := config[k].([]interface{})
+		if !ok {
+			values = []interface{}{config[k]}
+		} else if !o.isSlice {
+			return nil, fmt.Errorf("%s takes a single value", k)
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case bool:
+				if !o.isBool {
+					return nil, fmt.Errorf("%s is not a boolean option", k)
+				}
+				if v {
+					flags = append(flags, "--"+k)
+				}
+			case map[string]interface{}, []interface{}, nil:
+				return nil, fmt.Errorf("invalid value for %s", k)
+			default:
+				if o.isBool {
+					return nil, fmt.Errorf("%s is a boolean option", k)
+				}
+				flags = append(flags, "--"+k+"="+fmt.Sprint(v))
+			}
+		}
+	}
+	return flags, nil
+}
+
+// extractConfigFlag removes --config FILE from the arguments.
+func extractConfigFlag(args []string) (string, []string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--config=") {
+			return arg[len("--config="):], append(args[:i:i], args[i+1:]...), true
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1], append(args[:i:i], args[i+2:]...), true
+		}
+	}
+	return "", args, false
+}
+
+// commandTypes returns the struct of each command by its name.
+func commandTypes() map[string]reflect.Type {
+	commands := make(map[string]reflect.Type)
+	t := reflect.TypeOf(cmds{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("command"); name != "" {
+			commands[name] = t.Field(i).Type
+		}
+	}
+	return commands
+}
+
+// commandOptions returns the options of a command by their long and short names, including those of nested structs
+// such as options.
+func commandOptions(t reflect.Type) (map[string]*configOption, map[string]*configOption) {
+	long := make(map[string]*configOption)
+	short := make(map[string]*configOption)
+	var scan func(t reflect.Type)
+	scan = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Tag.Get("positional-args") != "" {
+				continue
+			}
+			if f.Type.Kind() == reflect.Struct && f.Tag.Get("long") == "" {
+				scan(f.Type)
+				continue
+			}
+			o := &configOption{long: f.Tag.Get("long"), isBool: f.Type.Kind() == reflect.Bool, isSlice: f.Type.Kind() == reflect.Slice}
+			if o.long != "" {
+				long[o.long] = o
+			}
+			if s := f.Tag.Get("short"); s != "" {
+				short[s] = o
+			}
+		}
+	}
+	scan(t)
+	return long, short
+}
+
+// scanArgs returns the long names of the options given in args and whether there are positional arguments.
+func scanArgs(args []string, long, short map[string]*configOption) (map[string]bool, bool) {
+	set := make(map[string]bool)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var o *configOption
+		inline := false
+		switch {
+		case arg == "--":
+			return set, i+1 < len(args)
+		case strings.HasPrefix(arg, "--"):
+			name := arg[2:]
+			if j := strings.Index(name, "="); j != -1 {
+				name, inline = name[:j], true
+			}
+			o = long[name]
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			o = short[arg[1:2]]
+			inline = len(arg) > 2
+		default:
+			return set, true
+		}
+		if o == nil {
+			continue
+		}
+		if o.long != "" {
+			set[o.long] = true
+		}
+		if !o.isBool && !inline {
+			// the value
+			i++
+		}
+	}
+	return set, false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
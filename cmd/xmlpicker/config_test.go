@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	for idx, test := range []struct {
+		name           string
+		config         string
+		args           []string
+		expectedArgs   []string
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:           "command, flags and inputs",
+			config:         "command: json\nselector: /r/i\nhead: 2\ninputs: [a.xml, b.xml]\n",
+			expectedArgs:   []string{"json", "--head=2", "--selector=/r/i", "a.xml", "b.xml"},
+			expectedOutput: jsonRecord("1") + jsonRecord("2"),
+		},
+		{
+			name:           "command line flags take precedence",
+			config:         "command: json\nselector: /r/x\nhead: 2\ninputs: [a.xml, b.xml]\n",
+			args:           []string{"-s", "/r/i", "--head", "1"},
+			expectedArgs:   []string{"json", "-s", "/r/i", "--head", "1", "a.xml", "b.xml"},
+			expectedOutput: jsonRecord("1"),
+		},
+		{
+			name:           "command line inputs replace those of the file",
+			config:         "command: json\nselector: /r/i\ninputs: [a.xml]\n",
+			args:           []string{"b.xml"},
+			expectedArgs:   []string{"json", "--selector=/r/i", "b.xml"},
+			expectedOutput: jsonRecord("3"),
+		},
+		{
+			name:           "command line command",
+			config:         "command: xml\nselector: /r/i\nlenient: true\nstrict: false\ninputs: [b.xml]\n",
+			args:           []string{"json"},
+			expectedArgs:   []string{"json", "--lenient", "--selector=/r/i", "b.xml"},
+			expectedOutput: jsonRecord("3"),
+		},
+		{
+			name:           "repeated flag",
+			config:         "command: json\nselector: /r/i\ntar-entry: ['*.xml', '*.txt']\ninputs: [a.xml]\n",
+			expectedArgs:   []string{"json", "--selector=/r/i", "--tar-entry=*.xml", "--tar-entry=*.txt", "a.xml"},
+			expectedOutput: jsonRecord("1") + jsonRecord("2"),
+		},
+		{
+			name:        "no command",
+			config:      "selector: /r/i\n",
+			expectedErr: "invalid --config config.yaml: a command is required",
+		},
+		{
+			name:        "unknown option",
+			config:      "command: json\nselectr: /r/i\n",
+			expectedErr: `invalid --config config.yaml: unknown option "selectr" for json`,
+		},
+		{
+			name:        "list for a single value",
+			config:      "command: json\nselector: [/r/i, /r/j]\n",
+			expectedErr: "invalid --config config.yaml: selector takes a single value",
+		},
+		{
+			name:        "boolean for a value",
+			config:      "command: json\nselector: true\n",
+			expectedErr: "invalid --config config.yaml: selector is not a boolean option",
+		},
+		{
+			name:        "value for a boolean",
+			config:      "command: json\nlenient: 1\n",
+			expectedErr: "invalid --config config.yaml: lenient is a boolean option",
+		},
+		{
+			name:        "map value",
+			config:      "command: json\nselector: {a: b}\n",
+			expectedErr: "invalid --config config.yaml: invalid value for selector",
+		},
+		{
+			name:        "invalid yaml",
+			config:      "command: [json\n",
+			expectedErr: "invalid --config config.yaml: yaml: line 1: did not find expected ',' or ']'",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{
+				"config.yaml": test.config,
+				"a.xml":       `<r><i id="1"/><i id="2"/></r>`,
+				"b.xml":       `<r><i id="3"/></r>`,
+			})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			wd, err := os.Getwd()
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			if !assert.NoError(t, os.Chdir(dir), name) {
+				return
+			}
+			args, err := applyConfig(append([]string{"--config", "config.yaml"}, test.args...))
+			assert.NoError(t, os.Chdir(wd), name)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if !assert.NoError(t, err, name) || !assert.Equal(t, test.expectedArgs, args, name) {
+				return
+			}
+			stdout, _, err := runCaptured(dir, func() error {
+				_, err := flags.NewParser(&cmds{}, flags.None).ParseArgs(args)
+				return err
+			})
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expectedOutput, stdout, name)
+			}
+		})
+	}
+	t.Run("missing file", func(t *testing.T) {
+		_, err := applyConfig([]string{"json", "--config=" + filepath.Join(os.TempDir(), "missing.yaml")})
+		assert.Error(t, err)
+	})
+	t.Run("no --config", func(t *testing.T) {
+		args, err := applyConfig([]string{"json", "-s", "/r/i", "--", "--config"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"json", "-s", "/r/i", "--", "--config"}, args)
+		}
+	})
+}
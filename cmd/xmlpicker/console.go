@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// outputWriter applies --crlf and --console-encoding to w, a writer of records.
+func (o *options) outputWriter(w io.Writer) io.Writer {
+	if w == os.Stdout {
+		encoding := o.ConsoleEncoding
+		if encoding == "auto" {
+			encoding = "utf-8"
+			if consoleCodePage(os.Stdout) == 1252 {
+				encoding = "windows-1252"
+			}
+		}
+		if encoding == "windows-1252" {
+			w = &cp1252Writer{writer: w}
+		}
+	}
+	if o.CRLF {
+		w = &crlfWriter{writer: w}
+	}
+	return w
+}
+
+// crlfWriter writes line feeds as carriage return and line feed pairs.
+type crlfWriter struct {
+	writer io.Writer
+	// cr is set when the last byte written was a carriage return
+	cr  bool
+	buf bytes.Buffer
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	w.buf.Reset()
+	for _, c := range p {
+		if c == '\n' && !w.cr {
+			w.buf.WriteByte('\r')
+		}
+		w.buf.WriteByte(c)
+		w.cr = c == '\r'
+	}
+	if _, err := w.writer.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// cp1252Writer encodes UTF-8 as Windows-1252, the code page of western Windows consoles, characters it does not have
+// are written as ?.
+type cp1252Writer struct {
+	writer io.Writer
+	// partial holds the start of a character split across writes
+	partial []byte
+	buf     bytes.Buffer
+}
+
+var cp1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a,
+	'‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+func (w *cp1252Writer) Write(p []byte) (int, error) {
+	s := append(w.partial, p...)
+	w.partial = nil
+	w.buf.Reset()
+	for len(s) != 0 {
+		if !utf8.FullRune(s) {
+			w.partial = append([]byte(nil), s...)
+			break
+		}
+		r, size := utf8.DecodeRune(s)
+		s = s[size:]
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			w.buf.WriteByte(byte(r))
+		case cp1252[r] != 0:
+			w.buf.WriteByte(cp1252[r])
+		default:
+			w.buf.WriteByte('?')
+		}
+	}
+	if _, err := w.writer.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// consoleCodePage returns 0 as only Windows consoles have code pages.
+func consoleCodePage(f *os.File) uint32 {
+	return 0
+}
+
+// longPath returns filename, paths are only limited in length on Windows.
+func longPath(filename string) string {
+	return filename
+}
+
+// shellCommand returns the command that runs command with sh.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
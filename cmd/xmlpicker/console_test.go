@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputWriters(t *testing.T) {
+	for idx, test := range []struct {
+		name     string
+		crlf     bool
+		cp1252   bool
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "crlf",
+			crlf:     true,
+			writes:   []string{"a\nb\r\n", "\nc\r", "\n"},
+			expected: "a\r\nb\r\n\r\nc\r\n",
+		},
+		{
+			name:     "cp1252",
+			cp1252:   true,
+			writes:   []string{"café €5 “ok” 世"},
+			expected: "caf\xe9 \x805 \x93ok\x94 ?",
+		},
+		{
+			name:     "cp1252 split character",
+			cp1252:   true,
+			writes:   []string{"\xe2\x82", "\xac\n"},
+			expected: "\x80\n",
+		},
+		{
+			name:     "both",
+			crlf:     true,
+			cp1252:   true,
+			writes:   []string{"é\n"},
+			expected: "\xe9\r\n",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			var w io.Writer = &b
+			if test.cp1252 {
+				w = &cp1252Writer{writer: w}
+			}
+			if test.crlf {
+				w = &crlfWriter{writer: w}
+			}
+			for _, s := range test.writes {
+				n, err := w.Write([]byte(s))
+				assert.NoError(t, err, name)
+				assert.Equal(t, len(s), n, name)
+			}
+			assert.Equal(t, test.expected, b.String(), name)
+		})
+	}
+}
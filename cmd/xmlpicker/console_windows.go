@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var getConsoleOutputCP = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleOutputCP")
+
+// consoleCodePage returns the output code page of the console f writes to, or 0 when f is not a console.
+func consoleCodePage(f *os.File) uint32 {
+	var mode uint32
+	if err := syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode); err != nil {
+		return 0
+	}
+	cp, _, _ := getConsoleOutputCP.Call()
+	return uint32(cp)
+}
+
+// longPath returns filename with the \\?\ prefix when it is too long for the Windows API otherwise, relative names are
+// made absolute first as the prefix disables their resolution.
+func longPath(filename string) string {
+	if len(filename) < 248 || strings.HasPrefix(filename, `\\`) || filename == "-" {
+		return filename
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filename
+	}
+	return `\\?\` + abs
+}
+
+// shellCommand returns the command that runs command with cmd, or the %ComSpec% interpreter, as cmd /S /C "command".
+// The command line is passed as is since cmd does not follow the quoting rules of the other Windows programs.
+func shellCommand(command string) *exec.Cmd {
+	shell := os.Getenv("ComSpec")
+	if shell == "" {
+		shell = "cmd.exe"
+	}
+	cmd := exec.Command(shell)
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: syscall.EscapeArg(shell) + ` /S /C "` + command + `"`}
+	return cmd
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// containerTemplate is an attribute value or text of --container-xml or --summary-xml with placeholders, e.g.
+// generated="{{now}}".
+type containerTemplate struct {
+	flag  string
+	name  string
+	value *string
+	tmpl  *template.Template
+	// marker stands for the value while it is not known
+	marker string
+}
+
+// containerData is what the templates of --container-xml and --summary-xml are executed with.
+type containerData struct {
+	// Files are the inputs given on the command line.
+	Files    []string
+	count    int
+	sum      hash.Hash
+	deferred bool
+}
+
+// RecordCount returns the number of records written to the container, using it in --container-xml defers the output
+// until all records have been written.
+func (d *containerData) RecordCount() int {
+	d.deferred = true
+	return d.count
+}
+
+// SHA256 returns the hex encoded SHA-256 digest of the records as written to the container, using it in
+// --container-xml defers the output until all records have been written.
+func (d *containerData) SHA256() string {
+	d.deferred = true
+	return hex.EncodeToString(d.sum.Sum(nil))
+}
+
+// templateFuncs are the functions of the templates, now is the time {{now}} stands for.
+func templateFuncs(now time.Time) template.FuncMap {
+	return template.FuncMap{
+		"now": func() string {
+			return now.UTC().Format(time.RFC3339)
+		},
+		"join": strings.Join,
+	}
+}
+
+// parseTemplates parses the attribute values, or the text, of node that have placeholders.
+func parseTemplates(templates []*containerTemplate, flag string, node *xmlpicker.Node, funcs template.FuncMap) ([]*containerTemplate, error) {
+	for i := range node.StartElement.Attr {
+		a := &node.StartElement.Attr[i]
+		if !strings.Contains(a.Value, "{{") {
+			continue
+		}
+		name := a.Name.Local
+		if _, ok := node.Text(); ok {
+			name = "text"
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Parse(a.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s %s: %s", flag, name, err)
+		}
+		templates = append(templates, &containerTemplate{
+			flag:   flag,
+			name:   name,
+			value:  &a.Value,
+			tmpl:   tmpl,
+			marker: fmt.Sprintf("xmlpicker-template-%d-%d", time.Now().UnixNano(), len(templates)),
+		})
+	}
+	return templates, nil
+}
+
+// parseSummaryTemplates parses the attribute values and text of node and its descendants that have placeholders.
+func parseSummaryTemplates(templates []*containerTemplate, node *xmlpicker.Node, funcs template.FuncMap) ([]*containerTemplate, error) {
+	templates, err := parseTemplates(templates, "summary-xml", node, funcs)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range node.Children {
+		if templates, err = parseSummaryTemplates(templates, c, funcs); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// setUpTemplates parses the templates of the container and the summary and has the encoder write through a
+// switchWriter when there are some.
+func (p *xmlProcessor) setUpTemplates(w io.Writer, files []string) error {
+	funcs := templateFuncs(time.Now())
+	var err error
+	for n := p.containerNode; n != nil; n = n.Parent {
+		if p.templates, err = parseTemplates(p.templates, "container-xml", n, funcs); err != nil {
+			return err
+		}
+	}
+	if p.summaryNode != nil {
+		if p.summaryTemplates, err = parseSummaryTemplates(nil, p.summaryNode, funcs); err != nil {
+			return err
+		}
+	}
+	if len(p.templates) == 0 && p.summaryNode == nil {
+		return nil
+	}
+	p.data = containerData{Files: files, sum: sha256.New()}
+	p.switcher = &switchWriter{w: w}
+	p.exporter = xmlpicker.NewXMLExporter(p.switcher)
+	return nil
+}
+
+// executeTemplates sets the values of templates and reports whether one of them needs the records to be written
+// first.
+func (p *xmlProcessor) executeTemplates(templates []*containerTemplate) (bool, error) {
+	p.data.deferred = false
+	for _, t := range templates {
+		var b bytes.Buffer
+		if err := t.tmpl.Execute(&b, &p.data); err != nil {
+			return false, fmt.Errorf("invalid --%s %s: %s", t.flag, t.name, err)
+		}
+		*t.value = b.String()
+	}
+	return p.data.deferred, nil
+}
+
+// beginContainer writes the start of the container. When its templates need the records to be written first it is
+// kept in p.head, with markers for the values, and the records are written to a temporary file until they are known.
+func (p *xmlProcessor) beginContainer() error {
+	deferred, err := p.executeTemplates(p.templates)
+	if err != nil {
+		return err
+	}
+	if deferred {
+		for _, t := range p.templates {
+			*t.value = t.marker
+		}
+		p.switcher.w = &p.head
+	}
+	if err := p.exporter.StartPath(p.containerNode); err != nil {
+		return err
+	}
+	if err := p.exporter.Encoder.Flush(); err != nil {
+		return err
+	}
+	if deferred {
+		if p.deferred, err = ioutil.TempFile("", "xmlpicker-container"); err != nil {
+			return err
+		}
+		p.switcher.w = p.deferred
+	}
+	p.switcher.sum = p.data.sum
+	return nil
+}
+
+// finishContainer writes the summary and the end of the container, as well as its start and the records when they
+// were held back.
+func (p *xmlProcessor) finishContainer() error {
+	if err := p.exporter.Encoder.Flush(); err != nil {
+		return err
+	}
+	p.switcher.sum = nil
+	if p.summaryNode != nil {
+		if _, err := p.executeTemplates(p.summaryTemplates); err != nil {
+			return err
+		}
+		p.summaryNode.Parent = p.containerNode
+		if err := p.exporter.EncodeNode(p.summaryNode); err != nil {
+			return err
+		}
+	}
+	if p.deferred != nil {
+		if err := p.writeDeferred(); err != nil {
+			return err
+		}
+	}
+	if err := p.exporter.EndPath(p.containerNode); err != nil {
+		return err
+	}
+	return p.exporter.Encoder.Flush()
+}
+
+// writeDeferred writes the start of the container with the values of its templates followed by the records.
+func (p *xmlProcessor) writeDeferred() error {
+	defer func() {
+		p.deferred.Close()
+		os.Remove(p.deferred.Name())
+	}()
+	if err := p.exporter.Encoder.Flush(); err != nil {
+		return err
+	}
+	if _, err := p.executeTemplates(p.templates); err != nil {
+		return err
+	}
+	head := p.head.String()
+	for _, t := range p.templates {
+		var b bytes.Buffer
+		if err := xml.EscapeText(&b, []byte(*t.value)); err != nil {
+			return err
+		}
+		head = strings.Replace(head, t.marker, b.String(), -1)
+	}
+	p.switcher.w = p.writer
+	if _, err := io.WriteString(p.writer, head); err != nil {
+		return err
+	}
+	if _, err := p.deferred.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(p.writer, p.deferred)
+	return err
+}
+
+// switchWriter lets the encoder of the container write to the temporary file of the records and back, sum receives
+// what is written for the records.
+type switchWriter struct {
+	w   io.Writer
+	sum hash.Hash
+}
+
+func (s *switchWriter) Write(b []byte) (int, error) {
+	if s.sum != nil {
+		s.sum.Write(b)
+	}
+	return s.w.Write(b)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// timestamps matches what {{now}} stands for.
+var timestamps = regexp.MustCompile(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ`)
+
+func TestContainerTemplates(t *testing.T) {
+	const records = `<i id="1"></i><i id="2"></i><i id="3"></i>`
+	for idx, test := range []struct {
+		name        string
+		args        []string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "record count",
+			args:     []string{`--container-xml=<c n="{{.RecordCount}}"/>`},
+			expected: `<c n="3">` + records + `</c>`,
+		},
+		{
+			name:     "record count of what was written",
+			args:     []string{`--container-xml=<c n="{{.RecordCount}}"/>`, "--head=1"},
+			expected: `<c n="1"><i id="1"></i></c>`,
+		},
+		{
+			name:     "digest",
+			args:     []string{`--container-xml=<c sum="{{.SHA256}}"/>`},
+			expected: fmt.Sprintf(`<c sum="%x">`, sha256.Sum256([]byte(records))) + records + `</c>`,
+		},
+		{
+			name:     "now and files",
+			args:     []string{`--container-xml=<c at="{{now}}" f="{{join .Files &quot; &amp; &quot;}}"/>`},
+			expected: `<c at="NOW" f="a.xml &amp; b.xml">` + records + `</c>`,
+		},
+		{
+			name:     "ancestor of the container",
+			args:     []string{`--container-xml=<c n="{{.RecordCount}}"><d at="{{now}}"/></c>`, "--container-selector=/c/d"},
+			expected: `<c n="3"><d at="NOW">` + records + `</d></c>`,
+		},
+		{
+			name:     "no placeholders",
+			args:     []string{`--container-xml=<c n="{x}"/>`},
+			expected: `<c n="{x}">` + records + `</c>`,
+		},
+		{
+			name:        "unknown field",
+			args:        []string{`--container-xml=<c n="{{.Count}}"/>`},
+			expectedErr: `invalid --container-xml n: template: n:1:2: executing "n" at <.Count>: can't evaluate field Count in type *main.containerData`,
+		},
+		{
+			name:        "unclosed action",
+			args:        []string{`--container-xml=<c n="{{"/>`},
+			expectedErr: "invalid --container-xml n: template: n:1: unclosed action",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"a.xml": `<r><i id="1"/><i id="2"/></r>`, "b.xml": `<r><i id="3"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			args := append([]string{"--selector=/r/i"}, test.args...)
+			stdout, _, err := runCommand(dir, &xmlCmd{}, append(args, "a.xml", "b.xml")...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, timestamps.ReplaceAllString(stdout, "NOW"), name)
+			}
+		})
+	}
+}
+
+func TestSummaryXML(t *testing.T) {
+	const records = `<i id="1"></i><i id="2"></i><i id="3"></i>`
+	for idx, test := range []struct {
+		name        string
+		args        []string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name: "placeholders",
+			args: []string{`--container-xml=<c/>`, `--summary-xml=<s n="{{.RecordCount}}"><f>{{join .Files " "}}</f><d>{{.SHA256}}</d></s>`},
+			expected: `<c>` + records +
+				fmt.Sprintf(`<s n="3"><f>a.xml b.xml</f><d>%x</d></s></c>`, sha256.Sum256([]byte(records))),
+		},
+		{
+			name:     "with container placeholders",
+			args:     []string{`--container-xml=<c n="{{.RecordCount}}"/>`, `--summary-xml=<s at="{{now}}">plain</s>`, "--head=2"},
+			expected: `<c n="2"><i id="1"></i><i id="2"></i><s at="NOW">plain</s></c>`,
+		},
+		{
+			name:        "no container",
+			args:        []string{`--summary-xml=<s/>`},
+			expectedErr: "--summary-xml requires --container-xml",
+		},
+		{
+			name:        "malformed",
+			args:        []string{`--container-xml=<c/>`, `--summary-xml=<s`},
+			expectedErr: "invalid --summary-xml: XML syntax error on line 1: unexpected EOF",
+		},
+		{
+			name:        "unknown field",
+			args:        []string{`--container-xml=<c/>`, `--summary-xml=<s>{{.Count}}</s>`},
+			expectedErr: `invalid --summary-xml text: template: text:1:2: executing "text" at <.Count>: can't evaluate field Count in type *main.containerData`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"a.xml": `<r><i id="1"/><i id="2"/></r>`, "b.xml": `<r><i id="3"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			args := append([]string{"--selector=/r/i"}, test.args...)
+			stdout, _, err := runCommand(dir, &xmlCmd{}, append(args, "a.xml", "b.xml")...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, timestamps.ReplaceAllString(stdout, "NOW"), name)
+			}
+		})
+	}
+}
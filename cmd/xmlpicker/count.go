@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type countCmd struct {
+	Options options
+	KeyPath string `short:"k" long:"key-path" value-name:"KEY-PATH" description:"group the counts by this key of each record, either @attribute, #text or a relative path of child elements"`
+	Args    struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute writes a tab separated line with the count and filename of each file, followed by the key when grouping,
+// and then the totals.
+func (c *countCmd) Execute(_ []string) error {
+	total := &countProcessor{writer: os.Stdout, name: "total"}
+	if c.KeyPath != "" {
+		var err error
+		if total.keyPath, err = xmlpicker.ParseKeyPath(c.KeyPath); err != nil {
+			return err
+		}
+		total.groups = make(map[string]int)
+	}
+	// profiles cover all the files rather than just the first one
+	stopProfiling, err := c.Options.startProfiling()
+	if err != nil {
+		return err
+	}
+	defer stopProfiling()
+	for _, f := range c.Args.Filenames {
+		p := &countProcessor{writer: total.writer, name: f, keyPath: total.keyPath, total: total}
+		if p.keyPath != nil {
+			p.groups = make(map[string]int)
+		}
+		if err := mainImpl(&c.Options, []string{f}, p); err != nil {
+			return err
+		}
+	}
+	return total.Finish()
+}
+
+// countProcessor counts nodes without mapping them, and adds its counts to total when finished.
+type countProcessor struct {
+	writer  io.Writer
+	name    string
+	keyPath *xmlpicker.KeyPath
+	count   int
+	groups  map[string]int
+	total   *countProcessor
+}
+
+func (p *countProcessor) Begin() error {
+	return nil
+}
+
+func (p *countProcessor) Process(node *xmlpicker.Node) error {
+	p.count = p.count + 1
+	if p.keyPath != nil {
+		k, _ := p.keyPath.Key(node)
+		p.groups[k] = p.groups[k] + 1
+	}
+	return nil
+}
+
+func (p *countProcessor) Finish() error {
+	keys := make([]string, 0, len(p.groups))
+	for k := range p.groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(p.writer, "%d\t%s\t%s\n", p.groups[k], p.name, k); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(p.writer, "%d\t%s\n", p.count, p.name); err != nil {
+		return err
+	}
+	if p.total != nil {
+		p.total.count = p.total.count + p.count
+		for k, n := range p.groups {
+			p.total.groups[k] = p.total.groups[k] + n
+		}
+	}
+	return nil
+}
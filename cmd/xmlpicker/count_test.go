@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCount(t *testing.T) {
+	dir, ok := writeFiles(t, map[string]string{
+		"a.xml": `<r><i id="1" kind="x"/><i id="2" kind="y"/><i id="3" kind="x"/></r>`,
+		"b.xml": `<r><i id="4" kind="y"/><i id="5"/></r>`,
+		"c.xml": `<r/>`,
+	})
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedStdout string
+		expectedErr    string
+	}{
+		{
+			name:           "files",
+			args:           []string{"a.xml", "b.xml", "c.xml"},
+			expectedStdout: "3\ta.xml\n2\tb.xml\n0\tc.xml\n5\ttotal\n",
+		},
+		{
+			name: "grouped",
+			args: []string{"--key-path=@kind", "a.xml", "b.xml"},
+			expectedStdout: "2\ta.xml\tx\n1\ta.xml\ty\n3\ta.xml\n" +
+				"1\tb.xml\t\n1\tb.xml\ty\n2\tb.xml\n" +
+				"1\ttotal\t\n2\ttotal\tx\n2\ttotal\ty\n5\ttotal\n",
+		},
+		{
+			name:        "invalid key path",
+			args:        []string{"--key-path=@", "a.xml"},
+			expectedErr: `xmlpicker: invalid key path "@"`,
+		},
+		{
+			name:           "error",
+			args:           []string{"a.xml", "missing.xml"},
+			expectedStdout: "3\ta.xml\n",
+			expectedErr:    "missing.xml",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			stdout, _, err := runCommand(dir, &countCmd{}, append([]string{"--selector=/r/i"}, test.args...)...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+			} else {
+				assert.NoError(t, err, name)
+			}
+			assert.Equal(t, test.expectedStdout, stdout, name)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type coverageCmd struct {
+	Options   options
+	Selectors string `long:"selectors" value-name:"FILE" required:"yes" description:"file with a path selector, or an XPath prefixed by xpath:, per line, blank lines and lines starting with # are ignored"`
+	Top       int    `long:"top" value-name:"N" default:"10" description:"number of uncovered paths to report, 0 for all of them"`
+	Args      struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute parses the files once with all the selectors and writes, for each selector, the number of nodes it matched
+// and the fraction of the elements within them, followed by the paths with the most elements that no selector
+// covers.
+func (c *coverageCmd) Execute(_ []string) error {
+	names, selectors, err := c.readSelectors()
+	if err != nil {
+		return err
+	}
+	coverage := xmlpicker.NewCoverage(selectors...)
+	c.Options.selector = coverage
+	if err := mainImpl(&c.Options, c.Args.Filenames, &coverageProcessor{}); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "selector\tmatched\telements\tcoverage\t")
+	for i, name := range names {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t\n", name, coverage.Matched[i], coverage.Covered[i], 100*coverage.Fraction(i))
+	}
+	uncovered := 0
+	for _, n := range coverage.Uncovered {
+		uncovered += n
+	}
+	fmt.Fprintf(w, "uncovered\t\t%d\t%.1f%%\t\n", uncovered, 100*fraction(uncovered, coverage.Elements))
+	for _, p := range coverage.TopUncovered(c.Top) {
+		fmt.Fprintf(w, "  %s\t\t%d\t%.1f%%\t\n", p.Path, p.Count, 100*fraction(p.Count, coverage.Elements))
+	}
+	return w.Flush()
+}
+
+func fraction(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// readSelectors returns the selectors of the --selectors file and their names as written.
+func (c *coverageCmd) readSelectors() ([]string, []xmlpicker.Selector, error) {
+	f, err := os.Open(c.Selectors)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var names []string
+	var selectors []xmlpicker.Selector
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		o := options{Selector: line, ResolvePrefixes: c.Options.ResolvePrefixes}
+		if strings.HasPrefix(line, "xpath:") {
+			o.XPath = strings.TrimSpace(strings.TrimPrefix(line, "xpath:"))
+		}
+		selector, err := o.NewSelector()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid selector %q in %s: %s", line, c.Selectors, err)
+		}
+		names = append(names, line)
+		selectors = append(selectors, selector)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(selectors) == 0 {
+		return nil, nil, fmt.Errorf("no selectors in %s", c.Selectors)
+	}
+	return names, selectors, nil
+}
+
+// coverageProcessor receives no nodes, the Coverage selector does the work.
+type coverageProcessor struct{}
+
+func (p *coverageProcessor) Begin() error {
+	return nil
+}
+
+func (p *coverageProcessor) Process(node *xmlpicker.Node) error {
+	return nil
+}
+
+func (p *coverageProcessor) Finish() error {
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"runtime"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+// decompression configures how inputs are decompressed.
+type decompression struct {
+	// bufferSize is the size of the buffer compressed inputs are read through
+	bufferSize int
+	// workers are the goroutines decompressing gzip and zstd inputs in process, 0 for the standard library gzip
+	// reader and the zstd command
+	workers int
+	// trailingGarbage ends gzip inputs at bytes after a member that do not start another one, which are reported with
+	// the name of the input
+	trailingGarbage bool
+	name            string
+}
+
+// decompression returns the decompression --read-buffer, --parallel-decompress, --decompress-workers and
+// --trailing-garbage describe.
+func (o *options) decompression() decompression {
+	d := decompression{bufferSize: o.readBuffer}
+	if d.bufferSize == 0 {
+		d.bufferSize = defaultReadBuffer
+	}
+	d.trailingGarbage = o.TrailingGarbage
+	if o.ParallelDecompress {
+		d.workers = o.DecompressWorkers
+		if d.workers <= 0 {
+			d.workers = runtime.NumCPU()
+		}
+	}
+	return d
+}
+
+// newGzipReader reads all the members of a gzip stream, as the gzip readers do by default, so that concatenated files
+// as written by "cat *.xml.gz" are read in full. With trailingGarbage the members are read one at a time instead.
+func (d decompression) newGzipReader(r *bufio.Reader) (io.ReadCloser, error) {
+	if !d.trailingGarbage {
+		return d.newGzipMember(r, true)
+	}
+	gz, err := d.newGzipMember(r, false)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipMembers{d: d, r: r, gz: gz}, nil
+}
+
+// newGzipMember reads a gzip stream, or its first member without multistream.
+func (d decompression) newGzipMember(r *bufio.Reader, multistream bool) (io.ReadCloser, error) {
+	if d.workers > 0 {
+		// gzip streams cannot be inflated in parallel, pgzip reads ahead a block per worker instead, and at least two
+		// as it reports invalid checksums with a single block
+		blocks := d.workers
+		if blocks < 2 {
+			blocks = 2
+		}
+		gz, err := pgzip.NewReaderN(r, d.bufferSize, blocks)
+		if err != nil {
+			return nil, err
+		}
+		if !multistream {
+			gz.Multistream(false)
+		}
+		return gz, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if !multistream {
+		gz.Multistream(false)
+	}
+	return gz, nil
+}
+
+// gzipMembers reads the members of a gzip stream one after the other, so that bytes after a member that do not start
+// another one end the stream and are reported, rather than being read as a corrupt member.
+type gzipMembers struct {
+	d  decompression
+	r  *bufio.Reader
+	gz io.ReadCloser
+	// ended is set at the end of the stream, pgzip blocks when read again after the end of a member
+	ended bool
+}
+
+func (m *gzipMembers) Read(p []byte) (int, error) {
+	if m.ended {
+		return 0, io.EOF
+	}
+	for {
+		n, err := m.gz.Read(p)
+		if err != io.EOF || n != 0 {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		h, _ := m.r.Peek(2)
+		if len(h) == 0 {
+			m.ended = true
+			return 0, io.EOF
+		}
+		if len(h) < 2 || h[0] != 0x1f || h[1] != 0x8b {
+			m.ended = true
+			skipped, _ := io.Copy(ioutil.Discard, m.r)
+			warnf("ignored %d bytes of trailing garbage after the last gzip member of %s", skipped, m.d.name)
+			return 0, io.EOF
+		}
+		// a new reader for each member, as pgzip cannot be reset to the next one
+		if err := m.gz.Close(); err != nil {
+			return 0, err
+		}
+		if m.gz, err = m.d.newGzipMember(m.r, false); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (m *gzipMembers) Close() error {
+	return m.gz.Close()
+}
+
+// newZstdReader decompresses a zstd stream with the zstd command, or in process with d.workers goroutines.
+func (d decompression) newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	if d.workers == 0 {
+		return startCommand(r, "zstd", "--decompress", "--stdout", "--quiet")
+	}
+	z, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(d.workers), zstd.WithDecoderLowmem(false))
+	if err != nil {
+		return nil, err
+	}
+	return z.IOReadCloser(), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func concatGzip(docs ...string) []byte {
+	var b bytes.Buffer
+	for _, doc := range docs {
+		gz := gzip.NewWriter(&b)
+		gz.Write([]byte(doc))
+		gz.Close()
+	}
+	return b.Bytes()
+}
+
+func TestGzipMember(t *testing.T) {
+	for idx, workers := range []int{0, 2} {
+		t.Run(fmt.Sprintf("%d workers %d", idx, workers), func(t *testing.T) {
+			d := decompression{bufferSize: defaultReadBuffer, workers: workers}
+			r := bufio.NewReader(bytes.NewReader(concatGzip("<a/>", "<b/>")))
+			gz, err := d.newGzipMember(r, false)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer gz.Close()
+			actual, err := ioutil.ReadAll(gz)
+			assert.NoError(t, err)
+			assert.Equal(t, "<a/>", string(actual))
+		})
+	}
+}
+
+func TestStdinDocuments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlpicker")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	// as piped by cat one.xml.gz two.xml.gz
+	stdin := filepath.Join(dir, "stdin")
+	if !assert.NoError(t, ioutil.WriteFile(stdin, concatGzip("<a><b>x</b></a>", "<a><b>y</b></a>\n"), 0666)) {
+		return
+	}
+	for idx, args := range [][]string{
+		nil,
+		{"--stdin-format=xml.gz"},
+		{"--parallel-decompress"},
+		{"--trailing-garbage"},
+		{"--parallel-decompress", "--trailing-garbage"},
+	} {
+		name := fmt.Sprintf("%d %v", idx, args)
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(stdin)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer f.Close()
+			saved := os.Stdin
+			os.Stdin = f
+			defer func() { os.Stdin = saved }()
+			args := append([]string{"--selector=/a/b"}, args...)
+			stdout, _, err := runCommand(dir, &jsonCmd{}, append(args, "-")...)
+			assert.NoError(t, err, name)
+			assert.Equal(t, "{\"#text\":[\"x\"],\"_name\":\"b\",\"_namespaces\":{}}\n{\"#text\":[\"y\"],\"_name\":\"b\",\"_namespaces\":{}}\n", stdout, name)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	ageMagic        = []byte("age-encryption.org/v1\n")
+	ageArmorMagic   = []byte("-----BEGIN AGE ENCRYPTED FILE-----")
+	pgpArmorMagic   = []byte("-----BEGIN PGP MESSAGE-----")
+	encryptionPeekN = len(ageArmorMagic)
+)
+
+// detectEncryption returns "age" or "pgp" if the header of the input looks like an encrypted message, or "none".
+func detectEncryption(h []byte) string {
+	switch {
+	case bytes.HasPrefix(h, ageMagic), bytes.HasPrefix(h, ageArmorMagic):
+		return "age"
+	case bytes.HasPrefix(h, pgpArmorMagic):
+		return "pgp"
+	case isPGPSessionKeyPacket(h):
+		return "pgp"
+	}
+	return "none"
+}
+
+var (
+	// pgpPublicKeyAlgorithms are RSA, Elgamal and ECDH, pgpSymmetricAlgorithms IDEA, TripleDES, CAST5, Blowfish, AES,
+	// Twofish and Camellia.
+	pgpPublicKeyAlgorithms = map[byte]bool{1: true, 2: true, 16: true, 18: true}
+	pgpSymmetricAlgorithms = map[byte]bool{1: true, 2: true, 3: true, 4: true, 7: true, 8: true, 9: true, 10: true, 11: true, 12: true, 13: true}
+)
+
+// isPGPSessionKeyPacket reports whether h starts with a public key or symmetric key encrypted session key packet, with
+// which binary OpenPGP messages start. The whole packet header and the version and algorithms that follow it are
+// checked so that text in Latin-1 or another 8-bit encoding, whose first byte may look like a packet tag, is not taken
+// for an encrypted message.
+func isPGPSessionKeyPacket(h []byte) bool {
+	if len(h) < 2 || h[0]&0x80 == 0 {
+		return false
+	}
+	var tag byte
+	var n, length int
+	if h[0]&0x40 == 0 {
+		// old format, the low bits give the size of the length, an indeterminate length is not used for these packets
+		tag = (h[0] >> 2) & 0x0f
+		switch h[0] & 3 {
+		case 0:
+			n = 2
+		case 1:
+			n = 3
+		case 2:
+			n = 5
+		default:
+			return false
+		}
+		if len(h) < n {
+			return false
+		}
+		for _, b := range h[1:n] {
+			length = length<<8 | int(b)
+		}
+	} else {
+		// new format, partial lengths are not used for these packets
+		tag = h[0] & 0x3f
+		switch l := int(h[1]); {
+		case l < 192:
+			n, length = 2, l
+		case l < 224 && len(h) >= 3:
+			n, length = 3, (l-192)<<8+int(h[2])+192
+		case l == 255 && len(h) >= 6:
+			n, length = 6, int(h[2])<<24|int(h[3])<<16|int(h[4])<<8|int(h[5])
+		default:
+			return false
+		}
+	}
+	body := h[n:]
+	switch tag {
+	case 1:
+		// version 3, the 8 byte id of the key and its algorithm, then the encrypted session key
+		return length > 10 && length <= 4096 && len(body) >= 10 && body[0] == 3 && pgpPublicKeyAlgorithms[body[9]]
+	case 3:
+		// version 4, the cipher and the string-to-key specifier: simple, salted or iterated and salted
+		return length >= 4 && length <= 256 && len(body) >= 3 && body[0] == 4 && pgpSymmetricAlgorithms[body[1]] &&
+			(body[2] == 0 || body[2] == 1 || body[2] == 3)
+	}
+	return false
+}
+
+// Wraps the reader to decrypt it with the age or gpg command, as selected by --decrypt, the returned Reader should be
+// closed.
+func autoDecrypt(source io.Reader, o *options) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(source, o.readBuffer)
+	kind := o.Decrypt
+	if kind == "auto" {
+		h, err := br.Peek(encryptionPeekN)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		kind = detectEncryption(h)
+	}
+	switch kind {
+	case "age":
+		args := []string{"--decrypt"}
+		for _, identity := range o.AgeIdentity {
+			args = append(args, "--identity", identity)
+		}
+		return startCommand(br, "age", args...)
+	case "pgp":
+		args := []string{"--batch", "--quiet", "--decrypt"}
+		if o.PGPPassphraseFile != "" {
+			args = append(args, "--pinentry-mode", "loopback", "--passphrase-file", o.PGPPassphraseFile)
+		}
+		return startCommand(br, "gpg", args...)
+	}
+	return ioutil.NopCloser(br), nil
+}
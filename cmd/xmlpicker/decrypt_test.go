@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectEncryption(t *testing.T) {
+	for idx, test := range []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "age", header: "age-encryption.org/v1\n-> X25519 ", expected: "age"},
+		{name: "age armor", header: "-----BEGIN AGE ENCRYPTED FILE-----\n", expected: "age"},
+		{name: "pgp armor", header: "-----BEGIN PGP MESSAGE-----\n\nhQEMA", expected: "pgp"},
+		// as written by gpg --encrypt for an RSA key and by gpg --symmetric
+		{name: "public key session key", header: "\x85\x01\x0c\x03\xf8\xa6\x54\x46\xf0\x0b\x25\x11\x01\x08\x00\xb0", expected: "pgp"},
+		{name: "symmetric key session key", header: "\x8c\x0d\x04\x09\x03\x02\xbb\x42\x4d\x2d\x83\x46\x6d\x4c\xff\xd2", expected: "pgp"},
+		{name: "new format public key session key", header: "\xc1\xc0\x4c\x03\xf8\xa6\x54\x46\xf0\x0b\x25\x11\x12\x01", expected: "pgp"},
+		{name: "new format symmetric key session key", header: "\xc3\x0d\x04\x07\x03\x02\xbb\x42", expected: "pgp"},
+		{name: "xml", header: `<?xml version="1.0"?><r/>`, expected: "none"},
+		{name: "empty", header: "", expected: "none"},
+		{name: "latin-1 text", header: "\x84\xe9t\xe9 chaud", expected: "none"},
+		{name: "latin-1 symmetric key tag", header: "\x8c\x0d\x04 ann\xe9es", expected: "none"},
+		{name: "latin-1 new format tag", header: "\xc3\xa9t\xe9", expected: "none"},
+		{name: "latin-1 public key tag", header: "\x85\x01\x0ccafe cr\xe8me br\xfbl\xe9e", expected: "none"},
+		{name: "unknown public key algorithm", header: "\x85\x01\x0c\x03\xf8\xa6\x54\x46\xf0\x0b\x25\x11\x63\x08", expected: "none"},
+		{name: "unknown cipher", header: "\x8c\x0d\x04\x63\x03\x02", expected: "none"},
+		{name: "indeterminate length", header: "\x87\x03\xf8\xa6\x54\x46\xf0\x0b\x25\x11\x01", expected: "none"},
+		{name: "partial length", header: "\xc3\xe0\x04\x09\x03\x02", expected: "none"},
+		{name: "truncated", header: "\x85\x01", expected: "none"},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, detectEncryption([]byte(test.header)), name)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// newEnricher parses an --enrich given as KEY-PATH=FILE[,key=COLUMN][,prefix=PREFIX][,required] and loads its lookup
+// table.
+func newEnricher(spec string) (*xmlpicker.Enricher, error) {
+	i := strings.Index(spec, "=")
+	if i == -1 {
+		return nil, fmt.Errorf("invalid --enrich %q, expected KEY-PATH=FILE", spec)
+	}
+	key, err := xmlpicker.ParseKeyPath(spec[:i])
+	if err != nil {
+		return nil, err
+	}
+	e := &xmlpicker.Enricher{Key: key}
+	parts := strings.Split(spec[i+1:], ",")
+	filename, keyColumn := parts[0], ""
+	for _, p := range parts[1:] {
+		switch {
+		case strings.HasPrefix(p, "key="):
+			keyColumn = p[len("key="):]
+		case strings.HasPrefix(p, "prefix="):
+			e.Prefix = p[len("prefix="):]
+		case p == "required":
+			e.Required = true
+		default:
+			return nil, fmt.Errorf("invalid --enrich %q, unknown option %q", spec, p)
+		}
+	}
+	if filename == "" {
+		return nil, fmt.Errorf("invalid --enrich %q, expected KEY-PATH=FILE", spec)
+	}
+	if e.Table, err = xmlpicker.LoadLookupTable(filename, keyColumn); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
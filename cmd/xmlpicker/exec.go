@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// execProcessor runs --exec for each record rendered by next, up to workers at a time, and writes the records, or
+// what the command printed for them with --exec-capture, in their original order. Records whose command finished
+// before that of an earlier record are held back, once workers plus reorder records are running or held no command
+// starts until the earliest finishes. With --unordered the records are written as soon as their command finishes.
+//
+// Commands that load the records into another system can be limited to a rate with --exec-rate, workers limit how
+// many run at a time, and those that fail are retried with exponential backoff with --exec-retries.
+type execProcessor struct {
+	command   string
+	capture   bool
+	onError   string
+	workers   int
+	unordered bool
+	reorder   int
+	retries   int
+	backoff   time.Duration
+	limiter   *xmlpicker.RateLimitedProcessor
+
+	writer   io.Writer
+	next     processor
+	buf      bytes.Buffer
+	finished chan *execJob
+	running  int
+	// pending are the records not written yet in input order, running or held back, only used in order.
+	pending []*execJob
+
+	records    int
+	maxBacklog int
+	stalls     int
+	stalled    time.Duration
+}
+
+type execJob struct {
+	path     string
+	record   []byte
+	output   []byte
+	stderr   []byte
+	err      error
+	finished bool
+}
+
+// newExecProcessor returns the processor created by newProcessor, which has each record passed to --exec when it is
+// given.
+func (o *options) newExecProcessor(w io.Writer, newProcessor func(w io.Writer) (processor, error)) (processor, error) {
+	if o.Exec == "" {
+		return newProcessor(w)
+	}
+	if o.ExecWorkers < 1 {
+		return nil, fmt.Errorf("invalid --exec-workers %d, expected at least 1", o.ExecWorkers)
+	}
+	if o.ReorderBuffer < 0 {
+		return nil, fmt.Errorf("invalid --reorder-buffer %d, expected at least 0", o.ReorderBuffer)
+	}
+	if o.ExecRetries < 0 {
+		return nil, fmt.Errorf("invalid --exec-retries %d, expected at least 0", o.ExecRetries)
+	}
+	if o.ExecRate < 0 {
+		return nil, fmt.Errorf("invalid --exec-rate %g, expected a positive rate", o.ExecRate)
+	}
+	p := &execProcessor{
+		command:   o.Exec,
+		capture:   o.ExecCapture,
+		onError:   o.ExecOnError,
+		workers:   o.ExecWorkers,
+		unordered: o.Unordered,
+		reorder:   o.ReorderBuffer,
+		retries:   o.ExecRetries,
+		backoff:   o.ExecBackoff,
+		limiter:   &xmlpicker.RateLimitedProcessor{Rate: o.ExecRate},
+		writer:    w,
+		// at most workers commands run at a time, so that those that finish never wait to be received
+		finished: make(chan *execJob, o.ExecWorkers),
+	}
+	var err error
+	if p.next, err = newProcessor(&p.buf); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *execProcessor) Begin() error {
+	if err := p.next.Begin(); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+func (p *execProcessor) Process(node *xmlpicker.Node) error {
+	if err := p.next.Process(node); err != nil {
+		p.buf.Reset()
+		return err
+	}
+	job := &execJob{
+		path:   node.Path(),
+		record: append([]byte(nil), p.buf.Bytes()...),
+	}
+	p.buf.Reset()
+	// only wait for a command to finish once all the workers are busy or the reorder buffer is full
+	for p.running == p.workers || (!p.unordered && len(p.pending) >= p.workers+p.reorder) {
+		start := time.Now()
+		stalled := p.running < p.workers
+		if err := p.receive(); err != nil {
+			return err
+		}
+		if stalled {
+			p.stalls++
+			p.stalled += time.Since(start)
+		}
+	}
+	p.records++
+	p.running++
+	if !p.unordered {
+		p.pending = append(p.pending, job)
+	}
+	go func() {
+		p.start(job)
+		p.finished <- job
+	}()
+	for {
+		select {
+		case job := <-p.finished:
+			if err := p.done(job); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *execProcessor) Finish() error {
+	for p.running != 0 {
+		if err := p.receive(); err != nil {
+			return err
+		}
+	}
+	if !p.unordered && p.workers > 1 && p.records != 0 {
+		infof("exec: %d records, at most %d held back for order, stalled %d times for %s waiting on earlier records", p.records, p.maxBacklog, p.stalls, p.stalled)
+	}
+	if err := p.next.Finish(); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+// start runs the command of job once --exec-rate allows, again after a backoff while it fails and --exec-retries
+// allows.
+func (p *execProcessor) start(job *execJob) {
+	retrying := &xmlpicker.RetryingProcessor{
+		Next: xmlpicker.ProcessorFunc(func(*xmlpicker.Node) error {
+			p.limiter.Wait()
+			job.output, job.stderr, job.err = p.run(job.record)
+			return job.err
+		}),
+		Attempts:   p.retries + 1,
+		Backoff:    p.backoff,
+		MaxBackoff: time.Minute,
+		Retryable: func(err error) bool {
+			warnf("running %s for %s: %s, retrying", p.command, job.path, err)
+			return true
+		},
+	}
+	retrying.Process(nil)
+}
+
+// receive waits for a command to finish and writes the records that are ready.
+func (p *execProcessor) receive() error {
+	return p.done(<-p.finished)
+}
+
+// done writes the record of the finished job, in order it is held back until the earlier records are written.
+func (p *execProcessor) done(job *execJob) error {
+	p.running--
+	if p.unordered {
+		return p.write(job)
+	}
+	job.finished = true
+	for len(p.pending) != 0 && p.pending[0].finished {
+		job := p.pending[0]
+		p.pending = p.pending[1:]
+		if err := p.write(job); err != nil {
+			return err
+		}
+	}
+	if backlog := len(p.pending) - p.running; backlog > p.maxBacklog {
+		p.maxBacklog = backlog
+	}
+	return nil
+}
+
+// write writes the record of a finished job according to --exec-capture and --exec-on-error.
+func (p *execProcessor) write(job *execJob) error {
+	if job.err != nil {
+		switch p.onError {
+		case "skip":
+			warnf("running %s for %s: %s, skipping the record", p.command, job.path, job.err)
+			return nil
+		case "keep":
+			warnf("running %s for %s: %s, keeping the record", p.command, job.path, job.err)
+			_, err := p.writer.Write(job.record)
+			return err
+		}
+		return fmt.Errorf("running %s for %s: %s", p.command, job.path, job.err)
+	}
+	if len(job.stderr) != 0 {
+		os.Stderr.Write(job.stderr)
+	}
+	if p.capture {
+		_, err := p.writer.Write(job.output)
+		return err
+	}
+	if len(job.output) != 0 {
+		os.Stderr.Write(job.output)
+	}
+	_, err := p.writer.Write(job.record)
+	return err
+}
+
+// flush writes anything next wrote outside of a record.
+func (p *execProcessor) flush() error {
+	_, err := p.writer.Write(p.buf.Bytes())
+	p.buf.Reset()
+	return err
+}
+
+// run runs the command with the shell, record is passed in a temporary file in place of {} or otherwise on stdin. It
+// returns what the command wrote to stdout and to stderr, or its error made of what it wrote to stderr when it fails.
+func (p *execProcessor) run(record []byte) ([]byte, []byte, error) {
+	command := p.command
+	var stdin io.Reader = bytes.NewReader(record)
+	if strings.Contains(command, "{}") {
+		f, err := ioutil.TempFile("", "xmlpicker-record")
+		if err != nil {
+			return nil, nil, err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(record)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		command = strings.Replace(command, "{}", f.Name(), -1)
+		stdin = nil
+	}
+	cmd := shellCommand(command)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, nil, errors.New(msg)
+	}
+	return stdout.Bytes(), stderr.Bytes(), nil
+}
@@ -0,0 +1,295 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+)
+
+// execID sets id to the id of the record on stdin.
+const execID = `id=$(sed 's/.*"@id":"\([0-9]*\)".*/\1/'); `
+
+func TestExec(t *testing.T) {
+	for idx, test := range []struct {
+		name           string
+		command        flags.Commander
+		args           []string
+		expectedOutput string
+		expectedStderr string
+		expectedErr    string
+	}{
+		{
+			name:           "record on stdin",
+			args:           []string{"--exec=" + execID + "echo got $id"},
+			expectedOutput: jsonRecord("1") + jsonRecord("2"),
+			expectedStderr: "got 1\ngot 2\n",
+		},
+		{
+			name:           "captured",
+			args:           []string{"--exec=" + execID + "echo got $id", "--exec-capture"},
+			expectedOutput: "got 1\ngot 2\n",
+		},
+		{
+			name:           "stderr of a captured command",
+			args:           []string{"--exec=echo warning >&2; cat", "--exec-capture"},
+			expectedOutput: jsonRecord("1") + jsonRecord("2"),
+			expectedStderr: "warning\nwarning\n",
+		},
+		{
+			name:           "record in a file",
+			args:           []string{"--exec=cat - {} | sed 's/@id/@ID/'", "--exec-capture"},
+			expectedOutput: strings.Replace(jsonRecord("1")+jsonRecord("2"), "@id", "@ID", -1),
+		},
+		{
+			name:           "xml",
+			command:        &xmlCmd{},
+			args:           []string{"--exec=cat {}", "--exec-capture"},
+			expectedOutput: "<r><i id=\"1\"></i></r>\n<r><i id=\"2\"></i></r>\n",
+		},
+		{
+			name:        "xml with a container",
+			command:     &xmlCmd{},
+			args:        []string{"--exec=cat", "--container-xml=<c/>"},
+			expectedErr: "--exec cannot be combined with --container-xml",
+		},
+		{
+			name:        "no workers",
+			args:        []string{"--exec=cat", "--exec-workers=0"},
+			expectedErr: "invalid --exec-workers 0, expected at least 1",
+		},
+		{
+			name:        "negative rate",
+			args:        []string{"--exec=cat", "--exec-rate=-1"},
+			expectedErr: "invalid --exec-rate -1, expected a positive rate",
+		},
+		{
+			name:        "negative reorder buffer",
+			args:        []string{"--exec=cat", "--reorder-buffer=-1"},
+			expectedErr: "invalid --reorder-buffer -1, expected at least 0",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"records.xml": `<r><i id="1"/><i id="2"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			command := test.command
+			if command == nil {
+				command = &jsonCmd{}
+			}
+			args := append([]string{"--selector=/r/i"}, test.args...)
+			stdout, stderr, err := runCommand(dir, command, append(args, "records.xml")...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expectedOutput, stdout, name)
+				assert.Equal(t, test.expectedStderr, stderr, name)
+			}
+		})
+	}
+}
+
+func TestExecRetries(t *testing.T) {
+	// the command fails until it has run three times in the directory
+	const flaky = `--exec=n=$(cat runs 2>/dev/null || echo 0); echo $((n+1)) > runs; test $n -ge 2`
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedRuns   string
+		expectedStderr string
+		expectedErr    string
+	}{
+		{
+			name:           "retried",
+			args:           []string{"--exec-retries=2"},
+			expectedRuns:   "3",
+			expectedStderr: "retrying",
+		},
+		{
+			name:         "too few retries",
+			args:         []string{"--exec-retries=1"},
+			expectedRuns: "2",
+			expectedErr:  "running " + flaky[len("--exec="):] + " for /r/i: exit status 1",
+		},
+		{
+			name:         "no retries",
+			expectedRuns: "1",
+			expectedErr:  "exit status 1",
+		},
+		{
+			name:        "invalid",
+			args:        []string{"--exec-retries=-1"},
+			expectedErr: "invalid --exec-retries -1, expected at least 0",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "xmlpicker")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer os.RemoveAll(dir)
+			if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "records.xml"), []byte(`<r><i id="1"/></r>`), 0666)) {
+				return
+			}
+			args := append([]string{"--selector=/r/i", flaky, "--exec-retry-backoff=1ms"}, test.args...)
+			stdout, stderr, err := runCommand(dir, &jsonCmd{}, append(args, "records.xml")...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+			} else if assert.NoError(t, err, name) {
+				assert.Equal(t, "{\"@id\":\"1\",\"_name\":\"i\",\"_namespaces\":{}}\n", stdout, name)
+			}
+			assert.Contains(t, stderr, test.expectedStderr, name)
+			runs, _ := ioutil.ReadFile(filepath.Join(dir, "runs"))
+			assert.Equal(t, test.expectedRuns, strings.TrimSpace(string(runs)), name)
+		})
+	}
+}
+
+func TestExecRate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlpicker")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "records.xml"), []byte(`<r><i/><i/><i/></r>`), 0666)) {
+		return
+	}
+	start := time.Now()
+	_, _, err = runCommand(dir, &jsonCmd{}, "--selector=/r/i", "--exec=true", "--exec-workers=3", "--exec-rate=20", "records.xml")
+	assert.NoError(t, err)
+	// the second and third commands wait for a slot 50ms after the one before
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "took %s", time.Since(start))
+}
+
+func TestExecOrder(t *testing.T) {
+	// the later the record the sooner its command finishes
+	const reversed = "--exec=" + execID + "sleep 0.$((6-id)); echo $id"
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name:           "ordered",
+			args:           []string{reversed, "--exec-workers=5"},
+			expectedStdout: "1\n2\n3\n4\n5\n",
+			expectedStderr: "exec: 5 records, at most 4 held back for order, stalled 0 times",
+		},
+		{
+			name:           "unordered",
+			args:           []string{reversed, "--exec-workers=5", "--unordered"},
+			expectedStdout: "5\n4\n3\n2\n1\n",
+		},
+		{
+			name:           "single worker",
+			args:           []string{reversed},
+			expectedStdout: "1\n2\n3\n4\n5\n",
+		},
+		{
+			name: "full reorder buffer",
+			// the first record holds back those after it, the third does not start until it is written
+			args:           []string{"--exec=" + execID + `test $id = 1 && sleep 0.3; echo $id`, "--exec-workers=2", "--reorder-buffer=0"},
+			expectedStdout: "1\n2\n3\n4\n5\n",
+			expectedStderr: "exec: 5 records, at most 1 held back for order, stalled",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"records.xml": `<r><i id="1"/><i id="2"/><i id="3"/><i id="4"/><i id="5"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			args := append([]string{"--selector=/r/i", "--exec-capture"}, test.args...)
+			stdout, stderr, err := runCommand(dir, &jsonCmd{}, append(args, "records.xml")...)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expectedStdout, stdout, name)
+				assert.Contains(t, stderr, test.expectedStderr, name)
+			}
+		})
+	}
+}
+
+func TestExecOnError(t *testing.T) {
+	// the commands of the records 2 and 4 fail, after those of the records that follow them have finished
+	const failing = "--exec=" + execID + `test $id = 2 -o $id = 4 && sleep 0.2 && echo failed $id >&2 && exit 1; true`
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		unordered      bool
+		expectedStdout string
+		expectedStderr []string
+		expectedErr    string
+	}{
+		{
+			name:           "fail",
+			expectedStdout: jsonRecord("1"),
+			expectedErr:    "for /r/i: failed 2",
+		},
+		{
+			name:           "skip",
+			args:           []string{"--exec-on-error=skip"},
+			expectedStdout: jsonRecord("1") + jsonRecord("3") + jsonRecord("5"),
+			expectedStderr: []string{"for /r/i: failed 2, skipping the record", "for /r/i: failed 4, skipping the record"},
+		},
+		{
+			name:           "keep",
+			args:           []string{"--exec-on-error=keep"},
+			expectedStdout: jsonRecord("1") + jsonRecord("2") + jsonRecord("3") + jsonRecord("4") + jsonRecord("5"),
+			expectedStderr: []string{"for /r/i: failed 2, keeping the record", "for /r/i: failed 4, keeping the record"},
+		},
+		{
+			name:           "skip unordered",
+			args:           []string{"--exec-on-error=skip", "--unordered"},
+			unordered:      true,
+			expectedStdout: jsonRecord("1") + jsonRecord("3") + jsonRecord("5"),
+			expectedStderr: []string{"failed 2, skipping the record", "failed 4, skipping the record"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"records.xml": `<r><i id="1"/><i id="2"/><i id="3"/><i id="4"/><i id="5"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			args := append([]string{"--selector=/r/i", failing, "--exec-workers=5"}, test.args...)
+			stdout, stderr, err := runCommand(dir, &jsonCmd{}, append(args, "records.xml")...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+			} else {
+				assert.NoError(t, err, name)
+			}
+			if test.unordered {
+				lines := strings.SplitAfter(stdout, "\n")
+				sort.Strings(lines)
+				stdout = strings.Join(lines, "")
+			}
+			assert.Equal(t, test.expectedStdout, stdout, name)
+			for _, s := range test.expectedStderr {
+				assert.Contains(t, stderr, s, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// explodeProcessor writes each record rendered by next to its own file in --explode-dir, named by --name-template.
+type explodeProcessor struct {
+	dir    string
+	name   *template.Template
+	mapper xmlpicker.Mapper
+	next   processor
+	buf    bytes.Buffer
+	// header is what next wrote before the first record, such as an XML declaration, it starts every file
+	header []byte
+	count  int
+	names  map[string]bool
+}
+
+// explodeData is what --name-template is executed with.
+type explodeData struct {
+	// Record is the record mapped to JSON, e.g. {{index .Record "@id"}}.
+	Record map[string]interface{}
+	// Index counts the records from 1.
+	Index int
+	// Name is the local name of the element of the record.
+	Name string
+}
+
+// newExplodeProcessor returns the processor writing the records rendered by the processor newProcessor creates to
+// files with the ext extension by default, mapper gives the Record of --name-template.
+func (o *options) newExplodeProcessor(outputs []string, ext string, mapper xmlpicker.Mapper, newProcessor func(w io.Writer) (processor, error)) (processor, error) {
+	if len(outputs) != 0 || len(o.Route) != 0 || o.Exec != "" {
+		return nil, fmt.Errorf("--explode-dir cannot be combined with --output, --route or --exec")
+	}
+	text := o.NameTemplate
+	if text == "" {
+		text = "{{.Index}}" + ext
+	}
+	tmpl, err := template.New("name-template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --name-template: %s", err)
+	}
+	if err := os.MkdirAll(longPath(o.ExplodeDir), 0755); err != nil {
+		return nil, err
+	}
+	p := &explodeProcessor{dir: o.ExplodeDir, name: tmpl, mapper: mapper, names: make(map[string]bool)}
+	if p.next, err = newProcessor(o.outputWriter(&p.buf)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *explodeProcessor) Begin() error {
+	if err := p.next.Begin(); err != nil {
+		return err
+	}
+	p.header = append([]byte(nil), p.buf.Bytes()...)
+	p.buf.Reset()
+	return nil
+}
+
+func (p *explodeProcessor) Process(node *xmlpicker.Node) error {
+	defer p.buf.Reset()
+	data := explodeData{Index: p.count + 1, Name: node.StartElement.Name.Local}
+	var err error
+	if data.Record, err = p.mapper.FromNode(node); err != nil {
+		return err
+	}
+	if err := p.next.Process(node); err != nil {
+		return err
+	}
+	name, err := p.filename(&data)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(p.dir, name)
+	if err := os.MkdirAll(longPath(filepath.Dir(path)), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(longPath(path), append(p.header, p.buf.Bytes()...), 0644); err != nil {
+		return err
+	}
+	p.count++
+	return nil
+}
+
+// filename returns the name --name-template gives a record, which must stay within --explode-dir and differ from the
+// names of the other records.
+func (p *explodeProcessor) filename(data *explodeData) (string, error) {
+	var b bytes.Buffer
+	if err := p.name.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("--name-template: %s", err)
+	}
+	// index gives no error for a missing key
+	if strings.Contains(b.String(), "<no value>") {
+		return "", fmt.Errorf("--name-template gave %q, a value is missing from the record", b.String())
+	}
+	name := filepath.Clean(filepath.FromSlash(strings.TrimSpace(b.String())))
+	if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("--name-template gave %q, which is not a filename within --explode-dir", b.String())
+	}
+	if p.names[name] {
+		return "", fmt.Errorf("--name-template gave %s for more than one record", name)
+	}
+	p.names[name] = true
+	return name, nil
+}
+
+func (p *explodeProcessor) Finish() error {
+	// what next writes after the last record, such as the end of a container, is not part of any file
+	defer p.buf.Reset()
+	if err := p.next.Finish(); err != nil {
+		return err
+	}
+	infof("wrote %d files to %s", p.count, p.dir)
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplode(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		command     flags.Commander
+		args        []string
+		expected    map[string]string
+		expectedErr string
+	}{
+		{
+			name:    "json",
+			command: &jsonCmd{},
+			expected: map[string]string{
+				"1.json": jsonRecord("1"),
+				"2.json": jsonRecord("2"),
+				"3.json": jsonRecord("3"),
+			},
+		},
+		{
+			name:    "xml",
+			command: &xmlCmd{},
+			expected: map[string]string{
+				"1.xml": `<r><i id="1"></i></r>` + "\n",
+				"2.xml": `<r><i id="2"></i></r>` + "\n",
+				"3.xml": `<r><i id="3"></i></r>` + "\n",
+			},
+		},
+		{
+			name:    "name template",
+			command: &xmlCmd{},
+			args:    []string{`--name-template={{.Name}}/{{index .Record "@id"}}-{{.Index}}.xml`},
+			expected: map[string]string{
+				filepath.Join("i", "1-1.xml"): `<r><i id="1"></i></r>` + "\n",
+				filepath.Join("i", "2-2.xml"): `<r><i id="2"></i></r>` + "\n",
+				filepath.Join("i", "3-3.xml"): `<r><i id="3"></i></r>` + "\n",
+			},
+		},
+		{
+			name:        "missing value",
+			command:     &jsonCmd{},
+			args:        []string{`--name-template={{index .Record "@key"}}`},
+			expectedErr: `--name-template gave "<no value>", a value is missing from the record`,
+		},
+		{
+			name:        "outside the directory",
+			command:     &jsonCmd{},
+			args:        []string{"--name-template=../{{.Index}}"},
+			expectedErr: `--name-template gave "../1", which is not a filename within --explode-dir`,
+		},
+		{
+			name:        "absolute",
+			command:     &jsonCmd{},
+			args:        []string{"--name-template=/tmp/{{.Index}}"},
+			expectedErr: `--name-template gave "/tmp/1", which is not a filename within --explode-dir`,
+		},
+		{
+			name:        "same name",
+			command:     &jsonCmd{},
+			args:        []string{"--name-template={{.Name}}.json"},
+			expectedErr: "--name-template gave i.json for more than one record",
+		},
+		{
+			name:        "unclosed action",
+			command:     &jsonCmd{},
+			args:        []string{"--name-template={{"},
+			expectedErr: "invalid --name-template: template: name-template:1: unclosed action",
+		},
+		{
+			name:        "unknown field",
+			command:     &jsonCmd{},
+			args:        []string{"--name-template={{.Key}}"},
+			expectedErr: `--name-template: template: name-template:1:2: executing "name-template" at <.Key>: can't evaluate field Key in type *main.explodeData`,
+		},
+		{
+			name:        "output",
+			command:     &jsonCmd{},
+			args:        []string{"--output=records.json"},
+			expectedErr: "--explode-dir cannot be combined with --output, --route or --exec",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"a.xml": `<r><i id="1"/><i id="2"/></r>`, "b.xml": `<r><i id="3"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			args := append([]string{"--selector=/r/i", "--explode-dir=out"}, test.args...)
+			stdout, _, err := runCommand(dir, test.command, append(args, "a.xml", "b.xml")...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.Equal(t, "", stdout, name)
+			actual := make(map[string]string)
+			err = filepath.Walk(filepath.Join(dir, "out"), func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				rel, err := filepath.Rel(filepath.Join(dir, "out"), path)
+				actual[rel] = string(b)
+				return err
+			})
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, actual, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type fieldsCmd struct {
+	Options options
+	Format  string   `short:"f" long:"format" choice:"kv" choice:"env" default:"kv" description:"key=value lines quoted for POSIX shells or an env file with upper case keys and double quoted values"`
+	Field   []string `long:"field" value-name:"[NAME=]KEY-PATH" description:"output the value of KEY-PATH, named after its last step unless NAME is given, may be repeated, by default the attributes and text only child elements are output"`
+	Args    struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute writes the fields of each record, separated by an empty line.
+func (c *fieldsCmd) Execute(_ []string) error {
+	p := &fieldsProcessor{writer: c.Options.outputWriter(os.Stdout), write: xmlpicker.WriteKeyValues}
+	if c.Format == "env" {
+		p.write = xmlpicker.WriteEnv
+	}
+	for _, v := range c.Field {
+		f, err := xmlpicker.ParseField(v)
+		if err != nil {
+			return err
+		}
+		p.fields = append(p.fields, f)
+	}
+	return mainImpl(&c.Options, c.Args.Filenames, p)
+}
+
+type fieldsProcessor struct {
+	writer io.Writer
+	write  func(w io.Writer, kvs []xmlpicker.KeyValue) error
+	fields []xmlpicker.Field
+	count  int
+}
+
+func (p *fieldsProcessor) Begin() error {
+	return nil
+}
+
+func (p *fieldsProcessor) Process(node *xmlpicker.Node) error {
+	if p.count != 0 {
+		if _, err := p.writer.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	p.count++
+	return p.write(p.writer, xmlpicker.RecordFields(node, p.fields))
+}
+
+func (p *fieldsProcessor) Finish() error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type gendocCmd struct {
+	Seed             int64   `long:"seed" value-name:"N" default:"1" description:"seed of the pseudo-random generator, the same flags always give the same document"`
+	Records          int     `long:"records" value-name:"N" description:"number of /doc/record elements"`
+	Size             string  `long:"size" value-name:"BYTES" description:"stop starting records once the document reaches this size, e.g. 512MiB"`
+	Depth            int     `long:"depth" value-name:"N" default:"3" description:"levels of elements below each record"`
+	FanOut           int     `long:"fan-out" value-name:"N" default:"4" description:"maximum number of children of an element"`
+	Attributes       int     `long:"attributes" value-name:"N" default:"2" description:"maximum number of attributes of an element"`
+	TextSize         int     `long:"text-size" value-name:"BYTES" default:"64" description:"maximum size of a text"`
+	Namespaces       int     `long:"namespaces" value-name:"N" description:"number of prefixes declared on the document element"`
+	NamespaceDensity float64 `long:"namespace-density" value-name:"P" default:"0.2" description:"probability, from 0 to 1, that a name uses one of the --namespaces prefixes"`
+}
+
+// Execute writes the generated document to stdout.
+func (c *gendocCmd) Execute(_ []string) error {
+	g := xmlpicker.DocumentGenerator{
+		Seed:             c.Seed,
+		Records:          c.Records,
+		Depth:            c.Depth,
+		FanOut:           c.FanOut,
+		Attributes:       c.Attributes,
+		TextSize:         c.TextSize,
+		Namespaces:       c.Namespaces,
+		NamespaceDensity: c.NamespaceDensity,
+	}
+	if c.Size != "" {
+		size, err := parseByteSize(c.Size)
+		if err != nil {
+			return fmt.Errorf("invalid --size %s: %s", c.Size, err)
+		}
+		g.Size = int64(size)
+	}
+	if g.Namespaces == 0 {
+		g.NamespaceDensity = 0
+	}
+	_, err := g.WriteTo(os.Stdout)
+	return err
+}
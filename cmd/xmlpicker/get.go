@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type getCmd struct {
+	Options options
+	KeyPath string `short:"k" long:"key-path" value-name:"KEY-PATH" description:"key of each record, either @attribute, #text or a relative path of child elements"`
+	Key     string `long:"key" value-name:"KEY" description:"output the record with this key"`
+	Number  int    `long:"number" value-name:"N" default:"-1" description:"output the Nth record, starting at 0, instead of looking up --key"`
+	Format  string `short:"f" long:"format" choice:"json" choice:"xml" default:"json" description:"output format of the record"`
+	Pretty  bool   `short:"p" long:"pretty" description:"generated formatted output"`
+	Args    struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+func (c *getCmd) Execute(_ []string) error {
+	p := &getProcessor{number: c.Number}
+	if c.Number < 0 {
+		if c.KeyPath == "" {
+			return fmt.Errorf("either --key-path and --key or --number is required")
+		}
+		var err error
+		if p.keyPath, err = xmlpicker.ParseKeyPath(c.KeyPath); err != nil {
+			return err
+		}
+		p.key = c.Key
+	}
+	if c.Format == "xml" {
+		x := newXMLProcessor(c.Options.outputWriter(os.Stdout))
+		if c.Pretty {
+			x.exporter.Encoder.Indent("", "    ")
+		}
+		p.next = x
+	} else {
+		j := newJSONProcessor(c.Options.outputWriter(os.Stdout))
+		if c.Pretty {
+			j.encoder.SetIndent("", "    ")
+		}
+		p.next = j
+	}
+	return mainImpl(&c.Options, c.Args.Filenames, p)
+}
+
+// getProcessor passes on the first node with the key, or the node with the number when there is no key path, and then
+// stops processing.
+type getProcessor struct {
+	next    processor
+	keyPath *xmlpicker.KeyPath
+	key     string
+	number  int
+	count   int
+	found   bool
+}
+
+func (p *getProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *getProcessor) Process(node *xmlpicker.Node) error {
+	if p.keyPath != nil {
+		if k, ok := p.keyPath.Key(node); !ok || k != p.key {
+			return nil
+		}
+	} else {
+		p.count = p.count + 1
+		if p.count <= p.number {
+			return nil
+		}
+	}
+	p.found = true
+	if err := p.next.Process(node); err != nil {
+		return err
+	}
+	return errStop
+}
+
+func (p *getProcessor) Finish() error {
+	if err := p.next.Finish(); err != nil {
+		return err
+	}
+	if p.found {
+		return nil
+	}
+	if p.keyPath != nil {
+		return fmt.Errorf("record with key %q not found", p.key)
+	}
+	return fmt.Errorf("record %d not found", p.number)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	dir, ok := writeFiles(t, map[string]string{
+		"records.xml": `<r><i id="1"><t>a</t></i><i id="2"><t>b</t></i><i id="3"><t>c</t></i></r>`,
+		// malformed after the second record, which is only read when the record is not found before it
+		"cut.xml": `<r><i id="1"/><i id="2"/><<<`,
+	})
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedStdout string
+		expectedErr    string
+	}{
+		{
+			name:           "key",
+			args:           []string{"--key-path=@id", "--key=2", "records.xml"},
+			expectedStdout: `{"@id":"2","_name":"i","_namespaces":{},"t":[{"#text":["b"]}]}` + "\n",
+		},
+		{
+			name:           "key of a child",
+			args:           []string{"--key-path=t", "--key=c", "records.xml"},
+			expectedStdout: `{"@id":"3","_name":"i","_namespaces":{},"t":[{"#text":["c"]}]}` + "\n",
+		},
+		{
+			name:           "number",
+			args:           []string{"--number=0", "records.xml"},
+			expectedStdout: `{"@id":"1","_name":"i","_namespaces":{},"t":[{"#text":["a"]}]}` + "\n",
+		},
+		{
+			name:           "xml",
+			args:           []string{"--key-path=@id", "--key=2", "--format=xml", "records.xml"},
+			expectedStdout: `<r><i id="2"><t>b</t></i></r>` + "\n",
+		},
+		{
+			name:           "stops reading",
+			args:           []string{"--key-path=@id", "--key=2", "cut.xml"},
+			expectedStdout: jsonRecord("2"),
+		},
+		{
+			name:        "reads on",
+			args:        []string{"--key-path=@id", "--key=3", "cut.xml"},
+			expectedErr: "XML syntax error",
+		},
+		{
+			name:        "key not found",
+			args:        []string{"--key-path=@id", "--key=4", "records.xml"},
+			expectedErr: `record with key "4" not found`,
+		},
+		{
+			name:        "number not found",
+			args:        []string{"--number=3", "records.xml"},
+			expectedErr: "record 3 not found",
+		},
+		{
+			name:        "no key path",
+			args:        []string{"--key=1", "records.xml"},
+			expectedErr: "either --key-path and --key or --number is required",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			stdout, _, err := runCommand(dir, &getCmd{}, append([]string{"--selector=/r/i"}, test.args...)...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+			} else {
+				assert.NoError(t, err, name)
+			}
+			assert.Equal(t, test.expectedStdout, stdout, name)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type graphCmd struct {
+	Options   options
+	Format    string `short:"f" long:"format" choice:"dot" choice:"mermaid" default:"dot" description:"Graphviz DOT or Mermaid flowchart"`
+	Aggregate bool   `short:"a" long:"aggregate" description:"merge the structure of every matched node instead of stopping after the first one"`
+	Args      struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute renders the element structure of the first matched node, or of all of them with --aggregate, which with
+// the default selector is the structure of the whole document.
+func (c *graphCmd) Execute(_ []string) error {
+	p := &graphProcessor{writer: os.Stdout, format: c.Format, aggregate: c.Aggregate, structure: xmlpicker.NewStructure()}
+	return mainImpl(&c.Options, c.Args.Filenames, p)
+}
+
+type graphProcessor struct {
+	writer    io.Writer
+	format    string
+	aggregate bool
+	structure *xmlpicker.Structure
+}
+
+func (p *graphProcessor) Begin() error {
+	return nil
+}
+
+func (p *graphProcessor) Process(node *xmlpicker.Node) error {
+	p.structure.Add(node)
+	if !p.aggregate {
+		return errStop
+	}
+	return nil
+}
+
+func (p *graphProcessor) Finish() error {
+	if p.format == "mermaid" {
+		return p.structure.WriteMermaid(p.writer)
+	}
+	return p.structure.WriteDOT(p.writer)
+}
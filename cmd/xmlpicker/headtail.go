@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// errStop is returned by a processor that does not want any more nodes, input is not read any further.
+var errStop = errors.New("stop processing")
+
+// headProcessor passes on the first size nodes and then stops processing.
+type headProcessor struct {
+	next  processor
+	size  int
+	count int
+}
+
+func (p *headProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *headProcessor) Process(node *xmlpicker.Node) error {
+	if p.count >= p.size {
+		return errStop
+	}
+	p.count = p.count + 1
+	if err := p.next.Process(node); err != nil {
+		return err
+	}
+	if p.count >= p.size {
+		return errStop
+	}
+	return nil
+}
+
+func (p *headProcessor) Finish() error {
+	return p.next.Finish()
+}
+
+// tailProcessor keeps the last size nodes and passes them on when finished.
+type tailProcessor struct {
+	next  processor
+	size  int
+	seen  int
+	items []reservoirItem
+}
+
+func (p *tailProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *tailProcessor) Process(node *xmlpicker.Node) error {
+	// the parent is kept as the caller may clear it once we return
+	item := reservoirItem{seq: p.seen, node: node, parent: node.Parent}
+	if len(p.items) < p.size {
+		p.items = append(p.items, item)
+	} else {
+		p.items[p.seen%p.size] = item
+	}
+	p.seen = p.seen + 1
+	return nil
+}
+
+func (p *tailProcessor) Finish() error {
+	start := 0
+	if p.seen > p.size {
+		start = p.seen % p.size
+	}
+	for i := range p.items {
+		item := p.items[(start+i)%len(p.items)]
+		item.node.Parent = item.parent
+		if err := p.next.Process(item.node); err == errStop {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return p.next.Finish()
+}
+
+func (o *options) wrapHeadTail(proc processor) (processor, error) {
+	if o.Head < 0 || o.Tail < 0 {
+		return nil, fmt.Errorf("--head and --tail must not be negative")
+	}
+	if o.Head != 0 && o.Tail != 0 {
+		return nil, fmt.Errorf("--head and --tail cannot be combined")
+	}
+	if o.First && (o.Head != 0 || o.Tail != 0) {
+		return nil, fmt.Errorf("--first cannot be combined with --head or --tail")
+	}
+	if o.First {
+		return &headProcessor{next: proc, size: 1}, nil
+	}
+	if o.Head != 0 {
+		return &headProcessor{next: proc, size: o.Head}, nil
+	}
+	if o.Tail != 0 {
+		return &tailProcessor{next: proc, size: o.Tail}, nil
+	}
+	return proc, nil
+}
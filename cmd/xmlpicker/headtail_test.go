@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadTail(t *testing.T) {
+	dir, ok := writeFiles(t, map[string]string{
+		"records.xml": `<r><i id="1"/><i id="2"/><i id="3"/></r>`,
+		"more.xml":    `<r><i id="4"/><i id="5"/></r>`,
+		// the records are followed by malformed xml, which is only read when more records are wanted
+		"cut.xml": `<r><i id="1"/><i id="2"/><<<`,
+	})
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedStdout string
+		expectedErr    string
+	}{
+		{
+			name:           "head",
+			args:           []string{"--head=2", "records.xml"},
+			expectedStdout: jsonRecord("1") + jsonRecord("2"),
+		},
+		{
+			name:           "head larger than the input",
+			args:           []string{"--head=10", "records.xml"},
+			expectedStdout: jsonRecord("1") + jsonRecord("2") + jsonRecord("3"),
+		},
+		{
+			name:           "head stops reading",
+			args:           []string{"--head=2", "cut.xml", "more.xml"},
+			expectedStdout: jsonRecord("1") + jsonRecord("2"),
+		},
+		{
+			name:           "head reads on",
+			args:           []string{"--head=3", "cut.xml"},
+			expectedStdout: jsonRecord("1") + jsonRecord("2"),
+			expectedErr:    "XML syntax error",
+		},
+		{
+			name:           "first",
+			args:           []string{"--first", "cut.xml"},
+			expectedStdout: jsonRecord("1"),
+		},
+		{
+			name:           "tail",
+			args:           []string{"--tail=2", "records.xml"},
+			expectedStdout: jsonRecord("2") + jsonRecord("3"),
+		},
+		{
+			name:           "tail across inputs",
+			args:           []string{"--tail=3", "records.xml", "more.xml"},
+			expectedStdout: jsonRecord("3") + jsonRecord("4") + jsonRecord("5"),
+		},
+		{
+			name:           "tail larger than the input",
+			args:           []string{"--tail=5", "records.xml"},
+			expectedStdout: jsonRecord("1") + jsonRecord("2") + jsonRecord("3"),
+		},
+		{
+			name:        "head and tail",
+			args:        []string{"--head=1", "--tail=1", "records.xml"},
+			expectedErr: "--head and --tail cannot be combined",
+		},
+		{
+			name:        "negative",
+			args:        []string{"--tail=-1", "records.xml"},
+			expectedErr: "--head and --tail must not be negative",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			stdout, _, err := runCommand(dir, &jsonCmd{}, append([]string{"--selector=/r/i"}, test.args...)...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+			} else {
+				assert.NoError(t, err, name)
+			}
+			assert.Equal(t, test.expectedStdout, stdout, name)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type indexCmd struct {
+	Options options
+	Key     string `short:"k" long:"key" value-name:"KEY-PATH" description:"key of each record, either @attribute, #text or a relative path of child elements"`
+	Output  string `short:"o" long:"output" value-name:"FILE" description:"where to write the index, defaults to the input filename with an .idx suffix"`
+	Args    struct {
+		Filename string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+func (c *indexCmd) Execute(_ []string) error {
+	var key *xmlpicker.KeyPath
+	if c.Key != "" {
+		var err error
+		if key, err = xmlpicker.ParseKeyPath(c.Key); err != nil {
+			return err
+		}
+	}
+	f, err := openUncompressed(c.Args.Filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	parser, err := newParser(f, &c.Options)
+	if err != nil {
+		return err
+	}
+	idx, err := xmlpicker.BuildIndex(parser, key)
+	if err != nil {
+		return err
+	}
+	output := c.Output
+	if output == "" {
+		output = c.Args.Filename + ".idx"
+	}
+	w, err := os.Create(longPath(output))
+	if err != nil {
+		return err
+	}
+	if _, err := idx.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (o *options) UsesIndex() bool {
+	return len(o.RecordKey) != 0 || len(o.RecordNumber) != 0
+}
+
+// parseIndexed processes just the records selected by --record-number and --record-key using the index of filename.
+func parseIndexed(filename string, o *options, proc processor) error {
+	indexFilename := o.Index
+	if indexFilename == "" {
+		indexFilename = filename + ".idx"
+	}
+	r, err := os.Open(longPath(indexFilename))
+	if err != nil {
+		return err
+	}
+	idx, err := xmlpicker.ReadIndex(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	f, err := openUncompressed(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	transforms, err := o.NewTransforms()
+	if err != nil {
+		return err
+	}
+	entries := make([]xmlpicker.IndexEntry, 0, len(o.RecordNumber)+len(o.RecordKey))
+	for _, n := range o.RecordNumber {
+		if n < 0 || n >= len(idx.Entries) {
+			return fmt.Errorf("record %d not found in %s", n, indexFilename)
+		}
+		entries = append(entries, idx.Entries[n])
+	}
+	for _, k := range o.RecordKey {
+		e, ok := idx.Lookup(k)
+		if !ok {
+			return fmt.Errorf("record with key %q not found in %s", k, indexFilename)
+		}
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		n, err := xmlpicker.ReadRecord(f, e, o.NSFlag())
+		if err != nil {
+			return err
+		}
+		if err := process(n, transforms, proc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openUncompressed opens filename for random access, offsets in an index only make sense for uncompressed files.
+func openUncompressed(filename string) (*os.File, error) {
+	if filename == "-" {
+		return nil, fmt.Errorf("indexes cannot be used with stdin")
+	}
+	f, err := os.Open(longPath(filename))
+	if err != nil {
+		return nil, err
+	}
+	h := make([]byte, 2)
+	if _, err := io.ReadFull(f, h); err == nil && h[0] == 0x1f && h[1] == 0x8b {
+		f.Close()
+		return nil, fmt.Errorf("indexes cannot be used with compressed file %s", filename)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
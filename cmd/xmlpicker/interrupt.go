@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// errInterrupted is returned once a signal was received, at the first record boundary after it.
+var errInterrupted = errors.New("interrupted")
+
+// interruptedError ends a run that was stopped by a signal.
+type interruptedError struct {
+	signal os.Signal
+	code   int
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("interrupted by %s", e.signal)
+}
+
+func (e *interruptedError) exitCode() int {
+	return e.code
+}
+
+// watchSignals records SIGINT and SIGTERM so that the run stops at the next record rather than straight away, the
+// returned function stops watching.
+func (o *options) watchSignals() func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case s := <-c:
+			o.signal.Store(s)
+			atomic.StoreInt32(&o.interrupted, 1)
+			// a second signal is not caught
+			signal.Stop(c)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+func (o *options) checkInterrupted() error {
+	if atomic.LoadInt32(&o.interrupted) != 0 {
+		return errInterrupted
+	}
+	return nil
+}
+
+func (o *options) interruptedError() error {
+	s := o.signal.Load().(os.Signal)
+	code := 1
+	if n, ok := s.(syscall.Signal); ok {
+		code = 128 + int(n)
+	}
+	return &interruptedError{signal: s, code: code}
+}
+
+// runState is written to --state, it records how far a run got so that --resume can carry on from there.
+type runState struct {
+	// Completed holds the inputs that were processed in full.
+	Completed []string `json:"completed,omitempty"`
+	// File is the input that was being processed, Records the number of records that were read from it and Offset
+	// where the last of them ended, within the archive entry for tar archives.
+	File    string `json:"file,omitempty"`
+	Records int    `json:"records,omitempty"`
+	Offset  int64  `json:"offset,omitempty"`
+}
+
+// loadState reads the state of a previous run for --resume, there is none if the file does not exist.
+func (o *options) loadState() error {
+	if o.Resume && o.State == "" {
+		return fmt.Errorf("--resume requires --state")
+	}
+	if !o.Resume {
+		return nil
+	}
+	b, err := ioutil.ReadFile(o.State)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &o.resume); err != nil {
+		return fmt.Errorf("invalid --state %s: %s", o.State, err)
+	}
+	return nil
+}
+
+// resumeFile reports whether filename still needs to be processed, and sets the number of its records to skip.
+func (o *options) resumeFile(filename string) bool {
+	for _, f := range o.resume.Completed {
+		if f == filename {
+			o.state.Completed = append(o.state.Completed, filename)
+			return false
+		}
+	}
+	o.state.File, o.state.Records, o.state.Offset = filename, 0, 0
+	o.skip = 0
+	if filename == o.resume.File {
+		o.skip = o.resume.Records
+	}
+	return true
+}
+
+func (o *options) completeFile(filename string) {
+	o.state.Completed = append(o.state.Completed, filename)
+	o.state.File, o.state.Records, o.state.Offset = "", 0, 0
+}
+
+func (o *options) writeState() error {
+	if o.State == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(&o.state, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(o.State, append(b, '\n'), 0666)
+}
@@ -0,0 +1,120 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// xmlIDs returns the ids of the i elements of a well-formed document.
+func xmlIDs(doc string) ([]string, error) {
+	var ids []string
+	d := xml.NewDecoder(bytes.NewReader([]byte(doc)))
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return ids, err
+		}
+		if start, ok := t.(xml.StartElement); ok && start.Name.Local == "i" {
+			ids = append(ids, start.Attr[0].Value)
+		}
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	var doc bytes.Buffer
+	var all []string
+	doc.WriteString("<r>")
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(&doc, `<i id="%d"/>`, i)
+		all = append(all, fmt.Sprint(i))
+	}
+	doc.WriteString("</r>")
+	dir, ok := writeFiles(t, map[string]string{"more.xml": `<r><i id="400"/></r>`})
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dir)
+	all = append(all, "400")
+
+	// the first records are written to a named pipe, the run is interrupted while it waits for more and those that
+	// follow are not read
+	records := filepath.Join(dir, "records.xml")
+	if !assert.NoError(t, syscall.Mkfifo(records, 0666)) {
+		return
+	}
+	go func() {
+		f, err := os.OpenFile(records, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		split := strings.Index(doc.String(), `<i id="100"/>`)
+		f.Write(doc.Bytes()[:split])
+		time.Sleep(200 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+		time.Sleep(200 * time.Millisecond)
+		f.Write(doc.Bytes()[split:])
+	}()
+	args := []string{"--selector=/r/i", "--container-xml=<out/>", "--state=state.json", "records.xml", "more.xml"}
+	stdout, _, err := runCommand(dir, &xmlCmd{}, args...)
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.Equal(t, "interrupted by interrupt", err.Error())
+	if e, ok := err.(exitCoder); assert.True(t, ok) {
+		assert.Equal(t, 130, e.exitCode())
+	}
+	// the container is closed
+	first, err := xmlIDs(stdout)
+	if !assert.NoError(t, err, stdout) {
+		return
+	}
+	assert.True(t, len(first) >= 100 && len(first) < 400, "%d records before the interrupt", len(first))
+	b, err := ioutil.ReadFile(filepath.Join(dir, "state.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var state runState
+	if assert.NoError(t, json.Unmarshal(b, &state)) {
+		assert.Equal(t, runState{File: "records.xml", Records: len(first), Offset: state.Offset}, state)
+		// the offset is the end of the last record
+		last := fmt.Sprintf(`<i id="%d"/>`, len(first)-1)
+		assert.Equal(t, int64(strings.Index(doc.String(), last)+len(last)), state.Offset)
+	}
+
+	// the records are read from a regular file on resume
+	if !assert.NoError(t, os.Remove(records)) || !assert.NoError(t, ioutil.WriteFile(records, doc.Bytes(), 0666)) {
+		return
+	}
+	stdout, _, err = runCommand(dir, &xmlCmd{}, append([]string{"--resume"}, args...)...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rest, err := xmlIDs(stdout)
+	if assert.NoError(t, err, stdout) {
+		assert.Equal(t, all, append(first, rest...))
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "state.json"))
+	var completed runState
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(b, &completed)) {
+		assert.Equal(t, runState{Completed: []string{"records.xml", "more.xml"}}, completed)
+	}
+}
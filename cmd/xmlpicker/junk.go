@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// skipJunkLimit returns the number of bytes --skip-junk allows to skip.
+func (o *options) skipJunkLimit() (int, error) {
+	limit, err := parseByteSize(o.SkipJunk)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --skip-junk %s: %s", o.SkipJunk, err)
+	}
+	return limit, nil
+}
+
+// skipLeadingJunk skips the bytes before the first < of the document of src with --skip-junk, and returns the reader
+// of the rest of it and the number of bytes skipped, which are reported.
+func (o *options) skipLeadingJunk(r io.Reader, src *source) (io.Reader, int64, error) {
+	if o.SkipJunk == "" {
+		return r, 0, nil
+	}
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, o.readBuffer)
+	}
+	n, err := xmlpicker.SkipLeadingJunk(br, o.skipJunk)
+	name := src.name()
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %s", name, err)
+	}
+	if n != 0 {
+		infof("skipped %d bytes before the document of %s", n, name)
+	}
+	return br, int64(n), nil
+}
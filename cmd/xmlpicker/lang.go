@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/t11e/xmlpicker"
+)
+
+// langProcessor only passes on the nodes in the language of --lang, without their descendants in other languages.
+type langProcessor struct {
+	next processor
+	lang string
+}
+
+func (p *langProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *langProcessor) Process(node *xmlpicker.Node) error {
+	if !xmlpicker.FilterLang(node, p.lang) {
+		return nil
+	}
+	return p.next.Process(node)
+}
+
+func (p *langProcessor) Finish() error {
+	return p.next.Finish()
+}
+
+func (o *options) wrapLang(proc processor) processor {
+	if o.Lang == "" {
+		return proc
+	}
+	return &langProcessor{next: proc, lang: o.Lang}
+}
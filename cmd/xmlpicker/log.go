@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// logLevel orders diagnostics, those above the level of --log-level are not written.
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarn
+	levelInfo
+	levelDebug
+)
+
+var logLevels = map[string]logLevel{"error": levelError, "warn": levelWarn, "info": levelInfo, "debug": levelDebug}
+
+// logger writes diagnostics to stderr, stdout only ever carries the output of a command.
+var logger = struct {
+	sync.Mutex
+	level logLevel
+}{level: levelInfo}
+
+// configureLogging applies --log-level and --quiet.
+func (o *options) configureLogging() {
+	logger.Lock()
+	defer logger.Unlock()
+	logger.level = logLevels[o.LogLevel]
+	if o.Quiet {
+		logger.level = levelError
+	}
+}
+
+func logf(level logLevel, format string, args ...interface{}) {
+	logger.Lock()
+	defer logger.Unlock()
+	if level <= logger.level {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+func errorf(format string, args ...interface{}) {
+	logf(levelError, format, args...)
+}
+
+func warnf(format string, args ...interface{}) {
+	logf(levelWarn, format, args...)
+}
+
+func infof(format string, args ...interface{}) {
+	logf(levelInfo, format, args...)
+}
+
+func debugf(format string, args ...interface{}) {
+	logf(levelDebug, format, args...)
+}
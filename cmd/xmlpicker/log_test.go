@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdoutOnlyHasRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlpicker")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"records.xml":    `<r><i id="1"/><i id="2"/></r>`,
+		"undeclared.xml": `<r><i id="1"><p:x/></i></r>`,
+		"truncated.xml":  `<r><i id="1"/><i id="2">`,
+	}
+	for name, data := range files {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666)) {
+			return
+		}
+	}
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedIDs    []string
+		expectedStderr string
+		expectedErr    string
+	}{
+		{
+			name:        "records",
+			args:        []string{"records.xml"},
+			expectedIDs: []string{"1", "2"},
+		},
+		{
+			name:           "warning",
+			args:           []string{"--undeclared-prefix=warn", "undeclared.xml"},
+			expectedIDs:    []string{"1"},
+			expectedStderr: "undeclared prefix",
+		},
+		{
+			name:        "quiet warning",
+			args:        []string{"--undeclared-prefix=warn", "--quiet", "undeclared.xml"},
+			expectedIDs: []string{"1"},
+		},
+		{
+			name:           "exec failures",
+			args:           []string{"--exec=grep -q '\"2\"'", "--exec-on-error=skip", "records.xml"},
+			expectedIDs:    []string{"2"},
+			expectedStderr: "skipping the record",
+		},
+		{
+			name:           "debug",
+			args:           []string{"--log-level=debug", "records.xml"},
+			expectedIDs:    []string{"1", "2"},
+			expectedStderr: "reading records.xml",
+		},
+		{
+			name:        "error",
+			args:        []string{"records.xml", "truncated.xml"},
+			expectedIDs: []string{"1", "2", "1"},
+			expectedErr: "unexpected EOF",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			stdout, stderr, err := runCaptured(dir, func() error {
+				c := &jsonCmd{}
+				if _, err := flags.NewParser(c, flags.None).ParseArgs(append([]string{"--selector=/r/i"}, test.args...)); err != nil {
+					return err
+				}
+				return c.Execute(nil)
+			})
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+			} else {
+				assert.NoError(t, err, name)
+			}
+			var ids []string
+			for _, line := range strings.SplitAfter(stdout, "\n") {
+				if line == "" {
+					continue
+				}
+				var record map[string]interface{}
+				if assert.NoError(t, json.Unmarshal([]byte(line), &record), "%s: stdout line %q", name, line) {
+					ids = append(ids, fmt.Sprint(record["@id"]))
+				}
+			}
+			assert.Equal(t, test.expectedIDs, ids, name)
+			if test.expectedStderr == "" {
+				assert.Empty(t, stderr, name)
+			} else {
+				assert.Contains(t, stderr, test.expectedStderr, name)
+			}
+		})
+	}
+}
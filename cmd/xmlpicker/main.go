@@ -2,30 +2,199 @@ package main
 
 import (
 	"bufio"
-	"compress/gzip"
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	flags "github.com/jessevdk/go-flags"
 	"github.com/t11e/xmlpicker"
+	"golang.org/x/text/unicode/norm"
 )
 
 type cmds struct {
-	jsonCmd `command:"json" description:"convert to JSON"`
-	xmlCmd  `command:"xml" description:"convert to XML"`
+	jsonCmd          `command:"json" description:"convert to JSON"`
+	xmlCmd           `command:"xml" description:"convert to XML"`
+	indexCmd         `command:"index" description:"build an index of the matched nodes of uncompressed files"`
+	getCmd           `command:"get" description:"output a single record, selected by key or number, and stop reading"`
+	countCmd         `command:"count" description:"count the matched nodes of each file"`
+	benchSelectorCmd `command:"bench-selector" description:"measure the throughput and allocations of selectors over a sample file"`
+	graphCmd         `command:"graph" description:"render the element structure of matched nodes as a Graphviz or Mermaid diagram"`
+	testSelectorsCmd `command:"test-selectors" description:"check the nodes selectors match in documents against the expectations of YAML test files"`
+	pipelineCmd      `command:"pipeline" description:"run the json and xml jobs of a --config file over a single parse of the input"`
+	fieldsCmd        `command:"fields" description:"output fields of each record as shell friendly key=value lines or an env file"`
+	applyPatchesCmd  `command:"apply-patches" description:"copy a document replacing or removing the elements at the paths of a patches document"`
+	segmentsCmd      `command:"segments" description:"output the aligned source and target segments of XLIFF and TMX translation units as JSON lines or CSV"`
+	mergeCmd         `command:"merge" description:"combine the records selected in many files into a single document within --container-xml"`
+	coverageCmd      `command:"coverage" description:"report how many nodes each selector of a file matches and which elements none of them covers"`
+	repairCmd        `command:"repair" description:"close the elements left open in output files cut short by an interrupted run, in place"`
+	gendocCmd        `command:"gendoc" hidden:"yes" description:"write a pseudo-random synthetic document of any size for benchmarks and limit tests"`
 }
 
 type options struct {
+	Config    string `long:"config" value-name:"FILE" description:"YAML file of the command, flags and inputs of a job, keyed by the long flag names, flags given on the command line take precedence"`
 	Selector  string `short:"s" long:"selector" default:"/" description:"path selector to describe which nodes are exported"`
+	XPath     string `short:"x" long:"xpath" description:"XPath 1.0 location path to describe which nodes are exported, used instead of --selector"`
 	Namespace string `short:"n" long:"namespace" choice:"expand" choice:"strip" choice:"prefix" default:"prefix" description:"how to handle namespaces"`
+	Explain   bool   `long:"explain" description:"print how the selector was parsed as JSON instead of reading any input"`
+
+	Route           []string `long:"route" value-name:"SELECTOR=>FILE" description:"write the nodes matched by SELECTOR to FILE, may be repeated to extract several kinds of elements in a single read, used instead of --selector and --output"`
+	ResolvePrefixes bool     `long:"resolve-prefixes" description:"match the prefixes of --selector steps such as x:entry by the namespace they are bound to in the document rather than as written, whatever --namespace"`
+	// selector replaces --selector and --xpath, e.g. with the Router of a pipeline
+	selector xmlpicker.Selector
+	// preserveSpace keeps the whitespace around text for the mappers that map it
+	preserveSpace bool
+
+	CRLF            bool   `long:"crlf" description:"end the lines of the records with CRLF, as Windows tools expect"`
+	ConsoleEncoding string `long:"console-encoding" choice:"auto" choice:"utf-8" choice:"windows-1252" default:"auto" description:"encoding of records written to stdout, auto uses Windows-1252 on Windows consoles with that code page"`
+
+	LogLevel string `long:"log-level" choice:"error" choice:"warn" choice:"info" choice:"debug" default:"info" description:"diagnostics written to stderr, stdout only carries records"`
+	Quiet    bool   `short:"q" long:"quiet" description:"only write errors to stderr, same as --log-level=error"`
+
+	NSDeclare        []string `long:"ns-declare" value-name:"PREFIX=URI" description:"namespace for a prefix that documents use without declaring it, may be repeated"`
+	UndeclaredPrefix string   `long:"undeclared-prefix" choice:"pass" choice:"warn" choice:"error" default:"pass" description:"what to do with prefixes that are used without being declared, with --namespace=prefix"`
+	MatchEndNS       bool     `long:"match-end-namespace" description:"accept end elements whose prefix differs from that of their start element when both are bound to the same namespace, with --namespace=prefix"`
+
+	Strict    bool   `long:"strict" description:"reject malformed xml, the default"`
+	Lenient   bool   `long:"lenient" description:"accept malformed xml such as unquoted attributes, unclosed HTML void elements and HTML entities"`
+	AutoClose string `long:"autoclose" value-name:"ELEMENTS" description:"comma separated elements that are closed automatically when left open, e.g. br,hr,img, implies non-strict parsing"`
+	EntityMap string `long:"entity-map" value-name:"FILE" description:"JSON object mapping entity names to their replacement text"`
+	Tokenizer string `long:"tokenizer" choice:"std" choice:"fast" default:"std" description:"tokenizer of the input, encoding/xml or a faster one for strict parsing of UTF-8 documents"`
+	entities  map[string]string
+
+	Catalog []string `long:"catalog" value-name:"FILE" description:"OASIS XML catalog used to resolve external DTDs to local files for their entities, may be repeated"`
+
+	Index        string   `long:"index" value-name:"FILE" description:"index built by the index command, defaults to the input filename with an .idx suffix"`
+	RecordKey    []string `long:"record-key" value-name:"KEY" description:"use the index to read just the record with this key, may be repeated"`
+	RecordNumber []int    `long:"record-number" value-name:"N" description:"use the index to read just the Nth record, starting at 0, may be repeated"`
+
+	Verify   string `long:"verify" value-name:"ALGORITHM:FILE" description:"verify the checksum of each input against a sha256sum style manifest, e.g. sha256:inputs.sums, inputs missing from it are rejected before they are read and the others are read to the end for their checksum even when --head or --first stop early"`
+	verifier *verifier
+
+	StdinFormat string `long:"stdin-format" choice:"auto" choice:"xml" choice:"xml.gz" choice:"tar" default:"auto" description:"format of the input read from -, auto detects compression and tar archives"`
+	ReadBuffer  string `long:"read-buffer" value-name:"SIZE" description:"size of the buffers inputs are read through before and after decompression, e.g. 64KiB or 4MiB, defaults to 1MiB"`
+	readBuffer  int
+	SkipJunk    string `long:"skip-junk" value-name:"SIZE" description:"skip up to SIZE bytes before the first < of each document, such as a byte order mark, a log prefix or stray bytes, e.g. 4KiB, and report how many were skipped"`
+	skipJunk    int
+	MaxReadBPS  string `long:"max-read-bps" value-name:"BYTES" description:"read each input, before decryption and decompression, at no more than BYTES a second, e.g. 20MiB, so that long runs on shared storage leave bandwidth to others"`
+	maxReadBPS  int64
+
+	TrailingGarbage bool `long:"trailing-garbage" description:"end a document at bytes that cannot be read after its final close tag, or after the last member of a gzip file, and report them rather than failing"`
+
+	ParallelDecompress bool `long:"parallel-decompress" description:"decompress gzip inputs with pgzip, which reads ahead and checksums on other goroutines, and zstd inputs in process with several goroutines rather than with the zstd command"`
+	DecompressWorkers  int  `long:"decompress-workers" value-name:"N" description:"goroutines used by --parallel-decompress, defaults to the number of CPUs"`
+
+	TarEntry   []string `long:"tar-entry" value-name:"GLOB" default:"*.xml" default:"*.xml.gz" description:"entries of tar archives that are processed, globs without a / match the base name, may be repeated"`
+	Provenance bool     `long:"provenance" description:"add _file, and for tar entries _entry and _modified, attributes to each record"`
+
+	Decrypt           string   `long:"decrypt" choice:"auto" choice:"age" choice:"pgp" choice:"none" default:"auto" description:"decrypt inputs with the age or gpg command, auto detects encrypted inputs by their header"`
+	AgeIdentity       []string `long:"age-identity" value-name:"FILE" description:"identity file used to decrypt age inputs, may be repeated"`
+	PGPPassphraseFile string   `long:"pgp-passphrase-file" value-name:"FILE" description:"file holding the passphrase used to decrypt PGP inputs, otherwise gpg asks its agent"`
+
+	InternNames  bool     `long:"intern-names" description:"share a single copy of each element and attribute name between records, which saves memory when --tail or --sample-n keep many records"`
+	Ignore       []string `long:"ignore" value-name:"SELECTOR" description:"skip the elements matched by SELECTOR and their content wherever they are, even within records, without keeping them in memory, may be repeated"`
+	CollectDepth int      `long:"collect-depth" value-name:"N" description:"only keep the elements of each record up to N levels below it, elements whose children are left out are marked with #truncated"`
+
+	Normalize string `long:"normalize" choice:"none" choice:"nfc" choice:"nfkc" default:"none" description:"convert text and attribute values to this Unicode normalization form as they are read, so that values that only differ by their normalization compare equal"`
+
+	Middleware []string `long:"middleware" value-name:"NAME[=ARG]" description:"pass the records through processor middleware, in the order given, may be repeated: count and timing log what they measured, rate=N passes N records a second, dedupe=KEY-PATH drops records whose key was seen, validate=KEY-PATH rejects records without the key and meta=NAME=VALUE adds an attribute"`
+
+	Lang string `long:"lang" value-name:"LANG" description:"only output the records whose xml:lang, or that of their nearest ancestor with one, matches LANG as the XPath lang function does, e.g. en matches en-GB, and leave out their descendants in other languages, records without a language are kept"`
+
+	Head  int  `long:"head" value-name:"N" description:"only output the first N records and stop reading"`
+	Tail  int  `long:"tail" value-name:"N" description:"only output the last N records"`
+	First bool `long:"first" description:"only output the first record, the parser stops as soon as it is found and the inputs are closed"`
+
+	Sample     float64 `long:"sample" value-name:"RATE" description:"only output each record with this probability, e.g. 0.01"`
+	SampleN    int     `long:"sample-n" value-name:"N" description:"only output a uniform random sample of N records, kept in memory until the end"`
+	SampleSeed int64   `long:"sample-seed" value-name:"SEED" description:"seed for --sample and --sample-n, defaults to the current time"`
+
+	ExtractBinary         []string `long:"extract-binary" value-name:"SELECTOR=DIR" description:"decode the text of matching elements and write it to files in DIR, may be repeated"`
+	ExtractBinaryKey      string   `long:"extract-binary-key" default:"id" description:"attribute used to name files written by --extract-binary"`
+	ExtractBinaryEncoding string   `long:"extract-binary-encoding" choice:"base64" choice:"hex" default:"base64" description:"encoding of elements matched by --extract-binary"`
+	EmbeddedXML           []string `long:"embedded-xml" value-name:"SELECTOR" description:"parse the escaped xml text of matching elements into structure, may be repeated"`
+	DetectEmbeddedXML     bool     `long:"detect-embedded-xml" description:"parse any text that looks like escaped xml into structure"`
+
+	Exec          string        `long:"exec" value-name:"COMMAND" description:"run COMMAND with sh, or cmd on Windows, for each record, the record is passed on stdin or in a temporary file named by {} in COMMAND, what it writes to stderr is passed through"`
+	ExecCapture   bool          `long:"exec-capture" description:"write what --exec prints instead of the record, otherwise its output goes to stderr"`
+	ExecWorkers   int           `long:"exec-workers" value-name:"N" default:"1" description:"number of --exec commands run at a time, records are still written in order unless --unordered is given"`
+	Unordered     bool          `long:"unordered" description:"write each --exec record as soon as its command finishes rather than in input order"`
+	ReorderBuffer int           `long:"reorder-buffer" value-name:"N" default:"64" description:"keep up to --exec-workers plus N records in memory, running or finished and waiting for an earlier record to keep the input order, a larger N lets fast commands continue past a slow one at the cost of memory and latency"`
+	ExecRetries   int           `long:"exec-retries" value-name:"N" description:"run --exec again up to N times for a record whose command fails, for commands that load records into another system and may fail transiently"`
+	ExecBackoff   time.Duration `long:"exec-retry-backoff" value-name:"DURATION" default:"1s" description:"wait this long before the first --exec-retries retry, doubling for each retry after it up to a minute"`
+	ExecRate      float64       `long:"exec-rate" value-name:"RECORDS-PER-SECOND" description:"start at most this many --exec commands a second, retries included, so as not to overwhelm the system they load records into"`
+	ExecOnError   string        `long:"exec-on-error" choice:"fail" choice:"skip" choice:"keep" default:"fail" description:"when --exec fails stop the run, skip the record or write the record as is"`
+
+	ExplodeDir   string `long:"explode-dir" value-name:"DIR" description:"write each record to its own file in DIR rather than to stdout or --output"`
+	NameTemplate string `long:"name-template" value-name:"TEMPLATE" description:"Go template of the filename of each record in --explode-dir, with the record mapped to JSON as .Record, its number from 1 as .Index and its element name as .Name, e.g. '{{index .Record \"@id\"}}.xml', defaults to {{.Index}} with the extension of the output format"`
+
+	HashField string `long:"hash-field" value-name:"NAME" description:"add a SHA-256 hash of the content of each record as the NAME attribute, ignoring attribute order, whitespace only text and --provenance"`
+	HashPaths string `long:"hash-paths" value-name:"KEY-PATHS" description:"comma separated key paths, such as @id,title, that --hash-field and --changed-only only hash the values of"`
+
+	ChangedOnly string `long:"changed-only" value-name:"FILE" description:"only output the records whose hash differs from the one FILE holds for their key, followed by a record with _key and _deleted attributes for each key that disappeared, FILE is then updated for the next run"`
+	ChangedKey  string `long:"changed-key" value-name:"KEY-PATH" description:"key path identifying records across runs of --changed-only, such as @id"`
+
+	Enrich []string `long:"enrich" value-name:"KEY-PATH=FILE[,key=COLUMN][,prefix=PREFIX][,required]" description:"add the columns of the row of the CSV or JSON lookup FILE matching the key of each record as attributes, may be repeated"`
+
+	Rejects    string `long:"rejects" value-name:"FILE" description:"write records that cannot be transformed, mapped, validated or encoded to FILE, one JSON object per line with the error, path and offset, and carry on"`
+	RejectsDir string `long:"rejects-dir" value-name:"DIR" description:"like --rejects but write each record to a numbered XML file in DIR, with the error in a JSON file of the same name"`
+	rejects    xmlpicker.RejectSink
+
+	State       string `long:"state" value-name:"FILE" description:"write the inputs and records that were processed to FILE when the run ends, including when it is interrupted by SIGINT or SIGTERM"`
+	Resume      bool   `long:"resume" description:"skip the inputs and records that --state records as processed by an earlier run"`
+	state       runState
+	resume      runState
+	skip        int
+	interrupted int32
+	signal      atomic.Value
+
+	PprofAddr string   `long:"pprof-addr" value-name:"HOST:PORT" description:"serve the net/http/pprof profiles on this address while running"`
+	Profile   []string `long:"profile" value-name:"KIND,FILE" description:"write a profile, cpu or a runtime/pprof profile such as heap, allocs or block, to FILE when the run ends, may be repeated"`
+	profiling bool
+
+	TraceTokens bool `long:"trace-tokens" description:"write each token the parser reads to stderr with the path it is at and whether the selector matched"`
+	TraceEvery  int  `long:"trace-every" value-name:"N" default:"1" description:"only trace every Nth token with --trace-tokens"`
+	TraceLimit  int  `long:"trace-limit" value-name:"N" default:"10000" description:"stop tracing after N tokens with --trace-tokens, 0 for no limit"`
+	tracer      *tracer
+
+	position position
 }
 
-func (o *options) NewSelector() xmlpicker.Selector {
-	return xmlpicker.PathSelector(o.Selector)
+func (o *options) NewSelector() (xmlpicker.Selector, error) {
+	if o.selector != nil {
+		return o.selector, nil
+	}
+	if o.XPath != "" {
+		return xmlpicker.ParseXPath(o.XPath)
+	}
+	path, err := xmlpicker.ParsePath(o.Selector)
+	if err != nil {
+		return nil, err
+	}
+	path.ResolvePrefixes = o.ResolvePrefixes
+	return path, nil
+}
+
+// explain writes the parsed form of the selector.
+func (o *options) explain(w io.Writer) error {
+	selector, err := o.NewSelector()
+	if err != nil {
+		return err
+	}
+	path, ok := selector.(*xmlpicker.Path)
+	if !ok {
+		return fmt.Errorf("cannot explain selector %T", selector)
+	}
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "    ")
+	return e.Encode(path.Explain())
 }
 
 func (o *options) NSFlag() xmlpicker.NSFlag {
@@ -40,43 +209,359 @@ func (o *options) NSFlag() xmlpicker.NSFlag {
 	panic("Bad namespace: " + o.Namespace)
 }
 
+// Normalizer returns the Unicode normalization of --normalize, nil for none.
+func (o *options) Normalizer() xmlpicker.Normalizer {
+	switch o.Normalize {
+	case "none", "":
+		return nil
+	case "nfc":
+		return normalizer(norm.NFC)
+	case "nfkc":
+		return normalizer(norm.NFKC)
+	}
+	panic("Bad normalize: " + o.Normalize)
+}
+
+// normalizer converts strings to form, returning those already in it without copying them.
+func normalizer(form norm.Form) xmlpicker.Normalizer {
+	return func(s string) string {
+		if form.IsNormalString(s) {
+			return s
+		}
+		return form.String(s)
+	}
+}
+
+// NewTransforms returns the functions that are applied, in order, to each matched node before it is processed.
+func (o *options) NewTransforms() ([]func(*xmlpicker.Node) error, error) {
+	var transforms []func(*xmlpicker.Node) error
+	for _, v := range o.EmbeddedXML {
+		selector, err := xmlpicker.ParsePathSelector(v)
+		if err != nil {
+			return nil, err
+		}
+		x := &xmlpicker.EmbeddedXMLExpander{Selector: selector, NSFlag: o.NSFlag()}
+		transforms = append(transforms, x.Expand)
+	}
+	if o.DetectEmbeddedXML {
+		x := &xmlpicker.EmbeddedXMLExpander{Detect: true, NSFlag: o.NSFlag()}
+		transforms = append(transforms, x.Expand)
+	}
+	encoding := xmlpicker.Base64Encoding
+	if o.ExtractBinaryEncoding == "hex" {
+		encoding = xmlpicker.HexEncoding
+	}
+	for _, v := range o.ExtractBinary {
+		i := strings.LastIndex(v, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid --extract-binary %q, expected SELECTOR=DIR", v)
+		}
+		selector, err := xmlpicker.ParsePathSelector(v[:i])
+		if err != nil {
+			return nil, err
+		}
+		x := &xmlpicker.BinaryExtractor{
+			Selector: selector,
+			Dir:      v[i+1:],
+			KeyAttr:  o.ExtractBinaryKey,
+			Encoding: encoding,
+		}
+		transforms = append(transforms, x.Extract)
+	}
+	for _, v := range o.Enrich {
+		e, err := newEnricher(v)
+		if err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, e.Enrich)
+	}
+	if o.HashField != "" {
+		f, err := o.newFingerprinter()
+		if err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, f.Annotate)
+	} else if o.HashPaths != "" && o.ChangedOnly == "" {
+		return nil, fmt.Errorf("--hash-paths requires --hash-field or --changed-only")
+	}
+	return transforms, nil
+}
+
+// newFingerprinter returns the Fingerprinter of --hash-field, which --changed-only compares records with.
+func (o *options) newFingerprinter() (*xmlpicker.Fingerprinter, error) {
+	f := &xmlpicker.Fingerprinter{Field: o.HashField, Ignore: []string{"_file", "_entry", "_modified"}}
+	if o.HashPaths != "" {
+		for _, v := range strings.Split(o.HashPaths, ",") {
+			k, err := xmlpicker.ParseKeyPath(v)
+			if err != nil {
+				return nil, err
+			}
+			f.Paths = append(f.Paths, k)
+		}
+	}
+	return f, nil
+}
+
 type jsonCmd struct {
-	Options options
-	Pretty  bool `short:"p" long:"pretty" description:"generated formatted JSON"`
-	Args    struct {
+	Options     options
+	Pretty      bool          `short:"p" long:"pretty" description:"generated formatted JSON"`
+	Extract     string        `short:"e" long:"extract" description:"JSONPath expression evaluated against each record, the selected values are written one per line"`
+	Mapper      string        `long:"mapper" value-name:"NAME" default:"simple" description:"how records are mapped to JSON: simple, badgerfish, parker, ordered or custom:NAME for a mapper registered with xmlpicker.RegisterMapper"`
+	MapperOpts  []string      `long:"mapper-option" value-name:"NAME=VALUE" description:"option of the --mapper, such as flatten=true for simple, may be repeated"`
+	Mixed       bool          `long:"mixed-content" description:"map elements with both text and child elements to an ordered #content list"`
+	Flatten     bool          `long:"flatten" description:"map child elements that only have text to a string"`
+	NoFlatten   []string      `long:"no-flatten" value-name:"SELECTOR" description:"keep the structure of matching child elements with --flatten, may be repeated"`
+	InnerXML    []string      `long:"inner-xml" value-name:"SELECTOR" description:"map the content of matching child elements to an XML string under their name with an _html suffix, or to a list of strings for repeated elements, may be repeated"`
+	Positions   bool          `long:"positions" description:"add the position of child elements among their siblings of the same name, counted from 1, under _pos"`
+	XMLNS       bool          `long:"xmlns" description:"add all the namespace prefixes in scope at each record, wherever they are declared, under _xmlns"`
+	Schema      []string      `long:"schema" value-name:"FILE" description:"XML schema used to type values and to only map repeatable elements to lists, may be repeated"`
+	JSONSchema  bool          `long:"json-schema" description:"print the JSON Schema of the records instead of reading any input"`
+	Validate    string        `long:"validate-output" value-name:"FILE" description:"JSON Schema each record is checked against, a record that does not validate stops the run unless --rejects or --rejects-dir is given"`
+	Output      []string      `short:"o" long:"output" value-name:"FILE[,on-error=fail|skip|drop]" description:"write the records to FILE rather than stdout, may be repeated to write each record to several files, on-error decides whether a failing output stops the run, skips the record or is dropped"`
+	Batch       int           `long:"batch" value-name:"N" description:"write the records as JSON arrays of N records, one per line, as bulk APIs expect"`
+	BatchWindow time.Duration `long:"batch-window" value-name:"DURATION" description:"with --batch, also write a batch once it is this old, e.g. 5s, so that records read slowly are not held back"`
+	Args        struct {
 		Filenames []string `required:"1" positional-arg-name:"file"`
 	} `positional-args:"yes"`
 }
 
 func (c *jsonCmd) Execute(_ []string) error {
-	p := newJSONProcessor(os.Stdout)
+	mapper, err := c.newMapper()
+	if err != nil {
+		return err
+	}
+	if c.JSONSchema {
+		return c.writeJSONSchema(mapper)
+	}
+	c.Options.preserveSpace = preservesSpace(mapper)
+	if c.Options.ExplodeDir != "" {
+		if c.Batch != 0 {
+			return fmt.Errorf("--explode-dir cannot be combined with --batch")
+		}
+		p, err := c.Options.newExplodeProcessor(c.Output, ".json", mapper, c.newRecordProcessor)
+		if err != nil {
+			return err
+		}
+		return mainImpl(&c.Options, c.Args.Filenames, p)
+	}
+	p, err := c.Options.openRoutes(c.Output, c.newProcessor)
+	if err != nil {
+		return err
+	}
+	return mainImpl(&c.Options, c.Args.Filenames, p)
+}
+
+func (c *jsonCmd) newProcessor(w io.Writer) (processor, error) {
+	return c.Options.newExecProcessor(c.Options.outputWriter(w), c.newRecordProcessor)
+}
+
+func (c *jsonCmd) newRecordProcessor(w io.Writer) (processor, error) {
+	p := newJSONProcessor(w)
 	if c.Pretty {
 		p.encoder.SetIndent("", "    ")
 	}
-	return mainImpl(&c.Options, c.Args.Filenames, p)
+	var err error
+	if p.mapper, err = c.newMapper(); err != nil {
+		return nil, err
+	}
+	if c.Extract != "" {
+		if p.extract, err = xmlpicker.CompileJSONPath(c.Extract); err != nil {
+			return nil, err
+		}
+	}
+	if c.Validate != "" {
+		if p.validator, err = loadJSONSchemaValidator(c.Validate); err != nil {
+			return nil, err
+		}
+	}
+	if c.Batch < 0 {
+		return nil, fmt.Errorf("--batch must not be negative")
+	}
+	if c.Batch > 0 {
+		if c.Extract != "" || c.Options.Exec != "" {
+			return nil, fmt.Errorf("--batch cannot be combined with --extract or --exec")
+		}
+		p.batch = &xmlpicker.BatchingProcessor{Size: c.Batch, Window: c.BatchWindow, Sink: p.writeBatch}
+	}
+	return p, nil
+}
+
+// preservesSpace reports whether mapper maps the whitespace around text, which the parser then keeps.
+func preservesSpace(mapper xmlpicker.Mapper) bool {
+	switch m := mapper.(type) {
+	case xmlpicker.SimpleMapper:
+		return m.MixedContent || len(m.InnerXML) != 0
+	case xmlpicker.OrderedMapper, xmlpicker.BadgerFishMapper:
+		return true
+	}
+	return false
+}
+
+func (c *jsonCmd) newMapper() (xmlpicker.Mapper, error) {
+	options := make(map[string]string, len(c.MapperOpts))
+	for _, v := range c.MapperOpts {
+		i := strings.Index(v, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid --mapper-option %q, expected NAME=VALUE", v)
+		}
+		options[v[:i]] = v[i+1:]
+	}
+	if c.Mapper != "simple" {
+		if len(c.Schema) != 0 || c.Mixed || c.Flatten || len(c.NoFlatten) != 0 || len(c.InnerXML) != 0 || c.Positions || c.XMLNS {
+			return nil, fmt.Errorf("--mapper=%s cannot be combined with --schema, --mixed-content, --flatten, --no-flatten, --inner-xml, --positions or --xmlns", c.Mapper)
+		}
+		return xmlpicker.NewMapper(strings.TrimPrefix(c.Mapper, "custom:"), options)
+	}
+	if len(c.Schema) != 0 {
+		if c.Mixed || c.Flatten || len(c.InnerXML) != 0 || c.Positions || c.XMLNS || len(c.MapperOpts) != 0 {
+			return nil, fmt.Errorf("--schema cannot be combined with --mixed-content, --flatten, --inner-xml, --positions, --xmlns or --mapper-option")
+		}
+		schema, err := xmlpicker.LoadSchema(c.Schema...)
+		if err != nil {
+			return nil, err
+		}
+		return xmlpicker.SchemaMapper{Schema: schema}, nil
+	}
+	m, err := xmlpicker.NewMapper("simple", options)
+	if err != nil {
+		return nil, err
+	}
+	mapper := m.(xmlpicker.SimpleMapper)
+	mapper.MixedContent = mapper.MixedContent || c.Mixed
+	mapper.FlattenText = mapper.FlattenText || c.Flatten
+	mapper.Positions = mapper.Positions || c.Positions
+	mapper.InScopeNamespaces = mapper.InScopeNamespaces || c.XMLNS
+	for _, v := range c.NoFlatten {
+		selector, err := xmlpicker.ParsePathSelector(v)
+		if err != nil {
+			return nil, err
+		}
+		mapper.NoFlatten = append(mapper.NoFlatten, selector)
+	}
+	for _, v := range c.InnerXML {
+		selector, err := xmlpicker.ParsePathSelector(v)
+		if err != nil {
+			return nil, err
+		}
+		mapper.InnerXML = append(mapper.InnerXML, selector)
+	}
+	return mapper, nil
+}
+
+// writeJSONSchema describes the records the mapper produces for the selector.
+func (c *jsonCmd) writeJSONSchema(mapper xmlpicker.Mapper) error {
+	d, ok := mapper.(xmlpicker.JSONSchemaDescriber)
+	if !ok {
+		return fmt.Errorf("cannot describe the records of %T", mapper)
+	}
+	selector, err := c.Options.NewSelector()
+	if err != nil {
+		return err
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "    ")
+	return e.Encode(d.JSONSchema(selector))
 }
 
 type xmlCmd struct {
 	Options           options
-	Pretty            bool   `short:"p" long:"pretty" description:"generated formatted XML"`
-	ContainerXml      string `long:"container-xml" description:"xml container for output elements, if empty output each one in its original position"`
-	ContainerSelector string `long:"container-selector" description:"used to find the first matching path in --container-xml' when generating the output, the rest of container-xml is ignored"`
-	Args              struct {
+	Pretty            bool     `short:"p" long:"pretty" description:"generated formatted XML"`
+	ContainerXml      string   `long:"container-xml" description:"xml container for output elements, if empty output each one in its original position, its attribute values may use the placeholders of --summary-xml, {{.RecordCount}} and {{.SHA256}} hold back the output until all records are written"`
+	ContainerSelector string   `long:"container-selector" description:"used to find the first matching path in --container-xml' when generating the output, the rest of container-xml is ignored"`
+	SummaryXml        string   `long:"summary-xml" description:"xml element written in --container-xml after the records, its attribute values and text may use {{.RecordCount}}, {{.SHA256}} of the records, {{join .Files \" \"}} and {{now}}"`
+	NSPrefix          []string `long:"ns-prefix" value-name:"PREFIX=URI" description:"write the namespace URI with this prefix in every record, may be repeated"`
+	InvalidChars      string   `long:"invalid-chars" choice:"replace" choice:"strip" choice:"escape" choice:"error" description:"what to do with characters that XML does not allow in text and attribute values, such as control characters: replace them with U+FFFD, strip them, write character references where the XML version allows them or stop with an error, defaults to escape with --xml-version=1.1 and replace otherwise"`
+	XMLVersion        string   `long:"xml-version" choice:"1.0" choice:"1.1" default:"1.0" description:"XML version written, 1.1 starts the output with its declaration and writes control characters as character references"`
+	MergeAncestors    bool     `long:"merge-ancestors" description:"write consecutive records that have the same ancestors under a single copy of them rather than repeating them for each record"`
+	Output            []string `short:"o" long:"output" value-name:"FILE[,on-error=fail|skip|drop]" description:"write the records to FILE rather than stdout, may be repeated to write each record to several files, on-error decides whether a failing output stops the run, skips the record or is dropped"`
+	// detach is set by merge
+	detach bool
+	Args   struct {
 		Filenames []string `required:"1" positional-arg-name:"file"`
 	} `positional-args:"yes"`
 }
 
 func (c *xmlCmd) Execute(_ []string) error {
-	p := newXMLProcessor(os.Stdout)
+	if len(c.Options.Route) == 0 {
+		selector, err := c.Options.NewSelector()
+		if err != nil {
+			return err
+		}
+		if s, ok := selector.(xmlpicker.AttributeSelector); ok {
+			if name, ok := s.SelectsAttribute(); ok {
+				return fmt.Errorf("the xml command cannot write the value of attribute %s, select its element or use the json command", name)
+			}
+		}
+	}
+	if c.Options.ExplodeDir != "" {
+		if c.ContainerXml != "" || c.MergeAncestors {
+			return fmt.Errorf("--explode-dir cannot be combined with --container-xml or --merge-ancestors")
+		}
+		p, err := c.Options.newExplodeProcessor(c.Output, ".xml", xmlpicker.SimpleMapper{}, c.newRecordProcessor)
+		if err != nil {
+			return err
+		}
+		return mainImpl(&c.Options, c.Args.Filenames, p)
+	}
+	p, err := c.Options.openRoutes(c.Output, c.newProcessor)
+	if err != nil {
+		return err
+	}
+	return mainImpl(&c.Options, c.Args.Filenames, p)
+}
+
+func (c *xmlCmd) newProcessor(w io.Writer) (processor, error) {
+	if c.Options.Exec != "" && c.ContainerXml != "" {
+		return nil, fmt.Errorf("--exec cannot be combined with --container-xml")
+	}
+	if c.MergeAncestors && c.ContainerXml != "" {
+		return nil, fmt.Errorf("--merge-ancestors cannot be combined with --container-xml")
+	}
+	if c.MergeAncestors && c.Options.Exec != "" {
+		return nil, fmt.Errorf("--merge-ancestors cannot be combined with --exec")
+	}
+	return c.Options.newExecProcessor(c.Options.outputWriter(w), c.newRecordProcessor)
+}
+
+func (c *xmlCmd) newRecordProcessor(w io.Writer) (processor, error) {
+	p := newXMLProcessor(w)
+	p.detach = c.detach
 	var err error
 	p.containerNode, err = c.createContainerNode()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if p.summaryNode, err = c.createSummaryNode(); err != nil {
+		return nil, err
+	}
+	if err := p.setUpTemplates(w, c.Args.Filenames); err != nil {
+		return nil, err
+	}
+	if p.exporter.Prefixes, err = parseNSPrefixes(c.NSPrefix); err != nil {
+		return nil, err
+	}
+	if c.MergeAncestors {
+		p.paths = xmlpicker.NewPathWriter(p.exporter)
+	}
+	if c.XMLVersion == "1.1" {
+		p.exporter.Version = c.XMLVersion
+		p.exporter.InvalidChars = xmlpicker.InvalidCharEscape
+	}
+	switch c.InvalidChars {
+	case "replace":
+		p.exporter.InvalidChars = xmlpicker.InvalidCharReplace
+	case "strip":
+		p.exporter.InvalidChars = xmlpicker.InvalidCharStrip
+	case "escape":
+		p.exporter.InvalidChars = xmlpicker.InvalidCharEscape
+	case "error":
+		p.exporter.InvalidChars = xmlpicker.InvalidCharError
 	}
 	if c.Pretty {
 		p.exporter.Encoder.Indent("", "    ")
 	}
-	return mainImpl(&c.Options, c.Args.Filenames, p)
+	return p, nil
 }
 
 func (c *xmlCmd) createContainerNode() (*xmlpicker.Node, error) {
@@ -88,7 +573,11 @@ func (c *xmlCmd) createContainerNode() (*xmlpicker.Node, error) {
 	decoder.Strict = true
 	//TODO Add dependency on "golang.org/x/net/html/charset" for more charset support
 	//decoder.CharsetReader = charset.NewReaderLabel
-	parser := xmlpicker.NewParser(decoder, xmlpicker.PathSelector(c.ContainerSelector))
+	selector, err := xmlpicker.ParsePathSelector(c.ContainerSelector)
+	if err != nil {
+		return nil, err
+	}
+	parser := xmlpicker.NewParser(decoder, selector)
 	parser.NSFlag = c.Options.NSFlag()
 	node, err := parser.Next()
 	if err != nil {
@@ -97,62 +586,448 @@ func (c *xmlCmd) createContainerNode() (*xmlpicker.Node, error) {
 	return node, nil
 }
 
+// createSummaryNode parses --summary-xml.
+func (c *xmlCmd) createSummaryNode() (*xmlpicker.Node, error) {
+	if c.SummaryXml == "" {
+		return nil, nil
+	}
+	if c.ContainerXml == "" {
+		return nil, fmt.Errorf("--summary-xml requires --container-xml")
+	}
+	decoder := xml.NewDecoder(strings.NewReader(c.SummaryXml))
+	decoder.Strict = true
+	parser := xmlpicker.NewParser(decoder, xmlpicker.PathSelector("/"))
+	parser.NSFlag = c.Options.NSFlag()
+	node, err := parser.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid --summary-xml: %s", err)
+	}
+	return node, nil
+}
+
+// parseNSPrefixes returns the namespace URI to prefix table given by --ns-prefix.
+func parseNSPrefixes(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	prefixes := make(map[string]string, len(specs))
+	used := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		i := strings.Index(spec, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid --ns-prefix %q, expected PREFIX=URI", spec)
+		}
+		prefix, uri := spec[:i], spec[i+1:]
+		if prefix == "" || uri == "" || strings.ContainsAny(prefix, ": ") || strings.HasPrefix(strings.ToLower(prefix), "xml") {
+			return nil, fmt.Errorf("invalid --ns-prefix %q", spec)
+		}
+		if _, ok := prefixes[uri]; ok || used[prefix] {
+			return nil, fmt.Errorf("duplicate --ns-prefix %q", spec)
+		}
+		prefixes[uri] = prefix
+		used[prefix] = true
+	}
+	return prefixes, nil
+}
+
 func main() {
-	parser := flags.NewParser(&cmds{}, flags.Default)
-	_, err := parser.Parse()
+	args, err := applyConfig(os.Args[1:])
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	parser := flags.NewParser(&cmds{}, flags.Default)
+	if _, err := parser.ParseArgs(args); err != nil {
 		if _, ok := err.(*flags.Error); ok {
 			os.Exit(2)
 		}
-		panic(err)
+		if e, ok := err.(exitCoder); ok {
+			os.Exit(e.exitCode())
+		}
+		// the error was printed to stderr by the parser
+		os.Exit(1)
 	}
 }
 
+// exitCoder is implemented by errors that end the program with their own exit code rather than a panic, the error
+// is printed by the flags parser.
+type exitCoder interface {
+	exitCode() int
+}
+
 func mainImpl(o *options, fs []string, proc processor) error {
+	o.configureLogging()
+	if o.Explain {
+		return o.explain(os.Stdout)
+	}
+	if o.SampleSeed == 0 {
+		o.SampleSeed = time.Now().UnixNano()
+	}
+	var err error
+	if o.readBuffer, err = o.readBufferSize(); err != nil {
+		return err
+	}
+	if o.SkipJunk != "" {
+		if o.skipJunk, err = o.skipJunkLimit(); err != nil {
+			return err
+		}
+	}
+	if o.maxReadBPS, err = o.maxReadRate(); err != nil {
+		return err
+	}
+	if o.Verify != "" {
+		if o.verifier, err = newVerifier(o.Verify); err != nil {
+			return err
+		}
+	}
+	closeRejects, err := o.openRejects()
+	if err != nil {
+		return err
+	}
+	defer closeRejects()
+	if proc, err = o.wrapChanged(proc); err != nil {
+		return err
+	}
+	if proc, err = o.wrapMiddleware(proc); err != nil {
+		return err
+	}
+	// records kept by --tail and --sample-n are only processed once all input is read and cannot be located
+	proc = o.wrapRejects(proc, o.Tail == 0 && o.SampleN == 0)
+	proc, err = o.wrapHeadTail(proc)
+	if err != nil {
+		return err
+	}
+	if proc, err = o.wrapSampling(proc); err != nil {
+		return err
+	}
+	proc = o.wrapLang(proc)
+	if err := o.loadState(); err != nil {
+		return err
+	}
+	stopProfiling, err := o.startProfiling()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := stopProfiling(); err != nil {
+			errorf("%s", err)
+		}
+	}()
+	defer o.watchSignals()()
 	if err := proc.Begin(); err != nil {
 		return err
 	}
+	interrupted := false
 	for _, f := range fs {
-		if err := parse(f, o, proc); err != nil {
+		if !o.resumeFile(f) {
+			debugf("skipping %s, processed by an earlier run", f)
+			continue
+		}
+		debugf("reading %s", f)
+		if err := parse(f, o, proc); err == errStop {
+			break
+		} else if err == errInterrupted {
+			interrupted = true
+			break
+		} else if err != nil {
+			o.writeState()
 			return err
 		}
+		o.completeFile(f)
+	}
+	// output is finished, closing any container element, even when interrupted
+	if err := proc.Finish(); err != nil {
+		return err
+	}
+	if err := o.writeState(); err != nil {
+		return err
 	}
-	return proc.Finish()
+	if interrupted {
+		return o.interruptedError()
+	}
+	return nil
 }
 
 func parse(filename string, o *options, proc processor) error {
+	if o.UsesIndex() {
+		return parseIndexed(filename, o, proc)
+	}
+	v := o.verifier
+	var expected string
+	if v != nil {
+		// an input missing from the manifest is rejected before any of its records are processed
+		var err error
+		if expected, err = v.expected(filename); err != nil {
+			return err
+		}
+	}
 	raw, err := open(filename)
 	if err != nil {
 		return err
 	}
+	raw = o.throttle(raw)
 	defer raw.Close()
-	reader, err := autoDecompress(raw)
+	var digest *digestReader
+	if v != nil {
+		digest = v.wrap(raw)
+		raw = digest
+	}
+	decrypted, err := autoDecrypt(raw, o)
+	if err != nil {
+		return err
+	}
+	defer decrypted.Close()
+	format := "auto"
+	if filename == "-" {
+		format = o.StdinFormat
+	}
+	d := o.decompression()
+	d.name = filename
+	reader, err := decompress(decrypted, format, d)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
-	decoder := xml.NewDecoder(reader)
-	decoder.Strict = true
-	//TODO Add dependency on "golang.org/x/net/html/charset" for more charset support
-	//decoder.CharsetReader = charset.NewReaderLabel
-	parser := xmlpicker.NewParser(decoder, o.NewSelector())
-	parser.NSFlag = o.NSFlag()
+	stop := parseInput(reader, filename, format, o, proc)
+	if stop != nil && stop != errStop && stop != errInterrupted {
+		return stop
+	}
+	if v != nil {
+		// stop decompressing and decrypting before reading the rest of the input for the digest
+		reader.Close()
+		decrypted.Close()
+		if err := v.check(filename, digest, expected); err != nil {
+			return err
+		}
+	}
+	return stop
+}
+
+// parseInput processes each document of a tar archive, or the input itself if it is not one. Unless format is
+// "auto" tar archives are not detected.
+func parseInput(r io.Reader, filename, format string, o *options, proc processor) error {
+	br := bufio.NewReaderSize(r, o.readBuffer)
+	if format == "tar" || (format == "auto" && isTar(br)) {
+		return parseTar(br, filename, o, proc)
+	}
+	return parseDocument(br, &source{file: filename}, o, proc)
+}
+
+func parseDocument(r io.Reader, src *source, o *options, proc processor) error {
+	r, skipped, err := o.skipLeadingJunk(r, src)
+	if err != nil {
+		return err
+	}
+	parser, err := newParser(r, o)
+	if err != nil {
+		return err
+	}
+	transforms, err := o.NewTransforms()
+	if err != nil {
+		return err
+	}
+	if o.Provenance {
+		transforms = append([]func(*xmlpicker.Node) error{src.annotate}, transforms...)
+	}
+	// the errors of transforms are rejected here, along with those of proc
+	next := o.rejecting(xmlpicker.ProcessorFunc(func(n *xmlpicker.Node) error {
+		return process(n, transforms, proc)
+	}), true)
 	for {
+		if err := o.checkInterrupted(); err != nil {
+			return err
+		}
 		n, err := parser.Next()
 		if err == io.EOF {
-			break
+			if offset, garbage := parser.Garbage(); garbage != nil {
+				warnf("ignored trailing garbage of %s at offset %d: %s", src.name(), offset+skipped, garbage)
+			}
+			return nil
 		}
 		if err != nil {
 			return err
 		}
-		if err := proc.Process(n); err != nil {
+		o.position = position{file: src.file, entry: src.entry}
+		o.position.start, o.state.Offset = parser.Offsets()
+		// the offsets are those of the input, including the bytes skipped with --skip-junk
+		o.position.start += skipped
+		o.state.Offset += skipped
+		o.state.Records++
+		if o.skip > 0 {
+			o.skip--
+			continue
+		}
+		if err := next.Process(n); err != nil {
+			if _, ok := err.(*xmlpicker.RecordError); ok {
+				return fmt.Errorf("invalid record %s in %s: %s", n.Path(), o.position, err)
+			}
 			return err
 		}
 		n.Parent = nil // ensure parser doesn't care if we overwrite this value
 	}
+}
+
+func newParser(r io.Reader, o *options) (*xmlpicker.Parser, error) {
+	if o.Tokenizer == "fast" {
+		tokenizer, err := o.newTokenizer(r)
+		if err != nil {
+			return nil, err
+		}
+		selector, err := o.NewSelector()
+		if err != nil {
+			return nil, err
+		}
+		return o.configureParser(xmlpicker.NewTokenParser(tokenizer, selector))
+	}
+	decoder := xml.NewDecoder(r)
+	if err := o.configureDecoder(decoder); err != nil {
+		return nil, err
+	}
+	//TODO Add dependency on "golang.org/x/net/html/charset" for more charset support
+	//decoder.CharsetReader = charset.NewReaderLabel
+	selector, err := o.NewSelector()
+	if err != nil {
+		return nil, err
+	}
+	return o.configureParser(xmlpicker.NewParser(decoder, selector))
+}
+
+// configureParser applies the options that do not depend on the tokenizer.
+func (o *options) configureParser(parser *xmlpicker.Parser) (*xmlpicker.Parser, error) {
+	var err error
+	parser.NSFlag = o.NSFlag()
+	parser.FirstMatchOnly = o.First
+	parser.TrailingGarbage = o.TrailingGarbage
+	parser.PreserveSpace = o.preserveSpace
+	if o.CollectDepth < 0 {
+		return nil, fmt.Errorf("--collect-depth must not be negative")
+	}
+	parser.CollectDepth = o.CollectDepth
+	for _, v := range o.Ignore {
+		selector, err := xmlpicker.ParsePathSelector(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --ignore %s: %s", v, err)
+		}
+		parser.Ignore = append(parser.Ignore, selector)
+	}
+	parser.InternNames = o.InternNames
+	parser.Normalize = o.Normalizer()
+	for _, v := range strings.Split(o.AutoClose, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			parser.AutoClose = append(parser.AutoClose, v)
+		}
+	}
+	if err := o.configurePrefixes(parser); err != nil {
+		return nil, err
+	}
+	if err := o.configureTrace(parser); err != nil {
+		return nil, err
+	}
+	if len(o.Catalog) != 0 {
+		if parser.Catalog, err = xmlpicker.LoadCatalog(o.Catalog...); err != nil {
+			return nil, err
+		}
+	}
+	return parser, nil
+}
+
+// configureDecoder applies --strict, --lenient and --entity-map.
+func (o *options) configureDecoder(decoder *xml.Decoder) error {
+	if o.Strict && (o.Lenient || o.AutoClose != "") {
+		return fmt.Errorf("--strict cannot be combined with --lenient or --autoclose")
+	}
+	decoder.Strict = !o.Lenient && o.AutoClose == ""
+	entities := make(map[string]string)
+	if o.Lenient {
+		decoder.AutoClose = xml.HTMLAutoClose
+		for k, v := range xml.HTMLEntity {
+			entities[k] = v
+		}
+	}
+	if err := o.loadEntities(); err != nil {
+		return err
+	}
+	for k, v := range o.entities {
+		entities[k] = v
+	}
+	if len(entities) != 0 {
+		decoder.Entity = entities
+	}
+	return nil
+}
+
+// newTokenizer returns the Tokenizer of --tokenizer fast, with the entities of --entity-map.
+func (o *options) newTokenizer(r io.Reader) (*xmlpicker.Tokenizer, error) {
+	if o.Lenient || o.AutoClose != "" {
+		return nil, fmt.Errorf("--tokenizer fast cannot be combined with --lenient or --autoclose")
+	}
+	if err := o.loadEntities(); err != nil {
+		return nil, err
+	}
+	tokenizer := xmlpicker.NewTokenizer(r)
+	if len(o.entities) != 0 {
+		tokenizer.Entity = make(map[string]string, len(o.entities))
+		for k, v := range o.entities {
+			tokenizer.Entity[k] = v
+		}
+	}
+	return tokenizer, nil
+}
+
+// loadEntities reads --entity-map, once.
+func (o *options) loadEntities() error {
+	if o.EntityMap == "" || o.entities != nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile(o.EntityMap)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &o.entities); err != nil {
+		return fmt.Errorf("invalid --entity-map %s: %s", o.EntityMap, err)
+	}
 	return nil
 }
 
+// configurePrefixes sets up the handling of prefixes from --ns-declare, --undeclared-prefix and --match-end-namespace.
+func (o *options) configurePrefixes(parser *xmlpicker.Parser) error {
+	switch o.UndeclaredPrefix {
+	case "warn":
+		parser.UndeclaredPrefixes = xmlpicker.PrefixWarn
+	case "error":
+		parser.UndeclaredPrefixes = xmlpicker.PrefixError
+	}
+	parser.MatchEndNamespaces = o.MatchEndNS
+	parser.Warn = func(err error) {
+		warnf("%s", err)
+	}
+	if len(o.NSDeclare) == 0 {
+		return nil
+	}
+	namespaces := make(xmlpicker.Namespaces, len(o.NSDeclare))
+	for _, spec := range o.NSDeclare {
+		i := strings.Index(spec, "=")
+		if i <= 0 || i == len(spec)-1 {
+			return fmt.Errorf("invalid --ns-declare %q, expected PREFIX=URI", spec)
+		}
+		namespaces[spec[:i]] = spec[i+1:]
+	}
+	parser.ResolvePrefix = func(prefix string) (string, bool) {
+		ns, ok := namespaces[prefix]
+		return ns, ok
+	}
+	return nil
+}
+
+func process(n *xmlpicker.Node, transforms []func(*xmlpicker.Node) error, proc processor) error {
+	for _, transform := range transforms {
+		if err := transform(n); err != nil {
+			return &xmlpicker.RecordError{Stage: "transform", Err: err}
+		}
+	}
+	return proc.Process(n)
+}
+
 type processor interface {
 	Begin() error
 	Process(node *xmlpicker.Node) error
@@ -160,17 +1035,26 @@ type processor interface {
 }
 
 func newJSONProcessor(w io.Writer) *jsonProcessor {
-	e := json.NewEncoder(w)
-	e.SetEscapeHTML(false)
-	return &jsonProcessor{
-		encoder: e,
-		mapper:  xmlpicker.SimpleMapper{},
+	p := &jsonProcessor{
+		writer: w,
+		mapper: xmlpicker.SimpleMapper{},
 	}
+	p.encoder = json.NewEncoder(&p.buf)
+	p.encoder.SetEscapeHTML(false)
+	return p
 }
 
 type jsonProcessor struct {
+	writer  io.Writer
 	encoder *json.Encoder
 	mapper  xmlpicker.Mapper
+	extract *xmlpicker.JSONPath
+
+	validator *xmlpicker.JSONSchemaValidator
+	// batch collects the records of --batch
+	batch *xmlpicker.BatchingProcessor
+	// records are encoded to buf first so that encoding errors can be told apart from write errors
+	buf bytes.Buffer
 }
 
 func (p *jsonProcessor) Begin() error {
@@ -180,19 +1064,58 @@ func (p *jsonProcessor) Begin() error {
 func (p *jsonProcessor) Process(node *xmlpicker.Node) error {
 	v, err := p.mapper.FromNode(node)
 	if err != nil {
-		return err
+		return &xmlpicker.RecordError{Stage: "map", Err: err}
 	}
-	return p.encoder.Encode(v)
+	if p.validator != nil {
+		if err := p.validator.Validate(v); err != nil {
+			return &xmlpicker.RecordError{Stage: "validate", Err: err, Record: v}
+		}
+	}
+	if p.batch != nil {
+		return p.batch.Add(v)
+	}
+	p.buf.Reset()
+	if p.extract == nil {
+		if err := p.encoder.Encode(v); err != nil {
+			return &xmlpicker.RecordError{Stage: "encode", Err: err, Record: v}
+		}
+	} else {
+		for _, value := range p.extract.Find(v) {
+			// strings are written as is, anything else as JSON
+			if s, ok := value.(string); ok {
+				p.buf.WriteString(s + "\n")
+				continue
+			}
+			if err := p.encoder.Encode(value); err != nil {
+				return &xmlpicker.RecordError{Stage: "encode", Err: err, Record: v}
+			}
+		}
+	}
+	_, err = p.writer.Write(p.buf.Bytes())
+	return err
 }
 
 func (p *jsonProcessor) Finish() error {
+	if p.batch != nil {
+		return p.batch.Flush()
+	}
 	return nil
 }
 
+// writeBatch writes the records of a batch as a JSON array.
+func (p *jsonProcessor) writeBatch(batch []interface{}) error {
+	p.buf.Reset()
+	if err := p.encoder.Encode(batch); err != nil {
+		return &xmlpicker.RecordError{Stage: "encode", Err: err}
+	}
+	_, err := p.writer.Write(p.buf.Bytes())
+	return err
+}
+
 func newXMLProcessor(w io.Writer) *xmlProcessor {
 	return &xmlProcessor{
 		writer:   w,
-		exporter: &xmlpicker.XMLExporter{Encoder: xml.NewEncoder(w)},
+		exporter: xmlpicker.NewXMLExporter(w),
 	}
 }
 
@@ -200,28 +1123,67 @@ type xmlProcessor struct {
 	writer        io.Writer
 	exporter      *xmlpicker.XMLExporter
 	containerNode *xmlpicker.Node
+	summaryNode   *xmlpicker.Node
+	// templates are the values of the container with placeholders, summaryTemplates those of the summary and data
+	// what they are executed with. When the container needs the records to be written first its start is kept in head
+	// and the records in deferred. The encoder writes through switcher when there are templates or a summary.
+	templates        []*containerTemplate
+	summaryTemplates []*containerTemplate
+	data             containerData
+	head             bytes.Buffer
+	deferred         *os.File
+	switcher         *switchWriter
+	// paths keeps the ancestors of the last record, last, open with --merge-ancestors
+	paths *xmlpicker.PathWriter
+	last  *xmlpicker.Node
+	// detach moves the records into the container with the namespaces declared by their ancestors, as merge does
+	detach bool
 }
 
 func (p *xmlProcessor) Begin() error {
-	if p.containerNode != nil {
-		if err := p.exporter.StartPath(p.containerNode); err != nil {
+	if p.exporter.Version != "" {
+		// the declaration is on a line of its own, before the container or the first record
+		if err := p.exporter.EncodeDeclaration(); err != nil {
+			return err
+		}
+		if err := p.exporter.Encoder.Flush(); err != nil {
+			return err
+		}
+		if _, err := p.writer.Write([]byte{'\n'}); err != nil {
 			return err
 		}
 	}
-	return nil
+	if p.containerNode == nil {
+		return nil
+	}
+	if p.switcher != nil {
+		return p.beginContainer()
+	}
+	return p.exporter.StartPath(p.containerNode)
 }
 
 func (p *xmlProcessor) Process(node *xmlpicker.Node) error {
+	if p.paths != nil {
+		return p.processMerged(node)
+	}
 	if p.containerNode == nil {
 		if err := p.exporter.StartPath(node.Parent); err != nil {
 			return err
 		}
 	} else {
+		if p.detach {
+			node = node.Detach()
+			// a record in no namespace must not end up in the default namespace of the container
+			if _, ok := node.Namespaces[""]; !ok && node.Namespaces != nil && p.containerNode.InScopeNamespaces()[""] != "" {
+				node.Namespaces[""] = ""
+			}
+		}
 		node.Parent = p.containerNode
 	}
 	if err := p.exporter.EncodeNode(node); err != nil {
 		return err
 	}
+	p.data.count = p.data.count + 1
 	if p.containerNode == nil {
 		if err := p.exporter.EndPath(node.Parent); err != nil {
 			return err
@@ -237,7 +1199,61 @@ func (p *xmlProcessor) Process(node *xmlpicker.Node) error {
 	return nil
 }
 
+// processMerged writes node under the ancestors of the previous record that it shares with it. The open ancestors are
+// ended, followed by a newline, when node does not share the outermost one.
+func (p *xmlProcessor) processMerged(node *xmlpicker.Node) error {
+	path := p.paths.Path()
+	if len(path) != 0 && (node.Parent.Parent == nil || !hasAncestor(node.Parent, path[0])) {
+		if err := p.endMerged(); err != nil {
+			return err
+		}
+	}
+	if err := p.paths.SwitchPath(p.last, node.Parent); err != nil {
+		return err
+	}
+	p.last = node.Parent
+	if err := p.exporter.EncodeNode(node); err != nil {
+		return err
+	}
+	p.data.count = p.data.count + 1
+	if len(p.paths.Path()) == 0 {
+		return p.endMerged()
+	}
+	return nil
+}
+
+// endMerged ends the open ancestors and writes the newline that follows each top level element.
+func (p *xmlProcessor) endMerged() error {
+	if err := p.paths.Close(); err != nil {
+		return err
+	}
+	p.last = nil
+	if err := p.exporter.Encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := p.writer.Write([]byte{'\n'})
+	return err
+}
+
+// hasAncestor reports whether ancestor is node or one of its ancestors.
+func hasAncestor(node, ancestor *xmlpicker.Node) bool {
+	for n := node; n != nil; n = n.Parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *xmlProcessor) Finish() error {
+	if p.switcher != nil {
+		return p.finishContainer()
+	}
+	if p.paths != nil && p.last != nil {
+		if err := p.endMerged(); err != nil {
+			return err
+		}
+	}
 	if p.containerNode != nil {
 		if err := p.exporter.EndPath(p.containerNode); err != nil {
 			return err
@@ -251,18 +1267,32 @@ func open(filename string) (io.ReadCloser, error) {
 	if filename == "-" {
 		return ioutil.NopCloser(os.Stdin), nil
 	}
-	return os.Open(filename)
+	return os.Open(longPath(filename))
 }
 
-// Wraps the reader to decompress if the gzip header is detected, the returned Reader should be closed.
-func autoDecompress(source io.Reader) (io.ReadCloser, error) {
-	br := bufio.NewReader(source)
-	h, err := br.Peek(2)
-	if err != nil {
+// Wraps the reader to decompress it as required by format, the returned Reader should be closed.
+func decompress(source io.Reader, format string, d decompression) (io.ReadCloser, error) {
+	switch format {
+	case "xml":
+		return ioutil.NopCloser(source), nil
+	case "xml.gz":
+		return d.newGzipReader(bufio.NewReaderSize(source, d.bufferSize))
+	}
+	return autoDecompress(source, d)
+}
+
+// Wraps the reader to decompress if the gzip or zstd header is detected, the returned Reader should be closed.
+func autoDecompress(source io.Reader, d decompression) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(source, d.bufferSize)
+	h, err := br.Peek(4)
+	if len(h) < 2 {
 		return nil, err
 	}
-	if h[0] != 0x1f || h[1] != 0x8b {
-		return ioutil.NopCloser(br), nil
+	if h[0] == 0x1f && h[1] == 0x8b {
+		return d.newGzipReader(br)
+	}
+	if len(h) == 4 && h[0] == 0x28 && h[1] == 0xb5 && h[2] == 0x2f && h[3] == 0xfd {
+		return d.newZstdReader(br)
 	}
-	return gzip.NewReader(br)
+	return ioutil.NopCloser(br), nil
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles writes files, keyed by their name, to a new temporary directory that the caller removes.
+func writeFiles(t *testing.T, files map[string]string) (string, bool) {
+	dir, err := ioutil.TempDir("", "xmlpicker")
+	if !assert.NoError(t, err) {
+		return "", false
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0777)) || !assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0666)) {
+			os.RemoveAll(dir)
+			return "", false
+		}
+	}
+	return dir, true
+}
+
+// jsonRecord returns the line the json command writes for an i element with the attribute id.
+func jsonRecord(id string) string {
+	return "{\"@id\":\"" + id + "\",\"_name\":\"i\",\"_namespaces\":{}}\n"
+}
+
+// runCommand parses args into c and executes it in dir, returning what it wrote to stdout and stderr.
+func runCommand(dir string, c flags.Commander, args ...string) (string, string, error) {
+	return runCaptured(dir, func() error {
+		rest, err := flags.NewParser(c, flags.None).ParseArgs(args)
+		if err != nil {
+			return err
+		}
+		return c.Execute(rest)
+	})
+}
+
+// runCaptured runs f in dir with stdout and stderr redirected to files and returns what was written to them.
+func runCaptured(dir string, f func() error) (string, string, error) {
+	stdout, err := ioutil.TempFile("", "stdout")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+	stderr, err := ioutil.TempFile("", "stderr")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return "", "", err
+	}
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	runErr := f()
+	os.Stdout, os.Stderr = savedStdout, savedStderr
+	if err := os.Chdir(wd); err != nil {
+		return "", "", err
+	}
+	out, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		return "", "", err
+	}
+	diagnostics, err := ioutil.ReadFile(stderr.Name())
+	if err != nil {
+		return "", "", err
+	}
+	return string(out), string(diagnostics), runErr
+}
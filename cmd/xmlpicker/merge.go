@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+type mergeCmd struct {
+	Options           options
+	Pretty            bool     `short:"p" long:"pretty" description:"generated formatted XML"`
+	ContainerXml      string   `long:"container-xml" required:"yes" description:"xml container the records of all the files are written in, its attribute values may use the placeholders of --summary-xml, {{.RecordCount}} and {{.SHA256}} hold back the output until all records are written"`
+	ContainerSelector string   `long:"container-selector" description:"used to find the first matching path in --container-xml' when generating the output, the rest of container-xml is ignored"`
+	SummaryXml        string   `long:"summary-xml" description:"xml element written in --container-xml after the records, its attribute values and text may use {{.RecordCount}}, {{.SHA256}} of the records, {{join .Files \" \"}} and {{now}}"`
+	NSPrefix          []string `long:"ns-prefix" value-name:"PREFIX=URI" description:"write the namespace URI with this prefix in every record, may be repeated"`
+	XMLVersion        string   `long:"xml-version" choice:"1.0" choice:"1.1" default:"1.0" description:"XML version written, 1.1 starts the output with its declaration and writes control characters as character references"`
+	Output            []string `short:"o" long:"output" value-name:"FILE[,on-error=fail|skip|drop]" description:"write the combined document to FILE rather than stdout, may be repeated, on-error decides whether a failing output stops the run, skips the record or is dropped"`
+	Args              struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute writes the nodes selected in each file, by default their document element, one after the other in a single
+// container as the xml command does. The records keep the namespaces declared by their ancestors so that the combined
+// document is well formed whatever the files they come from declare.
+func (c *mergeCmd) Execute(_ []string) error {
+	if c.Options.Exec != "" || c.Options.ExplodeDir != "" {
+		return fmt.Errorf("merge cannot be combined with --exec or --explode-dir")
+	}
+	x := &xmlCmd{
+		Options:           c.Options,
+		Pretty:            c.Pretty,
+		ContainerXml:      c.ContainerXml,
+		ContainerSelector: c.ContainerSelector,
+		SummaryXml:        c.SummaryXml,
+		NSPrefix:          c.NSPrefix,
+		XMLVersion:        c.XMLVersion,
+		Output:            c.Output,
+		detach:            true,
+	}
+	x.Args.Filenames = c.Args.Filenames
+	return x.Execute(nil)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		files          []string
+		expected       string
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:     "document elements",
+			args:     []string{"--container-xml=<all/>"},
+			files:    []string{"a.xml", "b.xml"},
+			expected: `<all><r><i id="1"></i><i id="2"></i></r><r><i id="3"></i></r></all>`,
+		},
+		{
+			name:     "selected records",
+			args:     []string{"--container-xml=<all/>", "--selector=/r/i"},
+			files:    []string{"a.xml", "b.xml"},
+			expected: `<all><i id="1"></i><i id="2"></i><i id="3"></i></all>`,
+		},
+		{
+			name:     "namespaces of each file",
+			args:     []string{"--container-xml=<all/>", "--selector=/*/*"},
+			files:    []string{"ns1.xml", "ns2.xml"},
+			expected: `<all><a:i id="1" xmlns:a="urn:a"></a:i><a:i id="2" xmlns:a="urn:b"></a:i></all>`,
+		},
+		{
+			name:     "placeholders and summary",
+			args:     []string{`--container-xml=<all n="{{.RecordCount}}"/>`, `--summary-xml=<s>{{join .Files ","}}</s>`, "--selector=/r/i"},
+			files:    []string{"a.xml", "b.xml"},
+			expected: `<all n="3"><i id="1"></i><i id="2"></i><i id="3"></i><s>a.xml,b.xml</s></all>`,
+		},
+		{
+			name:     "pretty",
+			args:     []string{"--container-xml=<all/>", "--selector=/r/i", "--pretty"},
+			files:    []string{"a.xml", "b.xml"},
+			expected: "<all>\n    <i id=\"1\"></i>\n    <i id=\"2\"></i>\n    <i id=\"3\"></i>\n</all>",
+		},
+		{
+			name:           "output",
+			args:           []string{"--container-xml=<all/>", "--selector=/r/i", "--output=merged.xml"},
+			files:          []string{"a.xml", "b.xml"},
+			expectedOutput: `<all><i id="1"></i><i id="2"></i><i id="3"></i></all>`,
+		},
+		{
+			name:        "no container",
+			files:       []string{"a.xml"},
+			expectedErr: "the required flag `--container-xml' was not specified",
+		},
+		{
+			name:        "exec",
+			args:        []string{"--container-xml=<all/>", "--exec=cat"},
+			files:       []string{"a.xml"},
+			expectedErr: "merge cannot be combined with --exec or --explode-dir",
+		},
+		{
+			name:        "explode",
+			args:        []string{"--container-xml=<all/>", "--explode-dir=out"},
+			files:       []string{"a.xml"},
+			expectedErr: "merge cannot be combined with --exec or --explode-dir",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{
+				"a.xml":   `<r><i id="1"/><i id="2"/></r>`,
+				"b.xml":   `<r><i id="3"/></r>`,
+				"ns1.xml": `<a:r xmlns:a="urn:a"><a:i id="1"/></a:r>`,
+				"ns2.xml": `<a:r xmlns:a="urn:b"><a:i id="2"/></a:r>`,
+			})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			stdout, _, err := runCommand(dir, &mergeCmd{}, append(test.args, test.files...)...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.Equal(t, test.expected, stdout, name)
+			if test.expectedOutput != "" {
+				b, err := ioutil.ReadFile(filepath.Join(dir, "merged.xml"))
+				if assert.NoError(t, err, name) {
+					assert.Equal(t, test.expectedOutput, string(b), name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// middlewareProcessor passes the nodes through the middleware of --middleware to the next processor, and logs what
+// counting and timing middleware measured when finished.
+type middlewareProcessor struct {
+	next    processor
+	chain   xmlpicker.Processor
+	reports []func()
+}
+
+func (p *middlewareProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *middlewareProcessor) Process(node *xmlpicker.Node) error {
+	return p.chain.Process(node)
+}
+
+func (p *middlewareProcessor) Finish() error {
+	err := p.next.Finish()
+	for _, report := range p.reports {
+		report()
+	}
+	return err
+}
+
+func (o *options) wrapMiddleware(proc processor) (processor, error) {
+	if len(o.Middleware) == 0 {
+		return proc, nil
+	}
+	p := &middlewareProcessor{next: proc}
+	var middleware []xmlpicker.Middleware
+	for _, spec := range o.Middleware {
+		m, report, err := newMiddleware(spec)
+		if err != nil {
+			return nil, err
+		}
+		middleware = append(middleware, m)
+		if report != nil {
+			p.reports = append(p.reports, report)
+		}
+	}
+	p.chain = xmlpicker.Chain(proc, middleware...)
+	return p, nil
+}
+
+// newMiddleware returns the middleware of a --middleware NAME[=ARG], along with a function logging what it measured.
+func newMiddleware(spec string) (xmlpicker.Middleware, func(), error) {
+	name, arg := spec, ""
+	if i := strings.Index(spec, "="); i != -1 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	switch name {
+	case "count":
+		count := new(int64)
+		return xmlpicker.Counting(count), func() {
+			infof("middleware count: %d records", *count)
+		}, nil
+	case "timing":
+		var count int
+		var total time.Duration
+		m := xmlpicker.Timing(func(_ *xmlpicker.Node, d time.Duration) {
+			count++
+			total += d
+		})
+		return m, func() {
+			if count != 0 {
+				infof("middleware timing: %d records in %s, %s each", count, total, total/time.Duration(count))
+			}
+		}, nil
+	case "rate":
+		rate, err := strconv.ParseFloat(arg, 64)
+		if err != nil || rate <= 0 {
+			return nil, nil, fmt.Errorf("invalid --middleware %s, expected rate=RECORDS-PER-SECOND", spec)
+		}
+		return xmlpicker.RateLimiting(rate), nil, nil
+	case "dedupe", "validate":
+		keyPath, err := xmlpicker.ParseKeyPath(arg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --middleware %s: %s", spec, err)
+		}
+		if name == "dedupe" {
+			return xmlpicker.Deduplicating(keyPath), nil, nil
+		}
+		return xmlpicker.Validating(xmlpicker.RequireKey(keyPath)), nil, nil
+	case "meta":
+		i := strings.Index(arg, "=")
+		if i <= 0 {
+			return nil, nil, fmt.Errorf("invalid --middleware %s, expected meta=NAME=VALUE", spec)
+		}
+		return xmlpicker.Annotating(xml.Attr{Name: xml.Name{Local: arg[:i]}, Value: arg[i+1:]}), nil, nil
+	}
+	return nil, nil, fmt.Errorf("unknown --middleware %s, expected count, timing, rate, dedupe, validate or meta", name)
+}
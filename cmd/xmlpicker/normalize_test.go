@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizer(t *testing.T) {
+	for idx, test := range []struct {
+		normalize string
+		input     string
+		expected  string
+	}{
+		{"none", "cafe\u0301 \ufb01", "cafe\u0301 \ufb01"},
+		{"nfc", "cafe\u0301 \ufb01", "caf\u00e9 \ufb01"},
+		{"nfkc", "cafe\u0301 \ufb01", "caf\u00e9 fi"},
+		{"nfc", "caf\u00e9", "caf\u00e9"},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.normalize), func(t *testing.T) {
+			o := &options{Normalize: test.normalize}
+			actual := test.input
+			if normalize := o.Normalizer(); normalize != nil {
+				actual = normalize(test.input)
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
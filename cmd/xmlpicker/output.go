@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// output is one of the --output destinations of a command.
+type output struct {
+	name string
+	// onError is what happens when the output fails: fail stops the run, skip leaves out the record and drop leaves
+	// out the rest of the records.
+	onError string
+	next    processor
+	file    *os.File
+	dropped bool
+}
+
+func (o *output) Process(node *xmlpicker.Node) error {
+	if o.dropped {
+		return nil
+	}
+	err := o.next.Process(node)
+	if err == nil || o.onError == "fail" {
+		return err
+	}
+	if o.onError == "drop" {
+		o.dropped = true
+		warnf("output %s: %s, no more records are written to it", o.name, err)
+		return nil
+	}
+	warnf("output %s: %s", o.name, err)
+	return nil
+}
+
+// outputs delivers each node to several outputs, each with its own processor.
+type outputs struct {
+	outputs []*output
+	tee     xmlpicker.Processor
+}
+
+// openOutputs creates the processor of each --output, given as FILE[,on-error=POLICY], or one for stdout when there
+// are none.
+func openOutputs(specs []string, newProcessor func(w io.Writer) (processor, error)) (processor, error) {
+	if len(specs) == 0 {
+		return newProcessor(os.Stdout)
+	}
+	p := &outputs{}
+	procs := make([]xmlpicker.Processor, 0, len(specs))
+	for _, spec := range specs {
+		o := &output{name: spec, onError: "fail"}
+		if i := strings.LastIndex(spec, ",on-error="); i != -1 {
+			o.name, o.onError = spec[:i], spec[i+len(",on-error="):]
+		}
+		if o.onError != "fail" && o.onError != "skip" && o.onError != "drop" {
+			p.close()
+			return nil, fmt.Errorf("invalid --output %q, on-error must be fail, skip or drop", spec)
+		}
+		var w io.Writer = os.Stdout
+		if o.name != "-" {
+			f, err := os.Create(longPath(o.name))
+			if err != nil {
+				p.close()
+				return nil, err
+			}
+			o.file, w = f, f
+		}
+		p.outputs = append(p.outputs, o)
+		var err error
+		if o.next, err = newProcessor(w); err != nil {
+			p.close()
+			return nil, err
+		}
+		procs = append(procs, o)
+	}
+	p.tee = xmlpicker.TeeProcessor(procs...)
+	return p, nil
+}
+
+func (p *outputs) Begin() error {
+	for _, o := range p.outputs {
+		if err := o.next.Begin(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *outputs) Process(node *xmlpicker.Node) error {
+	return p.tee.Process(node)
+}
+
+// Finish finishes and closes every output.
+func (p *outputs) Finish() error {
+	var first error
+	for _, o := range p.outputs {
+		if err := o.next.Finish(); err != nil && first == nil && o.onError == "fail" {
+			first = err
+		}
+	}
+	if err := p.close(); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
+
+func (p *outputs) close() error {
+	var first error
+	for _, o := range p.outputs {
+		if o.file != nil {
+			if err := o.file.Close(); err != nil && first == nil {
+				first = err
+			}
+			o.file = nil
+		}
+	}
+	return first
+}
+
+// openRoutes creates the processor of each --route, given as SELECTOR=>FILE[,on-error=POLICY], and has o select the
+// nodes of any of them so that they are all written in a single read of the input. Without routes it opens the
+// --output specs.
+func (o *options) openRoutes(specs []string, newProcessor func(w io.Writer) (processor, error)) (processor, error) {
+	if len(o.Route) == 0 {
+		return openOutputs(specs, newProcessor)
+	}
+	if len(specs) != 0 || o.Selector != "/" || o.XPath != "" {
+		return nil, fmt.Errorf("--route cannot be combined with --output, --selector or --xpath")
+	}
+	p := &pipelineProcessor{router: &xmlpicker.Router{}}
+	for _, spec := range o.Route {
+		i := strings.Index(spec, "=>")
+		if i <= 0 || strings.TrimSpace(spec[i+2:]) == "" {
+			p.close()
+			return nil, fmt.Errorf("invalid --route %q, expected SELECTOR=>FILE", spec)
+		}
+		selector, err := xmlpicker.ParsePath(strings.TrimSpace(spec[:i]))
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		if last := selector.Steps[len(selector.Steps)-1]; last.Position.Last {
+			p.close()
+			return nil, fmt.Errorf("invalid --route %q, last() is only supported by --selector", spec)
+		}
+		selector.ResolvePrefixes = o.ResolvePrefixes
+		next, err := openOutputs([]string{strings.TrimSpace(spec[i+2:])}, newProcessor)
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		job := &pipelineJob{next: next}
+		p.jobs = append(p.jobs, job)
+		p.router.Routes = append(p.router.Routes, xmlpicker.Route{Selector: selector, Processor: job})
+	}
+	o.selector = p.router
+	return p, nil
+}
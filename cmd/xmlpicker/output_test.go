@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute(t *testing.T) {
+	const rows = "{\"@id\":\"1\",\"_name\":\"row\",\"_namespaces\":{}}\n{\"@id\":\"2\",\"_name\":\"row\",\"_namespaces\":{}}\n" +
+		"{\"@id\":\"3\",\"_name\":\"row\",\"_namespaces\":{}}\n"
+	const other = "{\"@id\":\"4\",\"_name\":\"other\",\"_namespaces\":{}}\n"
+	for idx, test := range []struct {
+		name           string
+		command        flags.Commander
+		routes         []string
+		args           []string
+		expected       map[string]string
+		expectedStdout string
+		expectedErr    string
+	}{
+		{
+			name:   "routes",
+			routes: []string{"/r/row=>row.json", "/r/other=>other.json"},
+			expected: map[string]string{
+				"row.json":   rows,
+				"other.json": other,
+			},
+		},
+		{
+			name:   "node of several routes",
+			routes: []string{"/r/row=>rows.json", "/r/*=>all.json"},
+			expected: map[string]string{
+				"rows.json": rows,
+				"all.json":  rows + other,
+			},
+		},
+		{
+			name:           "stdout",
+			routes:         []string{"/r/other=>-", "/r/row=>row.json"},
+			expectedStdout: other,
+			expected: map[string]string{
+				"row.json": rows,
+			},
+		},
+		{
+			name:    "xml",
+			command: &xmlCmd{},
+			routes:  []string{"/r/row => row.xml", "/r/other=>other.xml"},
+			expected: map[string]string{
+				"row.xml":   "<r><row id=\"1\"></row></r>\n<r><row id=\"2\"></row></r>\n<r><row id=\"3\"></row></r>\n",
+				"other.xml": "<r><other id=\"4\"></other></r>\n",
+			},
+		},
+		{
+			name:        "last",
+			routes:      []string{"/r/row[last()]=>row.json"},
+			expectedErr: `invalid --route "/r/row[last()]=>row.json", last() is only supported by --selector`,
+		},
+		{
+			name:        "no file",
+			routes:      []string{"/r/row=> "},
+			expectedErr: `invalid --route "/r/row=> ", expected SELECTOR=>FILE`,
+		},
+		{
+			name:        "no selector",
+			routes:      []string{"row.json"},
+			expectedErr: `invalid --route "row.json", expected SELECTOR=>FILE`,
+		},
+		{
+			name:        "invalid selector",
+			routes:      []string{"/r/row[=>row.json"},
+			expectedErr: `xmlpicker: unterminated [ in "/r/row["`,
+		},
+		{
+			name:        "with a selector",
+			routes:      []string{"/r/row=>row.json"},
+			args:        []string{"--selector=/r/other"},
+			expectedErr: "--route cannot be combined with --output, --selector or --xpath",
+		},
+		{
+			name:        "with an output",
+			routes:      []string{"/r/row=>row.json"},
+			args:        []string{"--output=other.json"},
+			expectedErr: "--route cannot be combined with --output, --selector or --xpath",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"rows.xml": `<r><row id="1"/><row id="2"/><row id="3"/><other id="4"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			command := test.command
+			if command == nil {
+				command = &jsonCmd{}
+			}
+			args := test.args
+			for _, route := range test.routes {
+				args = append(args, "--route="+route)
+			}
+			stdout, _, err := runCommand(dir, command, append(args, "rows.xml")...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.Equal(t, test.expectedStdout, stdout, name)
+			for file, expected := range test.expected {
+				actual, err := ioutil.ReadFile(filepath.Join(dir, file))
+				assert.NoError(t, err, name)
+				assert.Equal(t, expected, string(actual), "%s %s", name, file)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type applyPatchesCmd struct {
+	Output string `short:"o" long:"output" value-name:"FILE" description:"write the patched document to FILE rather than stdout"`
+	Args   struct {
+		Patches  string `required:"1" positional-arg-name:"patches.xml"`
+		Filename string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute copies the document, replacing or removing the elements the patches document has a patch for.
+func (c *applyPatchesCmd) Execute(_ []string) error {
+	f, err := os.Open(longPath(c.Args.Patches))
+	if err != nil {
+		return err
+	}
+	patches, err := xmlpicker.ReadPatches(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	in, err := open(c.Args.Filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := autoDecompress(in, decompression{bufferSize: defaultReadBuffer})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var w io.Writer = os.Stdout
+	if c.Output != "" {
+		out, err := os.Create(longPath(c.Output))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		w = out
+	}
+	bw := bufio.NewWriter(w)
+	if err := xmlpicker.ApplyPatches(r, bw, patches); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	flags "github.com/jessevdk/go-flags"
+	"github.com/t11e/xmlpicker"
+	"gopkg.in/yaml.v3"
+)
+
+type pipelineCmd struct {
+	Options options
+	Args    struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// pipelineConfig is the part of a --config file that describes the jobs of a pipeline. Each job is a map of the
+// flags of the json or xml command, given by command, along with the output file, which defaults to stdout. The
+// input and parsing flags are those of the pipeline.
+type pipelineConfig struct {
+	Jobs []map[string]interface{} `yaml:"jobs"`
+}
+
+// Execute runs the jobs of the --config file over a single parse of each input.
+func (c *pipelineCmd) Execute(_ []string) error {
+	if c.Options.Config == "" {
+		return fmt.Errorf("pipeline requires a --config file with jobs")
+	}
+	b, err := ioutil.ReadFile(c.Options.Config)
+	if err != nil {
+		return err
+	}
+	var config pipelineConfig
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return fmt.Errorf("invalid --config %s: %s", c.Options.Config, err)
+	}
+	if len(config.Jobs) == 0 {
+		return fmt.Errorf("invalid --config %s: no jobs", c.Options.Config)
+	}
+	p := &pipelineProcessor{router: &xmlpicker.Router{}}
+	defer p.close()
+	for i, spec := range config.Jobs {
+		job, selector, err := c.newJob(spec)
+		if job != nil {
+			// closed along with the others
+			p.jobs = append(p.jobs, job)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid job %d in %s: %s", i, c.Options.Config, err)
+		}
+		p.router.Routes = append(p.router.Routes, xmlpicker.Route{Selector: selector, Processor: job})
+	}
+	c.Options.selector = p.router
+	return mainImpl(&c.Options, c.Args.Filenames, p)
+}
+
+// newJob parses the flags of a job and sets up its output.
+func (c *pipelineCmd) newJob(spec map[string]interface{}) (*pipelineJob, xmlpicker.Selector, error) {
+	command, _ := spec["command"].(string)
+	if command == "" {
+		command = "json"
+	}
+	var cmd interface {
+		newProcessor(w io.Writer) (processor, error)
+	}
+	var o *options
+	switch command {
+	case "json":
+		j := &jsonCmd{}
+		cmd, o = j, &j.Options
+	case "xml":
+		x := &xmlCmd{}
+		cmd, o = x, &x.Options
+	default:
+		return nil, nil, fmt.Errorf("unsupported command %q, expected json or xml", command)
+	}
+	long, _ := commandOptions(commandTypes()[command])
+	args, err := configFlags(spec, command, long, nil, "command", "output")
+	if err != nil {
+		return nil, nil, err
+	}
+	// the inputs are those of the pipeline
+	if _, err := flags.NewParser(cmd, flags.None).ParseArgs(append(args, c.Args.Filenames...)); err != nil {
+		return nil, nil, err
+	}
+	selector, err := o.NewSelector()
+	if err != nil {
+		return nil, nil, err
+	}
+	job := &pipelineJob{}
+	var w io.Writer = os.Stdout
+	if output, _ := spec["output"].(string); output != "" {
+		if job.file, err = os.Create(longPath(output)); err != nil {
+			return nil, nil, err
+		}
+		w = job.file
+	}
+	if job.next, err = cmd.newProcessor(w); err != nil {
+		return job, nil, err
+	}
+	if job.next, err = o.wrapMiddleware(job.next); err != nil {
+		return job, nil, err
+	}
+	if job.next, err = o.wrapHeadTail(job.next); err != nil {
+		return job, nil, err
+	}
+	if o.SampleSeed == 0 {
+		o.SampleSeed = time.Now().UnixNano()
+	}
+	if job.next, err = o.wrapSampling(job.next); err != nil {
+		return job, nil, err
+	}
+	job.next = o.wrapLang(job.next)
+	return job, selector, nil
+}
+
+// pipelineJob passes the nodes routed to it to the processor of a job until it stops.
+type pipelineJob struct {
+	next processor
+	file *os.File
+	done bool
+}
+
+func (j *pipelineJob) Process(node *xmlpicker.Node) error {
+	if j.done {
+		return nil
+	}
+	err := j.next.Process(node)
+	if err == errStop {
+		j.done = true
+		return nil
+	}
+	return err
+}
+
+// pipelineProcessor routes nodes to the jobs of a pipeline, it stops once all of them have.
+type pipelineProcessor struct {
+	router *xmlpicker.Router
+	jobs   []*pipelineJob
+}
+
+func (p *pipelineProcessor) Begin() error {
+	for _, j := range p.jobs {
+		if err := j.next.Begin(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pipelineProcessor) Process(node *xmlpicker.Node) error {
+	if err := p.router.Process(node); err != nil {
+		return err
+	}
+	for _, j := range p.jobs {
+		if !j.done {
+			return nil
+		}
+	}
+	return errStop
+}
+
+func (p *pipelineProcessor) Finish() error {
+	for _, j := range p.jobs {
+		if err := j.next.Finish(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pipelineProcessor) close() {
+	for _, j := range p.jobs {
+		if j.file != nil {
+			j.file.Close()
+		}
+	}
+}
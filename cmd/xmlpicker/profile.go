@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+)
+
+// startProfiling serves the net/http/pprof handlers on --pprof-addr and starts the profiles given by --profile, the
+// returned function writes the profiles. Only the first call for a run does anything.
+func (o *options) startProfiling() (func() error, error) {
+	if o.profiling {
+		return func() error { return nil }, nil
+	}
+	o.profiling = true
+	if o.PprofAddr != "" {
+		l, err := net.Listen("tcp", o.PprofAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pprof-addr: %s", err)
+		}
+		go http.Serve(l, nil)
+	}
+	var stops []func() error
+	stop := func() error {
+		for _, f := range stops {
+			if err := f(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, spec := range o.Profile {
+		i := strings.Index(spec, ",")
+		if i == -1 {
+			stop()
+			return nil, fmt.Errorf("invalid --profile %q, expected KIND,FILE", spec)
+		}
+		kind, filename := spec[:i], spec[i+1:]
+		if kind != "cpu" && pprof.Lookup(kind) == nil {
+			stop()
+			return nil, fmt.Errorf("unknown --profile kind %q", kind)
+		}
+		f, err := os.Create(filename)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		switch kind {
+		case "cpu":
+			if err := pprof.StartCPUProfile(f); err != nil {
+				f.Close()
+				stop()
+				return nil, err
+			}
+			stops = append(stops, func() error {
+				pprof.StopCPUProfile()
+				return f.Close()
+			})
+			continue
+		case "block":
+			runtime.SetBlockProfileRate(1)
+		}
+		stops = append(stops, func() error {
+			defer f.Close()
+			if kind == "heap" {
+				// up to date statistics
+				runtime.GC()
+			}
+			return pprof.Lookup(kind).WriteTo(f, 0)
+		})
+	}
+	return stop, nil
+}
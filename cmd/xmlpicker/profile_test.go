@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile(t *testing.T) {
+	for idx, test := range []struct {
+		name          string
+		args          []string
+		expectedFiles []string
+		expectedErr   string
+	}{
+		{
+			name:          "cpu and heap",
+			args:          []string{"--profile=cpu,cpu.pprof", "--profile=heap,heap.pprof"},
+			expectedFiles: []string{"cpu.pprof", "heap.pprof"},
+		},
+		{
+			name:          "block",
+			args:          []string{"--profile=block,block.pprof"},
+			expectedFiles: []string{"block.pprof"},
+		},
+		{
+			name:        "no file",
+			args:        []string{"--profile=cpu"},
+			expectedErr: `invalid --profile "cpu", expected KIND,FILE`,
+		},
+		{
+			name:        "unknown kind",
+			args:        []string{"--profile=disk,disk.pprof"},
+			expectedErr: `unknown --profile kind "disk"`,
+		},
+		{
+			name:        "invalid address",
+			args:        []string{"--pprof-addr=localhost:http:x"},
+			expectedErr: "invalid --pprof-addr",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"a.xml": `<r><i id="1"/></r>`, "b.xml": `<r><i id="2"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			// count runs each file separately, the profiles cover them all
+			args := append([]string{"--selector=/r/i"}, test.args...)
+			stdout, _, err := runCommand(dir, &countCmd{}, append(args, "a.xml", "b.xml")...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.Equal(t, "1\ta.xml\n1\tb.xml\n2\ttotal\n", stdout, name)
+			for _, f := range test.expectedFiles {
+				b, err := ioutil.ReadFile(filepath.Join(dir, f))
+				// profiles are gzipped protocol buffers
+				if assert.NoError(t, err, name) && assert.True(t, len(b) > 2, "%s %s", name, f) {
+					assert.Equal(t, []byte{0x1f, 0x8b}, b[:2], "%s %s", name, f)
+				}
+			}
+		})
+	}
+}
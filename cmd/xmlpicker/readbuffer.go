@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultReadBuffer is the size of the buffers of commands without --read-buffer, large enough that network and
+// spinning disk sources are read in few large requests rather than the 4KiB ones of bufio.
+const defaultReadBuffer = 1 << 20
+
+// minReadBuffer is the default size of bufio buffers, which leaves room for the headers peeked at to detect
+// encryption, compression and tar archives.
+const minReadBuffer = 4096
+
+// readBufferSize returns the size --read-buffer gives, in bytes.
+func (o *options) readBufferSize() (int, error) {
+	if o.ReadBuffer == "" {
+		return defaultReadBuffer, nil
+	}
+	size, err := parseByteSize(o.ReadBuffer)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --read-buffer %s: %s", o.ReadBuffer, err)
+	}
+	if size < minReadBuffer {
+		return 0, fmt.Errorf("invalid --read-buffer %s: must be at least %d bytes", o.ReadBuffer, minReadBuffer)
+	}
+	return size, nil
+}
+
+// parseByteSize parses a number of bytes with an optional binary unit suffix, such as 512, 64KiB or 4MiB. The K, M and
+// G suffixes, with or without B, are binary units too.
+func parseByteSize(s string) (int, error) {
+	units := []struct {
+		suffix string
+		scale  int
+	}{
+		{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+	number, scale := strings.TrimSpace(s), 1
+	for _, u := range units {
+		if len(number) > len(u.suffix) && strings.EqualFold(number[len(number)-len(u.suffix):], u.suffix) {
+			number, scale = strings.TrimSpace(number[:len(number)-len(u.suffix)]), u.scale
+			break
+		}
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size such as 64KiB or 4MiB", s)
+	}
+	if n > int(^uint(0)>>1)/scale {
+		return 0, fmt.Errorf("%q is too large", s)
+	}
+	return n * scale, nil
+}
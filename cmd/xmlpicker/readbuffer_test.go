@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for idx, test := range []struct {
+		s        string
+		expected int
+		err      string
+	}{
+		{s: "512", expected: 512},
+		{s: "512B", expected: 512},
+		{s: "64KiB", expected: 64 << 10},
+		{s: "64k", expected: 64 << 10},
+		{s: "4MiB", expected: 4 << 20},
+		{s: "4 MB", expected: 4 << 20},
+		{s: "1GiB", expected: 1 << 30},
+		{s: "MiB", err: `"MiB" is not a size such as 64KiB or 4MiB`},
+		{s: "-1KiB", err: `"-1KiB" is not a size such as 64KiB or 4MiB`},
+		{s: "1.5MiB", err: `"1.5MiB" is not a size such as 64KiB or 4MiB`},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.s), func(t *testing.T) {
+			actual, err := parseByteSize(test.s)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
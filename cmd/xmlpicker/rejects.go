@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// openRejects sets up the sink given by --rejects or --rejects-dir, if any, the returned function closes it.
+func (o *options) openRejects() (func() error, error) {
+	if o.Rejects != "" && o.RejectsDir != "" {
+		return nil, fmt.Errorf("--rejects cannot be combined with --rejects-dir")
+	}
+	if o.Rejects != "" {
+		f, err := os.Create(longPath(o.Rejects))
+		if err != nil {
+			return nil, err
+		}
+		o.rejects = xmlpicker.NewRejectWriter(f)
+		return f.Close, nil
+	}
+	if o.RejectsDir != "" {
+		if err := os.MkdirAll(o.RejectsDir, 0777); err != nil {
+			return nil, err
+		}
+		o.rejects = &xmlpicker.RejectDir{Dir: o.RejectsDir}
+	}
+	return func() error { return nil }, nil
+}
+
+// rejecting routes the record errors of proc to the rejects sink, if there is one. When locate is set they are
+// attributed to the position of the node last read.
+func (o *options) rejecting(proc xmlpicker.Processor, locate bool) xmlpicker.Processor {
+	if o.rejects == nil {
+		return proc
+	}
+	p := &xmlpicker.RejectingProcessor{Next: proc, Sink: o.rejects}
+	if locate {
+		p.Locate = o.locate
+	}
+	return p
+}
+
+func (o *options) locate(r *xmlpicker.Rejected) {
+	r.File = o.position.file
+	if o.position.entry != "" {
+		r.File = o.position.entry + " in " + o.position.file
+	}
+	r.Offset = o.position.start
+}
+
+func (o *options) wrapRejects(proc processor, locate bool) processor {
+	if o.rejects == nil {
+		return proc
+	}
+	return &rejectingProcessor{processor: proc, rejecting: o.rejecting(proc, locate)}
+}
+
+// rejectingProcessor routes the record errors of the processor it wraps to the rejects sink.
+type rejectingProcessor struct {
+	processor
+	rejecting xmlpicker.Processor
+}
+
+func (p *rejectingProcessor) Process(node *xmlpicker.Node) error {
+	return p.rejecting.Process(node)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type repairCmd struct {
+	DryRun bool `long:"dry-run" description:"report what would be cut and appended without changing the files"`
+	Args   struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute repairs each output file that was cut short in place, dropping its last incomplete token and appending
+// the end tags of the elements left open.
+func (c *repairCmd) Execute(_ []string) error {
+	for _, filename := range c.Args.Filenames {
+		if err := c.repair(filename); err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+	return nil
+}
+
+func (c *repairCmd) repair(filename string) error {
+	f, err := os.Open(longPath(filename))
+	if err != nil {
+		return err
+	}
+	t, err := xmlpicker.FindTruncation(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if t.Complete() {
+		infof("%s is complete", filename)
+		return nil
+	}
+	endTags := t.EndTags()
+	infof("%s: cutting %d bytes at offset %d and appending %s", filename, t.Size-t.Offset, t.Offset, endTags)
+	if c.DryRun {
+		return nil
+	}
+	if f, err = os.OpenFile(longPath(filename), os.O_WRONLY, 0); err != nil {
+		return err
+	}
+	if err = f.Truncate(t.Offset); err == nil {
+		_, err = f.WriteAt(endTags, t.Offset)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// sampleProcessor passes each node on to the next processor with a fixed probability.
+type sampleProcessor struct {
+	next processor
+	rate float64
+	rand *rand.Rand
+}
+
+func (p *sampleProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *sampleProcessor) Process(node *xmlpicker.Node) error {
+	if p.rand.Float64() >= p.rate {
+		return nil
+	}
+	return p.next.Process(node)
+}
+
+func (p *sampleProcessor) Finish() error {
+	return p.next.Finish()
+}
+
+// reservoirProcessor keeps a uniform random sample of at most size nodes and passes them on, in their original order,
+// when finished.
+type reservoirProcessor struct {
+	next  processor
+	size  int
+	rand  *rand.Rand
+	seen  int
+	items []reservoirItem
+}
+
+type reservoirItem struct {
+	seq    int
+	node   *xmlpicker.Node
+	parent *xmlpicker.Node
+}
+
+func (p *reservoirProcessor) Begin() error {
+	return p.next.Begin()
+}
+
+func (p *reservoirProcessor) Process(node *xmlpicker.Node) error {
+	// the parent is kept as the caller may clear it once we return
+	item := reservoirItem{seq: p.seen, node: node, parent: node.Parent}
+	p.seen = p.seen + 1
+	if len(p.items) < p.size {
+		p.items = append(p.items, item)
+		return nil
+	}
+	if i := p.rand.Intn(p.seen); i < p.size {
+		p.items[i] = item
+	}
+	return nil
+}
+
+func (p *reservoirProcessor) Finish() error {
+	sort.Sort(bySeq(p.items))
+	for _, item := range p.items {
+		item.node.Parent = item.parent
+		if err := p.next.Process(item.node); err == errStop {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return p.next.Finish()
+}
+
+type bySeq []reservoirItem
+
+func (s bySeq) Len() int           { return len(s) }
+func (s bySeq) Less(i, j int) bool { return s[i].seq < s[j].seq }
+func (s bySeq) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (o *options) wrapSampling(proc processor) (processor, error) {
+	if o.Sample == 0 && o.SampleN == 0 {
+		return proc, nil
+	}
+	if o.Sample < 0 || o.Sample > 1 {
+		return nil, fmt.Errorf("--sample must be between 0 and 1")
+	}
+	if o.SampleN < 0 {
+		return nil, fmt.Errorf("--sample-n must not be negative")
+	}
+	r := rand.New(rand.NewSource(o.SampleSeed))
+	if o.SampleN != 0 {
+		proc = &reservoirProcessor{next: proc, size: o.SampleN, rand: r}
+	}
+	if o.Sample != 0 {
+		proc = &sampleProcessor{next: proc, rate: o.Sample, rand: r}
+	}
+	return proc, nil
+}
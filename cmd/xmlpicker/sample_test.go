@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+// collectProcessor records the ids of the nodes it is passed, and the names of their parents, and stops after stop
+// nodes if it is set.
+type collectProcessor struct {
+	stop     int
+	ids      []string
+	parents  []string
+	begun    bool
+	finished bool
+}
+
+func (p *collectProcessor) Begin() error {
+	p.begun = true
+	return nil
+}
+
+func (p *collectProcessor) Process(node *xmlpicker.Node) error {
+	p.ids = append(p.ids, node.StartElement.Attr[0].Value)
+	parent := ""
+	if node.Parent != nil {
+		parent = node.Parent.StartElement.Name.Local
+	}
+	p.parents = append(p.parents, parent)
+	if p.stop != 0 && len(p.ids) >= p.stop {
+		return errStop
+	}
+	return nil
+}
+
+func (p *collectProcessor) Finish() error {
+	p.finished = true
+	return nil
+}
+
+// sample passes count nodes with the ids 0, 1, 2... through the processors set up by o, clearing their parent once
+// processed like the parser does, and returns what reached the end.
+func sample(o *options, count int, stop int) (*collectProcessor, error) {
+	c := &collectProcessor{stop: stop}
+	proc, err := o.wrapSampling(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := proc.Begin(); err != nil {
+		return nil, err
+	}
+	parent := &xmlpicker.Node{StartElement: xml.StartElement{Name: xml.Name{Local: "r"}}}
+	for i := 0; i < count; i++ {
+		node := &xmlpicker.Node{
+			StartElement: xml.StartElement{
+				Name: xml.Name{Local: "i"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: strconv.Itoa(i)}},
+			},
+			Parent: parent,
+		}
+		err := proc.Process(node)
+		node.Parent = nil
+		if err == errStop {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return c, proc.Finish()
+}
+
+func ids(from, to int) []string {
+	var s []string
+	for i := from; i < to; i++ {
+		s = append(s, strconv.Itoa(i))
+	}
+	return s
+}
+
+func TestSampleOptions(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		options     options
+		expectedErr string
+	}{
+		{name: "rate below 0", options: options{Sample: -0.1}, expectedErr: "--sample must be between 0 and 1"},
+		{name: "rate above 1", options: options{Sample: 1.5}, expectedErr: "--sample must be between 0 and 1"},
+		{name: "negative size", options: options{SampleN: -1}, expectedErr: "--sample-n must not be negative"},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			_, err := sample(&test.options, 1, 0)
+			assert.EqualError(t, err, test.expectedErr, name)
+		})
+	}
+}
+
+func TestSampleProcessor(t *testing.T) {
+	for idx, test := range []struct {
+		name     string
+		rate     float64
+		expected []string
+	}{
+		{name: "all", rate: 1, expected: ids(0, 100)},
+		{name: "none", rate: 1e-9},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			c, err := sample(&options{Sample: test.rate, SampleSeed: 1}, 100, 0)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, c.ids, name)
+				assert.True(t, c.begun && c.finished, name)
+			}
+		})
+	}
+	t.Run("seeded", func(t *testing.T) {
+		first, err := sample(&options{Sample: 0.1, SampleSeed: 42}, 10000, 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		again, err := sample(&options{Sample: 0.1, SampleSeed: 42}, 10000, 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		other, err := sample(&options{Sample: 0.1, SampleSeed: 43}, 10000, 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, first.ids, again.ids)
+		assert.NotEqual(t, first.ids, other.ids)
+		assert.InDelta(t, 1000, len(first.ids), 100)
+		for i := 1; i < len(first.ids); i++ {
+			a, _ := strconv.Atoi(first.ids[i-1])
+			b, _ := strconv.Atoi(first.ids[i])
+			assert.True(t, a < b, "%s after %s", first.ids[i], first.ids[i-1])
+		}
+	})
+}
+
+func TestReservoirProcessor(t *testing.T) {
+	for idx, test := range []struct {
+		name          string
+		size          int
+		count         int
+		stop          int
+		expectedCount int
+	}{
+		{name: "fewer nodes than the size", size: 10, count: 5, expectedCount: 5},
+		{name: "as many nodes as the size", size: 5, count: 5, expectedCount: 5},
+		{name: "more nodes than the size", size: 5, count: 100, expectedCount: 5},
+		{name: "stopped by the next processor", size: 5, count: 100, stop: 2, expectedCount: 2},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			c, err := sample(&options{SampleN: test.size, SampleSeed: 1}, test.count, test.stop)
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.True(t, c.begun && c.finished, name)
+			if !assert.Len(t, c.ids, test.expectedCount, name) {
+				return
+			}
+			if test.count <= test.size {
+				assert.Equal(t, ids(0, test.count), c.ids, name)
+			}
+			for i, id := range c.ids {
+				assert.Equal(t, "r", c.parents[i], "%s parent of %s", name, id)
+				if i > 0 {
+					a, _ := strconv.Atoi(c.ids[i-1])
+					b, _ := strconv.Atoi(id)
+					assert.True(t, a < b, "%s %s after %s", name, id, c.ids[i-1])
+				}
+			}
+		})
+	}
+	t.Run("uniform", func(t *testing.T) {
+		const size, count, runs = 3, 10, 3000
+		chosen := make(map[string]int)
+		for seed := int64(1); seed <= runs; seed++ {
+			c, err := sample(&options{SampleN: size, SampleSeed: seed}, count, 0)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, id := range c.ids {
+				chosen[id]++
+			}
+		}
+		for _, id := range ids(0, count) {
+			// each node is expected in size out of count samples, 900 here
+			assert.InDelta(t, runs*size/count, chosen[id], 120, "node %s", id)
+		}
+	})
+	t.Run("with a rate", func(t *testing.T) {
+		c, err := sample(&options{Sample: 0.5, SampleN: 5, SampleSeed: 7}, 100, 0)
+		if assert.NoError(t, err) {
+			assert.Len(t, c.ids, 5)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+
+	"github.com/t11e/xmlpicker"
+)
+
+type segmentsCmd struct {
+	Options    options
+	Preset     string `long:"preset" choice:"auto" choice:"xliff" choice:"tmx" default:"auto" description:"translation units to read, the trans-unit and unit elements of XLIFF, the tu elements of TMX or both, used instead of --selector"`
+	Format     string `short:"f" long:"format" choice:"json" choice:"csv" default:"json" description:"JSON lines or CSV with a header row"`
+	SourceLang string `long:"source-lang" value-name:"LANG" description:"language of the source of TMX units, by default the srclang of each tu or of the header"`
+	Args       struct {
+		Filenames []string `required:"1" positional-arg-name:"file"`
+	} `positional-args:"yes"`
+}
+
+// Execute writes a record with the id, languages, source and target of each segment of the translation units.
+func (c *segmentsCmd) Execute(_ []string) error {
+	c.Options.selector = xmlpicker.TranslationUnitSelector{
+		XLIFF: c.Preset != "tmx",
+		TMX:   c.Preset != "xliff",
+	}
+	w := c.Options.outputWriter(os.Stdout)
+	p := &segmentsProcessor{extractor: &xmlpicker.SegmentExtractor{SourceLang: c.SourceLang}}
+	if c.Format == "csv" {
+		p.csv = csv.NewWriter(w)
+	} else {
+		p.json = json.NewEncoder(w)
+		p.json.SetEscapeHTML(false)
+	}
+	return mainImpl(&c.Options, c.Args.Filenames, p)
+}
+
+type segmentsProcessor struct {
+	extractor *xmlpicker.SegmentExtractor
+	json      *json.Encoder
+	csv       *csv.Writer
+}
+
+func (p *segmentsProcessor) Begin() error {
+	if p.csv != nil {
+		return p.csv.Write([]string{"id", "source_lang", "source", "target_lang", "target"})
+	}
+	return nil
+}
+
+func (p *segmentsProcessor) Process(node *xmlpicker.Node) error {
+	segments, err := p.extractor.Segments(node)
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if p.csv != nil {
+			err = p.csv.Write([]string{s.ID, s.SourceLang, s.Source, s.TargetLang, s.Target})
+		} else {
+			err = p.json.Encode(s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *segmentsProcessor) Finish() error {
+	if p.csv != nil {
+		p.csv.Flush()
+		return p.csv.Error()
+	}
+	return nil
+}
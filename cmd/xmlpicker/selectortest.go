@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/t11e/xmlpicker"
+	"gopkg.in/yaml.v3"
+)
+
+type testSelectorsCmd struct {
+	Verbose bool `short:"v" long:"verbose" description:"also report the tests that pass"`
+	Args    struct {
+		Filenames []string `required:"1" positional-arg-name:"tests.yaml"`
+	} `positional-args:"yes"`
+}
+
+// selectorTests is the format of a test-selectors file.
+type selectorTests struct {
+	Tests []selectorTest `yaml:"tests"`
+}
+
+// selectorTest declares the paths of the nodes a selector, or an XPath, matches in a document given inline or by a
+// filename relative to the tests file. Paths are written like /feed/entry[2] where a missing position means 1.
+type selectorTest struct {
+	Name      string   `yaml:"name"`
+	Selector  string   `yaml:"selector"`
+	XPath     string   `yaml:"xpath"`
+	Namespace string   `yaml:"namespace"`
+	XML       string   `yaml:"xml"`
+	File      string   `yaml:"file"`
+	Expected  []string `yaml:"expected"`
+}
+
+// Execute runs the tests of each file and fails if any of them does.
+func (c *testSelectorsCmd) Execute(_ []string) error {
+	total, failed := 0, 0
+	for _, filename := range c.Args.Filenames {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		var tests selectorTests
+		if err := yaml.Unmarshal(b, &tests); err != nil {
+			return fmt.Errorf("invalid selector tests %s: %s", filename, err)
+		}
+		for i, test := range tests.Tests {
+			name := test.Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			total++
+			actual, err := test.run(filepath.Dir(filename))
+			if err == nil && equalPaths(test.Expected, actual) {
+				if c.Verbose {
+					fmt.Printf("ok\t%s\t%s\n", filename, name)
+				}
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL\t%s\t%s\n", filename, name)
+			if err != nil {
+				fmt.Printf("\terror: %s\n", err)
+				continue
+			}
+			fmt.Printf("\texpected: %s\n\tactual:   %s\n", strings.Join(test.Expected, " "), strings.Join(actual, " "))
+		}
+	}
+	if failed != 0 {
+		return testsFailedError(fmt.Sprintf("%d of %d selector tests failed", failed, total))
+	}
+	fmt.Printf("ok\t%d selector tests\n", total)
+	return nil
+}
+
+// testsFailedError exits with status 1 rather than a panic.
+type testsFailedError string
+
+func (e testsFailedError) Error() string {
+	return string(e)
+}
+
+func (e testsFailedError) exitCode() int {
+	return 1
+}
+
+// run returns the paths of the nodes matched in the document of the test.
+func (t *selectorTest) run(dir string) ([]string, error) {
+	o := &options{Selector: t.Selector, XPath: t.XPath, Namespace: t.Namespace}
+	if o.Selector == "" {
+		o.Selector = "/"
+	}
+	if o.Namespace == "" {
+		o.Namespace = "prefix"
+	}
+	if o.Namespace != "expand" && o.Namespace != "strip" && o.Namespace != "prefix" {
+		return nil, fmt.Errorf("invalid namespace %q", o.Namespace)
+	}
+	selector, err := o.NewSelector()
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = strings.NewReader(t.XML)
+	if t.File != "" {
+		f, err := os.Open(filepath.Join(dir, t.File))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = true
+	parser := xmlpicker.NewParser(decoder, selector)
+	parser.NSFlag = o.NSFlag()
+	positions := xmlpicker.NewNodePositions()
+	parser.Trace = positions.Trace
+	paths := []string{}
+	for {
+		n, err := parser.Next()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, positions.Path(n))
+	}
+}
+
+// equalPaths compares the paths, a position of 1 may be written or left out.
+func equalPaths(expected, actual []string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if xmlpicker.NormalizePositionPath(expected[i]) != actual[i] {
+			return false
+		}
+	}
+	return true
+}
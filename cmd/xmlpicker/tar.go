@@ -0,0 +1,91 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// isTar reports whether the input starts with a ustar or GNU tar header.
+func isTar(br *bufio.Reader) bool {
+	h, _ := br.Peek(262)
+	return len(h) == 262 && bytes.Equal(h[257:], []byte("ustar"))
+}
+
+// parseTar processes each regular file in the archive that matches --tar-entry as a separate document.
+func parseTar(r io.Reader, filename string, o *options, proc processor) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		if !hdr.FileInfo().Mode().IsRegular() || hdr.Size == 0 || !o.matchesTarEntry(hdr.Name) {
+			continue
+		}
+		d := o.decompression()
+		d.name = hdr.Name + " in " + filename
+		entry, err := autoDecompress(tr, d)
+		if err != nil {
+			return fmt.Errorf("%s in %s: %s", hdr.Name, filename, err)
+		}
+		err = parseDocument(entry, &source{file: filename, entry: hdr.Name, modified: hdr.ModTime}, o, proc)
+		entry.Close()
+		if err == errStop || err == errInterrupted {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("%s in %s: %s", hdr.Name, filename, err)
+		}
+	}
+}
+
+func (o *options) matchesTarEntry(name string) bool {
+	for _, glob := range o.TarEntry {
+		s := name
+		if !strings.Contains(glob, "/") {
+			s = path.Base(name)
+		}
+		if ok, _ := path.Match(glob, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// source describes where a record was read from, for --provenance.
+type source struct {
+	file     string
+	entry    string
+	modified time.Time
+}
+
+// name is the file, or the entry and the file, of the source for messages.
+func (s *source) name() string {
+	if s.entry != "" {
+		return s.entry + " in " + s.file
+	}
+	return s.file
+}
+
+func (s *source) annotate(n *xmlpicker.Node) error {
+	attrs := []xml.Attr{{Name: xml.Name{Local: "_file"}, Value: s.file}}
+	if s.entry != "" {
+		attrs = append(attrs,
+			xml.Attr{Name: xml.Name{Local: "_entry"}, Value: s.entry},
+			xml.Attr{Name: xml.Name{Local: "_modified"}, Value: s.modified.UTC().Format(time.RFC3339)},
+		)
+	}
+	n.StartElement.Attr = append(n.StartElement.Attr, attrs...)
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// tarArchive returns a tar archive of files, given as name and content pairs, modified at modified.
+func tarArchive(modified time.Time, files ...string) []byte {
+	var b bytes.Buffer
+	w := tar.NewWriter(&b)
+	for i := 0; i < len(files); i += 2 {
+		w.WriteHeader(&tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1])), ModTime: modified, Typeflag: tar.TypeReg})
+		w.Write([]byte(files[i+1]))
+	}
+	w.Close()
+	return b.Bytes()
+}
+
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestTar(t *testing.T) {
+	modified := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	archive := tarArchive(modified,
+		"feed/a.xml", `<r><i id="1"/></r>`,
+		"feed/notes.txt", `<r><i id="x"/></r>`,
+		"feed/b.xml.gz", string(gzipped([]byte(`<r><i id="2"/><i id="3"/></r>`))),
+		"other/c.xml", `<r><i id="4"/></r>`,
+	)
+	var zst bytes.Buffer
+	z, _ := zstd.NewWriter(&zst)
+	z.Write(archive)
+	z.Close()
+	dir, ok := writeFiles(t, map[string]string{
+		"records.tar":     string(archive),
+		"records.tar.gz":  string(gzipped(archive)),
+		"records.tar.zst": zst.String(),
+	})
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(dir)
+	all := jsonRecord("1") + jsonRecord("2") + jsonRecord("3") + jsonRecord("4")
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedStdout string
+	}{
+		{
+			name:           "tar",
+			args:           []string{"records.tar"},
+			expectedStdout: all,
+		},
+		{
+			name:           "tar.gz",
+			args:           []string{"records.tar.gz"},
+			expectedStdout: all,
+		},
+		{
+			name:           "tar.zst",
+			args:           []string{"--parallel-decompress", "records.tar.zst"},
+			expectedStdout: all,
+		},
+		{
+			name:           "entry glob on the base name",
+			args:           []string{"--tar-entry=c.*", "records.tar"},
+			expectedStdout: jsonRecord("4"),
+		},
+		{
+			name:           "entry glob on the path",
+			args:           []string{"--tar-entry=feed/*.xml", "--tar-entry=other/*", "records.tar"},
+			expectedStdout: jsonRecord("1") + jsonRecord("4"),
+		},
+		{
+			name: "provenance",
+			args: []string{"--provenance", "--tar-entry=*.gz", "records.tar.gz"},
+			expectedStdout: `{"@_entry":"feed/b.xml.gz","@_file":"records.tar.gz","@_modified":"2017-01-02T03:04:05Z","@id":"2","_name":"i","_namespaces":{}}` + "\n" +
+				`{"@_entry":"feed/b.xml.gz","@_file":"records.tar.gz","@_modified":"2017-01-02T03:04:05Z","@id":"3","_name":"i","_namespaces":{}}` + "\n",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			stdout, _, err := runCommand(dir, &jsonCmd{}, append([]string{"--selector=/r/i"}, test.args...)...)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expectedStdout, stdout, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// maxReadRate returns the bytes a second --max-read-bps allows, 0 for no limit.
+func (o *options) maxReadRate() (int64, error) {
+	if o.MaxReadBPS == "" {
+		return 0, nil
+	}
+	rate, err := parseByteSize(o.MaxReadBPS)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --max-read-bps %s: %s", o.MaxReadBPS, err)
+	}
+	if rate == 0 {
+		return 0, fmt.Errorf("invalid --max-read-bps %s: must be positive", o.MaxReadBPS)
+	}
+	return int64(rate), nil
+}
+
+// throttledInput reads an input at no more than --max-read-bps and closes it.
+type throttledInput struct {
+	*xmlpicker.ThrottledReader
+	io.Closer
+}
+
+// throttle limits the rate r is read at with --max-read-bps.
+func (o *options) throttle(r io.ReadCloser) io.ReadCloser {
+	if o.maxReadBPS == 0 {
+		return r
+	}
+	return &throttledInput{ThrottledReader: xmlpicker.NewThrottledReader(r, o.maxReadBPS), Closer: r}
+}
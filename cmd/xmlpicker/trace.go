@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// tracer writes the tokens read by the parser for --trace-tokens.
+type tracer struct {
+	writer io.Writer
+	nsFlag xmlpicker.NSFlag
+	every  int
+	limit  int
+	seen   int
+	traced int
+}
+
+// configureTrace sets up --trace-tokens, the counts carry on from one document to the next.
+func (o *options) configureTrace(parser *xmlpicker.Parser) error {
+	if !o.TraceTokens {
+		return nil
+	}
+	if o.TraceEvery < 1 || o.TraceLimit < 0 {
+		return fmt.Errorf("--trace-every must be positive and --trace-limit must not be negative")
+	}
+	if o.tracer == nil {
+		o.tracer = &tracer{writer: os.Stderr, nsFlag: o.NSFlag(), every: o.TraceEvery, limit: o.TraceLimit}
+	}
+	parser.Trace = o.tracer.trace
+	return nil
+}
+
+func (t *tracer) trace(trace *xmlpicker.TokenTrace) {
+	token := t.formatToken(trace.Token)
+	if token == "" || (t.limit != 0 && t.traced >= t.limit) {
+		return
+	}
+	t.seen++
+	if (t.seen-1)%t.every != 0 {
+		return
+	}
+	t.traced++
+	state := ""
+	if trace.Matched {
+		state = " matched"
+	} else if trace.InMatch {
+		state = " in match"
+	}
+	fmt.Fprintf(t.writer, "trace: %d %s %s%s\n", trace.Offset, t.formatPath(trace.Node), token, state)
+	if t.traced == t.limit {
+		fmt.Fprintf(t.writer, "trace: limit of %d tokens reached\n", t.limit)
+	}
+}
+
+// formatPath writes the names of the path with their namespace, or their prefix with --namespace=prefix.
+func (t *tracer) formatPath(node *xmlpicker.Node) string {
+	var names []string
+	for n := node; n != nil && n.Parent != nil; n = n.Parent {
+		names = append(names, t.formatName(n.StartElement.Name))
+	}
+	var b bytes.Buffer
+	for i := len(names) - 1; i >= 0; i-- {
+		b.WriteString("/")
+		b.WriteString(names[i])
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
+
+func (t *tracer) formatName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if t.nsFlag == xmlpicker.NSPrefix {
+		return name.Space + ":" + name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+// formatToken describes a token, or returns "" for whitespace.
+func (t *tracer) formatToken(token xml.Token) string {
+	switch token := token.(type) {
+	case xml.StartElement:
+		s := "<" + t.formatName(token.Name)
+		for _, a := range token.Attr {
+			s += " " + t.formatName(a.Name) + "=" + strconv.Quote(truncate(a.Value))
+		}
+		return s + ">"
+	case xml.EndElement:
+		return "</" + t.formatName(token.Name) + ">"
+	case xml.CharData:
+		s := strings.TrimSpace(string(token))
+		if s == "" {
+			return ""
+		}
+		return "text " + strconv.Quote(truncate(s))
+	case xml.Comment:
+		return "comment " + strconv.Quote(truncate(string(token)))
+	case xml.ProcInst:
+		return "<?" + token.Target + "?>"
+	case xml.Directive:
+		return "<!" + truncate(string(token)) + ">"
+	}
+	return fmt.Sprintf("%T", token)
+}
+
+func truncate(s string) string {
+	const max = 40
+	if r := []rune(s); len(r) > max {
+		return string(r[:max]) + "..."
+	}
+	return s
+}
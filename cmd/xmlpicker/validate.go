@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/t11e/xmlpicker"
+)
+
+// position is where the node last read by parseDocument was found, for error reporting.
+type position struct {
+	file  string
+	entry string
+	start int64
+}
+
+func (p position) String() string {
+	if p.entry != "" {
+		return fmt.Sprintf("%s in %s at offset %d", p.entry, p.file, p.start)
+	}
+	return fmt.Sprintf("%s at offset %d", p.file, p.start)
+}
+
+func loadJSONSchemaValidator(filename string) (*xmlpicker.JSONSchemaValidator, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	v, err := xmlpicker.CompileJSONSchema(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --validate-output %s: %s", filename, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verifier checks the digest of each input against a manifest in the format written by sha256sum and friends.
+type verifier struct {
+	algorithm string
+	newHash   func() hash.Hash
+	manifest  string
+	sums      map[string]string
+}
+
+func newVerifier(spec string) (*verifier, error) {
+	i := strings.Index(spec, ":")
+	if i == -1 {
+		return nil, fmt.Errorf("invalid --verify %q, expected ALGORITHM:FILE", spec)
+	}
+	v := &verifier{algorithm: spec[:i], manifest: spec[i+1:]}
+	switch v.algorithm {
+	case "md5":
+		v.newHash = md5.New
+	case "sha1":
+		v.newHash = sha1.New
+	case "sha256":
+		v.newHash = sha256.New
+	case "sha512":
+		v.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported --verify algorithm %q", v.algorithm)
+	}
+	f, err := os.Open(v.manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	v.sums = make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line in %s: %q", v.manifest, line)
+		}
+		name := strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		v.sums[name] = strings.ToLower(fields[0])
+	}
+	return v, scanner.Err()
+}
+
+func (v *verifier) expected(filename string) (string, error) {
+	if sum, ok := v.sums[filename]; ok {
+		return sum, nil
+	}
+	if sum, ok := v.sums[filepath.Base(filename)]; ok {
+		return sum, nil
+	}
+	return "", fmt.Errorf("no %s checksum for %s in %s", v.algorithm, filename, v.manifest)
+}
+
+// digestReader hashes everything that is read through it.
+type digestReader struct {
+	io.Reader
+	io.Closer
+	hash hash.Hash
+}
+
+func (v *verifier) wrap(r io.ReadCloser) *digestReader {
+	h := v.newHash()
+	return &digestReader{Reader: io.TeeReader(r, h), Closer: r, hash: h}
+}
+
+// check reads the rest of the input, so the digest covers all of it, then compares it against the expected sum from
+// the manifest and reports it at the info level.
+func (v *verifier) check(filename string, r *digestReader, expected string) error {
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(r.hash.Sum(nil))
+	infof("%s:%s  %s", v.algorithm, actual, filename)
+	if actual != expected {
+		return fmt.Errorf("%s checksum mismatch for %s, expected %s but got %s", v.algorithm, filename, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlpicker")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	const doc = `<r><i id="1"/><i id="2"/></r>`
+	sum := sha256.Sum256([]byte(doc))
+	manifest := hex.EncodeToString(sum[:]) + "  records.xml\n" + hex.EncodeToString(make([]byte, 32)) + " *changed.xml\n"
+	files := map[string]string{
+		"records.xml":  doc,
+		"changed.xml":  doc,
+		"unlisted.xml": doc,
+		"inputs.sums":  manifest,
+	}
+	for name, data := range files {
+		if !assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666)) {
+			return
+		}
+	}
+	for idx, test := range []struct {
+		name           string
+		args           []string
+		expectedStdout string
+		expectedErr    string
+	}{
+		{
+			name:           "verified",
+			args:           []string{"records.xml"},
+			expectedStdout: "{\"@id\":\"1\",\"_name\":\"i\",\"_namespaces\":{}}\n{\"@id\":\"2\",\"_name\":\"i\",\"_namespaces\":{}}\n",
+		},
+		{
+			name:           "mismatch after the head",
+			args:           []string{"--head=1", "changed.xml"},
+			expectedStdout: "{\"@id\":\"1\",\"_name\":\"i\",\"_namespaces\":{}}\n",
+			expectedErr:    "sha256 checksum mismatch for changed.xml",
+		},
+		{
+			name:        "unlisted before reading",
+			args:        []string{"unlisted.xml"},
+			expectedErr: "no sha256 checksum for unlisted.xml in inputs.sums",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			args := append([]string{"--selector=/r/i", "--verify=sha256:inputs.sums"}, test.args...)
+			stdout, _, err := runCommand(dir, &jsonCmd{}, args...)
+			if test.expectedErr != "" {
+				if assert.Error(t, err, name) {
+					assert.Contains(t, err.Error(), test.expectedErr, name)
+				}
+			} else {
+				assert.NoError(t, err, name)
+			}
+			assert.Equal(t, test.expectedStdout, stdout, name)
+		})
+	}
+}
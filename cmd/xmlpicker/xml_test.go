@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeAncestors(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		merge       bool
+		args        []string
+		files       []string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "repeated ancestors",
+			merge:    true,
+			files:    []string{"groups.xml"},
+			expected: `<r><g n="1"><i id="1"></i><i id="2"></i></g><g n="2"><i id="3"></i></g><h><i id="4"></i></h><g n="2"><i id="5"></i></g></r>` + "\n",
+		},
+		{
+			name:  "without",
+			merge: false,
+			files: []string{"groups.xml"},
+			expected: "<r><g n=\"1\"><i id=\"1\"></i></g></r>\n<r><g n=\"1\"><i id=\"2\"></i></g></r>\n<r><g n=\"2\"><i id=\"3\"></i></g></r>\n" +
+				"<r><h><i id=\"4\"></i></h></r>\n<r><g n=\"2\"><i id=\"5\"></i></g></r>\n",
+		},
+		{
+			name:     "files",
+			merge:    true,
+			files:    []string{"a.xml", "b.xml"},
+			expected: "<r><g><i id=\"1\"></i><i id=\"2\"></i></g></r>\n<r><g><i id=\"3\"></i></g></r>\n",
+		},
+		{
+			name:  "pretty",
+			merge: true,
+			args:  []string{"--pretty"},
+			files: []string{"groups.xml"},
+			expected: "<r>\n    <g n=\"1\">\n        <i id=\"1\"></i>\n        <i id=\"2\"></i>\n    </g>\n    <g n=\"2\">\n        <i id=\"3\"></i>\n    </g>\n" +
+				"    <h>\n        <i id=\"4\"></i>\n    </h>\n    <g n=\"2\">\n        <i id=\"5\"></i>\n    </g>\n</r>\n",
+		},
+		{
+			name:        "container",
+			merge:       true,
+			args:        []string{"--container-xml=<c/>"},
+			files:       []string{"groups.xml"},
+			expectedErr: "--merge-ancestors cannot be combined with --container-xml",
+		},
+		{
+			name:        "exec",
+			merge:       true,
+			args:        []string{"--exec=cat"},
+			files:       []string{"groups.xml"},
+			expectedErr: "--merge-ancestors cannot be combined with --exec",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{
+				"groups.xml": `<r><g n="1"><i id="1"/><i id="2"/></g><g n="2"><i id="3"/></g><h><i id="4"/></h><g n="2"><i id="5"/></g></r>`,
+				"a.xml":      `<r><g><i id="1"/><i id="2"/></g></r>`,
+				"b.xml":      `<r><g><i id="3"/></g></r>`,
+			})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			args := append([]string{"--selector=/r/*/i"}, test.args...)
+			if test.merge {
+				args = append(args, "--merge-ancestors")
+			}
+			stdout, _, err := runCommand(dir, &xmlCmd{}, append(args, test.files...)...)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, stdout, name)
+			}
+		})
+	}
+}
+
+func TestXMLAttributeSelector(t *testing.T) {
+	for idx, args := range [][]string{
+		{"--selector=/r/i/@id"},
+		{"--xpath=//i/@id"},
+	} {
+		name := fmt.Sprintf("%d %s", idx, args[0])
+		t.Run(name, func(t *testing.T) {
+			dir, ok := writeFiles(t, map[string]string{"records.xml": `<r><i id="1"/></r>`})
+			if !ok {
+				return
+			}
+			defer os.RemoveAll(dir)
+			_, _, err := runCommand(dir, &xmlCmd{}, append(args, "records.xml")...)
+			assert.EqualError(t, err, "the xml command cannot write the value of attribute id, select its element or use the json command", name)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package xmlpicker
+
+import (
+	"sort"
+	"strings"
+)
+
+// Coverage is a Selector that returns no node but measures, over the documents it is given to a Parser for, how many
+// nodes each of Selectors matches and how many elements fall within those nodes, as well as the paths of the elements
+// that none of them covers, to check that an extraction config captures everything intended.
+//
+// As for a Parser, the elements within a node a selector matched are not matched by it again. Only Matches is used,
+// so a SubtreeSelector counts the nodes that pass its structural prefilter.
+type Coverage struct {
+	Selectors []Selector
+	// Elements is the number of elements seen.
+	Elements int
+	// Matched and Covered are the number of nodes matched by each selector and of elements within them, including the
+	// matched elements.
+	Matched []int
+	Covered []int
+	// Uncovered counts the elements that are within the nodes of none of the selectors by path, e.g. /feed/entry/id.
+	Uncovered map[string]int
+
+	// open holds the node each selector matched and its depth while its elements are seen
+	open      []*Node
+	openDepth []int
+	ancestors []*Node
+}
+
+func NewCoverage(selectors ...Selector) *Coverage {
+	return &Coverage{
+		Selectors: selectors,
+		Matched:   make([]int, len(selectors)),
+		Covered:   make([]int, len(selectors)),
+		Uncovered: make(map[string]int),
+		open:      make([]*Node, len(selectors)),
+		openDepth: make([]int, len(selectors)),
+	}
+}
+
+// Matches records node and returns false.
+func (c *Coverage) Matches(node *Node) bool {
+	c.Elements++
+	c.ancestors = c.ancestors[:0]
+	for n := node; n.Parent != nil; n = n.Parent {
+		c.ancestors = append(c.ancestors, n)
+	}
+	depth := len(c.ancestors)
+	covered := false
+	for i, s := range c.Selectors {
+		if open := c.open[i]; open != nil && c.openDepth[i] <= depth && c.ancestors[depth-c.openDepth[i]] == open {
+			c.Covered[i]++
+			covered = true
+			continue
+		}
+		c.open[i] = nil
+		if s.Matches(node) {
+			c.open[i] = node
+			c.openDepth[i] = depth
+			c.Matched[i]++
+			c.Covered[i]++
+			covered = true
+		}
+	}
+	if !covered {
+		steps := make([]string, depth)
+		for i, n := range c.ancestors {
+			steps[depth-1-i] = n.StartElement.Name.Local
+		}
+		c.Uncovered["/"+strings.Join(steps, "/")]++
+	}
+	return false
+}
+
+func (c *Coverage) selectors() []Selector {
+	return c.Selectors
+}
+
+// Reset resets the stateful Selectors for a new document, the counts go on accumulating.
+func (c *Coverage) Reset() {
+	for i, s := range c.Selectors {
+		c.open[i] = nil
+		ResetSelector(s)
+	}
+}
+
+// Fraction returns the fraction of the elements that are within the nodes selector i matched.
+func (c *Coverage) Fraction(i int) float64 {
+	if c.Elements == 0 {
+		return 0
+	}
+	return float64(c.Covered[i]) / float64(c.Elements)
+}
+
+// PathCount is a path and a number of elements.
+type PathCount struct {
+	Path  string
+	Count int
+}
+
+// TopUncovered returns the n paths with the most uncovered elements, all of them when n is 0, by decreasing count and
+// then by path.
+func (c *Coverage) TopUncovered(n int) []PathCount {
+	paths := make([]PathCount, 0, len(c.Uncovered))
+	for p, count := range c.Uncovered {
+		paths = append(paths, PathCount{p, count})
+	}
+	sort.Sort(byCount(paths))
+	if n > 0 && n < len(paths) {
+		paths = paths[:n]
+	}
+	return paths
+}
+
+type byCount []PathCount
+
+func (p byCount) Len() int      { return len(p) }
+func (p byCount) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byCount) Less(i, j int) bool {
+	if p[i].Count != p[j].Count {
+		return p[i].Count > p[j].Count
+	}
+	return p[i].Path < p[j].Path
+}
@@ -0,0 +1,35 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestCoverage(t *testing.T) {
+	const doc = `<feed><meta><title/></meta><entry id="1"><title/><link/></entry><entry id="2"><title/><entry/></entry><log/><log/></feed>`
+	descendants, err := xmlpicker.ParseXPath("//entry")
+	if !assert.NoError(t, err) {
+		return
+	}
+	coverage := xmlpicker.NewCoverage(
+		xmlpicker.PathSelector("/feed/entry"),
+		xmlpicker.PathSelector("/feed/meta"),
+		xmlpicker.PathSelector("/feed/missing"),
+		descendants,
+	)
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), coverage)
+	_, err = parser.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 11, coverage.Elements)
+	// the entry within an entry is not matched again by //entry
+	assert.Equal(t, []int{2, 1, 0, 2}, coverage.Matched)
+	assert.Equal(t, []int{6, 2, 0, 6}, coverage.Covered)
+	assert.InDelta(t, 6.0/11, coverage.Fraction(0), 1e-9)
+	assert.Equal(t, []xmlpicker.PathCount{{"/feed/log", 2}, {"/feed", 1}}, coverage.TopUncovered(2))
+	assert.Len(t, coverage.TopUncovered(0), 2)
+}
@@ -0,0 +1,29 @@
+// Package xmlpicker wraps an xml.Decoder to pick out smaller chunks from very large XML files where each chunk can be
+// held in memory for processing.
+//
+// A Parser reads tokens from a decoder and returns a Node for every element its Selector picks, PathSelector builds a
+// Selector from a path such as /listings/listing. The chunks can then be handed to a Processor, converted to JSON
+// values with a Mapper such as SimpleMapper or written back out as XML with an XMLExporter.
+//
+// # Stability
+//
+// The v1 API is frozen: the identifiers below keep their names, signatures and documented behavior in every v1
+// release. New fields, options and methods may be added, defaulting to the current behavior.
+//
+//   - Parser: NewParser, NewTokenParser, Next and the options NSFlag (NSExpand, NSPrefix, NSStrip), MaxDepth,
+//     MaxChildren, MaxTokensPerRecord, MaxTokensTotal, CollectDepth and PreserveSpace. Next returns io.EOF at the end
+//     of the input and ErrUnexpectedEOF when it is cut short.
+//   - Node kinds: an element has the StartElement, Namespaces and Children read, a text node has no name and its
+//     text is read with Text, and the value of an attribute selected by an AttributeSelector is a text node whose
+//     Parent is its element and whose Path ends with @name. Parent, Path, PathNames, Depth, Name, Attrs, SetText,
+//     LookupPrefix, Detach and DeepCopy work on all of them.
+//   - Selector, SubtreeSelector and AttributeSelector, with PathSelector, ParsePathSelector, ParsePath, ParseXPath
+//     and the Path, Step, Position and Predicate they build.
+//   - Processor, ProcessorFunc and RecordError.
+//   - Mapper with SimpleMapper, BadgerFishMapper, ParkerMapper and OrderedMapper.
+//   - XMLExporter with NewXMLExporter, EncodeDeclaration and EncodeNode.
+//
+// The other exported identifiers are experimental and may still change in a minor release, until they are added to
+// this list. Identifiers that get renamed are kept as deprecated aliases of the new name, e.g. FormatNodePath and
+// UnexpectedEOF.
+package xmlpicker
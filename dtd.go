@@ -0,0 +1,368 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDTDDepth limits the nesting of parameter entities and of general entities within entity values.
+const maxDTDDepth = 16
+
+// dtd collects the general entities declared by the internal subset and external DTD of a document. It is not a
+// validating parser, everything but entity declarations, parameter entity references and conditional sections is
+// skipped, and external parameter entities are only read when they resolve to local files.
+type dtd struct {
+	catalog  *Catalog
+	entities map[string]string
+	params   map[string]*paramEntity
+	depth    int
+}
+
+type paramEntity struct {
+	value    string
+	publicID string
+	systemID string
+	base     string
+	external bool
+}
+
+// loadDoctype adds the entities declared by the DOCTYPE directive, and by its external DTD if the catalog resolves it,
+// to entities. Entities that are already present are kept.
+func (c *Catalog) loadDoctype(directive string, entities map[string]string) error {
+	directive = strings.TrimSpace(directive)
+	if !strings.HasPrefix(directive, "DOCTYPE") {
+		return nil
+	}
+	fields, subset := dtdFields(directive[len("DOCTYPE"):])
+	d := &dtd{catalog: c, entities: make(map[string]string), params: make(map[string]*paramEntity)}
+	// the internal subset is read first, the first declaration of an entity is binding
+	if err := d.parse(subset, ""); err != nil {
+		return err
+	}
+	if publicID, systemID, ok := externalID(fields, 1); ok {
+		if err := d.include(publicID, systemID, ""); err != nil {
+			return err
+		}
+	}
+	for name := range d.entities {
+		if _, ok := entities[name]; !ok {
+			entities[name] = d.expand(d.entities[name], 0)
+		}
+	}
+	return nil
+}
+
+// dtdFields splits the start of a declaration into whitespace separated fields, quoted literals are kept with their
+// quotes. Splitting stops at an internal subset, which is returned without its brackets.
+func dtdFields(s string) ([]string, string) {
+	var fields []string
+	i := 0
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i = i + 1
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				return append(fields, s[i:]), ""
+			}
+			fields = append(fields, s[i:i+end+2])
+			i = i + end + 2
+		case c == '[':
+			end := strings.LastIndexByte(s, ']')
+			if end < i {
+				end = len(s)
+			}
+			return fields, s[i+1 : end]
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\r\n\"'[", rune(s[i])) {
+				i = i + 1
+			}
+			fields = append(fields, s[start:i])
+		}
+	}
+	return fields, ""
+}
+
+// externalID reads SYSTEM "system" or PUBLIC "public" "system" from fields starting at i.
+func externalID(fields []string, i int) (string, string, bool) {
+	if i >= len(fields) {
+		return "", "", false
+	}
+	switch fields[i] {
+	case "SYSTEM":
+		if i+1 < len(fields) && isLiteral(fields[i+1]) {
+			return "", unquote(fields[i+1]), true
+		}
+	case "PUBLIC":
+		if i+1 < len(fields) && isLiteral(fields[i+1]) {
+			systemID := ""
+			if i+2 < len(fields) && isLiteral(fields[i+2]) {
+				systemID = unquote(fields[i+2])
+			}
+			return unquote(fields[i+1]), systemID, true
+		}
+	}
+	return "", "", false
+}
+
+func isLiteral(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0]
+}
+
+func unquote(s string) string {
+	return s[1 : len(s)-1]
+}
+
+// include parses an external DTD or parameter entity. Identifiers the catalog does not know are read relative to base
+// when they are local, anything else is skipped.
+func (d *dtd) include(publicID, systemID, base string) error {
+	filename, ok := d.catalog.Resolve(publicID, systemID)
+	if !ok {
+		if systemID == "" || base == "" {
+			return nil
+		}
+		if filename, ok = localPath(resolveLocal(base, systemID)); !ok {
+			return nil
+		}
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("xmlpicker: reading DTD %s: %s", systemID, err)
+	}
+	return d.parse(string(b), filepath.Dir(filename))
+}
+
+// parse reads the declarations of a DTD, base is the directory that relative system identifiers are resolved against.
+func (d *dtd) parse(s, base string) error {
+	d.depth = d.depth + 1
+	defer func() { d.depth = d.depth - 1 }()
+	if d.depth > maxDTDDepth {
+		return fmt.Errorf("xmlpicker: DTD nested too deeply")
+	}
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '%':
+			end := strings.IndexByte(s[i:], ';')
+			if end == -1 {
+				return nil
+			}
+			if err := d.reference(s[i+1:i+end], base); err != nil {
+				return err
+			}
+			i = i + end + 1
+		case strings.HasPrefix(s[i:], "<!--"):
+			i = skipPast(s, i, "-->")
+		case strings.HasPrefix(s[i:], "<?"):
+			i = skipPast(s, i, "?>")
+		case strings.HasPrefix(s[i:], "<!["):
+			keyword, body, end := conditionalSection(s, i)
+			if d.expandParams(keyword) == "INCLUDE" {
+				if err := d.parse(body, base); err != nil {
+					return err
+				}
+			}
+			i = end
+		case strings.HasPrefix(s[i:], "<!ENTITY"):
+			end := declarationEnd(s, i)
+			d.declare(s[i+len("<!ENTITY"):end-1], base)
+			i = end
+		case strings.HasPrefix(s[i:], "<!"):
+			i = declarationEnd(s, i)
+		default:
+			i = i + 1
+		}
+	}
+	return nil
+}
+
+func skipPast(s string, i int, end string) int {
+	j := strings.Index(s[i:], end)
+	if j == -1 {
+		return len(s)
+	}
+	return i + j + len(end)
+}
+
+// declarationEnd returns the offset after the > that ends the declaration starting at i.
+func declarationEnd(s string, i int) int {
+	var quote byte
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// conditionalSection splits the section starting at i into its keyword and body, and returns the offset after it.
+func conditionalSection(s string, i int) (string, string, int) {
+	open := strings.IndexByte(s[i+3:], '[')
+	if open == -1 {
+		return "", "", len(s)
+	}
+	keyword := strings.TrimSpace(s[i+3 : i+3+open])
+	start := i + 3 + open + 1
+	nesting := 1
+	for j := start; j < len(s); j++ {
+		if strings.HasPrefix(s[j:], "<![") {
+			nesting = nesting + 1
+		} else if strings.HasPrefix(s[j:], "]]>") {
+			nesting = nesting - 1
+			if nesting == 0 {
+				return keyword, s[start:j], j + 3
+			}
+		}
+	}
+	return keyword, s[start:], len(s)
+}
+
+// reference includes the text of a parameter entity.
+func (d *dtd) reference(name, base string) error {
+	pe, ok := d.params[name]
+	if !ok {
+		return nil
+	}
+	if pe.external {
+		return d.include(pe.publicID, pe.systemID, pe.base)
+	}
+	return d.parse(pe.value, base)
+}
+
+// declare records an entity declaration, the first declaration of a name is binding.
+func (d *dtd) declare(decl, base string) {
+	fields, _ := dtdFields(decl)
+	param := len(fields) > 0 && fields[0] == "%"
+	if param {
+		fields = fields[1:]
+	}
+	if len(fields) < 2 {
+		return
+	}
+	name := fields[0]
+	if param {
+		if _, ok := d.params[name]; ok {
+			return
+		}
+		if isLiteral(fields[1]) {
+			d.params[name] = &paramEntity{value: d.expandParams(unquote(fields[1]))}
+		} else if publicID, systemID, ok := externalID(fields, 1); ok {
+			d.params[name] = &paramEntity{publicID: publicID, systemID: systemID, base: base, external: true}
+		}
+		return
+	}
+	if _, ok := d.entities[name]; ok {
+		return
+	}
+	// external general entities are not supported
+	if isLiteral(fields[1]) {
+		d.entities[name] = expandCharRefs(d.expandParams(unquote(fields[1])))
+	}
+}
+
+// expandParams replaces the references to internal parameter entities in s.
+func (d *dtd) expandParams(s string) string {
+	for depth := 0; depth < maxDTDDepth && strings.IndexByte(s, '%') != -1; depth++ {
+		var out []string
+		rest := s
+		changed := false
+		for {
+			i := strings.IndexByte(rest, '%')
+			end := strings.IndexByte(rest[i+1:], ';')
+			if i == -1 || end == -1 {
+				out = append(out, rest)
+				break
+			}
+			name := rest[i+1 : i+1+end]
+			pe, ok := d.params[name]
+			if !ok || pe.external {
+				out = append(out, rest[:i+1])
+				rest = rest[i+1:]
+				continue
+			}
+			out = append(out, rest[:i], pe.value)
+			rest = rest[i+end+2:]
+			changed = true
+		}
+		s = strings.Join(out, "")
+		if !changed {
+			break
+		}
+	}
+	return s
+}
+
+// expandCharRefs replaces the character references in s.
+func expandCharRefs(s string) string {
+	if !strings.Contains(s, "&#") {
+		return s
+	}
+	var out []string
+	for {
+		i := strings.Index(s, "&#")
+		if i == -1 {
+			break
+		}
+		end := strings.IndexByte(s[i:], ';')
+		if end == -1 {
+			break
+		}
+		ref := s[i+2 : i+end]
+		var n uint64
+		var err error
+		if strings.HasPrefix(ref, "x") {
+			n, err = strconv.ParseUint(ref[1:], 16, 32)
+		} else {
+			n, err = strconv.ParseUint(ref, 10, 32)
+		}
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			out = append(out, s[:i+end+1])
+		} else {
+			out = append(out, s[:i], string(rune(n)))
+		}
+		s = s[i+end+1:]
+	}
+	return strings.Join(append(out, s), "")
+}
+
+var predefinedEntities = map[string]string{"lt": "<", "gt": ">", "amp": "&", "apos": "'", "quot": `"`}
+
+// expand replaces the references to general entities in an entity value, as the decoder inserts values as they are.
+func (d *dtd) expand(s string, depth int) string {
+	if depth > maxDTDDepth || !strings.Contains(s, "&") {
+		return s
+	}
+	var out []string
+	for {
+		i := strings.IndexByte(s, '&')
+		if i == -1 {
+			break
+		}
+		end := strings.IndexByte(s[i:], ';')
+		if end == -1 {
+			break
+		}
+		name := s[i+1 : i+end]
+		if v, ok := predefinedEntities[name]; ok {
+			out = append(out, s[:i], v)
+		} else if v, ok := d.entities[name]; ok {
+			out = append(out, s[:i], d.expand(v, depth+1))
+		} else {
+			out = append(out, s[:i+end+1])
+		}
+		s = s[i+end+1:]
+	}
+	return strings.Join(append(out, s), "")
+}
@@ -0,0 +1,76 @@
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EmbeddedXMLExpander parses XML documents that have been embedded as escaped text and splices their root element
+// into the Node tree in place of the text.
+//
+// Nodes matched by Selector must contain an embedded document, otherwise an error is returned. When Detect is set any
+// text only node whose content looks like XML is expanded, text that fails to parse is left untouched.
+type EmbeddedXMLExpander struct {
+	Selector Selector
+	Detect   bool
+	NSFlag   NSFlag
+}
+
+// Expand walks node and its descendants, expanding every embedded document that is found.
+func (x *EmbeddedXMLExpander) Expand(node *Node) error {
+	if _, ok := node.Text(); ok {
+		return nil
+	}
+	if x.Selector != nil && x.Selector.Matches(node) {
+		return x.expandNode(node, true)
+	}
+	if x.Detect {
+		if err := x.expandNode(node, false); err != nil {
+			return err
+		}
+	}
+	for _, c := range node.Children {
+		if err := x.Expand(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *EmbeddedXMLExpander) expandNode(node *Node, required bool) error {
+	text, ok := textContent(node)
+	if !ok || (!required && !looksLikeXML(text)) {
+		if required {
+			return fmt.Errorf("xmlpicker: expected embedded xml at %s", node.Path())
+		}
+		return nil
+	}
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = true
+	parser := NewParser(decoder, PathSelector("/"))
+	parser.NSFlag = x.NSFlag
+	root, err := parser.Next()
+	if err == nil {
+		_, err = parser.Next()
+		if err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = fmt.Errorf("xmlpicker: multiple root elements")
+		}
+	}
+	if err != nil {
+		if !required {
+			return nil
+		}
+		return fmt.Errorf("xmlpicker: invalid embedded xml at %s: %s", node.Path(), err)
+	}
+	root.Parent = node
+	node.Children = []*Node{root}
+	return nil
+}
+
+func looksLikeXML(s string) bool {
+	return strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">")
+}
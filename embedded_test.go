@@ -0,0 +1,110 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestEmbeddedXMLExpander(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		xml         string
+		selector    string
+		detect      bool
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "control",
+			xml:      `<a><payload>&lt;order id="1"&gt;&lt;/order&gt;</payload></a>`,
+			expected: `{"_name":"a","payload":[{"#text":["<order id=\"1\"></order>"]}]}`,
+		},
+		{
+			name:     "selector",
+			xml:      `<a><payload>&lt;order id="1"&gt;&lt;item&gt;x&lt;/item&gt;&lt;/order&gt;</payload></a>`,
+			selector: "/a/payload",
+			expected: `{"_name":"a","payload":[{"order":[{"@id":"1","item":[{"#text":["x"]}]}]}]}`,
+		},
+		{
+			name:     "cdata",
+			xml:      `<a><payload><![CDATA[<order id="1"/>]]></payload></a>`,
+			selector: "/a/payload",
+			expected: `{"_name":"a","payload":[{"order":[{"@id":"1"}]}]}`,
+		},
+		{
+			name:     "detect",
+			xml:      `<a><b>&lt;order/&gt;</b><c>&lt;not xml</c><d>&lt;bad&gt;</d></a>`,
+			detect:   true,
+			expected: `{"_name":"a","b":[{"order":[{}]}],"c":[{"#text":["<not xml"]}],"d":[{"#text":["<bad>"]}]}`,
+		},
+		{
+			name:        "selector invalid",
+			xml:         `<a><payload>&lt;bad&gt;</payload></a>`,
+			selector:    "/a/payload",
+			expectedErr: "xmlpicker: invalid embedded xml at /a/payload: XML syntax error on line 1: unexpected EOF",
+		},
+		{
+			name:        "selector multiple roots",
+			xml:         `<a><payload>&lt;x/&gt;&lt;y/&gt;</payload></a>`,
+			selector:    "/a/payload",
+			expectedErr: "xmlpicker: invalid embedded xml at /a/payload: xmlpicker: multiple root elements",
+		},
+		{
+			name:        "selector not text",
+			xml:         `<a><payload><x/></payload></a>`,
+			selector:    "/a/payload",
+			expectedErr: "xmlpicker: expected embedded xml at /a/payload",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			expander := xmlpicker.EmbeddedXMLExpander{Detect: test.detect}
+			if test.selector != "" {
+				expander.Selector = xmlpicker.PathSelector(test.selector)
+			}
+			var b bytes.Buffer
+			e := json.NewEncoder(&b)
+			e.SetEscapeHTML(false)
+			var actualErr error
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector("/"))
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					actualErr = err
+					break
+				}
+				if err := expander.Expand(n); err != nil {
+					actualErr = err
+					break
+				}
+				v, err := xmlpicker.SimpleMapper{}.FromNode(n)
+				if err != nil {
+					actualErr = err
+					break
+				}
+				if err := e.Encode(v); err != nil {
+					actualErr = err
+					break
+				}
+			}
+			if test.expectedErr != "" {
+				assert.EqualError(t, actualErr, test.expectedErr, "%s\nXML:\n%s\n", name, test.xml)
+				return
+			}
+			assert.NoError(t, actualErr, "%s\nXML:\n%s\n", name, test.xml)
+			actual := strings.TrimSuffix(b.String(), "\n")
+			assert.Equal(t, test.expected, actual, "%s\nXML:\n%s\n", name, test.xml)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package xmlpicker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LookupTable holds reference data keyed by a single column, e.g. the names of category codes.
+type LookupTable struct {
+	// Columns are the names of the values of each row, in order, without the key column.
+	Columns []string
+	Rows    map[string][]string
+}
+
+// ReadLookupCSV reads a LookupTable from CSV with a header line. The key is the column named keyColumn, or the first
+// column when keyColumn is empty.
+func ReadLookupCSV(r io.Reader, keyColumn string) (*LookupTable, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("xmlpicker: missing lookup header")
+	} else if err != nil {
+		return nil, err
+	}
+	key := 0
+	if keyColumn != "" {
+		key = -1
+		for i, v := range header {
+			if v == keyColumn {
+				key = i
+			}
+		}
+		if key == -1 {
+			return nil, fmt.Errorf("xmlpicker: missing lookup key column %q", keyColumn)
+		}
+	}
+	t := &LookupTable{Rows: make(map[string][]string)}
+	t.Columns = dropColumn(header, key)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return t, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if _, ok := t.Rows[record[key]]; ok {
+			return nil, fmt.Errorf("xmlpicker: duplicate lookup key %q", record[key])
+		}
+		t.Rows[record[key]] = dropColumn(record, key)
+	}
+}
+
+// ReadLookupJSON reads a LookupTable from either an object of rows by key or an array of rows holding their key in
+// keyColumn. A row is an object, the values of which must be scalars, or a single scalar that is stored in a "value"
+// column.
+func ReadLookupJSON(r io.Reader, keyColumn string) (*LookupTable, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	rows := make(map[string]map[string]string)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, row := range v {
+			values, err := lookupRow(row)
+			if err != nil {
+				return nil, err
+			}
+			rows[key] = values
+		}
+	case []interface{}:
+		if keyColumn == "" {
+			return nil, fmt.Errorf("xmlpicker: missing lookup key column for an array of rows")
+		}
+		for _, row := range v {
+			values, err := lookupRow(row)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := values[keyColumn]
+			if !ok {
+				return nil, fmt.Errorf("xmlpicker: missing lookup key column %q", keyColumn)
+			}
+			if _, ok := rows[key]; ok {
+				return nil, fmt.Errorf("xmlpicker: duplicate lookup key %q", key)
+			}
+			delete(values, keyColumn)
+			rows[key] = values
+		}
+	default:
+		return nil, fmt.Errorf("xmlpicker: expected an object or array of lookup rows")
+	}
+	columns := make(map[string]bool)
+	for _, row := range rows {
+		for k := range row {
+			columns[k] = true
+		}
+	}
+	t := &LookupTable{Rows: make(map[string][]string, len(rows))}
+	for k := range columns {
+		t.Columns = append(t.Columns, k)
+	}
+	sort.Strings(t.Columns)
+	for key, row := range rows {
+		values := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			values[i] = row[c]
+		}
+		t.Rows[key] = values
+	}
+	return t, nil
+}
+
+func lookupRow(v interface{}) (map[string]string, error) {
+	row, ok := v.(map[string]interface{})
+	if !ok {
+		s, err := lookupValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"value": s}, nil
+	}
+	values := make(map[string]string, len(row))
+	for k, v := range row {
+		s, err := lookupValue(v)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = s
+	}
+	return values, nil
+}
+
+func lookupValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("xmlpicker: expected a scalar lookup value, got %T", v)
+}
+
+// LoadLookupTable reads a LookupTable from filename, which is read as JSON when it has a .json extension and as CSV
+// otherwise.
+func LoadLookupTable(filename string, keyColumn string) (*LookupTable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var t *LookupTable
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		t, err = ReadLookupJSON(f, keyColumn)
+	} else {
+		t, err = ReadLookupCSV(f, keyColumn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s in %s", err, filename)
+	}
+	return t, nil
+}
+
+func dropColumn(record []string, i int) []string {
+	values := make([]string, 0, len(record)-1)
+	values = append(values, record[:i]...)
+	return append(values, record[i+1:]...)
+}
+
+// Enricher joins nodes against a LookupTable, adding the values of the row matching the key of a node as attributes
+// named after their column with Prefix prepended. Nodes without a key or a matching row are left untouched unless
+// Required is set, in which case an error is returned.
+type Enricher struct {
+	Key      *KeyPath
+	Table    *LookupTable
+	Prefix   string
+	Required bool
+}
+
+// Enrich adds the values of the row matching node to it.
+func (e *Enricher) Enrich(node *Node) error {
+	key, ok := e.Key.Key(node)
+	if !ok {
+		if e.Required {
+			return fmt.Errorf("xmlpicker: missing lookup key %s at %s", e.Key, node.Path())
+		}
+		return nil
+	}
+	row, ok := e.Table.Rows[key]
+	if !ok {
+		if e.Required {
+			return fmt.Errorf("xmlpicker: no lookup row for %q at %s", key, node.Path())
+		}
+		return nil
+	}
+	for i, c := range e.Table.Columns {
+		node.StartElement.Attr = append(node.StartElement.Attr, xml.Attr{Name: xml.Name{Local: e.Prefix + c}, Value: row[i]})
+	}
+	return nil
+}
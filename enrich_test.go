@@ -0,0 +1,183 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestReadLookup(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		json        bool
+		data        string
+		keyColumn   string
+		expected    *xmlpicker.LookupTable
+		expectedErr string
+	}{
+		{
+			name:     "csv",
+			data:     "code,name,group\nA,Apples,fruit\nB,Beans,veg\n",
+			expected: &xmlpicker.LookupTable{Columns: []string{"name", "group"}, Rows: map[string][]string{"A": {"Apples", "fruit"}, "B": {"Beans", "veg"}}},
+		},
+		{
+			name:      "csv key column",
+			data:      "name,code\nApples,A\n",
+			keyColumn: "code",
+			expected:  &xmlpicker.LookupTable{Columns: []string{"name"}, Rows: map[string][]string{"A": {"Apples"}}},
+		},
+		{
+			name:        "csv missing key column",
+			data:        "name,code\nApples,A\n",
+			keyColumn:   "id",
+			expectedErr: `xmlpicker: missing lookup key column "id"`,
+		},
+		{
+			name:        "csv duplicate key",
+			data:        "code,name\nA,Apples\nA,Apricots\n",
+			expectedErr: `xmlpicker: duplicate lookup key "A"`,
+		},
+		{
+			name:        "csv empty",
+			expectedErr: "xmlpicker: missing lookup header",
+		},
+		{
+			name:     "json object",
+			json:     true,
+			data:     `{"A": {"name": "Apples", "price": 1.5}, "B": {"name": "Beans", "organic": true}}`,
+			expected: &xmlpicker.LookupTable{Columns: []string{"name", "organic", "price"}, Rows: map[string][]string{"A": {"Apples", "", "1.5"}, "B": {"Beans", "true", ""}}},
+		},
+		{
+			name:     "json scalars",
+			json:     true,
+			data:     `{"A": "Apples", "B": "Beans"}`,
+			expected: &xmlpicker.LookupTable{Columns: []string{"value"}, Rows: map[string][]string{"A": {"Apples"}, "B": {"Beans"}}},
+		},
+		{
+			name:      "json array",
+			json:      true,
+			data:      `[{"code": "A", "name": "Apples"}, {"code": 2, "name": "Beans"}]`,
+			keyColumn: "code",
+			expected:  &xmlpicker.LookupTable{Columns: []string{"name"}, Rows: map[string][]string{"A": {"Apples"}, "2": {"Beans"}}},
+		},
+		{
+			name:        "json array without key column",
+			json:        true,
+			data:        `[{"code": "A", "name": "Apples"}]`,
+			expectedErr: "xmlpicker: missing lookup key column for an array of rows",
+		},
+		{
+			name:        "json nested value",
+			json:        true,
+			data:        `{"A": {"name": ["Apples"]}}`,
+			expectedErr: "xmlpicker: expected a scalar lookup value, got []interface {}",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			read := xmlpicker.ReadLookupCSV
+			if test.json {
+				read = xmlpicker.ReadLookupJSON
+			}
+			actual, err := read(strings.NewReader(test.data), test.keyColumn)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, actual, name)
+			}
+		})
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	table := &xmlpicker.LookupTable{
+		Columns: []string{"name", "group"},
+		Rows:    map[string][]string{"A": {"Apples", "fruit"}, "B": {"Beans", "veg"}},
+	}
+	for idx, test := range []struct {
+		name        string
+		xml         string
+		key         string
+		prefix      string
+		required    bool
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "attribute key",
+			xml:      `<item category="B"/>`,
+			key:      "@category",
+			prefix:   "category_",
+			expected: `{"@category":"B","@category_group":"veg","@category_name":"Beans","_name":"item"}`,
+		},
+		{
+			name:     "child key",
+			xml:      `<item><category>A</category></item>`,
+			key:      "category",
+			expected: `{"@group":"fruit","@name":"Apples","_name":"item","category":[{"#text":["A"]}]}`,
+		},
+		{
+			name:     "no match",
+			xml:      `<item category="C"/>`,
+			key:      "@category",
+			expected: `{"@category":"C","_name":"item"}`,
+		},
+		{
+			name:     "no key",
+			xml:      `<item/>`,
+			key:      "@category",
+			expected: `{"_name":"item"}`,
+		},
+		{
+			name:        "required no match",
+			xml:         `<item category="C"/>`,
+			key:         "@category",
+			required:    true,
+			expectedErr: `xmlpicker: no lookup row for "C" at /item`,
+		},
+		{
+			name:        "required no key",
+			xml:         `<item/>`,
+			key:         "@category",
+			required:    true,
+			expectedErr: "xmlpicker: missing lookup key @category at /item",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			key, err := xmlpicker.ParseKeyPath(test.key)
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector("/"))
+			n, err := parser.Next()
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			e := &xmlpicker.Enricher{Key: key, Table: table, Prefix: test.prefix, Required: test.required}
+			err = e.Enrich(n)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			v, err := xmlpicker.SimpleMapper{}.FromNode(n)
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			var b bytes.Buffer
+			assert.NoError(t, json.NewEncoder(&b).Encode(v), name)
+			assert.Equal(t, test.expected, strings.TrimSuffix(b.String(), "\n"), name)
+		})
+	}
+}
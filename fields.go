@@ -0,0 +1,131 @@
+package xmlpicker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Field names the value a KeyPath selects from a record.
+type Field struct {
+	Name string
+	Key  *KeyPath
+}
+
+// KeyValue is a named value of a record, as written by WriteKeyValues and WriteEnv.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// ParseField parses NAME=KEY-PATH, or a KEY-PATH which is then named after its last step.
+func ParseField(s string) (Field, error) {
+	name, path := "", s
+	if i := strings.Index(s, "="); i != -1 {
+		name, path = strings.TrimSpace(s[:i]), s[i+1:]
+		if name == "" {
+			return Field{}, fmt.Errorf("xmlpicker: invalid field %q", s)
+		}
+	}
+	k, err := ParseKeyPath(path)
+	if err != nil {
+		return Field{}, err
+	}
+	if name == "" {
+		name = strings.TrimSuffix(k.expr, "/#text")
+		if i := strings.LastIndex(name, "/"); i != -1 {
+			name = name[i+1:]
+		}
+		name = strings.TrimPrefix(name, "@")
+		if name == "#text" {
+			name = "text"
+		}
+	}
+	return Field{Name: name, Key: k}, nil
+}
+
+// RecordFields returns the values of fields in node, leaving out those it does not have. Without fields the attributes
+// of node are returned, followed by the first of each of its child elements that only have text.
+func RecordFields(node *Node, fields []Field) []KeyValue {
+	var kvs []KeyValue
+	if len(fields) != 0 {
+		for _, f := range fields {
+			if v, ok := f.Key.Key(node); ok {
+				kvs = append(kvs, KeyValue{Key: f.Name, Value: v})
+			}
+		}
+		return kvs
+	}
+	seen := make(map[string]bool)
+	add := func(key, value string) {
+		if !seen[key] {
+			seen[key] = true
+			kvs = append(kvs, KeyValue{Key: key, Value: value})
+		}
+	}
+	for _, a := range node.StartElement.Attr {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		add(a.Name.Local, a.Value)
+	}
+	for _, c := range node.Children {
+		if _, ok := c.Text(); ok {
+			continue
+		}
+		if text, ok := textContent(c); ok {
+			add(c.StartElement.Name.Local, text)
+		}
+	}
+	return kvs
+}
+
+// WriteKeyValues writes a key=value line for each of kvs, keys are made valid shell variable names and values are
+// quoted for POSIX shells when needed.
+func WriteKeyValues(w io.Writer, kvs []KeyValue) error {
+	var b bytes.Buffer
+	for _, kv := range kvs {
+		b.WriteString(variableName(kv.Key) + "=" + shellQuote(kv.Value) + "\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteEnv writes kvs in the style of env files, with upper case keys and double quoted values.
+func WriteEnv(w io.Writer, kvs []KeyValue) error {
+	var b bytes.Buffer
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "\n", `\n`, "\r", `\r`)
+	for _, kv := range kvs {
+		b.WriteString(strings.ToUpper(variableName(kv.Key)) + `="` + r.Replace(kv.Value) + "\"\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// variableName replaces the characters of s that cannot be part of a shell variable name with underscores.
+func variableName(s string) string {
+	name := []byte(s)
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	for _, c := range s {
+		if !(c == '_' || c == '-' || c == '.' || c == '/' || c == ':' || c == ',' || c == '@' || c == '+' ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+		}
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestRecordFields(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		xml         string
+		fields      []string
+		expectedKV  string
+		expectedEnv string
+		expectedErr string
+	}{
+		{
+			name:        "attributes and text children",
+			xml:         `<item id="1" x:type="a b" xmlns:x="urn:x"><title>It's</title><title>again</title><body><p>skipped</p></body></item>`,
+			expectedKV:  "id=1\ntype='a b'\ntitle='It'\\''s'\n",
+			expectedEnv: "ID=\"1\"\nTYPE=\"a b\"\nTITLE=\"It's\"\n",
+		},
+		{
+			name:        "fields",
+			xml:         `<item id="1"><meta><price>$5</price></meta></item>`,
+			fields:      []string{"@id", "cost=meta/price", "meta/missing"},
+			expectedKV:  "id=1\ncost='$5'\n",
+			expectedEnv: "ID=\"1\"\nCOST=\"\\$5\"\n",
+		},
+		{
+			name:        "names made valid",
+			xml:         `<item data-id="7"><line-1>a "b"` + "\n" + `c</line-1></item>`,
+			expectedKV:  "data_id=7\nline_1='a \"b\"\nc'\n",
+			expectedEnv: "DATA_ID=\"7\"\nLINE_1=\"a \\\"b\\\"\\nc\"\n",
+		},
+		{
+			name:        "empty value",
+			xml:         `<item id=""/>`,
+			expectedKV:  "id=''\n",
+			expectedEnv: "ID=\"\"\n",
+		},
+		{
+			name:        "invalid field",
+			xml:         `<item/>`,
+			fields:      []string{"=@id"},
+			expectedErr: `xmlpicker: invalid field "=@id"`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			var fields []xmlpicker.Field
+			for _, v := range test.fields {
+				f, err := xmlpicker.ParseField(v)
+				if test.expectedErr != "" {
+					assert.EqualError(t, err, test.expectedErr, name)
+					return
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				fields = append(fields, f)
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector("/"))
+			parser.NSFlag = xmlpicker.NSPrefix
+			n, err := parser.Next()
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			kvs := xmlpicker.RecordFields(n, fields)
+			var b bytes.Buffer
+			assert.NoError(t, xmlpicker.WriteKeyValues(&b, kvs), name)
+			assert.Equal(t, test.expectedKV, b.String(), name)
+			b.Reset()
+			assert.NoError(t, xmlpicker.WriteEnv(&b, kvs), name)
+			assert.Equal(t, test.expectedEnv, b.String(), name)
+		})
+	}
+}
+
+func TestParseField(t *testing.T) {
+	for idx, test := range []struct {
+		field    string
+		expected string
+	}{
+		{field: "@id", expected: "id"},
+		{field: "meta/price", expected: "price"},
+		{field: "meta/price/#text", expected: "price"},
+		{field: "#text", expected: "text"},
+		{field: "cost = meta/price", expected: "cost"},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.field)
+		t.Run(name, func(t *testing.T) {
+			f, err := xmlpicker.ParseField(test.field)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, f.Name, name)
+			}
+		})
+	}
+}
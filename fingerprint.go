@@ -0,0 +1,118 @@
+package xmlpicker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Fingerprinter computes a stable hash of the content of nodes, for instance to detect the records that changed
+// between two deliveries of a feed or as an idempotency key.
+//
+// The whole node is hashed unless Paths is given, in which case only the keys they select are. The hash of a whole
+// node does not depend on the order of attributes, on whitespace only text or on how namespaces were declared, and
+// ignores the attributes named in Ignore as well as Field.
+type Fingerprinter struct {
+	// Field is the attribute Annotate stores the hash in.
+	Field  string
+	Paths  []*KeyPath
+	Ignore []string
+	// Hash defaults to SHA-256.
+	Hash func() hash.Hash
+}
+
+// Fingerprint returns the hex encoded hash of node.
+func (f *Fingerprinter) Fingerprint(node *Node) string {
+	newHash := f.Hash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	h := newHash()
+	if len(f.Paths) != 0 {
+		for _, p := range f.Paths {
+			if key, ok := p.Key(node); ok {
+				io.WriteString(h, "="+key+"\x00")
+			} else {
+				io.WriteString(h, "-\x00")
+			}
+		}
+	} else {
+		f.writeNode(h, node)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Annotate adds the hash of node to it as the Field attribute, replacing any previous value.
+func (f *Fingerprinter) Annotate(node *Node) error {
+	value := f.Fingerprint(node)
+	for i, a := range node.StartElement.Attr {
+		if a.Name.Space == "" && a.Name.Local == f.Field {
+			node.StartElement.Attr[i].Value = value
+			return nil
+		}
+	}
+	node.StartElement.Attr = append(node.StartElement.Attr, xml.Attr{Name: xml.Name{Local: f.Field}, Value: value})
+	return nil
+}
+
+func (f *Fingerprinter) writeNode(w io.Writer, node *Node) {
+	io.WriteString(w, "<"+node.StartElement.Name.Space+"\x00"+node.StartElement.Name.Local+"\x00")
+	var attrs []xml.Attr
+	for _, a := range node.StartElement.Attr {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && (a.Name.Local == "xmlns" || f.ignored(a.Name.Local))) {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	sort.Sort(byName(attrs))
+	for _, a := range attrs {
+		io.WriteString(w, "@"+a.Name.Space+"\x00"+a.Name.Local+"\x00"+a.Value+"\x00")
+	}
+	var text []string
+	for _, c := range node.Children {
+		if s, ok := c.Text(); ok {
+			text = append(text, s)
+			continue
+		}
+		writeText(w, text)
+		text = nil
+		f.writeNode(w, c)
+	}
+	writeText(w, text)
+	io.WriteString(w, ">")
+}
+
+func (f *Fingerprinter) ignored(name string) bool {
+	if name == f.Field {
+		return true
+	}
+	for _, v := range f.Ignore {
+		if name == v {
+			return true
+		}
+	}
+	return false
+}
+
+// writeText writes adjacent text nodes as one, unless they are only whitespace.
+func writeText(w io.Writer, text []string) {
+	s := strings.Join(text, "")
+	if strings.TrimSpace(s) != "" {
+		io.WriteString(w, "#"+s+"\x00")
+	}
+}
+
+type byName []xml.Attr
+
+func (a byName) Len() int      { return len(a) }
+func (a byName) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool {
+	if a[i].Name.Space != a[j].Name.Space {
+		return a[i].Name.Space < a[j].Name.Space
+	}
+	return a[i].Name.Local < a[j].Name.Local
+}
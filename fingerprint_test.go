@@ -0,0 +1,141 @@
+package xmlpicker_test
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestFingerprinter(t *testing.T) {
+	for idx, test := range []struct {
+		name  string
+		a     string
+		b     string
+		paths []string
+		hash  func() hash.Hash
+		same  bool
+	}{
+		{
+			name: "identical",
+			a:    `<a id="1"><b>x</b></a>`,
+			b:    `<a id="1"><b>x</b></a>`,
+			same: true,
+		},
+		{
+			name: "attribute order and whitespace",
+			a:    `<a id="1" type="t"><b>x</b></a>`,
+			b:    "<a type=\"t\" id=\"1\">\n  <b>x</b>\n</a>",
+			same: true,
+		},
+		{
+			name: "namespace prefixes",
+			a:    `<p:a xmlns:p="urn:x"><p:b>x</p:b></p:a>`,
+			b:    `<a xmlns="urn:x"><b>x</b></a>`,
+			same: true,
+		},
+		{
+			name: "ignored attributes",
+			a:    `<a id="1" _file="one.xml" _hash="old"/>`,
+			b:    `<a id="1" _file="two.xml"/>`,
+			same: true,
+		},
+		{
+			name: "text",
+			a:    `<a><b>x</b></a>`,
+			b:    `<a><b>y</b></a>`,
+		},
+		{
+			name: "text split across children",
+			a:    `<a>x<b/>y</a>`,
+			b:    `<a>xy<b/></a>`,
+		},
+		{
+			name: "attribute",
+			a:    `<a id="1"/>`,
+			b:    `<a id="2"/>`,
+		},
+		{
+			name: "element name",
+			a:    `<a><b/></a>`,
+			b:    `<a><c/></a>`,
+		},
+		{
+			name:  "paths",
+			a:     `<a id="1" seen="today"><title>t</title><body>one</body></a>`,
+			b:     `<a id="1" seen="yesterday"><title>t</title><body>two</body></a>`,
+			paths: []string{"@id", "title"},
+			same:  true,
+		},
+		{
+			name:  "paths differ",
+			a:     `<a id="1"><title>t</title></a>`,
+			b:     `<a id="1"><title>u</title></a>`,
+			paths: []string{"@id", "title"},
+		},
+		{
+			name:  "paths missing and empty",
+			a:     `<a id=""/>`,
+			b:     `<a/>`,
+			paths: []string{"@id"},
+		},
+		{
+			name: "md5",
+			a:    `<a id="1"/>`,
+			b:    `<a id="1"/>`,
+			hash: md5.New,
+			same: true,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			f := &xmlpicker.Fingerprinter{Field: "_hash", Ignore: []string{"_file"}, Hash: test.hash}
+			for _, p := range test.paths {
+				k, err := xmlpicker.ParseKeyPath(p)
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				f.Paths = append(f.Paths, k)
+			}
+			a := fingerprint(t, f, test.a)
+			b := fingerprint(t, f, test.b)
+			if test.same {
+				assert.Equal(t, a, b, name)
+			} else {
+				assert.NotEqual(t, a, b, name)
+			}
+			if test.hash == nil {
+				assert.Len(t, a, 64, name)
+			}
+		})
+	}
+}
+
+func TestFingerprinterAnnotate(t *testing.T) {
+	f := &xmlpicker.Fingerprinter{Field: "_hash"}
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(`<a id="1"/>`)), xmlpicker.PathSelector("/"))
+	n, err := parser.Next()
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected := f.Fingerprint(n)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, f.Annotate(n))
+		assert.Equal(t, []xml.Attr{
+			{Name: xml.Name{Local: "id"}, Value: "1"},
+			{Name: xml.Name{Local: "_hash"}, Value: expected},
+		}, n.StartElement.Attr)
+	}
+}
+
+func fingerprint(t *testing.T, f *xmlpicker.Fingerprinter, s string) string {
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(s)), xmlpicker.PathSelector("/"))
+	n, err := parser.Next()
+	assert.NoError(t, err, s)
+	return f.Fingerprint(n)
+}
@@ -0,0 +1,184 @@
+package xmlpicker
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+)
+
+// DocumentGenerator writes synthetic documents of any size, the same settings and Seed always give the same bytes, so
+// that performance work and limit testing can run without shipping huge fixtures.
+//
+// The document element is named doc and its children, the records, are named record with an id attribute counting
+// from 1, so that /doc/record selects them. The elements below a record have random names and attributes, elements
+// without children hold random text.
+type DocumentGenerator struct {
+	Seed int64
+	// Records is the number of records, Size the number of bytes after which no record is started. One of them is
+	// required, the generator stops at whichever comes first.
+	Records int
+	Size    int64
+	// Depth is the number of levels of elements below a record, FanOut the maximum number of children of each of
+	// them.
+	Depth  int
+	FanOut int
+	// Attributes is the maximum number of attributes of an element besides the id of records.
+	Attributes int
+	// TextSize is the maximum number of bytes of a text.
+	TextSize int
+	// Namespaces is the number of prefixes declared on the document element, NamespaceDensity the probability, from 0
+	// to 1, that the name of an element or attribute below a record uses one of them.
+	Namespaces       int
+	NamespaceDensity float64
+}
+
+var generatedNames = []string{"item", "name", "value", "group", "entry", "field", "note", "part", "title", "code"}
+
+var generatedWords = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do",
+	"eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua", "&", "<", "été"}
+
+// Validate reports the settings that would not give a finite or well formed document.
+func (g *DocumentGenerator) Validate() error {
+	switch {
+	case g.Records < 0 || g.Size < 0:
+		return fmt.Errorf("xmlpicker: negative number of records or size")
+	case g.Records == 0 && g.Size == 0:
+		return fmt.Errorf("xmlpicker: a number of records or a size is required")
+	case g.Depth < 0 || g.FanOut < 0 || g.Attributes < 0 || g.TextSize < 0 || g.Namespaces < 0:
+		return fmt.Errorf("xmlpicker: negative depth, fan-out, attributes, text size or namespaces")
+	case g.Depth > 0 && g.FanOut == 0:
+		return fmt.Errorf("xmlpicker: a depth requires a fan-out")
+	case g.NamespaceDensity < 0 || g.NamespaceDensity > 1:
+		return fmt.Errorf("xmlpicker: namespace density %g is not between 0 and 1", g.NamespaceDensity)
+	}
+	return nil
+}
+
+// WriteTo writes the document to w and returns the number of bytes written.
+func (g *DocumentGenerator) WriteTo(w io.Writer) (int64, error) {
+	if err := g.Validate(); err != nil {
+		return 0, err
+	}
+	out := &generatorWriter{w: bufio.NewWriter(w)}
+	s := &generatorState{g: g, rand: rand.New(rand.NewSource(g.Seed)), w: out}
+	out.WriteString(xml.Header)
+	out.WriteString("<doc")
+	for i := 0; i < g.Namespaces; i++ {
+		fmt.Fprintf(out, ` xmlns:n%d="urn:xmlpicker:gendoc:%d"`, i, i)
+	}
+	out.WriteString(">\n")
+	for id := 1; g.Records == 0 || id <= g.Records; id++ {
+		if g.Size != 0 && out.n >= g.Size {
+			break
+		}
+		fmt.Fprintf(out, `<record id="%d"`, id)
+		s.attributes()
+		out.WriteString(">")
+		s.content(g.Depth)
+		out.WriteString("</record>\n")
+		if out.err != nil {
+			break
+		}
+	}
+	out.WriteString("</doc>\n")
+	if out.err == nil {
+		out.err = out.w.Flush()
+	}
+	return out.n, out.err
+}
+
+type generatorState struct {
+	g    *DocumentGenerator
+	rand *rand.Rand
+	w    *generatorWriter
+}
+
+// content writes the children of an element with depth levels below it, or its text.
+func (s *generatorState) content(depth int) {
+	if depth == 0 {
+		s.text()
+		return
+	}
+	n := 1 + s.rand.Intn(s.g.FanOut)
+	for i := 0; i < n; i++ {
+		name := s.name()
+		s.w.WriteString("<" + name)
+		s.attributes()
+		s.w.WriteString(">")
+		s.content(depth - 1)
+		s.w.WriteString("</" + name + ">")
+	}
+}
+
+func (s *generatorState) attributes() {
+	if s.g.Attributes == 0 {
+		return
+	}
+	n := s.rand.Intn(s.g.Attributes + 1)
+	seen := map[string]bool{"id": true}
+	for i := 0; i < n; i++ {
+		name := s.name()
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		s.w.WriteString(" " + name + `="`)
+		xml.EscapeText(s.w, []byte(s.words(1+s.rand.Intn(3), 32)))
+		s.w.WriteString(`"`)
+	}
+}
+
+func (s *generatorState) text() {
+	if s.g.TextSize == 0 {
+		return
+	}
+	xml.EscapeText(s.w, []byte(s.words(s.g.TextSize, 1+s.rand.Intn(s.g.TextSize))))
+}
+
+// words returns up to count words separated by spaces in no more than size bytes.
+func (s *generatorState) words(count, size int) string {
+	var b []byte
+	for i := 0; i < count; i++ {
+		word := generatedWords[s.rand.Intn(len(generatedWords))]
+		if len(b)+1+len(word) > size {
+			break
+		}
+		if len(b) != 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, word...)
+	}
+	return string(b)
+}
+
+func (s *generatorState) name() string {
+	name := generatedNames[s.rand.Intn(len(generatedNames))]
+	if s.g.Namespaces != 0 && s.rand.Float64() < s.g.NamespaceDensity {
+		return "n" + strconv.Itoa(s.rand.Intn(s.g.Namespaces)) + ":" + name
+	}
+	return name
+}
+
+// generatorWriter counts the bytes written and keeps the first error, so that the generator checks it once per record.
+type generatorWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *generatorWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
+
+func (w *generatorWriter) WriteString(s string) {
+	w.Write([]byte(s))
+}
@@ -0,0 +1,93 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestDocumentGenerator(t *testing.T) {
+	for idx, test := range []struct {
+		name      string
+		generator xmlpicker.DocumentGenerator
+		records   int
+		depth     int
+		err       string
+	}{
+		{"records", xmlpicker.DocumentGenerator{Seed: 1, Records: 20, Depth: 3, FanOut: 4, Attributes: 2, TextSize: 40}, 20, 3, ""},
+		{"namespaces", xmlpicker.DocumentGenerator{Seed: 2, Records: 10, Depth: 2, FanOut: 3, Attributes: 3, TextSize: 10, Namespaces: 3, NamespaceDensity: 0.5}, 10, 2, ""},
+		{"flat", xmlpicker.DocumentGenerator{Seed: 3, Records: 5, TextSize: 5}, 5, 0, ""},
+		{"size", xmlpicker.DocumentGenerator{Seed: 4, Size: 1 << 10, Depth: 1, FanOut: 2, TextSize: 20}, -1, 1, ""},
+		{"required", xmlpicker.DocumentGenerator{}, 0, 0, "xmlpicker: a number of records or a size is required"},
+		{"fan-out", xmlpicker.DocumentGenerator{Records: 1, Depth: 2}, 0, 0, "xmlpicker: a depth requires a fan-out"},
+		{"density", xmlpicker.DocumentGenerator{Records: 1, NamespaceDensity: 2}, 0, 0, "xmlpicker: namespace density 2 is not between 0 and 1"},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.name), func(t *testing.T) {
+			var b bytes.Buffer
+			n, err := test.generator.WriteTo(&b)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, int64(b.Len()), n)
+
+			var again bytes.Buffer
+			_, err = test.generator.WriteTo(&again)
+			assert.NoError(t, err)
+			assert.Equal(t, b.String(), again.String())
+
+			parser := xmlpicker.NewParser(xml.NewDecoder(bytes.NewReader(b.Bytes())), xmlpicker.PathSelector("/doc/record"))
+			parser.NSFlag = xmlpicker.NSPrefix
+			records := 0
+			for {
+				node, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				records++
+				assert.Equal(t, fmt.Sprint(records), node.StartElement.Attr[0].Value)
+				assert.Equal(t, test.depth, depth(node))
+			}
+			if test.records >= 0 {
+				assert.Equal(t, test.records, records)
+			} else {
+				assert.True(t, records > 1)
+				assert.True(t, int64(b.Len()) < test.generator.Size+1<<10)
+			}
+		})
+	}
+}
+
+func TestDocumentGenerator_Seed(t *testing.T) {
+	var a, b bytes.Buffer
+	_, err := (&xmlpicker.DocumentGenerator{Seed: 1, Records: 5, Depth: 2, FanOut: 3, TextSize: 20}).WriteTo(&a)
+	assert.NoError(t, err)
+	_, err = (&xmlpicker.DocumentGenerator{Seed: 2, Records: 5, Depth: 2, FanOut: 3, TextSize: 20}).WriteTo(&b)
+	assert.NoError(t, err)
+	assert.NotEqual(t, a.String(), b.String())
+}
+
+// depth returns the number of levels of elements below node.
+func depth(node *xmlpicker.Node) int {
+	d := 0
+	for _, c := range node.Children {
+		if _, ok := c.Text(); ok {
+			continue
+		}
+		if cd := depth(c) + 1; cd > d {
+			d = cd
+		}
+	}
+	return d
+}
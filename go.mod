@@ -0,0 +1,17 @@
+module github.com/t11e/xmlpicker
+
+go 1.19
+
+require (
+	github.com/jessevdk/go-flags v1.2.0
+	github.com/klauspost/compress v1.17.4
+	github.com/klauspost/pgzip v1.2.6
+	github.com/stretchr/testify v1.1.4
+	golang.org/x/text v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
@@ -0,0 +1,215 @@
+package xmlpicker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const indexHeader = "# xmlpicker index v1"
+
+// Index records the byte ranges of the nodes matched in an uncompressed document, so that they can later be read
+// again without parsing the whole document.
+type Index struct {
+	Entries []IndexEntry
+	keys    map[string]int
+}
+
+// IndexEntry is the byte range of a single matched node, and its key if a KeyPath was used to build the Index.
+type IndexEntry struct {
+	Start int64
+	End   int64
+	Key   string
+	// Namespaces are those declared by the ancestors of the node, NewSectionParser declares them again.
+	Namespaces Namespaces
+}
+
+// BuildIndex consumes all the nodes returned by parser and records their byte ranges. When key is not nil it is used to
+// extract a key for each node.
+func BuildIndex(parser *Parser, key *KeyPath) (*Index, error) {
+	idx := &Index{}
+	for {
+		node, err := parser.Next()
+		if err == io.EOF {
+			return idx, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := IndexEntry{}
+		e.Start, e.End = parser.Offsets()
+		if key != nil {
+			e.Key, _ = key.Key(node)
+		}
+		e.Namespaces = ancestorNamespaces(node)
+		idx.add(e)
+	}
+}
+
+// ancestorNamespaces returns the namespaces in scope at the parent of node, without the xml prefix, or nil if there
+// are none.
+func ancestorNamespaces(node *Node) Namespaces {
+	if node.Parent == nil {
+		return nil
+	}
+	ns := node.Parent.InScopeNamespaces()
+	delete(ns, "xml")
+	if len(ns) == 0 {
+		return nil
+	}
+	return ns
+}
+
+func (idx *Index) add(e IndexEntry) {
+	if e.Key != "" {
+		if idx.keys == nil {
+			idx.keys = make(map[string]int)
+		}
+		if _, ok := idx.keys[e.Key]; !ok {
+			idx.keys[e.Key] = len(idx.Entries)
+		}
+	}
+	idx.Entries = append(idx.Entries, e)
+}
+
+// Lookup returns the first entry with the given key.
+func (idx *Index) Lookup(key string) (IndexEntry, bool) {
+	i, ok := idx.keys[key]
+	if !ok {
+		return IndexEntry{}, false
+	}
+	return idx.Entries[i], true
+}
+
+// WriteTo writes the index in its text form, one tab separated line per entry. The namespaces of an entry follow its
+// key, one PREFIX=URI column each.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	c, err := fmt.Fprintln(bw, indexHeader)
+	n = n + int64(c)
+	if err != nil {
+		return n, err
+	}
+	for _, e := range idx.Entries {
+		c, err := fmt.Fprintf(bw, "%d\t%d\t%s", e.Start, e.End, strconv.Quote(e.Key))
+		n = n + int64(c)
+		if err != nil {
+			return n, err
+		}
+		prefixes := make([]string, 0, len(e.Namespaces))
+		for prefix := range e.Namespaces {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		for _, prefix := range prefixes {
+			c, err := fmt.Fprintf(bw, "\t%s", strconv.Quote(prefix+"="+e.Namespaces[prefix]))
+			n = n + int64(c)
+			if err != nil {
+				return n, err
+			}
+		}
+		c, err = fmt.Fprintln(bw)
+		n = n + int64(c)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// ReadIndex reads an index written by WriteTo.
+func ReadIndex(r io.Reader) (*Index, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() || scanner.Text() != indexHeader {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("xmlpicker: not an index")
+	}
+	idx := &Index{}
+	line := 1
+	for scanner.Scan() {
+		line = line + 1
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("xmlpicker: invalid index line %d", line)
+		}
+		var e IndexEntry
+		var err error
+		if e.Start, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("xmlpicker: invalid index line %d: %s", line, err)
+		}
+		if e.End, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("xmlpicker: invalid index line %d: %s", line, err)
+		}
+		if e.Key, err = strconv.Unquote(parts[2]); err != nil {
+			return nil, fmt.Errorf("xmlpicker: invalid index line %d: %s", line, err)
+		}
+		for _, part := range parts[3:] {
+			decl, err := strconv.Unquote(part)
+			if err != nil {
+				return nil, fmt.Errorf("xmlpicker: invalid index line %d: %s", line, err)
+			}
+			i := strings.Index(decl, "=")
+			if i == -1 {
+				return nil, fmt.Errorf("xmlpicker: invalid index line %d: namespace %q is not PREFIX=URI", line, decl)
+			}
+			if e.Namespaces == nil {
+				e.Namespaces = make(Namespaces)
+			}
+			e.Namespaces[decl[:i]] = decl[i+1:]
+		}
+		idx.add(e)
+	}
+	return idx, scanner.Err()
+}
+
+// ReadRecord parses the node recorded by e from r, see NewSectionParser.
+func ReadRecord(r io.ReaderAt, e IndexEntry, nsFlag NSFlag) (*Node, error) {
+	parser := NewSectionParser(r, e, PathSelector("/"))
+	parser.NSFlag = nsFlag
+	node, err := parser.Next()
+	if err == io.EOF {
+		return nil, fmt.Errorf("xmlpicker: no record at offset %d", e.Start)
+	}
+	return node, err
+}
+
+// NewSectionParser returns a Parser for the byte range of e in r, which it reads as a document of its own. The
+// Namespaces of e are declared by the root of the nodes so that their prefixes resolve as they did in the whole
+// document, and Offsets are those of the whole document. The Parsers of different entries are independent and can be
+// used concurrently, provided r supports concurrent calls to ReadAt as *os.File and bytes.Reader do.
+func NewSectionParser(r io.ReaderAt, e IndexEntry, selector Selector) *Parser {
+	var start bytes.Buffer
+	start.WriteString("<xmlpicker-section")
+	prefixes := make([]string, 0, len(e.Namespaces))
+	for prefix := range e.Namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		start.WriteString(" xmlns")
+		if prefix != "" {
+			start.WriteString(":" + prefix)
+		}
+		start.WriteString(`="`)
+		xml.EscapeText(&start, []byte(e.Namespaces[prefix]))
+		start.WriteString(`"`)
+	}
+	start.WriteString(">")
+	base := e.Start - int64(start.Len())
+	decoder := xml.NewDecoder(io.MultiReader(&start, io.NewSectionReader(r, e.Start, e.End-e.Start), strings.NewReader("</xmlpicker-section>")))
+	decoder.Strict = true
+	parser := NewParser(decoder, selector)
+	parser.node.declared = e.Namespaces.copy()
+	parser.section = true
+	parser.base = base
+	return parser
+}
@@ -0,0 +1,208 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestIndex(t *testing.T) {
+	const doc = `<feed>
+  <entry id="a"><title>one</title></entry>
+  <entry id="b"><title>two</title></entry>
+  <entry><title>three</title></entry>
+  <entry id="a"/>
+</feed>`
+	key, err := xmlpicker.ParseKeyPath("@id")
+	if !assert.NoError(t, err) {
+		return
+	}
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+	idx, err := xmlpicker.BuildIndex(parser, key)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, idx.Entries, 4) {
+		return
+	}
+	for i, expected := range []string{
+		`<entry id="a"><title>one</title></entry>`,
+		`<entry id="b"><title>two</title></entry>`,
+		`<entry><title>three</title></entry>`,
+		`<entry id="a"/>`,
+	} {
+		e := idx.Entries[i]
+		assert.Equal(t, expected, doc[e.Start:e.End], "entry %d", i)
+	}
+
+	var b bytes.Buffer
+	_, err = idx.WriteTo(&b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "# xmlpicker index v1\n9\t49\t\"a\"\n52\t92\t\"b\"\n95\t130\t\"\"\n133\t148\t\"a\"\n", b.String())
+	idx, err = xmlpicker.ReadIndex(&b)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	e, ok := idx.Lookup("b")
+	if assert.True(t, ok) {
+		node, err := xmlpicker.ReadRecord(strings.NewReader(doc), e, xmlpicker.NSExpand)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "two", deepText(node))
+		}
+	}
+	e, ok = idx.Lookup("a")
+	if assert.True(t, ok) {
+		assert.Equal(t, idx.Entries[0], e)
+	}
+	_, ok = idx.Lookup("")
+	assert.False(t, ok)
+	node, err := xmlpicker.ReadRecord(strings.NewReader(doc), idx.Entries[2], xmlpicker.NSExpand)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "three", deepText(node))
+	}
+}
+
+func TestReadIndexErrors(t *testing.T) {
+	_, err := xmlpicker.ReadIndex(strings.NewReader("junk\n"))
+	assert.EqualError(t, err, "xmlpicker: not an index")
+	_, err = xmlpicker.ReadIndex(strings.NewReader("# xmlpicker index v1\n1\t2\n"))
+	assert.EqualError(t, err, "xmlpicker: invalid index line 2")
+	_, err = xmlpicker.ReadIndex(strings.NewReader("# xmlpicker index v1\n1\t2\t\"\"\t\"x\"\n"))
+	assert.EqualError(t, err, `xmlpicker: invalid index line 2: namespace "x" is not PREFIX=URI`)
+	_, err = xmlpicker.ReadIndex(strings.NewReader("# xmlpicker index v1\n1\tx\t\"\"\n"))
+	assert.EqualError(t, err, `xmlpicker: invalid index line 2: strconv.ParseInt: parsing "x": invalid syntax`)
+}
+
+func TestKeyPath(t *testing.T) {
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(`<a id="1">t<b><c>x</c></b><b><c>y</c></b></a>`)), xmlpicker.PathSelector("/"))
+	node, err := parser.Next()
+	if !assert.NoError(t, err) {
+		return
+	}
+	for path, expected := range map[string]string{
+		"@id":     "1",
+		"#text":   "t",
+		"b/c":     "x",
+		"b/#text": "",
+	} {
+		k, err := xmlpicker.ParseKeyPath(path)
+		if assert.NoError(t, err, path) {
+			actual, ok := k.Key(node)
+			assert.True(t, ok, path)
+			assert.Equal(t, expected, actual, path)
+		}
+	}
+	for _, path := range []string{"@missing", "missing", "b/missing"} {
+		k, err := xmlpicker.ParseKeyPath(path)
+		if assert.NoError(t, err, path) {
+			_, ok := k.Key(node)
+			assert.False(t, ok, path)
+		}
+	}
+	for _, path := range []string{"", "@", "a//b"} {
+		_, err := xmlpicker.ParseKeyPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestNewSectionParser(t *testing.T) {
+	const doc = `<feed xmlns="urn:feed" xmlns:x="urn:x">
+  <entry x:id="1"><title>one</title></entry>
+  <group xmlns:x="urn:y"><entry x:id="2"><x:title>two</x:title></entry></group>
+</feed>`
+	selector, err := xmlpicker.ParseXPath("//entry")
+	if !assert.NoError(t, err) {
+		return
+	}
+	idx, err := xmlpicker.BuildIndex(xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), selector), nil)
+	if !assert.NoError(t, err) || !assert.Len(t, idx.Entries, 2) {
+		return
+	}
+	assert.Equal(t, xmlpicker.Namespaces{"": "urn:feed", "x": "urn:x"}, idx.Entries[0].Namespaces)
+	assert.Equal(t, xmlpicker.Namespaces{"": "urn:feed", "x": "urn:y"}, idx.Entries[1].Namespaces)
+	assert.Equal(t, `<entry x:id="2"><x:title>two</x:title></entry>`, doc[idx.Entries[1].Start:idx.Entries[1].End])
+
+	var b bytes.Buffer
+	_, err = idx.WriteTo(&b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "# xmlpicker index v1\n"+
+		"42\t84\t\"\"\t\"=urn:feed\"\t\"x=urn:x\"\n"+
+		"110\t156\t\"\"\t\"=urn:feed\"\t\"x=urn:y\"\n", b.String())
+	read, err := xmlpicker.ReadIndex(&b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, idx.Entries, read.Entries)
+	}
+
+	expected := map[xmlpicker.NSFlag][]string{
+		xmlpicker.NSExpand: {
+			`<entry xmlns="urn:feed" xmlns:x="urn:x" x:id="1"><title>one</title></entry>`,
+			`<entry xmlns="urn:feed" xmlns:x="urn:y" x:id="2"><title xmlns="urn:y">two</title></entry>`,
+		},
+		xmlpicker.NSPrefix: {
+			`<entry x:id="1" xmlns="urn:feed" xmlns:x="urn:x"><title>one</title></entry>`,
+			`<entry x:id="2" xmlns="urn:feed" xmlns:x="urn:y"><x:title>two</x:title></entry>`,
+		},
+	}
+	type result struct {
+		flag  xmlpicker.NSFlag
+		i     int
+		uri   string
+		start int64
+		end   int64
+		xml   string
+		err   error
+	}
+	results := make(chan result)
+	r := strings.NewReader(doc)
+	for flag := range expected {
+		for i, e := range idx.Entries {
+			go func(flag xmlpicker.NSFlag, i int, e xmlpicker.IndexEntry) {
+				res := result{flag: flag, i: i}
+				defer func() { results <- res }()
+				parser := xmlpicker.NewSectionParser(r, e, xmlpicker.PathSelector("/"))
+				parser.NSFlag = flag
+				node, err := parser.Next()
+				if err != nil {
+					res.err = err
+					return
+				}
+				res.uri = node.Attrs()[0].Name.URI
+				res.start, res.end = parser.Offsets()
+				var b bytes.Buffer
+				exporter := xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&b)}
+				if res.err = exporter.EncodeNode(node); res.err != nil {
+					return
+				}
+				if res.err = exporter.Encoder.Flush(); res.err != nil {
+					return
+				}
+				res.xml = b.String()
+				if _, err := parser.Next(); err != io.EOF {
+					res.err = fmt.Errorf("expected EOF, got %v", err)
+				}
+			}(flag, i, e)
+		}
+	}
+	for n := 0; n < len(expected)*len(idx.Entries); n++ {
+		res := <-results
+		name := fmt.Sprintf("%s %d", res.flag, res.i)
+		if !assert.NoError(t, res.err, name) {
+			continue
+		}
+		assert.Equal(t, []string{"urn:x", "urn:y"}[res.i], res.uri, name)
+		assert.Equal(t, idx.Entries[res.i].Start, res.start, name)
+		assert.Equal(t, idx.Entries[res.i].End, res.end, name)
+		assert.Equal(t, expected[res.flag][res.i], res.xml, name)
+	}
+}
@@ -0,0 +1,169 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a compiled JSONPath expression that is evaluated against the output of a Mapper.
+//
+// The supported subset is the root $, child access by .name, ['name'] or ["name"], array indexes [n] (negative
+// indexes count from the end), the wildcards .* and [*], and recursive descent ..name or ..*.
+type JSONPath struct {
+	expr     string
+	segments []jsonPathSegment
+}
+
+type jsonPathSegment struct {
+	recursive bool
+	wildcard  bool
+	name      string
+	index     int
+	isIndex   bool
+}
+
+// CompileJSONPath parses expr into a JSONPath.
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	p := &JSONPath{expr: expr}
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, p.errorf("must start with $")
+	}
+	s = s[1:]
+	for s != "" {
+		var seg jsonPathSegment
+		switch {
+		case strings.HasPrefix(s, ".."):
+			seg.recursive = true
+			s = s[2:]
+		case s[0] == '.':
+			s = s[1:]
+		case s[0] != '[':
+			return nil, p.errorf("unexpected %q", s)
+		}
+		if !strings.HasPrefix(s, "[") {
+			end := strings.IndexAny(s, ".[")
+			if end == -1 {
+				end = len(s)
+			}
+			switch name := s[:end]; name {
+			case "":
+				return nil, p.errorf("missing name")
+			case "*":
+				seg.wildcard = true
+			default:
+				seg.name = name
+			}
+			s = s[end:]
+			p.segments = append(p.segments, seg)
+			continue
+		}
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			return nil, p.errorf("unterminated [")
+		}
+		inner := strings.TrimSpace(s[1:end])
+		if n := len(inner); n >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[n-1] == inner[0] {
+			seg.name = inner[1 : n-1]
+		} else if inner == "*" {
+			seg.wildcard = true
+		} else if i, err := strconv.Atoi(inner); err == nil {
+			seg.index = i
+			seg.isIndex = true
+		} else {
+			return nil, p.errorf("unsupported subscript [%s]", inner)
+		}
+		s = s[end+1:]
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+func (p *JSONPath) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("xmlpicker: invalid jsonpath %q: %s", p.expr, fmt.Sprintf(format, args...))
+}
+
+func (p *JSONPath) String() string {
+	return p.expr
+}
+
+// Find returns the values in v that are selected by the path, in document order.
+func (p *JSONPath) Find(v interface{}) []interface{} {
+	values := []interface{}{v}
+	for _, seg := range p.segments {
+		var next []interface{}
+		for _, v := range values {
+			if seg.recursive {
+				next = seg.findRecursive(next, v)
+			} else {
+				next = seg.find(next, v)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func (seg jsonPathSegment) find(out []interface{}, v interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if seg.wildcard {
+			for _, k := range sortedKeys(v) {
+				out = append(out, v[k])
+			}
+		} else if c, ok := v[seg.name]; ok && !seg.isIndex {
+			out = append(out, c)
+		}
+	case Namespaces:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return seg.find(out, m)
+	case []string:
+		a := make([]interface{}, len(v))
+		for i, s := range v {
+			a[i] = s
+		}
+		return seg.find(out, a)
+	case []interface{}:
+		if seg.wildcard {
+			out = append(out, v...)
+		} else if seg.isIndex {
+			i := seg.index
+			if i < 0 {
+				i = len(v) + i
+			}
+			if i >= 0 && i < len(v) {
+				out = append(out, v[i])
+			}
+		}
+	}
+	return out
+}
+
+func (seg jsonPathSegment) findRecursive(out []interface{}, v interface{}) []interface{} {
+	out = seg.find(out, v)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			out = seg.findRecursive(out, v[k])
+		}
+	case []interface{}:
+		for _, c := range v {
+			out = seg.findRecursive(out, c)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
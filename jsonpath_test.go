@@ -0,0 +1,124 @@
+package xmlpicker_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestJSONPath(t *testing.T) {
+	const doc = `<a id="1"><b>hello</b><b>world</b><c><d>x</d><b>nested</b></c></a>`
+	for idx, test := range []struct {
+		path     string
+		expected string
+	}{
+		{
+			path:     `$`,
+			expected: `[{"@id":"1","_name":"a","b":[{"#text":["hello"]},{"#text":["world"]}],"c":[{"b":[{"#text":["nested"]}],"d":[{"#text":["x"]}]}]}]`,
+		},
+		{
+			path:     `$.b[0]["#text"]`,
+			expected: `[["hello"]]`,
+		},
+		{
+			path:     `$.b[0]['#text'][0]`,
+			expected: `["hello"]`,
+		},
+		{
+			path:     `$.b[-1]["#text"][0]`,
+			expected: `["world"]`,
+		},
+		{
+			path:     `$.b[*]["#text"][*]`,
+			expected: `["hello","world"]`,
+		},
+		{
+			path:     `$["@id"]`,
+			expected: `["1"]`,
+		},
+		{
+			path:     `$.c[0].*[0]["#text"][0]`,
+			expected: `["nested","x"]`,
+		},
+		{
+			path:     `$..b[*]["#text"][0]`,
+			expected: `["hello","world","nested"]`,
+		},
+		{
+			path:     `$..["#text"][0]`,
+			expected: `["hello","world","nested","x"]`,
+		},
+		{
+			path:     `$.missing[0]`,
+			expected: `[]`,
+		},
+		{
+			path:     `$.b[5]`,
+			expected: `[]`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.path)
+		t.Run(name, func(t *testing.T) {
+			p, err := xmlpicker.CompileJSONPath(test.path)
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/"))
+			node, err := parser.Next()
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			v, err := xmlpicker.SimpleMapper{}.FromNode(node)
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			actual := p.Find(v)
+			if actual == nil {
+				actual = []interface{}{}
+			}
+			b, err := json.Marshal(actual)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.expected, string(b), name)
+			}
+		})
+	}
+}
+
+func TestCompileJSONPathErrors(t *testing.T) {
+	for idx, test := range []struct {
+		path        string
+		expectedErr string
+	}{
+		{
+			path:        `b[0]`,
+			expectedErr: `xmlpicker: invalid jsonpath "b[0]": must start with $`,
+		},
+		{
+			path:        `$b`,
+			expectedErr: `xmlpicker: invalid jsonpath "$b": unexpected "b"`,
+		},
+		{
+			path:        `$.`,
+			expectedErr: `xmlpicker: invalid jsonpath "$.": missing name`,
+		},
+		{
+			path:        `$.b[0`,
+			expectedErr: `xmlpicker: invalid jsonpath "$.b[0": unterminated [`,
+		},
+		{
+			path:        `$.b[?(@.x)]`,
+			expectedErr: `xmlpicker: invalid jsonpath "$.b[?(@.x)]": unsupported subscript [?(@.x)]`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.path)
+		t.Run(name, func(t *testing.T) {
+			_, err := xmlpicker.CompileJSONPath(test.path)
+			assert.EqualError(t, err, test.expectedErr, name)
+		})
+	}
+}
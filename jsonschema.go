@@ -0,0 +1,234 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"sort"
+)
+
+// JSONSchemaURI identifies the JSON Schema draft used by JSONSchema.
+const JSONSchemaURI = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchemaDescriber is implemented by mappers that can describe the records they produce for the nodes matched by a
+// selector as a JSON Schema.
+type JSONSchemaDescriber interface {
+	JSONSchema(selector Selector) map[string]interface{}
+}
+
+// recordName returns the element name the last step of a Path selector requires, or "".
+func recordName(selector Selector) string {
+	if p, ok := selector.(*Path); ok && len(p.Steps) != 0 {
+		if name := p.Steps[len(p.Steps)-1].Name; name != "*" {
+			return name
+		}
+	}
+	return ""
+}
+
+// JSONSchema describes the records of SimpleMapper, whose structure does not depend on the document.
+func (m SimpleMapper) JSONSchema(selector Selector) map[string]interface{} {
+	name := map[string]interface{}{"type": "string"}
+	if n := recordName(selector); n != "" {
+		name["enum"] = []string{n}
+	}
+	record := m.elementSchema()
+	record["$schema"] = JSONSchemaURI
+	record["properties"].(map[string]interface{})["_name"] = name
+	record["properties"].(map[string]interface{})["_namespace"] = map[string]interface{}{"type": "string"}
+	if m.InScopeNamespaces {
+		record["properties"].(map[string]interface{})["_xmlns"] = map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}
+	}
+	record["required"] = []string{"_name"}
+	element := m.elementSchema()
+	if m.MixedContent {
+		// the child objects of #content are named
+		named := m.elementSchema()
+		named["properties"].(map[string]interface{})["_name"] = map[string]interface{}{"type": "string"}
+		named["required"] = []string{"_name"}
+		record["definitions"] = map[string]interface{}{"element": element, "namedElement": named}
+	} else {
+		record["definitions"] = map[string]interface{}{"element": element}
+	}
+	return record
+}
+
+func (m SimpleMapper) elementSchema() map[string]interface{} {
+	ref := map[string]interface{}{"$ref": "#/definitions/element"}
+	child := map[string]interface{}{"type": "array", "items": ref}
+	if m.FlattenText {
+		child = map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "string"}, ref}}},
+			},
+		}
+	}
+	properties := map[string]interface{}{
+		"#text":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"_namespaces": map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}},
+	}
+	if m.MixedContent {
+		properties["#content"] = map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"$ref": "#/definitions/namedElement"},
+			}},
+		}
+	}
+	patterns := map[string]interface{}{"^@": map[string]interface{}{"type": "string"}}
+	if len(m.InnerXML) != 0 {
+		patterns["_html$"] = map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+		}
+	}
+	if m.Positions {
+		properties["_pos"] = map[string]interface{}{"type": "integer", "minimum": 1}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"patternProperties":    patterns,
+		"additionalProperties": child,
+	}
+}
+
+// JSONSchema describes the records of SchemaMapper using the declaration of the element the selector matches, it
+// falls back to the description of SimpleMapper when the selector does not identify a declared element. Values that
+// are not valid for their type are mapped to strings and so do not validate.
+func (m SchemaMapper) JSONSchema(selector Selector) map[string]interface{} {
+	e := m.Schema.selectedElement(selector)
+	if e == nil || e.typ == nil {
+		return SimpleMapper{}.JSONSchema(selector)
+	}
+	g := &jsonSchemaGenerator{names: make(map[*schemaType]string), definitions: make(map[string]interface{})}
+	g.definitions["element"] = SimpleMapper{}.elementSchema()
+	properties := map[string]interface{}{
+		"_name":      map[string]interface{}{"type": "string", "enum": []string{recordName(selector)}},
+		"_namespace": map[string]interface{}{"type": "string"},
+	}
+	record := map[string]interface{}{
+		"$schema":  JSONSchemaURI,
+		"type":     "object",
+		"required": []string{"_name"},
+	}
+	if e.typ.children == nil {
+		properties["#text"] = valueSchema(e.typ.value)
+	} else {
+		record["allOf"] = []interface{}{g.ref(e.typ)}
+	}
+	record["properties"] = properties
+	record["definitions"] = g.definitions
+	return record
+}
+
+// selectedElement returns the declaration of the elements matched by a Path selector, following the declarations
+// from the document element when the path names each element from the root.
+func (s *Schema) selectedElement(selector Selector) *schemaElement {
+	name := recordName(selector)
+	if name == "" {
+		return nil
+	}
+	p := selector.(*Path)
+	if p.Anchored {
+		var e *schemaElement
+		for i, step := range p.Steps {
+			if step.Name == "*" || step.Descendant {
+				e = nil
+				break
+			}
+			if i == 0 {
+				e = s.roots[step.Name]
+			} else if e != nil && e.typ != nil {
+				e = e.typ.children[step.Name]
+			} else {
+				e = nil
+			}
+			if e == nil {
+				break
+			}
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return s.roots[name]
+}
+
+type jsonSchemaGenerator struct {
+	names       map[*schemaType]string
+	definitions map[string]interface{}
+}
+
+// ref returns a reference to the definition of a complex type, which is added when first needed.
+func (g *jsonSchemaGenerator) ref(t *schemaType) map[string]interface{} {
+	name, ok := g.names[t]
+	if !ok {
+		name = t.name
+		if _, taken := g.definitions[name]; name == "" || taken {
+			name = fmt.Sprintf("type%d", len(g.names))
+		}
+		g.names[t] = name
+		// registered before the definition is built as types may be recursive
+		g.definitions[name] = nil
+		g.definitions[name] = g.complexType(t)
+	}
+	return map[string]interface{}{"$ref": "#/definitions/" + name}
+}
+
+func (g *jsonSchemaGenerator) complexType(t *schemaType) map[string]interface{} {
+	properties := map[string]interface{}{
+		"_name":       map[string]interface{}{"type": "string"},
+		"_namespace":  map[string]interface{}{"type": "string"},
+		"_namespaces": map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}},
+	}
+	for name, kind := range t.attrs {
+		properties["@"+name] = valueSchema(kind)
+	}
+	if t.value == noValue || t.mixed {
+		properties["#text"] = map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	} else {
+		properties["#text"] = valueSchema(t.value)
+	}
+	names := make([]string, 0, len(t.children))
+	for name := range t.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e := t.children[name]
+		var child interface{}
+		switch {
+		case e.typ == nil:
+			child = map[string]interface{}{"$ref": "#/definitions/element"}
+		case e.typ.children == nil:
+			// an element with undeclared attributes is mapped to an object like one of a complex type
+			child = map[string]interface{}{"anyOf": []interface{}{valueSchema(e.typ.value), map[string]interface{}{"type": "object"}}}
+		default:
+			child = g.ref(e.typ)
+		}
+		if e.repeated {
+			child = map[string]interface{}{"type": "array", "items": child}
+		}
+		properties[name] = child
+	}
+	// declared attributes are typed by their property, the pattern only excludes the others from additionalProperties
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"patternProperties":    map[string]interface{}{"^@": map[string]interface{}{}},
+		"additionalProperties": map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/definitions/element"}},
+	}
+}
+
+func valueSchema(kind valueKind) map[string]interface{} {
+	switch kind {
+	case numberValue:
+		return map[string]interface{}{"type": "number"}
+	case booleanValue:
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{"type": "string"}
+}
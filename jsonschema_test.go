@@ -0,0 +1,51 @@
+package xmlpicker_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestSchemaMapperJSONSchema(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"feed.xsd": testSchema, "types.xsd": testSchemaTypes})
+	defer os.RemoveAll(dir)
+	schema, err := xmlpicker.LoadSchema(filepath.Join(dir, "feed.xsd"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	actual := xmlpicker.SchemaMapper{Schema: schema}.JSONSchema(xmlpicker.PathSelector("/feed/entry"))
+	b, err := json.Marshal(actual)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var v struct {
+		AllOf       []map[string]string `json:"allOf"`
+		Definitions map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"definitions"`
+	}
+	if !assert.NoError(t, json.Unmarshal(b, &v)) || !assert.Len(t, v.AllOf, 1) {
+		return
+	}
+	assert.Equal(t, "#/definitions/entryType", v.AllOf[0]["$ref"])
+	entry := v.Definitions["entryType"].Properties
+	for name, expected := range map[string]string{
+		"@id":       `{"type":"number"}`,
+		"@code":     `{"type":"string"}`,
+		"available": `{"anyOf":[{"type":"boolean"},{"type":"object"}]}`,
+		"price":     `{"$ref":"#/definitions/priceType"}`,
+		"tag":       `{"items":{"anyOf":[{"type":"string"},{"type":"object"}]},"type":"array"}`,
+		"note":      `{"items":{"$ref":"#/definitions/noteType"},"type":"array"}`,
+	} {
+		assert.JSONEq(t, expected, string(entry[name]), name)
+	}
+	assert.JSONEq(t, `{"type":"number"}`, string(v.Definitions["priceType"].Properties["#text"]))
+	assert.JSONEq(t, `{"type":"array","items":{"type":"string"}}`, string(v.Definitions["noteType"].Properties["#text"]))
+
+	fallback := xmlpicker.SchemaMapper{Schema: schema}.JSONSchema(xmlpicker.PathSelector("/other"))
+	assert.Equal(t, xmlpicker.SimpleMapper{}.JSONSchema(xmlpicker.PathSelector("/other")), fallback)
+}
@@ -0,0 +1,425 @@
+package xmlpicker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchemaValidator checks values, such as the records of a Mapper, against a JSON Schema. It supports the keywords
+// that describe structure and types: type, enum, const, properties, patternProperties, additionalProperties,
+// required, items, minItems, maxItems, minLength, maxLength, pattern, minimum, maximum, allOf, anyOf, oneOf, not and
+// $ref to the definitions of the same document. Other keywords are ignored.
+type JSONSchemaValidator struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// CompileJSONSchema parses a JSON Schema document.
+func CompileJSONSchema(b []byte) (*JSONSchemaValidator, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	v := &JSONSchemaValidator{patterns: make(map[string]*regexp.Regexp)}
+	if err := d.Decode(&v.root); err != nil {
+		return nil, fmt.Errorf("xmlpicker: invalid JSON Schema: %s", err)
+	}
+	if err := v.compile(v.root); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// compile checks the regular expressions and references of the schema so that validation cannot fail on them.
+func (v *JSONSchemaValidator) compile(schema interface{}) error {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		if p, ok := s["pattern"].(string); ok {
+			if err := v.compilePattern(p); err != nil {
+				return err
+			}
+		}
+		if patterns, ok := s["patternProperties"].(map[string]interface{}); ok {
+			for p := range patterns {
+				if err := v.compilePattern(p); err != nil {
+					return err
+				}
+			}
+		}
+		if ref, ok := s["$ref"].(string); ok {
+			if _, err := v.resolve(ref); err != nil {
+				return err
+			}
+		}
+		for _, c := range s {
+			if err := v.compile(c); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, c := range s {
+			if err := v.compile(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *JSONSchemaValidator) compilePattern(p string) error {
+	if _, ok := v.patterns[p]; ok {
+		return nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return fmt.Errorf("xmlpicker: invalid pattern %q in JSON Schema: %s", p, err)
+	}
+	v.patterns[p] = re
+	return nil
+}
+
+// resolve returns the schema a local reference such as "#/definitions/name" points to.
+func (v *JSONSchemaValidator) resolve(ref string) (interface{}, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("xmlpicker: unsupported JSON Schema reference %q", ref)
+	}
+	s := v.root
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		m, ok := s.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("xmlpicker: unresolved JSON Schema reference %q", ref)
+		}
+		if s, ok = m[part]; !ok {
+			return nil, fmt.Errorf("xmlpicker: unresolved JSON Schema reference %q", ref)
+		}
+	}
+	return s, nil
+}
+
+// Validate returns an error describing the first part of value that does not conform to the schema, located by a
+// JSON pointer. The value is compared as it would be encoded to JSON.
+func (v *JSONSchemaValidator) Validate(value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var normalized interface{}
+	if err := d.Decode(&normalized); err != nil {
+		return err
+	}
+	if err := v.validate(v.root, normalized, "", 0); err != nil {
+		return fmt.Errorf("xmlpicker: %s", err)
+	}
+	return nil
+}
+
+func (v *JSONSchemaValidator) validate(schema, value interface{}, pointer string, depth int) error {
+	if depth > 100 {
+		return fmt.Errorf("JSON Schema references nested too deeply at %s", formatPointer(pointer))
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		if b, ok := schema.(bool); ok && !b {
+			return fmt.Errorf("%s is not allowed", formatPointer(pointer))
+		}
+		return nil
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			return err
+		}
+		// draft-07 ignores the siblings of $ref
+		return v.validate(target, value, pointer, depth+1)
+	}
+	if t, ok := s["type"]; ok && !matchesType(t, value) {
+		return fmt.Errorf("%s is %s, expected %s", formatPointer(pointer), jsonType(value), formatTypes(t))
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not one of the allowed values", formatPointer(pointer))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, value) {
+		return fmt.Errorf("%s is not the allowed value", formatPointer(pointer))
+	}
+	var err error
+	switch value := value.(type) {
+	case map[string]interface{}:
+		err = v.validateObject(s, value, pointer, depth)
+	case []interface{}:
+		err = v.validateArray(s, value, pointer, depth)
+	case string:
+		err = v.validateString(s, value, pointer)
+	case json.Number:
+		err = validateNumber(s, value, pointer)
+	}
+	if err != nil {
+		return err
+	}
+	return v.validateCombinations(s, value, pointer, depth)
+}
+
+func (v *JSONSchemaValidator) validateObject(s map[string]interface{}, value map[string]interface{}, pointer string, depth int) error {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, ok := value[name]; !ok {
+					return fmt.Errorf("%s is missing %s", formatPointer(pointer), name)
+				}
+			}
+		}
+	}
+	properties, _ := s["properties"].(map[string]interface{})
+	patterns, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	keys := make([]string, 0, len(value))
+	for k := range value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := pointer + "/" + strings.Replace(strings.Replace(k, "~", "~0", -1), "/", "~1", -1)
+		matched := false
+		if ps, ok := properties[k]; ok {
+			matched = true
+			if err := v.validate(ps, value[k], p, depth+1); err != nil {
+				return err
+			}
+		}
+		for pattern, ps := range patterns {
+			if v.patterns[pattern].MatchString(k) {
+				matched = true
+				if err := v.validate(ps, value[k], p, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		if !matched && hasAdditional {
+			if err := v.validate(additional, value[k], p, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *JSONSchemaValidator) validateArray(s map[string]interface{}, value []interface{}, pointer string, depth int) error {
+	if n, ok := schemaNumber(s, "minItems"); ok && float64(len(value)) < n {
+		return fmt.Errorf("%s has fewer than %v items", formatPointer(pointer), n)
+	}
+	if n, ok := schemaNumber(s, "maxItems"); ok && float64(len(value)) > n {
+		return fmt.Errorf("%s has more than %v items", formatPointer(pointer), n)
+	}
+	items, ok := s["items"]
+	if !ok {
+		return nil
+	}
+	for i, item := range value {
+		itemSchema := items
+		if tuple, ok := items.([]interface{}); ok {
+			if i >= len(tuple) {
+				break
+			}
+			itemSchema = tuple[i]
+		}
+		if err := v.validate(itemSchema, item, pointer+"/"+strconv.Itoa(i), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *JSONSchemaValidator) validateString(s map[string]interface{}, value string, pointer string) error {
+	n := float64(utf8.RuneCountInString(value))
+	if min, ok := schemaNumber(s, "minLength"); ok && n < min {
+		return fmt.Errorf("%s is shorter than %v characters", formatPointer(pointer), min)
+	}
+	if max, ok := schemaNumber(s, "maxLength"); ok && n > max {
+		return fmt.Errorf("%s is longer than %v characters", formatPointer(pointer), max)
+	}
+	if p, ok := s["pattern"].(string); ok && !v.patterns[p].MatchString(value) {
+		return fmt.Errorf("%s does not match %s", formatPointer(pointer), p)
+	}
+	return nil
+}
+
+func validateNumber(s map[string]interface{}, value json.Number, pointer string) error {
+	f, err := value.Float64()
+	if err != nil {
+		return nil
+	}
+	if min, ok := schemaNumber(s, "minimum"); ok && f < min {
+		return fmt.Errorf("%s is less than %v", formatPointer(pointer), min)
+	}
+	if max, ok := schemaNumber(s, "maximum"); ok && f > max {
+		return fmt.Errorf("%s is greater than %v", formatPointer(pointer), max)
+	}
+	return nil
+}
+
+func (v *JSONSchemaValidator) validateCombinations(s map[string]interface{}, value interface{}, pointer string, depth int) error {
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, c := range all {
+			if err := v.validate(c, value, pointer, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		var first error
+		for _, c := range anyOf {
+			err := v.validate(c, value, pointer, depth+1)
+			if err == nil {
+				first = nil
+				break
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		if first != nil {
+			return fmt.Errorf("%s matches none of the allowed schemas: %s", formatPointer(pointer), first)
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		n := 0
+		for _, c := range oneOf {
+			if v.validate(c, value, pointer, depth+1) == nil {
+				n = n + 1
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("%s matches %d of the schemas, expected exactly one", formatPointer(pointer), n)
+		}
+	}
+	if not, ok := s["not"]; ok && v.validate(not, value, pointer, depth+1) == nil {
+		return fmt.Errorf("%s matches a schema it must not match", formatPointer(pointer))
+	}
+	return nil
+}
+
+func schemaNumber(s map[string]interface{}, keyword string) (float64, bool) {
+	n, ok := s[keyword].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matchesTypeName(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, value interface{}) bool {
+	actual := jsonType(value)
+	if name == "number" && actual == "integer" {
+		return true
+	}
+	return name == actual
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func formatTypes(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprint(name)
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// jsonEqual compares normalized JSON values, numbers by their value.
+func jsonEqual(a, b interface{}) bool {
+	if an, ok := a.(json.Number); ok {
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		bm, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(bm) {
+			return false
+		}
+		for k, v := range a {
+			if !jsonEqual(v, bm[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bs, ok := b.([]interface{})
+		if !ok || len(a) != len(bs) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], bs[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func formatPointer(pointer string) string {
+	if pointer == "" {
+		return "record"
+	}
+	return pointer
+}
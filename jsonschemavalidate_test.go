@@ -0,0 +1,122 @@
+package xmlpicker_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestJSONSchemaValidator(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"required": ["_name"],
+		"properties": {
+			"_name": {"enum": ["entry"]},
+			"id": {"type": "integer", "minimum": 1},
+			"tags": {"type": "array", "items": {"$ref": "#/definitions/tag"}, "maxItems": 2},
+			"price": {"anyOf": [{"type": "number"}, {"type": "string", "pattern": "^[0-9.]+$"}]}
+		},
+		"patternProperties": {"^@": {"type": "string"}},
+		"additionalProperties": false,
+		"definitions": {"tag": {"type": "string", "minLength": 1}}
+	}`
+	v, err := xmlpicker.CompileJSONSchema([]byte(schema))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for idx, test := range []struct {
+		value       string
+		expectedErr string
+	}{
+		{`{"_name": "entry", "id": 2, "tags": ["a"], "price": "1.5", "@code": "x"}`, ""},
+		{`{"_name": "entry", "price": 1.5}`, ""},
+		{`{"id": 2}`, "xmlpicker: record is missing _name"},
+		{`{"_name": "other"}`, "xmlpicker: /_name is not one of the allowed values"},
+		{`{"_name": "entry", "id": 1.5}`, "xmlpicker: /id is number, expected integer"},
+		{`{"_name": "entry", "id": 0}`, "xmlpicker: /id is less than 1"},
+		{`{"_name": "entry", "tags": ["a", ""]}`, "xmlpicker: /tags/1 is shorter than 1 characters"},
+		{`{"_name": "entry", "tags": ["a", "b", "c"]}`, "xmlpicker: /tags has more than 2 items"},
+		{`{"_name": "entry", "price": "cheap"}`, "xmlpicker: /price matches none of the allowed schemas: /price is string, expected number"},
+		{`{"_name": "entry", "@code": 1}`, "xmlpicker: /@code is integer, expected string"},
+		{`{"_name": "entry", "extra": 1}`, "xmlpicker: /extra is not allowed"},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.value), func(t *testing.T) {
+			var value interface{}
+			if !assert.NoError(t, json.Unmarshal([]byte(test.value), &value)) {
+				return
+			}
+			err := v.Validate(value)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCompileJSONSchemaErrors(t *testing.T) {
+	for idx, test := range []struct {
+		schema      string
+		expectedErr string
+	}{
+		{`{`, "xmlpicker: invalid JSON Schema: unexpected EOF"},
+		{`{"pattern": "("}`, "xmlpicker: invalid pattern \"(\" in JSON Schema: error parsing regexp: missing closing ): `(`"},
+		{`{"$ref": "#/definitions/missing"}`, "xmlpicker: unresolved JSON Schema reference \"#/definitions/missing\""},
+		{`{"$ref": "http://example.com/schema.json"}`, "xmlpicker: unsupported JSON Schema reference \"http://example.com/schema.json\""},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.schema), func(t *testing.T) {
+			_, err := xmlpicker.CompileJSONSchema([]byte(test.schema))
+			assert.EqualError(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestSchemaMapperOutputValidates(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"feed.xsd": testSchema, "types.xsd": testSchemaTypes})
+	defer os.RemoveAll(dir)
+	schema, err := xmlpicker.LoadSchema(filepath.Join(dir, "feed.xsd"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	mapper := xmlpicker.SchemaMapper{Schema: schema}
+	selector := xmlpicker.PathSelector("/feed/entry")
+	b, err := json.Marshal(mapper.JSONSchema(selector))
+	if !assert.NoError(t, err) {
+		return
+	}
+	v, err := xmlpicker.CompileJSONSchema(b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	const doc = `<feed><entry id="1"><price currency="EUR">1.50</price><quantity>7</quantity><available>true</available><tag>a</tag><note>see <b>this</b></note><extra>x</extra></entry><entry id="x"/></feed>`
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), selector)
+	var actual []string
+	for {
+		n, err := parser.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		record, err := mapper.FromNode(n)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if err := v.Validate(record); err != nil {
+			actual = append(actual, err.Error())
+		} else {
+			actual = append(actual, "")
+		}
+	}
+	assert.Equal(t, []string{"", "xmlpicker: /@id is string, expected number"}, actual)
+}
@@ -0,0 +1,31 @@
+package xmlpicker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// SkipLeadingJunk discards the bytes before the first < of a document, such as a UTF-8 byte order mark, a log prefix
+// or stray bytes left by a transfer, which would otherwise make a strict decoder fail at once. It returns the number of
+// bytes discarded and an error if there are more than limit of them. A reader that ends before any < is left empty.
+func SkipLeadingJunk(r *bufio.Reader, limit int) (int, error) {
+	n := 0
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if b == '<' {
+			return n, r.UnreadByte()
+		}
+		if n == limit {
+			r.UnreadByte()
+			return n, fmt.Errorf("xmlpicker: no < in the first %d bytes", limit)
+		}
+		n++
+	}
+}
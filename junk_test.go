@@ -0,0 +1,44 @@
+package xmlpicker_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestSkipLeadingJunk(t *testing.T) {
+	for idx, test := range []struct {
+		input     string
+		limit     int
+		skipped   int
+		remaining string
+		err       string
+	}{
+		{"<a/>", 0, 0, "<a/>", ""},
+		{"\ufeff<?xml version=\"1.0\"?><a/>", 3, 3, "<?xml version=\"1.0\"?><a/>", ""},
+		{"2024-01-02 INFO feed follows\n<a/>", 64, 29, "<a/>", ""},
+		{"\x00\x01\x02<a/>", 3, 3, "<a/>", ""},
+		{"junk", 64, 4, "", ""},
+		{"", 64, 0, "", ""},
+		{"too much junk<a/>", 4, 4, "much junk<a/>", "xmlpicker: no < in the first 4 bytes"},
+	} {
+		t.Run(fmt.Sprintf("%d %q", idx, test.input), func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(test.input))
+			skipped, err := xmlpicker.SkipLeadingJunk(r, test.limit)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.skipped, skipped)
+			remaining, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, test.remaining, string(remaining))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyPath extracts a key from a node. It is either "@name" for the value of an attribute, "#text" for the text of the
+// node itself or a relative path of child element names whose first match provides the text.
+type KeyPath struct {
+	expr string
+	attr string
+	path []string
+}
+
+// ParseKeyPath parses s into a KeyPath.
+func ParseKeyPath(s string) (*KeyPath, error) {
+	s = strings.TrimSpace(s)
+	k := &KeyPath{expr: s}
+	if strings.HasPrefix(s, "@") {
+		k.attr = s[1:]
+		if k.attr == "" {
+			return nil, fmt.Errorf("xmlpicker: invalid key path %q", s)
+		}
+		return k, nil
+	}
+	if s == "" {
+		return nil, fmt.Errorf("xmlpicker: invalid key path %q", s)
+	}
+	for _, v := range strings.Split(s, "/") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return nil, fmt.Errorf("xmlpicker: invalid key path %q", s)
+		}
+		k.path = append(k.path, v)
+	}
+	if k.path[len(k.path)-1] == "#text" {
+		k.path = k.path[:len(k.path)-1]
+	}
+	return k, nil
+}
+
+func (k *KeyPath) String() string {
+	return k.expr
+}
+
+// Key returns the key of node, or false if node has no such key.
+func (k *KeyPath) Key(node *Node) (string, bool) {
+	if k.attr != "" {
+		return attrValue(node, k.attr)
+	}
+	if len(k.path) == 0 {
+		return ownText(node)
+	}
+	if texts := collectTexts(node, k.path); len(texts) != 0 {
+		return texts[0], true
+	}
+	return "", false
+}
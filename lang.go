@@ -0,0 +1,59 @@
+package xmlpicker
+
+import "strings"
+
+// Lang returns the language of node given by its xml:lang attribute, or by that of its nearest ancestor that has
+// one, or "" if there is none.
+func (node *Node) Lang() string {
+	for n := node; n != nil; n = n.Parent {
+		if lang, ok := n.ownLang(); ok {
+			return lang
+		}
+	}
+	return ""
+}
+
+// ownLang returns the xml:lang attribute of node and whether it has one.
+func (node *Node) ownLang() (string, bool) {
+	for _, a := range node.Attrs() {
+		if a.Name.Local == "lang" && a.Name.URI == xmlNamespace {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// LangMatches reports whether lang, an xml:lang value, matches filter as the XPath lang function does: both are
+// equal, ignoring case, or lang is a sublanguage of filter, e.g. en-GB matches en.
+func LangMatches(lang, filter string) bool {
+	if len(lang) < len(filter) || !strings.EqualFold(lang[:len(filter)], filter) {
+		return false
+	}
+	return len(lang) == len(filter) || lang[len(filter)] == '-'
+}
+
+// FilterLang removes the descendants of node whose own xml:lang does not match lang, and reports whether node itself
+// matches lang or has no language. It is meant for records in several languages, such as the translation units of
+// TMX or multilingual catalogs, and for feeds whose records each have a language.
+func FilterLang(node *Node, lang string) bool {
+	if l := node.Lang(); l != "" && !LangMatches(l, lang) {
+		return false
+	}
+	filterLang(node, lang)
+	return true
+}
+
+func filterLang(node *Node, lang string) {
+	children := node.Children[:0]
+	for _, c := range node.Children {
+		if l, ok := c.ownLang(); ok && l != "" && !LangMatches(l, lang) {
+			continue
+		}
+		filterLang(c, lang)
+		children = append(children, c)
+	}
+	for i := len(children); i < len(node.Children); i++ {
+		node.Children[i] = nil
+	}
+	node.Children = children
+}
@@ -0,0 +1,64 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestLangMatches(t *testing.T) {
+	for idx, test := range []struct {
+		lang     string
+		filter   string
+		expected bool
+	}{
+		{"en", "en", true},
+		{"EN", "en", true},
+		{"en-GB", "en", true},
+		{"en-GB", "en-gb", true},
+		{"en", "en-GB", false},
+		{"eng", "en", false},
+		{"fr", "en", false},
+		{"", "en", false},
+	} {
+		t.Run(fmt.Sprintf("%d %s %s", idx, test.lang, test.filter), func(t *testing.T) {
+			assert.Equal(t, test.expected, xmlpicker.LangMatches(test.lang, test.filter))
+		})
+	}
+}
+
+func TestFilterLang(t *testing.T) {
+	const doc = `<tmx xml:lang="en">
+  <tu id="1"><tuv xml:lang="en-US"><seg>Hello</seg></tuv><tuv xml:lang="fr"><seg>Bonjour</seg></tuv><note>n</note></tu>
+  <tu id="2" xml:lang="fr"><tuv><seg>Salut</seg></tuv></tu>
+  <tu id="3" xml:lang=""><tuv xml:lang="de"><seg>Hallo</seg></tuv><tuv><seg>Hi</seg></tuv></tu>
+</tmx>`
+	for _, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSPrefix, xmlpicker.NSStrip} {
+		t.Run(nsFlag.String(), func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/tmx/tu"))
+			parser.NSFlag = nsFlag
+			var langs []string
+			var kept []string
+			for {
+				node, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				langs = append(langs, node.Lang())
+				if xmlpicker.FilterLang(node, "en") {
+					kept = append(kept, deepText(node))
+				}
+			}
+			assert.Equal(t, []string{"en", "fr", ""}, langs)
+			assert.Equal(t, []string{"Hellon", "Hi"}, kept)
+		})
+	}
+}
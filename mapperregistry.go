@@ -0,0 +1,88 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MapperFactory creates a Mapper from options given by name, e.g. on the command line.
+type MapperFactory func(options map[string]string) (Mapper, error)
+
+var mappers = struct {
+	sync.Mutex
+	factories map[string]MapperFactory
+}{factories: map[string]MapperFactory{
+	"simple":     newSimpleMapper,
+	"badgerfish": withoutOptions("badgerfish", BadgerFishMapper{}),
+	"parker":     withoutOptions("parker", ParkerMapper{}),
+	"ordered":    withoutOptions("ordered", OrderedMapper{}),
+}}
+
+// RegisterMapper makes a Mapper available to NewMapper under name, replacing any mapper registered under that name.
+// The built-in mappers are simple, badgerfish, parker and ordered.
+func RegisterMapper(name string, factory MapperFactory) {
+	mappers.Lock()
+	defer mappers.Unlock()
+	mappers.factories[name] = factory
+}
+
+// NewMapper creates the mapper registered under name with options. The simple mapper takes the boolean options
+// mixed-content, flatten, positions and xmlns, the other built-in mappers have none.
+func NewMapper(name string, options map[string]string) (Mapper, error) {
+	mappers.Lock()
+	factory, ok := mappers.factories[name]
+	mappers.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("xmlpicker: unknown mapper %q", name)
+	}
+	return factory(options)
+}
+
+// MapperNames returns the names of the registered mappers in lexical order.
+func MapperNames() []string {
+	mappers.Lock()
+	defer mappers.Unlock()
+	names := make([]string, 0, len(mappers.factories))
+	for name := range mappers.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newSimpleMapper(options map[string]string) (Mapper, error) {
+	m := SimpleMapper{}
+	for k, v := range options {
+		var option *bool
+		switch k {
+		case "mixed-content":
+			option = &m.MixedContent
+		case "flatten":
+			option = &m.FlattenText
+		case "positions":
+			option = &m.Positions
+		case "xmlns":
+			option = &m.InScopeNamespaces
+		default:
+			return nil, fmt.Errorf("xmlpicker: unknown option %s of mapper simple", k)
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("xmlpicker: invalid value %q of option %s of mapper simple", v, k)
+		}
+		*option = b
+	}
+	return m, nil
+}
+
+// withoutOptions returns a MapperFactory of m that rejects any option.
+func withoutOptions(name string, m Mapper) MapperFactory {
+	return func(options map[string]string) (Mapper, error) {
+		for k := range options {
+			return nil, fmt.Errorf("xmlpicker: unknown option %s of mapper %s", k, name)
+		}
+		return m, nil
+	}
+}
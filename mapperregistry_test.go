@@ -0,0 +1,196 @@
+package xmlpicker_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestMappers(t *testing.T) {
+	for idx, test := range []struct {
+		mapper        string
+		options       map[string]string
+		name          string
+		selector      string
+		xml           string
+		nsFlag        xmlpicker.NSFlag
+		preserveSpace bool
+		expected      []string
+	}{
+		{
+			mapper:   "simple",
+			options:  map[string]string{"flatten": "true"},
+			name:     "options",
+			selector: "/a",
+			xml:      `<a><b>x</b></a>`,
+			expected: []string{`{"_name":"a","b":"x"}`},
+		},
+		{
+			mapper:   "badgerfish",
+			name:     "attributes and text",
+			selector: "/a/b",
+			xml:      `<a><b id="1">x</b><b/></a>`,
+			expected: []string{`{"b":{"$":"x","@id":"1"}}`, `{"b":{}}`},
+		},
+		{
+			mapper:   "badgerfish",
+			name:     "children",
+			selector: "/a",
+			xml:      `<a><b>x</b><c/><b>y</b></a>`,
+			expected: []string{`{"a":{"b":[{"$":"x"},{"$":"y"}],"c":{}}}`},
+		},
+		{
+			mapper:   "badgerfish",
+			name:     "namespaces",
+			selector: "/a/b",
+			xml:      `<a xmlns="urn:a" xmlns:x="urn:x"><b x:id="1"><x:c xmlns:y="urn:y"/></b></a>`,
+			nsFlag:   xmlpicker.NSPrefix,
+			expected: []string{`{"b":{"@x:id":"1","@xmlns":{"$":"urn:a","x":"urn:x"},"x:c":{"@xmlns":{"y":"urn:y"}}}}`},
+		},
+		{
+			mapper:   "badgerfish",
+			name:     "namespaces",
+			selector: "/a/b",
+			xml:      `<a xmlns="urn:a" xmlns:x="urn:x"><b x:id="1"><x:c xmlns:y="urn:y"/></b></a>`,
+			nsFlag:   xmlpicker.NSExpand,
+			expected: []string{`{"b":{"@x:id":"1","@xmlns":{"$":"urn:a","x":"urn:x"},"x:c":{"@xmlns":{"y":"urn:y"}}}}`},
+		},
+		{
+			mapper:   "badgerfish",
+			name:     "mixed content",
+			selector: "/p",
+			xml:      `<p>Hello<b>world</b>and more<br/></p>`,
+			expected: []string{`{"p":{"$":"Hello and more","b":{"$":"world"},"br":{}}}`},
+		},
+		{
+			mapper:        "badgerfish",
+			name:          "mixed content with preserved space",
+			selector:      "/p",
+			xml:           `<p>Hello, <b> world </b>and <i>more</i>!</p>`,
+			preserveSpace: true,
+			expected:      []string{`{"p":{"$":"Hello, and !","b":{"$":"world"},"i":{"$":"more"}}}`},
+		},
+		{
+			mapper:   "badgerfish",
+			name:     "attribute selector",
+			selector: "/a/b/@id",
+			xml:      `<a><b id="1"/></a>`,
+			expected: []string{`{"$":"1"}`},
+		},
+		{
+			mapper:   "parker",
+			name:     "children",
+			selector: "/a",
+			xml:      `<a id="1"><b>x</b><c/><b>y</b><d><e>z</e></d></a>`,
+			expected: []string{`{"b":["x","y"],"c":null,"d":{"e":"z"}}`},
+		},
+		{
+			mapper:   "parker",
+			name:     "text",
+			selector: "/a/b",
+			xml:      `<a><b id="1">x</b><b/></a>`,
+			expected: []string{`{"#text":"x"}`, `{}`},
+		},
+		{
+			mapper:   "parker",
+			name:     "mixed content",
+			selector: "/a",
+			xml:      `<a>x<b>y</b>z</a>`,
+			expected: []string{`{"b":"y"}`},
+		},
+		{
+			mapper:   "ordered",
+			name:     "children",
+			selector: "/a",
+			xml:      `<a id="1"><b>x</b><c/><b>y</b></a>`,
+			expected: []string{`{"#content":[{"#content":["x"],"_name":"b"},{"#content":[],"_name":"c"},{"#content":["y"],"_name":"b"}],"@id":"1","_name":"a"}`},
+		},
+		{
+			mapper:   "ordered",
+			name:     "mixed content",
+			selector: "/a",
+			xml:      `<a>x<b>y</b>z</a>`,
+			expected: []string{`{"#content":["x",{"#content":["y"],"_name":"b"},"z"],"_name":"a"}`},
+		},
+	} {
+		name := fmt.Sprintf("%d %s %s %s", idx, test.mapper, test.name, test.nsFlag)
+		t.Run(name, func(t *testing.T) {
+			mapper, err := xmlpicker.NewMapper(test.mapper, test.options)
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			parser.NSFlag = test.nsFlag
+			parser.PreserveSpace = test.preserveSpace
+			actual := make([]string, 0)
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				v, err := mapper.FromNode(n)
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				b, err := json.Marshal(v)
+				assert.NoError(t, err, name)
+				actual = append(actual, string(b))
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestNewMapperErrors(t *testing.T) {
+	for idx, test := range []struct {
+		mapper      string
+		options     map[string]string
+		expectedErr string
+	}{
+		{
+			mapper:      "json",
+			expectedErr: `xmlpicker: unknown mapper "json"`,
+		},
+		{
+			mapper:      "simple",
+			options:     map[string]string{"pretty": "true"},
+			expectedErr: "xmlpicker: unknown option pretty of mapper simple",
+		},
+		{
+			mapper:      "simple",
+			options:     map[string]string{"flatten": "yes"},
+			expectedErr: `xmlpicker: invalid value "yes" of option flatten of mapper simple`,
+		},
+		{
+			mapper:      "parker",
+			options:     map[string]string{"flatten": "true"},
+			expectedErr: "xmlpicker: unknown option flatten of mapper parker",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.mapper)
+		t.Run(name, func(t *testing.T) {
+			_, err := xmlpicker.NewMapper(test.mapper, test.options)
+			assert.EqualError(t, err, test.expectedErr, name)
+		})
+	}
+}
+
+func TestRegisterMapper(t *testing.T) {
+	xmlpicker.RegisterMapper("test-custom", func(options map[string]string) (xmlpicker.Mapper, error) {
+		return xmlpicker.SimpleMapper{FlattenText: options["flat"] == "yes"}, nil
+	})
+	m, err := xmlpicker.NewMapper("test-custom", map[string]string{"flat": "yes"})
+	assert.NoError(t, err)
+	assert.Equal(t, xmlpicker.SimpleMapper{FlattenText: true}, m)
+	assert.Contains(t, xmlpicker.MapperNames(), "test-custom")
+	assert.Contains(t, xmlpicker.MapperNames(), "badgerfish")
+}
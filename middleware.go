@@ -0,0 +1,110 @@
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Middleware wraps a Processor with a concern that applies to every node, such as counting, validation or
+// deduplication, so that such concerns compose with any Processor.
+type Middleware func(next Processor) Processor
+
+// Chain returns proc wrapped by middleware, the first of which sees each node first.
+func Chain(proc Processor, middleware ...Middleware) Processor {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		proc = middleware[i](proc)
+	}
+	return proc
+}
+
+// Counting adds one to *count for each node passed on, it may be read with atomic.LoadInt64 while processing.
+func Counting(count *int64) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(node *Node) error {
+			atomic.AddInt64(count, 1)
+			return next.Process(node)
+		})
+	}
+}
+
+// RateLimiting passes at most perSecond nodes a second on with a RateLimitedProcessor.
+func RateLimiting(perSecond float64) Middleware {
+	return func(next Processor) Processor {
+		return &RateLimitedProcessor{Next: next, Rate: perSecond}
+	}
+}
+
+// ConcurrencyLimiting passes nodes on from at most limit goroutines at a time with a ConcurrencyLimitedProcessor.
+func ConcurrencyLimiting(limit int) Middleware {
+	return func(next Processor) Processor {
+		return &ConcurrencyLimitedProcessor{Next: next, Limit: limit}
+	}
+}
+
+// Timing calls observe with each node and the time the processors after it took.
+func Timing(observe func(node *Node, d time.Duration)) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(node *Node) error {
+			start := time.Now()
+			err := next.Process(node)
+			observe(node, time.Since(start))
+			return err
+		})
+	}
+}
+
+// Validating only passes on the nodes validate accepts, the others fail with a RecordError of the validate stage.
+func Validating(validate func(node *Node) error) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(node *Node) error {
+			if err := validate(node); err != nil {
+				return &RecordError{Stage: "validate", Err: err}
+			}
+			return next.Process(node)
+		})
+	}
+}
+
+// RequireKey returns a validation for Validating that rejects the nodes without a value at keyPath.
+func RequireKey(keyPath *KeyPath) func(node *Node) error {
+	return func(node *Node) error {
+		if _, ok := keyPath.Key(node); !ok {
+			return fmt.Errorf("xmlpicker: no %s in %s", keyPath, node.Path())
+		}
+		return nil
+	}
+}
+
+// Deduplicating drops the nodes whose value at keyPath was seen before, the nodes without one are passed on. The keys
+// seen are kept in memory.
+func Deduplicating(keyPath *KeyPath) Middleware {
+	return func(next Processor) Processor {
+		var mu sync.Mutex
+		seen := make(map[string]struct{})
+		return ProcessorFunc(func(node *Node) error {
+			if key, ok := keyPath.Key(node); ok {
+				mu.Lock()
+				_, dup := seen[key]
+				seen[key] = struct{}{}
+				mu.Unlock()
+				if dup {
+					return nil
+				}
+			}
+			return next.Process(node)
+		})
+	}
+}
+
+// Annotating adds attrs to the attributes of each node, e.g. to record where or when it was extracted.
+func Annotating(attrs ...xml.Attr) Middleware {
+	return func(next Processor) Processor {
+		return ProcessorFunc(func(node *Node) error {
+			node.StartElement.Attr = append(node.StartElement.Attr[:len(node.StartElement.Attr):len(node.StartElement.Attr)], attrs...)
+			return next.Process(node)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestChain(t *testing.T) {
+	const doc = `<feed><entry id="1"/><entry id="2"/><entry id="1"/><entry/><entry id="3"/></feed>`
+	keyPath, err := xmlpicker.ParseKeyPath("@id")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var count int64
+	var timed int
+	var actual []string
+	proc := xmlpicker.Chain(
+		xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+			xml, err := exportNode(node)
+			actual = append(actual, xml)
+			return err
+		}),
+		xmlpicker.Counting(&count),
+		xmlpicker.Deduplicating(keyPath),
+		xmlpicker.Validating(xmlpicker.RequireKey(keyPath)),
+		xmlpicker.Timing(func(node *xmlpicker.Node, d time.Duration) { timed++ }),
+		xmlpicker.Annotating(xml.Attr{Name: xml.Name{Local: "source"}, Value: "feed"}),
+	)
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+	var rejected []string
+	for {
+		node, err := parser.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		if err := proc.Process(node); err != nil {
+			if recordErr, ok := err.(*xmlpicker.RecordError); assert.True(t, ok) {
+				rejected = append(rejected, recordErr.Error())
+			}
+		}
+	}
+	assert.Equal(t, int64(5), count)
+	assert.Equal(t, 3, timed)
+	assert.Equal(t, []string{"validate: xmlpicker: no @id in /feed/entry"}, rejected)
+	assert.Equal(t, []string{
+		`<feed><entry id="1" source="feed"></entry></feed>`,
+		`<feed><entry id="2" source="feed"></entry></feed>`,
+		`<feed><entry id="3" source="feed"></entry></feed>`,
+	}, actual)
+}
+
+func TestRateLimiting(t *testing.T) {
+	proc := xmlpicker.Chain(xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error { return nil }), xmlpicker.RateLimiting(50))
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, proc.Process(&xmlpicker.Node{}))
+	}
+	assert.True(t, time.Since(start) >= 40*time.Millisecond, "took %s", time.Since(start))
+}
+
+func TestConcurrencyLimiting(t *testing.T) {
+	proc := xmlpicker.Chain(xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}), xmlpicker.ConcurrencyLimiting(1))
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, proc.Process(&xmlpicker.Node{}))
+		}()
+	}
+	wg.Wait()
+	assert.True(t, time.Since(start) >= 60*time.Millisecond, "took %s", time.Since(start))
+}
@@ -2,21 +2,74 @@ package xmlpicker
 
 import (
 	"encoding/xml"
+	"fmt"
 	"strings"
 )
 
+// xmlNamespace is bound to the xml prefix by definition.
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// Node is an element, or a text node, of a document together with its ancestors up to an empty root and, for the nodes
+// returned by a Parser and their descendants, its children. A text node has an empty name and a single attribute with
+// an empty name holding the text, use Text and SetText rather than relying on that.
 type Node struct {
 	StartElement xml.StartElement
 	Parent       *Node
 	Namespaces   Namespaces
 	Children     []*Node
+	// Truncated is set on the elements of a node whose child elements were left out by Parser.CollectDepth.
+	Truncated bool
+	// Index is the position in document order of a node returned by a Parser, counted from 0, or of a descendant of
+	// such a node with Parser.IndexChildren. It lets the nodes be put back in order after they were processed apart.
+	Index int
+
+	// declared, name and attrNames are tracked by the Parser whatever its NSFlag
+	declared  Namespaces
+	name      QName
+	attrNames []QName
+	// pathNames is set by the Parser on the nodes it matches, it ends with the name of the attribute for the text node
+	// of an attribute value
+	pathNames []xml.Name
+	// position and elementPosition are the positions of an element among its siblings of the same name and among all
+	// its sibling elements, counted from 1. The Parser tracks them outside of the nodes it matches, with the counts of
+	// the children of an element in siblings while it is open.
+	position        int
+	elementPosition int
+	siblings        *siblingCounts
+}
+
+// siblingCounts counts the child elements of an element, by name once they have several names.
+type siblingCounts struct {
+	elements int
+	name     xml.Name
+	count    int
+	names    map[xml.Name]int
+}
+
+// add counts a child named name and returns its positions among the children of that name and among all of them.
+func (s *siblingCounts) add(name xml.Name) (int, int) {
+	s.elements++
+	if s.names == nil {
+		if s.count == 0 || s.name == name {
+			s.name = name
+			s.count++
+			return s.count, s.elements
+		}
+		s.names = map[xml.Name]int{s.name: s.count}
+	}
+	s.names[name]++
+	return s.names[name], s.elements
 }
 
+// Namespaces maps prefixes, "" for the default namespace, to namespace URIs.
 type Namespaces map[string]string
 
+// Text returns the text of a text node, or false for an element.
 func (node *Node) Text() (string, bool) {
 	return decodeText(&node.StartElement)
 }
+
+// SetText turns node into a text node holding text.
 func (node *Node) SetText(text string) {
 	encodeText(&node.StartElement, text)
 }
@@ -40,6 +93,75 @@ func encodeText(e *xml.StartElement, text string) {
 	e.Attr = []xml.Attr{{Value: text}}
 }
 
+// SiblingIndex returns the position of node among the children of its parent with the same name, counted from 1 as in
+// the [n] predicates of XPath, text nodes are counted among text nodes. It returns 0 when the children of the parent
+// are not known, as for the nodes returned by a Parser.
+func (node *Node) SiblingIndex() int {
+	if node.Parent == nil {
+		return 0
+	}
+	i := 0
+	for _, c := range node.Parent.Children {
+		if c.StartElement.Name == node.StartElement.Name {
+			i = i + 1
+		}
+		if c == node {
+			return i
+		}
+	}
+	return 0
+}
+
+// siblingPosition returns the position of node among its sibling elements, of the same name unless any is set, as
+// tracked by the Parser or else counted among the children of its parent. It returns 0 when neither is known.
+func (node *Node) siblingPosition(any bool) int {
+	if !any {
+		if node.position != 0 {
+			return node.position
+		}
+		return node.SiblingIndex()
+	}
+	if node.elementPosition != 0 || node.Parent == nil {
+		return node.elementPosition
+	}
+	i := 0
+	for _, c := range node.Parent.Children {
+		if _, ok := c.Text(); !ok {
+			i = i + 1
+		}
+		if c == node {
+			return i
+		}
+	}
+	return 0
+}
+
+// lastSibling reports whether node is the last of its sibling elements, of the same name unless any is set, ok is
+// false when the children of its parent are not known.
+func (node *Node) lastSibling(any bool) (last, ok bool) {
+	if node.Parent == nil {
+		return false, false
+	}
+	for _, c := range node.Parent.Children {
+		if c == node {
+			ok = true
+			last = true
+		} else if ok && isSibling(node, c, any) {
+			last = false
+		}
+	}
+	return last, ok
+}
+
+// isSibling reports whether the element other is counted with node for positions among siblings.
+func isSibling(node, other *Node, any bool) bool {
+	if _, ok := other.Text(); ok {
+		return false
+	}
+	return any || other.StartElement.Name == node.StartElement.Name
+}
+
+// Depth returns the number of ancestors of node below the root, 1 for the document element.
 func (node *Node) Depth() int {
 	d := 0
 	for n := node; n != nil && n.Parent != nil; n = n.Parent {
@@ -48,6 +170,8 @@ func (node *Node) Depth() int {
 	return d
 }
 
+// LookupPrefix returns the namespace bound to prefix by the Namespaces of node and its ancestors, or prefix itself and
+// false if there is none. Namespaces are only set in NSPrefix mode, use InScopeNamespaces or ResolveQName otherwise.
 func (node *Node) LookupPrefix(prefix string) (string, bool) {
 	for n := node; n != nil; n = n.Parent {
 		if ns, ok := n.Namespaces[prefix]; ok {
@@ -57,15 +181,199 @@ func (node *Node) LookupPrefix(prefix string) (string, bool) {
 	return prefix, false
 }
 
-type FormatNodePath Node
+// NamespaceURI returns the namespace of the element, or "" if it is in no namespace. Unprefixed elements are in the
+// default namespace in scope whatever the NSFlag, even though their name space is empty in NSPrefix mode.
+func (node *Node) NamespaceURI() string {
+	return node.Name().URI
+}
 
-func (fnp *FormatNodePath) String() string {
-	node := (*Node)(fnp)
+// ResolveQName resolves a qualified name such as "p:local" against the namespaces in scope at node. A name without a
+// prefix is in the default namespace, as for element names.
+func (node *Node) ResolveQName(qname string) (xml.Name, error) {
+	prefix, local := "", qname
+	if i := strings.IndexByte(qname, ':'); i != -1 {
+		prefix, local = qname[:i], qname[i+1:]
+		if prefix == "" {
+			local = ""
+		}
+	}
+	if local == "" || strings.IndexByte(local, ':') != -1 {
+		return xml.Name{}, fmt.Errorf("xmlpicker: invalid qualified name %q", qname)
+	}
+	ns, ok := node.lookupNamespace(prefix)
+	if !ok {
+		return xml.Name{}, fmt.Errorf("xmlpicker: undeclared prefix %s at %s", prefix, node.Path())
+	}
+	return xml.Name{Space: ns, Local: local}, nil
+}
+
+// InScopeNamespaces returns the prefixes declared by node and its ancestors mapped to their namespace, the default
+// namespace uses the empty prefix. Unlike Namespaces it is available whatever the NSFlag of the Parser.
+func (node *Node) InScopeNamespaces() Namespaces {
+	var path []*Node
+	for n := node; n != nil; n = n.Parent {
+		path = append(path, n)
+	}
+	ns := Namespaces{"xml": xmlNamespace}
+	for i := len(path) - 1; i >= 0; i-- {
+		for prefix, v := range path[i].declarations() {
+			ns[prefix] = v
+		}
+	}
+	return ns
+}
+
+// declarations returns the namespaces declared on the element itself.
+func (node *Node) declarations() Namespaces {
+	if node.declared != nil {
+		return node.declared
+	}
+	return node.Namespaces
+}
+
+func (node *Node) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for n := node; n != nil; n = n.Parent {
+		if ns, ok := n.declarations()[prefix]; ok {
+			return ns, true
+		}
+	}
+	return "", prefix == ""
+}
+
+// DeepCopy returns a copy of node, its descendants and its ancestors that shares no memory with node. Like the
+// ancestors of the nodes returned by Parser.Next the copied ancestors have no children.
+func (node *Node) DeepCopy() *Node {
+	var parent *Node
+	if node.Parent != nil {
+		parent = node.Parent.copyAncestors()
+	}
+	return node.copyTree(parent)
+}
+
+// Detach returns a copy of node and its descendants that shares no memory with node and whose parent is a new empty
+// root, as if it was the document element. The namespaces declared by the ancestors of node are added to the copy so
+// that its prefixes can still be resolved.
+func (node *Node) Detach() *Node {
+	c := node.copyTree(&Node{})
+	for n := node.Parent; n != nil; n = n.Parent {
+		c.Namespaces = inherit(c.Namespaces, n.Namespaces)
+		c.declared = inherit(c.declared, n.declarations())
+	}
+	return c
+}
+
+// inherit adds the namespaces of an ancestor that are not overridden by ns.
+func inherit(ns, ancestor Namespaces) Namespaces {
+	for prefix, v := range ancestor {
+		if _, ok := ns[prefix]; ok {
+			continue
+		}
+		if ns == nil {
+			ns = make(Namespaces)
+		}
+		ns[prefix] = v
+	}
+	return ns
+}
+
+func (node *Node) copyAncestors() *Node {
+	c := &Node{
+		StartElement: node.StartElement.Copy(),
+		Namespaces:   node.Namespaces.copy(),
+		declared:     node.declared.copy(),
+		name:         node.name,
+		attrNames:    copyQNames(node.attrNames),
+	}
+	if node.Parent != nil {
+		c.Parent = node.Parent.copyAncestors()
+	}
+	return c
+}
+
+func (node *Node) copyTree(parent *Node) *Node {
+	c := node.copyNode(parent)
+	if node.Children != nil {
+		c.Children = make([]*Node, len(node.Children))
+		for i, child := range node.Children {
+			c.Children[i] = child.copyTree(c)
+		}
+	}
+	return c
+}
+
+// copyNode returns a copy of node, without its children, whose parent is parent.
+func (node *Node) copyNode(parent *Node) *Node {
+	return &Node{
+		StartElement: node.StartElement.Copy(),
+		Parent:       parent,
+		Namespaces:   node.Namespaces.copy(),
+		Truncated:    node.Truncated,
+		Index:        node.Index,
+		declared:     node.declared.copy(),
+		name:         node.name,
+		attrNames:    copyQNames(node.attrNames),
+		pathNames:    copyNames(node.pathNames),
+	}
+}
+
+func (ns Namespaces) copy() Namespaces {
+	if ns == nil {
+		return nil
+	}
+	c := make(Namespaces, len(ns))
+	for k, v := range ns {
+		c[k] = v
+	}
+	return c
+}
+
+// Path returns the local names of node and its ancestors separated by slashes, such as /feed/entry, or such as
+// /feed/entry/@id for the value of an attribute returned by a Parser with an attribute selector.
+func (node *Node) Path() string {
 	i := node.Depth() + 1
 	parts := make([]string, i, i)
 	for n := node; n.Parent != nil; n = n.Parent {
 		i = i - 1
 		parts[i] = n.StartElement.Name.Local
 	}
+	if _, ok := node.Text(); ok && len(node.pathNames) != 0 {
+		parts[len(parts)-1] = "@" + node.pathNames[len(node.pathNames)-1].Local
+	}
 	return strings.Join(parts, "/")
 }
+
+// PathNames returns the names of the ancestors of node from the document element down, followed by the name of node.
+// For a node returned by a Parser they are captured when it is matched, so they stay available to it and its
+// descendants after its Parent is cleared or it is detached.
+func (node *Node) PathNames() []xml.Name {
+	var names []xml.Name
+	n := node
+	for ; n.pathNames == nil && n.Parent != nil; n = n.Parent {
+		names = append(names, n.StartElement.Name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return append(copyNames(n.pathNames), names...)
+}
+
+func copyNames(names []xml.Name) []xml.Name {
+	if names == nil {
+		return nil
+	}
+	c := make([]xml.Name, len(names))
+	copy(c, names)
+	return c
+}
+
+// FormatNodePath formats the path of a node when converted from it, as in (*FormatNodePath)(node).
+//
+// Deprecated: use Node.Path.
+type FormatNodePath Node
+
+func (fnp *FormatNodePath) String() string {
+	return (*Node)(fnp).Path()
+}
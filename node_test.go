@@ -0,0 +1,267 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func exportNode(n *xmlpicker.Node) (string, error) {
+	var b bytes.Buffer
+	e := xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&b)}
+	if err := e.StartPath(n.Parent); err != nil {
+		return "", err
+	}
+	if err := e.EncodeNode(n); err != nil {
+		return "", err
+	}
+	if err := e.EndPath(n.Parent); err != nil {
+		return "", err
+	}
+	err := e.Encoder.Flush()
+	return b.String(), err
+}
+
+func TestNodeDeepCopy(t *testing.T) {
+	const doc = `<feed xmlns:x="urn:x" lang="en"><entry id="1"><x:title>one</x:title></entry></feed>`
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+	parser.NSFlag = xmlpicker.NSPrefix
+	n, err := parser.Next()
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected, err := exportNode(n)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := n.DeepCopy()
+	actual, err := exportNode(c)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, "/feed/entry", (*xmlpicker.FormatNodePath)(c).String())
+	assert.Equal(t, "/feed/entry", c.Path())
+
+	c.StartElement.Attr[0].Value = "2"
+	c.Parent.StartElement.Attr[0].Value = "fr"
+	c.Parent.Namespaces["x"] = "urn:y"
+	c.Children[0].Children[0].SetText("changed")
+	actual, err = exportNode(n)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestNodeSiblingIndex(t *testing.T) {
+	const doc = `<feed><entry><a/>x<b/><a/>y<a/></entry></feed>`
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+	n, err := parser.Next()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var actual []int
+	for _, c := range n.Children {
+		actual = append(actual, c.SiblingIndex())
+	}
+	assert.Equal(t, []int{1, 1, 1, 2, 2, 3}, actual)
+	assert.Equal(t, 0, n.SiblingIndex())
+	assert.Equal(t, 0, (&xmlpicker.Node{}).SiblingIndex())
+}
+
+func TestNodeDetach(t *testing.T) {
+	for idx, test := range []struct {
+		nsFlag   xmlpicker.NSFlag
+		expected string
+	}{
+		{
+			nsFlag:   xmlpicker.NSPrefix,
+			expected: `<entry id="1" xmlns="urn:default" xmlns:x="urn:x"><x:title>one</x:title></entry>`,
+		},
+		{
+			nsFlag:   xmlpicker.NSStrip,
+			expected: `<entry id="1"><title>one</title></entry>`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.nsFlag)
+		t.Run(name, func(t *testing.T) {
+			const doc = `<feed xmlns="urn:default" xmlns:x="urn:x"><entry id="1"><x:title>one</x:title></entry></feed>`
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+			parser.NSFlag = test.nsFlag
+			n, err := parser.Next()
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			d := n.Detach()
+			assert.Equal(t, 1, d.Depth(), name)
+			if test.nsFlag == xmlpicker.NSPrefix {
+				ns, ok := d.Children[0].LookupPrefix("x")
+				assert.True(t, ok, name)
+				assert.Equal(t, "urn:x", ns, name)
+			}
+			actual, err := exportNode(d)
+			assert.NoError(t, err, name)
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestNodeDetachConcurrent(t *testing.T) {
+	var doc bytes.Buffer
+	doc.WriteString(`<feed>`)
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&doc, `<entry id="%d"><title>%d</title></entry>`, i, i)
+	}
+	doc.WriteString(`</feed>`)
+	parser := xmlpicker.NewParser(xml.NewDecoder(&doc), xmlpicker.PathSelector("/feed/entry"))
+	results := make([]string, 100)
+	var wg sync.WaitGroup
+	for i := 0; ; i++ {
+		n, err := parser.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		wg.Add(1)
+		go func(i int, n *xmlpicker.Node) {
+			defer wg.Done()
+			n.Children[0].Children[0].SetText(strings.Repeat("x", i))
+			results[i], _ = exportNode(n)
+		}(i, n.Detach())
+	}
+	wg.Wait()
+	for i, actual := range results {
+		assert.Equal(t, fmt.Sprintf(`<entry id="%d"><title>%s</title></entry>`, i, strings.Repeat("x", i)), actual)
+	}
+}
+
+func TestNodeNamespaces(t *testing.T) {
+	const doc = `<feed xmlns="urn:default" xmlns:x="urn:x"><entry xmlns:y="urn:y"><x:title>one</x:title><y:id/><plain xmlns=""/></entry></feed>`
+	for _, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSStrip, xmlpicker.NSPrefix} {
+		name := nsFlag.String()
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+			parser.NSFlag = nsFlag
+			n, err := parser.Next()
+			if !assert.NoError(t, err, name) || !assert.Len(t, n.Children, 3, name) {
+				return
+			}
+			assert.Equal(t, "urn:default", n.NamespaceURI(), name)
+			assert.Equal(t, "urn:x", n.Children[0].NamespaceURI(), name)
+			assert.Equal(t, "urn:y", n.Children[1].NamespaceURI(), name)
+			assert.Equal(t, "", n.Children[2].NamespaceURI(), name)
+			assert.Equal(t, xmlpicker.QName{URI: "urn:default", Local: "entry"}, n.Name(), name)
+			assert.Equal(t, xmlpicker.QName{Prefix: "x", URI: "urn:x", Local: "title"}, n.Children[0].Name(), name)
+			assert.Equal(t, xmlpicker.Namespaces{
+				"":    "urn:default",
+				"x":   "urn:x",
+				"y":   "urn:y",
+				"xml": "http://www.w3.org/XML/1998/namespace",
+			}, n.InScopeNamespaces(), name)
+			assert.Equal(t, "", n.Children[2].InScopeNamespaces()[""], name)
+
+			for qname, expected := range map[string]xml.Name{
+				"y:id":     {Space: "urn:y", Local: "id"},
+				"title":    {Space: "urn:default", Local: "title"},
+				"xml:lang": {Space: "http://www.w3.org/XML/1998/namespace", Local: "lang"},
+			} {
+				actual, err := n.ResolveQName(qname)
+				assert.NoError(t, err, "%s %s", name, qname)
+				assert.Equal(t, expected, actual, "%s %s", name, qname)
+			}
+			_, err = n.ResolveQName("z:id")
+			assert.EqualError(t, err, "xmlpicker: undeclared prefix z at /feed/entry", name)
+			_, err = n.ResolveQName("x:")
+			assert.EqualError(t, err, `xmlpicker: invalid qualified name "x:"`, name)
+
+			d := n.Children[0].Detach()
+			assert.Equal(t, "urn:x", d.NamespaceURI(), name)
+			assert.Equal(t, "urn:y", d.InScopeNamespaces()["y"], name)
+		})
+	}
+}
+
+func TestNodeAttrs(t *testing.T) {
+	const doc = `<feed xmlns="urn:default" xmlns:x="urn:x"><entry xmlns:y="urn:y" id="1" x:kind="a" y:kind="b" xml:lang="en"><x:title/></entry></feed>`
+	expected := []xmlpicker.Attr{
+		{Name: xmlpicker.QName{Local: "id"}, Value: "1"},
+		{Name: xmlpicker.QName{Prefix: "x", URI: "urn:x", Local: "kind"}, Value: "a"},
+		{Name: xmlpicker.QName{Prefix: "y", URI: "urn:y", Local: "kind"}, Value: "b"},
+		{Name: xmlpicker.QName{Prefix: "xml", URI: "http://www.w3.org/XML/1998/namespace", Local: "lang"}, Value: "en"},
+	}
+	for _, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSStrip, xmlpicker.NSPrefix} {
+		name := nsFlag.String()
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+			parser.NSFlag = nsFlag
+			n, err := parser.Next()
+			if !assert.NoError(t, err, name) || !assert.Len(t, n.Children, 1, name) {
+				return
+			}
+			assert.Equal(t, xmlpicker.QName{URI: "urn:default", Local: "entry"}, n.Name(), name)
+			assert.Equal(t, xmlpicker.QName{Prefix: "x", URI: "urn:x", Local: "title"}, n.Children[0].Name(), name)
+			assert.Equal(t, expected, n.Attrs(), name)
+			assert.Equal(t, expected, n.DeepCopy().Attrs(), name)
+
+			n.StartElement.Attr = append(n.StartElement.Attr, xml.Attr{Name: xml.Name{Local: "added"}, Value: "c"})
+			attrs := n.Attrs()
+			assert.Equal(t, xmlpicker.Attr{Name: xmlpicker.QName{Local: "added"}, Value: "c"}, attrs[len(attrs)-1], name)
+		})
+	}
+}
+
+func TestNodeNamePrefixes(t *testing.T) {
+	const doc = `<feed xmlns:b="urn:x" xmlns:a="urn:x"><b:entry b:kind="a"><a:title a:kind="b"/></b:entry></feed>`
+	for idx, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSStrip, xmlpicker.NSPrefix} {
+		for _, tokenizer := range []bool{false, true} {
+			name := fmt.Sprintf("%d %s tokenizer=%v", idx, nsFlag, tokenizer)
+			t.Run(name, func(t *testing.T) {
+				var tokens xmlpicker.TokenReader = xml.NewDecoder(strings.NewReader(doc))
+				if tokenizer {
+					tokens = xmlpicker.NewTokenizer(strings.NewReader(doc))
+				}
+				parser := xmlpicker.NewTokenParser(tokens, xmlpicker.PathSelector("/feed/*"))
+				parser.NSFlag = nsFlag
+				n, err := parser.Next()
+				if !assert.NoError(t, err, name) || !assert.Len(t, n.Children, 1, name) {
+					return
+				}
+				assert.Equal(t, xmlpicker.QName{Prefix: "b", URI: "urn:x", Local: "entry"}, n.Name(), name)
+				assert.Equal(t, xmlpicker.QName{Prefix: "b", URI: "urn:x", Local: "kind"}, n.Attrs()[0].Name, name)
+				assert.Equal(t, xmlpicker.QName{Prefix: "a", URI: "urn:x", Local: "title"}, n.Children[0].Name(), name)
+				assert.Equal(t, xmlpicker.QName{Prefix: "a", URI: "urn:x", Local: "kind"}, n.Children[0].Attrs()[0].Name, name)
+			})
+		}
+	}
+}
+
+func TestNodePathNames(t *testing.T) {
+	const doc = `<feed xmlns="urn:f"><entry><title>one</title></entry></feed>`
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+	n, err := parser.Next()
+	if !assert.NoError(t, err) {
+		return
+	}
+	feed := xml.Name{Space: "urn:f", Local: "feed"}
+	entry := xml.Name{Space: "urn:f", Local: "entry"}
+	title := xml.Name{Space: "urn:f", Local: "title"}
+	assert.Equal(t, []xml.Name{feed, entry}, n.PathNames())
+	assert.Equal(t, []xml.Name{feed}, n.Parent.PathNames())
+
+	d := n.Detach()
+	assert.Equal(t, "/entry", d.Path())
+	assert.Equal(t, []xml.Name{feed, entry}, d.PathNames())
+
+	n.Parent = nil
+	assert.Equal(t, []xml.Name{feed, entry}, n.PathNames())
+	assert.Equal(t, []xml.Name{feed, entry, title}, n.Children[0].PathNames())
+
+	n.PathNames()[0].Local = "changed"
+	assert.Equal(t, []xml.Name{feed, entry}, n.PathNames())
+}
@@ -0,0 +1,36 @@
+package xmlpicker
+
+// Normalizer converts a string to a canonical form, such as a Unicode normalization form, so that strings that only
+// differ by their form compare equal. The String method of a norm.Form of golang.org/x/text/unicode/norm is one.
+type Normalizer func(s string) string
+
+// NormalizingMapper normalizes the strings of the objects Mapper returns, for instance when the Parser that read the
+// nodes did not normalize them. Keys are left as they are.
+type NormalizingMapper struct {
+	Mapper    Mapper
+	Normalize Normalizer
+}
+
+func (m NormalizingMapper) FromNode(node *Node) (map[string]interface{}, error) {
+	v, err := m.Mapper.FromNode(node)
+	if err != nil || m.Normalize == nil {
+		return v, err
+	}
+	return m.normalize(v).(map[string]interface{}), nil
+}
+
+func (m NormalizingMapper) normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return m.Normalize(v)
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = m.normalize(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = m.normalize(e)
+		}
+	}
+	return v
+}
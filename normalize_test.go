@@ -0,0 +1,68 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+// composeAcute is a Normalizer composing the only decomposed character of the tests.
+func composeAcute(s string) string {
+	return strings.Replace(s, "e\u0301", "\u00e9", -1)
+}
+
+func TestParserNormalize(t *testing.T) {
+	const doc = "<a><b name=\"cafe\u0301\">\ufb01 cafe\u0301</b></a>"
+	for idx, test := range []struct {
+		name      string
+		normalize xmlpicker.Normalizer
+		selector  string
+		expected  string
+	}{
+		{"none", nil, "/a/b", "<a><b name=\"cafe\u0301\">\ufb01 cafe\u0301</b></a>"},
+		{"compose", composeAcute, "/a/b", "<a><b name=\"caf\u00e9\">\ufb01 caf\u00e9</b></a>"},
+		{"compose selected", composeAcute, "/a/b[@name='caf\u00e9']", "<a><b name=\"caf\u00e9\">\ufb01 caf\u00e9</b></a>"},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.name), func(t *testing.T) {
+			selector, err := xmlpicker.ParseXPath(test.selector)
+			if !assert.NoError(t, err) {
+				return
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), selector)
+			parser.Normalize = test.normalize
+			node, err := parser.Next()
+			if !assert.NoError(t, err) {
+				return
+			}
+			actual, err := exportNode(node)
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNormalizingMapper(t *testing.T) {
+	const doc = "<a x=\"cafe\u0301\"><b>\ufb01</b><b>e\u0301</b></a>"
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/"))
+	node, err := parser.Next()
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := xmlpicker.NormalizingMapper{Mapper: xmlpicker.SimpleMapper{}, Normalize: composeAcute}
+	actual, err := m.FromNode(node)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{
+			"_name": "a",
+			"@x":    "caf\u00e9",
+			"b": []interface{}{
+				map[string]interface{}{"#text": []interface{}{"\ufb01"}},
+				map[string]interface{}{"#text": []interface{}{"\u00e9"}},
+			},
+		}, actual)
+	}
+}
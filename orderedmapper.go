@@ -0,0 +1,10 @@
+package xmlpicker
+
+// OrderedMapper maps nodes like SimpleMapper with MixedContent, except that the content of every element is mapped to
+// an ordered "#content" list of strings and child objects with their "_name", so that the order of all children is
+// kept and not only that of mixed content.
+type OrderedMapper struct{}
+
+func (m OrderedMapper) FromNode(node *Node) (map[string]interface{}, error) {
+	return SimpleMapper{ordered: true}.FromNode(node)
+}
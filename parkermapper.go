@@ -0,0 +1,59 @@
+package xmlpicker
+
+import "bytes"
+
+// ParkerMapper maps nodes following the Parker convention, which leaves out attributes and namespaces. A node is
+// mapped to an object of its child elements keyed by their local names, repeated children are kept in a list. A child
+// element that has child elements is mapped to an object in the same way, one that only has text to its text and an
+// empty one to null. The text of elements that also have child elements is dropped, the node itself only keeps it
+// under "#text" when it has no child elements.
+type ParkerMapper struct{}
+
+func (m ParkerMapper) FromNode(node *Node) (map[string]interface{}, error) {
+	if text, ok := node.Text(); ok {
+		return map[string]interface{}{"#text": text}, nil
+	}
+	switch v := m.fromNode(node).(type) {
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		return map[string]interface{}{"#text": v}, nil
+	default:
+		return map[string]interface{}{}, nil
+	}
+}
+
+// fromNode returns the object of the child elements of node, its text if it has none, or nil if it is empty.
+func (m ParkerMapper) fromNode(node *Node) interface{} {
+	var out map[string]interface{}
+	var text bytes.Buffer
+	hasText := false
+	for _, c := range node.Children {
+		if t, ok := c.Text(); ok {
+			text.WriteString(t)
+			hasText = true
+			continue
+		}
+		if out == nil {
+			out = make(map[string]interface{})
+		}
+		key := c.StartElement.Name.Local
+		value := m.fromNode(c)
+		if prev, ok := out[key]; ok {
+			if values, ok := prev.([]interface{}); ok {
+				out[key] = append(values, value)
+			} else {
+				out[key] = []interface{}{prev, value}
+			}
+			continue
+		}
+		out[key] = value
+	}
+	if out != nil {
+		return out
+	}
+	if hasText {
+		return text.String()
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package xmlpicker
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -8,39 +9,240 @@ import (
 	"strings"
 )
 
+// NewParser returns a Parser reading tokens from decoder and returning the nodes matched by selector. Nesting is
+// limited to 1000 elements and 1000 children per element, change MaxDepth and MaxChildren before the first call to
+// Next to allow more.
 func NewParser(decoder *xml.Decoder, selector Selector) *Parser {
+	p := NewTokenParser(decoder, selector)
+	p.decoder = decoder
+	return p
+}
+
+// NewTokenParser returns a Parser like NewParser reading tokens from tokens, such as a Tokenizer. The AutoClose of the
+// Parser only applies to an xml.Decoder.
+func NewTokenParser(tokens TokenReader, selector Selector) *Parser {
 	p := &Parser{
-		MaxDepth:    1000,
-		MaxChildren: 1000,
-		MaxTokens:   -1,
-		decoder:     decoder,
-		selector:    selector,
-		node:        &Node{},
+		MaxDepth:           1000,
+		MaxChildren:        1000,
+		MaxTokens:          -1,
+		MaxTokensPerRecord: -1,
+		MaxTokensTotal:     -1,
+		tokens:             tokens,
+		selector:           selector,
+		node:               &Node{},
+	}
+	ResetSelector(selector)
+	p.selectorErr = checkSelector(selector, true)
+	if path, ok := selector.(*Path); ok && p.selectorErr == nil && path.Steps[len(path.Steps)-1].Position.Last {
+		p.last = &path.Steps[len(path.Steps)-1]
+	}
+	if s, ok := selector.(AttributeSelector); ok {
+		p.attribute, _ = s.SelectsAttribute()
 	}
 	return p
 }
 
+// Parser reads a document token by token and builds a Node for each element matched by its Selector. Only matched
+// nodes, and their ancestors without their siblings, are kept in memory.
 type Parser struct {
-	NSFlag      NSFlag
+	NSFlag NSFlag
+	// MaxDepth and MaxChildren stop parsing with an error when they are exceeded.
 	MaxDepth    int
 	MaxChildren int
-	MaxTokens   int
+	// MaxTokens is the former name of MaxTokensTotal, both limits apply when they are set.
+	//
+	// Deprecated: use MaxTokensTotal.
+	MaxTokens int
+	// MaxTokensPerRecord limits the tokens read for a single node, counted from the end of the previous one, and
+	// MaxTokensTotal those read for the whole document. A limit of -1 means no limit.
+	MaxTokensPerRecord int
+	MaxTokensTotal     int
+
+	// ResolvePrefix is called in NSPrefix mode for a prefix that is used without being declared, for instance to look it
+	// up in an external catalog. When it returns a namespace the prefix is declared on the element that uses it.
+	ResolvePrefix func(prefix string) (string, bool)
+	// UndeclaredPrefixes decides what happens to the prefixes that are neither declared nor resolved in NSPrefix mode.
+	UndeclaredPrefixes PrefixPolicy
+	// MatchEndNamespaces makes NSPrefix mode accept an end element whose prefix differs from that of its start element
+	// when both prefixes are bound to the same namespace. By default the names must match as written, as XML requires.
+	MatchEndNamespaces bool
+	// Warn receives the warnings of PrefixWarn, they are dropped when it is nil.
+	Warn func(err error)
+	// AutoClose lists elements, such as HTML void elements, that are closed automatically when the next token does not
+	// close them. It extends the AutoClose of the decoder and, like it, only applies when the decoder is not strict.
+	AutoClose []string
+	// Catalog, when set, resolves the external DTD of the document so that the entities it declares, and those of the
+	// internal subset, are known to the decoder.
+	Catalog *Catalog
+	// Trace, when set, is called for each token read from the decoder, e.g. to find out why a selector does not
+	// match. The TokenTrace and its token are only valid during the call.
+	Trace func(t *TokenTrace)
+	// CollectDepth, when positive, only collects the elements of a matched node up to that many levels below it, along
+	// with their text. The elements whose child elements are left out are marked as Truncated.
+	CollectDepth int
+	// Ignore lists selectors of elements that are skipped along with their content wherever they are, even within
+	// matched nodes, without being collected or matched, e.g. huge sections of records that are of no interest. Only
+	// their Matches is used, it is called with the start element of each element that is not within an ignored one.
+	Ignore []Selector
+	// InternNames makes the nodes share a single copy of each distinct element name, attribute name and namespace,
+	// which saves memory when many nodes are kept at the cost of a map lookup per name.
+	InternNames bool
+	// IndexChildren numbers the child elements and text nodes of the matched nodes along with the matched nodes, so
+	// that the Index of every node collected increases in document order. Otherwise only the matched nodes are
+	// numbered and their Index is consecutive.
+	IndexChildren bool
+	// Normalize, when set, converts the text and attribute values of the elements read, e.g. to a Unicode normalization
+	// form so that selectors and the nodes returned compare equal whatever the normalization of the input.
+	Normalize Normalizer
+	// FirstMatchOnly makes Next return io.EOF, without reading any more tokens, once it has returned a node, so that
+	// the input can be closed as soon as the first node is found.
+	FirstMatchOnly bool
+	// ResultMapper, when set, maps the nodes sent by Stream to the Record of their Result.
+	ResultMapper Mapper
+	// PreserveSpace keeps the whitespace around the text of elements, e.g. for SimpleMapper.MixedContent to keep the
+	// word breaks between text and child elements. Text that is only whitespace is dropped either way.
+	PreserveSpace bool
+	// TrailingGarbage makes Next return io.EOF, rather than the error of the decoder, when the input cannot be read
+	// after the end of a document element, e.g. bytes left or appended after the final close tag. Garbage then returns
+	// the error. Garbage that starts an element cannot be told from another document and is not tolerated.
+	TrailingGarbage bool
+
+	tokens TokenReader
+	// decoder is set when tokens is an xml.Decoder, whose strictness, AutoClose and entities the Parser uses
+	decoder          *xml.Decoder
+	selector         Selector
+	tokenCount       int
+	recordTokenCount int
+	node             *Node
+	start            int64
+	end              int64
+	warned           map[string]bool
+	pending          xml.Token
+	autoClosed       bool
+	// selectorErr is the error of validating the selector and, once checked, Ignore, returned by the first Next
+	selectorErr error
+	checked     bool
+	// attribute is the local name of the attribute selected by an AttributeSelector
+	attribute string
+	// matched is set once Next has returned a node
+	matched bool
+	// index is the Index of the next node numbered
+	index int
+	// matchDepth is the depth of the node being matched and dropped the number of open elements left out by
+	// CollectDepth
+	matchDepth int
+	dropped    int
+	// stream receives the events of the node being matched by NextStream, streaming is the number of its open elements
+	stream    StreamMapper
+	streaming int
+	// names holds the interned names and attrNames is reused by push
+	names     map[string]string
+	attrNames []xml.Name
+	// translator translates the names of the raw tokens outside of NSPrefix mode, rawName and rawAttrs hold the names
+	// of the last start element it read as written, without the namespace declarations
+	translator *xml.Decoder
+	rawName    xml.Name
+	rawAttrs   []xml.Name
+	rawErr     error
+	// limitErr is the limit error Recover can skip past, limitToken the token read but not handled when it occurred
+	// and recoverDepth the depth Recover skips back to.
+	limitErr     error
+	limitToken   xml.Token
+	recoverDepth int
+	// section is set by NewSectionParser, the document is then wrapped in an element that declares the namespaces of
+	// the root and sectionOpen is set once its start has been read. base is added to the offsets of the decoder.
+	section     bool
+	sectionOpen bool
+	base        int64
+	// ended is set once a document element has been read, garbageErr and garbageOffset are the error of the decoder
+	// TrailingGarbage made Next ignore and where it occurred
+	ended         bool
+	garbageErr    error
+	garbageOffset int64
+	// last is the last step of a Path selector matching the last of its siblings. held are the nodes it matched last
+	// under each of the open elements, innermost last, returned when their parent ends unless a sibling starts first.
+	last *Step
+	held []heldNode
+}
 
-	decoder    *xml.Decoder
-	selector   Selector
-	tokenCount int
+// heldNode is a node held back by a Parser with its offsets and the index that followed it.
+type heldNode struct {
 	node       *Node
+	start, end int64
+	index      int
 }
 
+// TokenTrace describes a token read by a Parser.
+type TokenTrace struct {
+	Token  xml.Token
+	Offset int64
+	// Node is the element a start or end element token starts or ends, or the element any other token is in.
+	Node *Node
+	// Matched is set for the start element of a node matched by the selector.
+	Matched bool
+	// InMatch is set for the tokens inside a matched node.
+	InMatch bool
+}
+
+// Selector decides which nodes a Parser returns. Matches is called with the start element of each node, whose
+// ancestors are available but not its children. A selector that keeps state between calls implements
+// StatefulSelector.
 type Selector interface {
 	Matches(node *Node) bool
 }
 
+// SubtreeSelector is implemented by selectors that need to inspect the complete subtree of a node. Matches is used as
+// a structural prefilter when the start element is read and MatchesSubtree decides whether the node is returned once
+// its end element has been read.
+type SubtreeSelector interface {
+	Selector
+	MatchesSubtree(node *Node) bool
+}
+
+// AttributeSelector is implemented by selectors that can select the value of an attribute of the nodes they match,
+// e.g. /feed/entry/@id. When SelectsAttribute returns a name the Parser returns a text node holding the value of that
+// attribute, whose parent is the matched element, as soon as the start element is read without building its subtree.
+type AttributeSelector interface {
+	Selector
+	SelectsAttribute() (string, bool)
+}
+
+// compositeSelector is implemented by the selectors that combine others, such as Router, so that a Parser can check
+// them.
+type compositeSelector interface {
+	selectors() []Selector
+}
+
+// checkSelector validates the paths of s and of the selectors it combines. A Parser only holds back the nodes of last()
+// for the Path it is given itself, within another selector last() would match every sibling and is rejected.
+func checkSelector(s Selector, top bool) error {
+	if path, ok := s.(*Path); ok {
+		if err := path.Validate(); err != nil {
+			return err
+		}
+		if !top && path.Steps[len(path.Steps)-1].Position.Last {
+			return fmt.Errorf("xmlpicker: last() is only supported when the path is the selector of the Parser, not within another selector, in %q", path)
+		}
+	}
+	if c, ok := s.(compositeSelector); ok {
+		for _, inner := range c.selectors() {
+			if err := checkSelector(inner, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NSFlag is how a Parser names elements and attributes in namespaces.
 type NSFlag int
 
 const (
+	// NSExpand sets the space of names to the namespace URI, as xml.Decoder.Token does.
 	NSExpand NSFlag = iota
+	// NSPrefix keeps the prefixes of names as written and records the declarations in Node.Namespaces.
 	NSPrefix
+	// NSStrip drops namespaces and prefixes altogether.
 	NSStrip
 )
 
@@ -57,51 +259,194 @@ func (f NSFlag) String() string {
 	}
 }
 
-var UnexpectedEOF = errors.New("xmlpicker: unexpected EOF")
+// PrefixPolicy is what the Parser does with prefixes that are used without being declared.
+type PrefixPolicy int
+
+const (
+	// PrefixPassThrough keeps undeclared prefixes as they are, they have no namespace.
+	PrefixPassThrough PrefixPolicy = iota
+	// PrefixWarn keeps undeclared prefixes like PrefixPassThrough but warns about each one once.
+	PrefixWarn
+	// PrefixError stops parsing with an error.
+	PrefixError
+)
 
+func (p PrefixPolicy) String() string {
+	switch p {
+	case PrefixPassThrough:
+		return "PrefixPassThrough"
+	case PrefixWarn:
+		return "PrefixWarn"
+	case PrefixError:
+		return "PrefixError"
+	default:
+		return fmt.Sprintf("!PREFIXPOLICY(%d)", p)
+	}
+}
+
+// ErrUnexpectedEOF is returned by Next when the document ends inside a matched node.
+var ErrUnexpectedEOF = errors.New("xmlpicker: unexpected EOF")
+
+// UnexpectedEOF is the former name of ErrUnexpectedEOF.
+//
+// Deprecated: use ErrUnexpectedEOF.
+var UnexpectedEOF = ErrUnexpectedEOF
+
+// Next returns the next node matched by the selector, or io.EOF at the end of the document.
+//
+// The parser does not modify a node, its descendants or its ancestors once they have been returned, but the
+// ancestors are shared with the nodes returned before and after it. Use Node.DeepCopy or Node.Detach to take a
+// snapshot that can be modified or handed to another goroutine while the parser moves on.
 func (p *Parser) Next() (*Node, error) {
-	if p.node == nil {
+	if !p.checked {
+		// Ignore is set after the Parser is created
+		p.checked = true
+		for _, s := range p.Ignore {
+			if p.selectorErr == nil {
+				p.selectorErr = checkSelector(s, false)
+			}
+		}
+	}
+	if p.selectorErr != nil {
+		err := p.selectorErr
+		p.selectorErr, p.node = nil, nil
+		return nil, err
+	}
+	if p.garbageErr != nil {
+		return nil, io.EOF
+	}
+	if p.node == nil || p.limitErr != nil {
 		return nil, errors.New("xmlpicker: will no longer consume tokens, Next() called after error")
 	}
+	if p.FirstMatchOnly && p.matched {
+		return nil, io.EOF
+	}
+	if !p.autoClosed && p.decoder != nil {
+		// the decoder applies its own AutoClose in Token(), rawToken() uses it as well
+		p.decoder.AutoClose = append(p.decoder.AutoClose[:len(p.decoder.AutoClose):len(p.decoder.AutoClose)], p.AutoClose...)
+		p.autoClosed = true
+	}
 	for {
-		var t xml.Token
-		var err error
-		if p.NSFlag == NSPrefix {
-			t, err = p.decoder.RawToken()
-		} else {
-			t, err = p.decoder.Token()
-		}
+		offset := p.tokens.InputOffset()
+		t, err := p.token()
 		if err != nil {
 			if err == io.EOF && p.node.Children != nil {
-				return nil, UnexpectedEOF
+				return nil, ErrUnexpectedEOF
+			}
+			if p.TrailingGarbage && p.ended && p.node.Parent == nil && err != io.EOF {
+				p.garbageErr, p.garbageOffset = err, offset
+				return nil, io.EOF
 			}
 			return nil, err
 		}
+		if p.section {
+			if skip, err := p.sectionToken(t); err != nil {
+				return nil, err
+			} else if skip {
+				continue
+			}
+		}
 		p.tokenCount = p.tokenCount + 1
+		p.recordTokenCount = p.recordTokenCount + 1
 		if p.MaxTokens != -1 && p.tokenCount > p.MaxTokens {
 			p.node = nil
 			return nil, fmt.Errorf("xmlpicker: token limit reached %d", p.MaxTokens)
 		}
+		if p.MaxTokensTotal != -1 && p.tokenCount > p.MaxTokensTotal {
+			p.node = nil
+			return nil, fmt.Errorf("xmlpicker: token limit reached %d", p.MaxTokensTotal)
+		}
+		if p.MaxTokensPerRecord != -1 && p.recordTokenCount > p.MaxTokensPerRecord {
+			return nil, p.limitReached(fmt.Errorf("xmlpicker: record token limit reached %d", p.MaxTokensPerRecord), t, p.recordDepth(p.node.Depth()))
+		}
+		if _, ok := t.(xml.StartElement); !ok && p.Trace != nil {
+			p.trace(t, offset, false)
+		}
 		switch t := t.(type) {
 		case xml.StartElement:
-			p.push(t)
-			if p.node.Depth() > p.MaxDepth {
+			if err := p.push(t); err != nil {
 				p.node = nil
-				return nil, fmt.Errorf("xmlpicker: depth limit reached %d", p.MaxDepth)
+				return nil, err
+			}
+			depth := p.node.Depth()
+			if depth > p.MaxDepth {
+				return nil, p.limitReached(fmt.Errorf("xmlpicker: depth limit reached %d", p.MaxDepth), nil, p.recordDepth(depth-1))
+			}
+			if p.dropped != 0 {
+				p.dropped = p.dropped + 1
+				continue
+			}
+			if p.ignored() {
+				if p.Trace != nil {
+					p.trace(t, offset, false)
+				}
+				p.dropped = 1
+				continue
+			}
+			if p.streaming != 0 {
+				if p.Trace != nil {
+					p.trace(t, offset, false)
+				}
+				if p.truncate(depth) {
+					continue
+				}
+				p.streaming = p.streaming + 1
+				if p.IndexChildren {
+					p.node.Index = p.nextIndex()
+				}
+				if err := streamStart(p.node, p.stream); err != nil {
+					return nil, p.limitReached(err, nil, p.recordDepth(0))
+				}
+				continue
 			}
 			if p.node.Parent.Children == nil {
-				if p.selector.Matches(p.node) {
+				if n := len(p.held); n != 0 && p.node.Parent == p.held[n-1].node.Parent && isSibling(p.held[n-1].node, p.node, p.last.anySibling()) {
+					p.dropHeld()
+				}
+				matched := p.selector.Matches(p.node)
+				if p.Trace != nil {
+					p.trace(t, offset, matched)
+				}
+				if matched && p.attribute != "" {
+					if n := p.attributeNode(); n != nil {
+						n.Index = p.nextIndex()
+						p.start = offset
+						p.end = p.tokens.InputOffset()
+						p.recordTokenCount = 0
+						p.matched = true
+						return n, nil
+					}
+				} else if matched {
+					p.start = offset
+					p.matchDepth = depth
+					p.node.Index = p.nextIndex()
 					p.node.Children = make([]*Node, 0)
+					p.node.pathNames = p.node.PathNames()
 					if p.NSFlag == NSPrefix && p.node.Namespaces == nil {
 						p.node.Namespaces = make(Namespaces, 0)
 					}
+					if p.stream != nil {
+						p.streaming = 1
+						if err := streamStart(p.node, p.stream); err != nil {
+							return nil, p.limitReached(err, nil, p.recordDepth(0))
+						}
+					}
 				}
 				continue
 			}
+			if p.Trace != nil {
+				p.trace(t, offset, false)
+			}
+			if p.truncate(depth) {
+				continue
+			}
+			if p.IndexChildren {
+				p.node.Index = p.nextIndex()
+			}
 			p.node.Children = make([]*Node, 0)
 			p.node.Parent.Children = append(p.node.Parent.Children, p.node)
 			if len(p.node.Parent.Children) > p.MaxChildren {
-				return nil, fmt.Errorf("xmlpicker: maximum node child limit reached %d", p.MaxChildren)
+				return nil, p.limitReached(fmt.Errorf("xmlpicker: maximum node child limit reached %d", p.MaxChildren), nil, p.recordDepth(0))
 			}
 		case xml.EndElement:
 			prev, err := p.pop(t)
@@ -109,35 +454,365 @@ func (p *Parser) Next() (*Node, error) {
 				p.node = nil
 				return nil, err
 			}
+			if p.node.Parent == nil {
+				p.ended = true
+			}
+			if n := len(p.held); n != 0 && prev == p.held[n-1].node.Parent {
+				// none of the siblings that followed the held node had its name
+				return p.releaseHeld(), nil
+			}
+			if p.dropped != 0 {
+				p.dropped = p.dropped - 1
+				continue
+			}
+			if p.streaming != 0 {
+				p.streaming = p.streaming - 1
+				if err := p.stream.End(prev); err != nil {
+					return nil, p.limitReached(err, nil, p.recordDepth(p.node.Depth()))
+				}
+				if p.streaming != 0 {
+					continue
+				}
+				p.end = p.tokens.InputOffset()
+				p.recordTokenCount = 0
+				p.matched = true
+				return prev, nil
+			}
 			if prev.Children != nil && p.node.Children == nil {
+				if s, ok := p.selector.(SubtreeSelector); ok && !s.MatchesSubtree(prev) {
+					// the numbers of the node and its descendants are given to the next nodes
+					p.index = prev.Index
+					continue
+				}
+				if p.last != nil {
+					p.held = append(p.held, heldNode{node: prev, start: p.start, end: p.tokens.InputOffset(), index: p.index})
+					p.recordTokenCount = 0
+					continue
+				}
+				p.end = p.tokens.InputOffset()
+				p.recordTokenCount = 0
+				p.matched = true
 				return prev, nil
 			}
 		case xml.CharData:
+			if p.streaming != 0 && p.dropped == 0 {
+				if text := p.text(t); len(text) != 0 {
+					if err := p.stream.Text(p.normalize(string(text))); err != nil {
+						return nil, p.limitReached(err, nil, p.recordDepth(0))
+					}
+				}
+				continue
+			}
 			if p.node.Children == nil {
+				// outside of a matched node the text is dropped without being copied
 				continue
 			}
-			s := strings.TrimSpace(string(t.Copy()))
-			if len(s) == 0 {
+			// trimming the token first copies the text once and not at all when it is only whitespace
+			text := p.text(t)
+			if len(text) == 0 {
 				continue
 			}
 			node := &Node{Parent: p.node}
-			node.SetText(s)
+			node.SetText(p.normalize(string(text)))
+			if p.IndexChildren {
+				node.Index = p.nextIndex()
+			}
 			p.node.Children = append(p.node.Children, node)
 			if len(p.node.Children) > p.MaxChildren {
-				return nil, fmt.Errorf("xmlpicker: maximum node child limit reached %d", p.MaxChildren)
+				return nil, p.limitReached(fmt.Errorf("xmlpicker: maximum node child limit reached %d", p.MaxChildren), nil, p.recordDepth(0))
 			}
 		case xml.Comment:
 		case xml.ProcInst:
 		case xml.Directive:
+			if p.Catalog != nil {
+				if err := p.Catalog.loadDoctype(string(t), p.entities()); err != nil {
+					return nil, err
+				}
+			}
 		default:
 			return nil, fmt.Errorf("xmlpicker: unexpected xml token %+v", t)
 		}
 	}
 }
 
+// Recover skips the rest of the node Next stopped in with a depth, child or per record token limit error, or with an
+// error of the StreamMapper of NextStream, or the element that exceeded the limit outside of any node, so that the
+// following calls to Next carry on with the next node. It does nothing if Next did not return such an error, other
+// errors cannot be recovered from.
+func (p *Parser) Recover() error {
+	if p.node == nil {
+		return errors.New("xmlpicker: cannot recover, Next() returned an unrecoverable error")
+	}
+	if p.limitErr == nil {
+		return nil
+	}
+	t := p.limitToken
+	depth := p.node.Depth()
+	p.limitErr, p.limitToken = nil, nil
+	for {
+		switch t := t.(type) {
+		case xml.StartElement:
+			if err := p.push(t); err != nil {
+				p.node = nil
+				return err
+			}
+			depth = depth + 1
+		case xml.EndElement:
+			if _, err := p.pop(t); err != nil {
+				p.node = nil
+				return err
+			}
+			depth = depth - 1
+		}
+		if depth <= p.recoverDepth {
+			break
+		}
+		var err error
+		if t, err = p.token(); err != nil {
+			p.node = nil
+			return err
+		}
+		p.tokenCount = p.tokenCount + 1
+		if p.MaxTokens != -1 && p.tokenCount > p.MaxTokens {
+			p.node = nil
+			return fmt.Errorf("xmlpicker: token limit reached %d", p.MaxTokens)
+		}
+		if p.MaxTokensTotal != -1 && p.tokenCount > p.MaxTokensTotal {
+			p.node = nil
+			return fmt.Errorf("xmlpicker: token limit reached %d", p.MaxTokensTotal)
+		}
+	}
+	p.recordTokenCount = 0
+	p.dropped = 0
+	p.streaming = 0
+	return nil
+}
+
+// NextStream is like Next but sends the next matched node to m as events instead of collecting its descendants, so
+// that the memory used does not depend on the size of the node. The node is returned without its children once its end
+// element has been read, the value selected by an AttributeSelector is sent as text. Path selectors with text
+// predicates need the complete node and cannot be streamed, the MatchesSubtree of other SubtreeSelectors is not
+// called.
+func (p *Parser) NextStream(m StreamMapper) (*Node, error) {
+	if path, ok := p.selector.(*Path); ok && len(path.Steps) != 0 && len(path.Steps[len(path.Steps)-1].Texts) != 0 {
+		return nil, fmt.Errorf("xmlpicker: text predicates need the complete node and cannot be streamed")
+	}
+	if p.last != nil {
+		return nil, fmt.Errorf("xmlpicker: last() holds the node back until its siblings are known and cannot be streamed")
+	}
+	p.stream = m
+	n, err := p.Next()
+	p.stream = nil
+	if err == nil && p.attribute != "" {
+		text, _ := n.Text()
+		err = m.Text(text)
+	}
+	return n, err
+}
+
+// normalize applies Normalize to s, if set.
+func (p *Parser) normalize(s string) string {
+	if p.Normalize == nil {
+		return s
+	}
+	return p.Normalize(s)
+}
+
+// dropHeld forgets the innermost held node once a sibling follows it. The numbers of the node and its descendants
+// are given to the next nodes unless other nodes were numbered since.
+func (p *Parser) dropHeld() {
+	h := p.held[len(p.held)-1]
+	p.held = p.held[:len(p.held)-1]
+	if p.index == h.index {
+		p.index = h.node.Index
+	}
+}
+
+// releaseHeld returns the innermost held node, once its parent ended.
+func (p *Parser) releaseHeld() *Node {
+	h := p.held[len(p.held)-1]
+	p.held = p.held[:len(p.held)-1]
+	p.start, p.end = h.start, h.end
+	p.matched = true
+	return h.node
+}
+
+// ignored reports whether the current element is matched by one of the Ignore selectors.
+func (p *Parser) ignored() bool {
+	for _, s := range p.Ignore {
+		if s.Matches(p.node) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate leaves out the current element, marking its parent as Truncated, when it is deeper than CollectDepth.
+func (p *Parser) truncate(depth int) bool {
+	if p.CollectDepth > 0 && depth-p.matchDepth > p.CollectDepth {
+		p.node.Parent.Truncated = true
+		p.dropped = 1
+		return true
+	}
+	return false
+}
+
+// attributeNode returns a text node holding the value of the selected attribute of the current element, or nil if it
+// does not have one.
+func (p *Parser) attributeNode() *Node {
+	for _, a := range p.node.StartElement.Attr {
+		if a.Name.Local == p.attribute {
+			n := &Node{Parent: p.node}
+			n.SetText(a.Value)
+			n.pathNames = append(p.node.PathNames(), a.Name)
+			return n
+		}
+	}
+	return nil
+}
+
+// nextIndex returns the Index of the next node numbered.
+func (p *Parser) nextIndex() int {
+	i := p.index
+	p.index = p.index + 1
+	return i
+}
+
+// limitReached keeps what Recover needs to skip past err.
+func (p *Parser) limitReached(err error, t xml.Token, depth int) error {
+	p.limitErr = err
+	p.limitToken = t
+	p.recoverDepth = depth
+	return err
+}
+
+// recordDepth returns the depth of the parent of the node being matched, or depth when there is none.
+func (p *Parser) recordDepth(depth int) int {
+	for n := p.node; n.Parent != nil; n = n.Parent {
+		if n.Children != nil && n.Parent.Children == nil {
+			return n.Depth() - 1
+		}
+	}
+	return depth
+}
+
+// token returns the next token of the TokenReader, the raw tokens in NSPrefix mode. Otherwise the raw tokens are
+// translated by an xml.Decoder so that the prefixes they were written with are known to qualify.
+func (p *Parser) token() (xml.Token, error) {
+	if p.NSFlag == NSPrefix {
+		return p.rawToken()
+	}
+	if p.translator == nil {
+		p.translator = xml.NewTokenDecoder(rawTokens{p})
+	}
+	t, err := p.translator.Token()
+	if err, ok := err.(*xml.SyntaxError); ok && err != p.rawErr {
+		// the translator only counts the lines of its own input, which it has none of
+		if line, ok := p.line(); ok {
+			err.Line = line
+		}
+	}
+	return t, err
+}
+
+// rawTokens is the input of the translator of a Parser.
+type rawTokens struct {
+	p *Parser
+}
+
+func (r rawTokens) Token() (xml.Token, error) {
+	p := r.p
+	t, err := p.rawToken()
+	p.rawErr = err
+	if start, ok := t.(xml.StartElement); ok {
+		p.rawName = start.Name
+		p.rawAttrs = p.rawAttrs[:0]
+		for _, a := range start.Attr {
+			if a.Name.Space != xmlnsPrefix && (a.Name.Space != "" || a.Name.Local != xmlnsPrefix) {
+				p.rawAttrs = append(p.rawAttrs, a.Name)
+			}
+		}
+	}
+	return t, err
+}
+
+// line returns the line the TokenReader has read up to, if it is known.
+func (p *Parser) line() (int, bool) {
+	switch tokens := p.tokens.(type) {
+	case *xml.Decoder:
+		line, _ := tokens.InputPos()
+		return line, true
+	case *Tokenizer:
+		return tokens.line(), true
+	}
+	return 0, false
+}
+
+// entities returns the entities of the TokenReader, which the Catalog adds to.
+func (p *Parser) entities() map[string]string {
+	switch tokens := p.tokens.(type) {
+	case *xml.Decoder:
+		if tokens.Entity == nil {
+			tokens.Entity = make(map[string]string)
+		}
+		return tokens.Entity
+	case *Tokenizer:
+		if tokens.Entity == nil {
+			tokens.Entity = make(map[string]string)
+		}
+		return tokens.Entity
+	}
+	return make(map[string]string)
+}
+
+func (p *Parser) trace(t xml.Token, offset int64, matched bool) {
+	inMatch := p.node.Children != nil
+	switch t.(type) {
+	case xml.StartElement, xml.EndElement:
+		inMatch = p.node.Parent != nil && p.node.Parent.Children != nil
+	}
+	p.Trace(&TokenTrace{Token: t, Offset: offset, Node: p.node, Matched: matched, InMatch: inMatch})
+}
+
+// Offsets returns the byte range of the input, as seen by the decoder, from which the node last returned by Next was
+// read. The offsets of a Parser returned by NewSectionParser are those of the whole document.
+func (p *Parser) Offsets() (int64, int64) {
+	return p.start + p.base, p.end + p.base
+}
+
+// Garbage returns the offset and the error of the input TrailingGarbage made Next ignore, or a nil error.
+func (p *Parser) Garbage() (int64, error) {
+	return p.garbageOffset + p.base, p.garbageErr
+}
+
+// sectionToken reports whether t is the start or the end of the element NewSectionParser wraps the section in, which
+// are not part of the document. Its end ends the document with io.EOF.
+func (p *Parser) sectionToken(t xml.Token) (bool, error) {
+	switch t.(type) {
+	case xml.StartElement:
+		if p.sectionOpen {
+			return false, nil
+		}
+		p.sectionOpen = true
+		if p.NSFlag == NSPrefix {
+			p.node.Namespaces = p.node.declared
+		}
+		return true, nil
+	case xml.EndElement:
+		if p.node.Parent != nil {
+			return false, nil
+		}
+		return false, io.EOF
+	}
+	return false, nil
+}
+
 // push adds start to the path.
 // Namespace handling is similar to xml.Token().
-func (p *Parser) push(start xml.StartElement) *Node {
+func (p *Parser) push(start xml.StartElement) error {
+	if p.InternNames {
+		p.internNames(&start)
+	}
 	element := xml.StartElement{Name: start.Name}
 	if p.NSFlag == NSStrip {
 		element.Name.Space = ""
@@ -153,47 +828,173 @@ func (p *Parser) push(start xml.StartElement) *Node {
 			break
 		}
 	}
-	var ns Namespaces
+	var declared Namespaces
+	attrNames := p.attrNames[:0]
 	if !update {
 		element.Attr = make([]xml.Attr, len(start.Attr))
 		copy(element.Attr, start.Attr)
-	} else {
-		if p.NSFlag == NSPrefix {
-			ns = make(Namespaces)
+		for _, a := range start.Attr {
+			attrNames = append(attrNames, a.Name)
 		}
+	} else {
 		element.Attr = make([]xml.Attr, 0, len(start.Attr))
 		for _, a := range start.Attr {
 			if a.Name.Space == "xmlns" {
-				if ns != nil {
-					ns[a.Name.Local] = a.Value
+				if declared == nil {
+					declared = make(Namespaces)
 				}
+				declared[a.Name.Local] = a.Value
 				continue
 			}
 			if a.Name.Space == "" && a.Name.Local == "xmlns" { // default space for untagged names
-				if ns != nil {
-					ns[""] = a.Value
+				if declared == nil {
+					declared = make(Namespaces)
 				}
+				declared[""] = a.Value
 				continue
 			}
+			attrNames = append(attrNames, a.Name)
 			if p.NSFlag == NSStrip {
 				a.Name.Space = ""
 			}
 			element.Attr = append(element.Attr, a)
 		}
 	}
+	if p.Normalize != nil {
+		for i := range element.Attr {
+			element.Attr[i].Value = p.Normalize(element.Attr[i].Value)
+		}
+	}
 	pushed := &Node{
 		StartElement: element,
-		Namespaces:   ns,
 		Parent:       p.node,
+		declared:     declared,
+	}
+	if parent := p.node; parent.Children == nil {
+		// positions are only needed where the selector is evaluated, outside of the matched nodes
+		if parent.siblings == nil {
+			parent.siblings = &siblingCounts{}
+		}
+		pushed.position, pushed.elementPosition = parent.siblings.add(element.Name)
+	}
+	if p.NSFlag == NSPrefix {
+		pushed.Namespaces = declared
+		if err := p.resolvePrefix(pushed, start.Name.Space); err != nil {
+			return err
+		}
+		for _, a := range attrNames {
+			if err := p.resolvePrefix(pushed, a.Space); err != nil {
+				return err
+			}
+		}
 	}
-	// TODO needed?
-	//if p.NSFlag == NSPrefix && pushed.StartElement.Name.Space != "" {
-	//	if defaultSpace, ok := pushed.LookupPrefix(""); ok && defaultSpace == pushed.StartElement.Name.Space {
-	//		pushed.StartElement.Name.Space = ""
-	//	}
-	//}
+	p.qualify(pushed, start.Name, attrNames)
+	p.attrNames = attrNames
+	// the name space stays the prefix as written in NSPrefix mode, Name holds the namespace it resolves to, including
+	// the default namespace of unprefixed elements
 	p.node = pushed
-	return pushed
+	return nil
+}
+
+// internNames replaces the names of start, and those of its attributes, by the copies seen first. The attributes are
+// changed in place, like xml.Decoder.Token() does when it translates their namespaces.
+func (p *Parser) internNames(start *xml.StartElement) {
+	if p.names == nil {
+		p.names = make(map[string]string)
+	}
+	p.intern(&start.Name)
+	for i := range start.Attr {
+		p.intern(&start.Attr[i].Name)
+	}
+}
+
+func (p *Parser) intern(name *xml.Name) {
+	name.Space = p.internString(name.Space)
+	name.Local = p.internString(name.Local)
+}
+
+func (p *Parser) internString(s string) string {
+	if v, ok := p.names[s]; ok {
+		return v
+	}
+	p.names[s] = s
+	return s
+}
+
+// resolvePrefix handles prefix according to ResolvePrefix and UndeclaredPrefixes if it is not declared.
+func (p *Parser) resolvePrefix(node *Node, prefix string) error {
+	if _, ok := node.lookupNamespace(prefix); ok {
+		return nil
+	}
+	if p.ResolvePrefix != nil {
+		if ns, ok := p.ResolvePrefix(prefix); ok {
+			if node.declared == nil {
+				node.declared = make(Namespaces)
+				node.Namespaces = node.declared
+			}
+			node.declared[prefix] = ns
+			return nil
+		}
+	}
+	err := fmt.Errorf("xmlpicker: undeclared prefix %s at %s", prefix, node.Path())
+	switch p.UndeclaredPrefixes {
+	case PrefixError:
+		return err
+	case PrefixWarn:
+		if p.warned[prefix] {
+			return nil
+		}
+		if p.warned == nil {
+			p.warned = make(map[string]bool)
+		}
+		p.warned[prefix] = true
+		if p.Warn != nil {
+			p.Warn(err)
+		}
+	}
+	return nil
+}
+
+// text returns the text of t that is collected, without its surrounding whitespace unless PreserveSpace is set and
+// empty when it is only whitespace.
+func (p *Parser) text(t xml.CharData) []byte {
+	text := bytes.TrimSpace(t)
+	if len(text) == 0 || !p.PreserveSpace {
+		return text
+	}
+	return t
+}
+
+// rawToken returns the next raw token. Like xml.Decoder.Token() it inserts the end element of an element listed in
+// the AutoClose of a non-strict decoder when the next token does not close it. The translator is strict, so outside
+// of NSPrefix mode the end element of the open element is also inserted before an end element that does not match it,
+// as a non-strict decoder does. The token that follows an inserted end element is checked again.
+func (p *Parser) rawToken() (xml.Token, error) {
+	t, err := p.pending, error(nil)
+	if t != nil {
+		p.pending = nil
+	} else {
+		t, err = p.tokens.RawToken()
+	}
+	if err != nil || p.decoder == nil || p.decoder.Strict || p.node.Parent == nil {
+		return t, err
+	}
+	name := xml.Name{Space: p.node.name.Prefix, Local: p.node.name.Local}
+	end, ok := t.(xml.EndElement)
+	if ok && end.Name.Local == name.Local {
+		return t, nil
+	}
+	for _, s := range p.decoder.AutoClose {
+		if strings.EqualFold(s, name.Local) {
+			p.pending = t
+			return xml.EndElement{Name: name}, nil
+		}
+	}
+	if ok && p.NSFlag != NSPrefix {
+		p.pending = t
+		return xml.EndElement{Name: name}, nil
+	}
+	return t, nil
 }
 
 // pop removes the end element from the path and returns an error if it does not match the appropriate start element.
@@ -209,9 +1010,24 @@ func (p *Parser) pop(end xml.EndElement) (*Node, error) {
 	if start.Name.Local != end.Name.Local {
 		return nil, fmt.Errorf("xmlpicker: element <%s> closed by </%s>", start.Name.Local, end.Name.Local)
 	}
-	if p.NSFlag != NSStrip && start.Name.Space != end.Name.Space {
+	if p.NSFlag != NSStrip && start.Name.Space != end.Name.Space && !p.sameNamespace(popped, start.Name.Space, end.Name.Space) {
 		return nil, fmt.Errorf("xmlpicker: element <%s> in space %s closed by </%s> in space %s", start.Name.Local, start.Name.Space, end.Name.Local, end.Name.Space)
 	}
 	p.node = popped.Parent
+	popped.siblings = nil
 	return popped, nil
 }
+
+// sameNamespace reports whether the prefixes of a start and end element are bound to the same namespace at node, which
+// only applies in NSPrefix mode with MatchEndNamespaces.
+func (p *Parser) sameNamespace(node *Node, startPrefix, endPrefix string) bool {
+	if p.NSFlag != NSPrefix || !p.MatchEndNamespaces {
+		return false
+	}
+	startSpace, ok := node.LookupPrefix(startPrefix)
+	if !ok {
+		return false
+	}
+	endSpace, ok := node.LookupPrefix(endPrefix)
+	return ok && startSpace == endSpace
+}
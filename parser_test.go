@@ -1,9 +1,11 @@
 package xmlpicker_test
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -13,11 +15,12 @@ import (
 
 func TestParserNext(t *testing.T) {
 	for idx, test := range []struct {
-		name        string
-		xml         string
-		nsFlag      xmlpicker.NSFlag
-		expected    int
-		expectedErr string
+		name               string
+		xml                string
+		nsFlag             xmlpicker.NSFlag
+		matchEndNamespaces bool
+		expected           int
+		expectedErr        string
 	}{
 		{
 			name:     "control",
@@ -180,6 +183,33 @@ func TestParserNext(t *testing.T) {
 			nsFlag:      xmlpicker.NSPrefix,
 			expectedErr: "xmlpicker: element <a> in space x1 closed by </a> in space x2",
 		},
+		{
+			name:               "different space prefix, match end namespaces",
+			xml:                `<root xmlns:x1="http://example.com/x" xmlns:x2="http://example.com/x"><x1:a></x2:a></root>`,
+			nsFlag:             xmlpicker.NSPrefix,
+			matchEndNamespaces: true,
+			expected:           1,
+		},
+		{
+			name:               "different space prefix, different namespaces",
+			xml:                `<root xmlns:x1="http://example.com/x" xmlns:x2="http://example.com/y"><x1:a></x2:a></root>`,
+			nsFlag:             xmlpicker.NSPrefix,
+			matchEndNamespaces: true,
+			expectedErr:        "xmlpicker: element <a> in space x1 closed by </a> in space x2",
+		},
+		{
+			name:        "default namespace closed by prefix",
+			xml:         `<root xmlns:x="http://example.com/x"><a xmlns="http://example.com/x"></x:a></root>`,
+			nsFlag:      xmlpicker.NSPrefix,
+			expectedErr: "xmlpicker: element <a> in space  closed by </a> in space x",
+		},
+		{
+			name:               "default namespace closed by prefix, match end namespaces",
+			xml:                `<root xmlns:x="http://example.com/x"><a xmlns="http://example.com/x"></x:a></root>`,
+			nsFlag:             xmlpicker.NSPrefix,
+			matchEndNamespaces: true,
+			expected:           1,
+		},
 	} {
 		name := fmt.Sprintf("%d %s %s", idx, test.name, test.nsFlag)
 		t.Run(name, func(t *testing.T) {
@@ -187,6 +217,7 @@ func TestParserNext(t *testing.T) {
 			var actualErr error
 			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector("/"))
 			parser.NSFlag = test.nsFlag
+			parser.MatchEndNamespaces = test.matchEndNamespaces
 			for {
 				_, err := parser.Next()
 				if err == io.EOF {
@@ -207,3 +238,769 @@ func TestParserNext(t *testing.T) {
 		})
 	}
 }
+
+func TestParserUndeclaredPrefixes(t *testing.T) {
+	const doc = `<root><a:b a:id="1"><c:d/></a:b><a:b/></root>`
+	for idx, test := range []struct {
+		policy      xmlpicker.PrefixPolicy
+		resolve     map[string]string
+		noWarn      bool
+		expected    []string
+		expectedErr string
+		warnings    []string
+	}{
+		{
+			policy:   xmlpicker.PrefixPassThrough,
+			expected: []string{"", ""},
+		},
+		{
+			policy:   xmlpicker.PrefixWarn,
+			expected: []string{"", ""},
+			warnings: []string{"xmlpicker: undeclared prefix a at /root/b", "xmlpicker: undeclared prefix c at /root/b/d"},
+		},
+		{
+			policy:   xmlpicker.PrefixWarn,
+			noWarn:   true,
+			expected: []string{"", ""},
+		},
+		{
+			policy:      xmlpicker.PrefixError,
+			expectedErr: "xmlpicker: undeclared prefix a at /root/b",
+		},
+		{
+			policy:   xmlpicker.PrefixError,
+			resolve:  map[string]string{"a": "urn:a", "c": "urn:c"},
+			expected: []string{"urn:a", "urn:a"},
+		},
+		{
+			policy:      xmlpicker.PrefixError,
+			resolve:     map[string]string{"a": "urn:a"},
+			expectedErr: "xmlpicker: undeclared prefix c at /root/b/d",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.policy)
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/root/*"))
+			parser.NSFlag = xmlpicker.NSPrefix
+			parser.UndeclaredPrefixes = test.policy
+			var warnings []string
+			if !test.noWarn {
+				parser.Warn = func(err error) {
+					warnings = append(warnings, err.Error())
+				}
+			}
+			if test.resolve != nil {
+				parser.ResolvePrefix = func(prefix string) (string, bool) {
+					ns, ok := test.resolve[prefix]
+					return ns, ok
+				}
+			}
+			var actual []string
+			var actualErr error
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					actualErr = err
+					break
+				}
+				actual = append(actual, n.NamespaceURI())
+				if test.resolve != nil && len(actual) == 1 {
+					assert.Equal(t, "urn:a", n.Attrs()[0].Name.URI, name)
+					assert.Equal(t, xmlpicker.Namespaces{"a": "urn:a"}, n.Namespaces, name)
+				}
+			}
+			if test.expectedErr != "" {
+				assert.EqualError(t, actualErr, test.expectedErr, name)
+			} else {
+				assert.NoError(t, actualErr, name)
+				assert.Equal(t, test.expected, actual, name)
+			}
+			assert.Equal(t, test.warnings, warnings, name)
+		})
+	}
+}
+
+func TestParserAutoClose(t *testing.T) {
+	const doc = `<root><p>a<br>b<img src=x></p><p><br/><BR>c<hr></hr></p></root>`
+	for idx, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSStrip, xmlpicker.NSPrefix} {
+		name := fmt.Sprintf("%d %s", idx, nsFlag)
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(doc))
+			decoder.Strict = false
+			decoder.AutoClose = []string{"br"}
+			parser := xmlpicker.NewParser(decoder, xmlpicker.PathSelector("/root/p"))
+			parser.NSFlag = nsFlag
+			parser.AutoClose = []string{"img", "hr"}
+			var actual []string
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				var names []string
+				for _, c := range n.Children {
+					if text, ok := c.Text(); ok {
+						names = append(names, text)
+					} else {
+						names = append(names, c.StartElement.Name.Local)
+					}
+				}
+				actual = append(actual, strings.Join(names, ","))
+			}
+			assert.Equal(t, []string{"a,br,b,img", "br,BR,c,hr"}, actual, name)
+		})
+	}
+}
+
+func TestParserSyntaxErrorLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		xml         string
+		strict      bool
+		expectedErr string
+	}{
+		{
+			name:        "mismatched element local",
+			xml:         "<r>\n<a>\n\n</b></r>",
+			strict:      true,
+			expectedErr: "XML syntax error on line 4: element <a> closed by </b>",
+		},
+		{
+			name:        "mismatched element space",
+			xml:         "<r>\n<x:a>\n</y:a>\n</r>",
+			strict:      true,
+			expectedErr: "XML syntax error on line 3: element <a> in space x closed by </a> in space y",
+		},
+		{
+			name:        "eof",
+			xml:         "<r>\n<a>\n",
+			strict:      true,
+			expectedErr: "XML syntax error on line 3: unexpected EOF",
+		},
+		{
+			name:        "mismatched element space, not strict",
+			xml:         "<r>\n<x:a>\n</y:a>\n</r>",
+			expectedErr: "XML syntax error on line 3: element <a> in space x closed by </a> in space y",
+		},
+		{
+			name: "mismatched element local, not strict",
+			xml:  "<r>\n<p><b>x\n</p></r>",
+		},
+	}
+	for idx, test := range tests {
+		for _, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSStrip} {
+			name := fmt.Sprintf("%d %s %s", idx, test.name, nsFlag)
+			t.Run(name, func(t *testing.T) {
+				decoder := xml.NewDecoder(strings.NewReader(test.xml))
+				decoder.Strict = test.strict
+				parser := xmlpicker.NewParser(decoder, xmlpicker.PathSelector("/r"))
+				parser.NSFlag = nsFlag
+				n, err := parser.Next()
+				if test.expectedErr != "" {
+					assert.EqualError(t, err, test.expectedErr, name)
+					return
+				}
+				if assert.NoError(t, err, name) {
+					assert.Len(t, n.Children, 1, name)
+				}
+			})
+		}
+	}
+}
+
+func TestParserMaxTokens(t *testing.T) {
+	const doc = `<r><i>a</i><i>b</i><i>c</i></r>`
+	for idx, test := range []struct {
+		name          string
+		configure     func(p *xmlpicker.Parser)
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:      "no limits",
+			configure: func(p *xmlpicker.Parser) {},
+			expected:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "per record reset after each match",
+			configure: func(p *xmlpicker.Parser) { p.MaxTokensPerRecord = 4 },
+			expected:  []string{"a", "b", "c"},
+		},
+		{
+			name:          "per record exceeded",
+			configure:     func(p *xmlpicker.Parser) { p.MaxTokensPerRecord = 3 },
+			expectedError: "xmlpicker: record token limit reached 3",
+		},
+		{
+			name:          "total exceeded",
+			configure:     func(p *xmlpicker.Parser) { p.MaxTokensTotal = 7 },
+			expected:      []string{"a", "b"},
+			expectedError: "xmlpicker: token limit reached 7",
+		},
+		{
+			name:          "deprecated total",
+			configure:     func(p *xmlpicker.Parser) { p.MaxTokens = 7 },
+			expected:      []string{"a", "b"},
+			expectedError: "xmlpicker: token limit reached 7",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/r/i"))
+			test.configure(parser)
+			var actual []string
+			var err error
+			for {
+				var n *xmlpicker.Node
+				n, err = parser.Next()
+				if err != nil {
+					break
+				}
+				text, _ := n.Children[0].Text()
+				actual = append(actual, text)
+			}
+			assert.Equal(t, test.expected, actual, name)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError, name)
+			} else {
+				assert.Equal(t, io.EOF, err, name)
+			}
+		})
+	}
+}
+
+func TestParserRecover(t *testing.T) {
+	for idx, test := range []struct {
+		name      string
+		doc       string
+		nsFlag    xmlpicker.NSFlag
+		configure func(p *xmlpicker.Parser)
+		expected  []string
+	}{
+		{
+			name:      "depth in node",
+			doc:       `<r><i>a</i><i><x><y><z/></y></x></i><i>c</i></r>`,
+			configure: func(p *xmlpicker.Parser) { p.MaxDepth = 3 },
+			expected:  []string{"a", "error: xmlpicker: depth limit reached 3", "c"},
+		},
+		{
+			name:      "depth in node with prefixes",
+			doc:       `<r xmlns:p="urn:p"><i>a</i><i><p:x><p:y><z/></p:y></p:x></i><i>c</i></r>`,
+			nsFlag:    xmlpicker.NSPrefix,
+			configure: func(p *xmlpicker.Parser) { p.MaxDepth = 3 },
+			expected:  []string{"a", "error: xmlpicker: depth limit reached 3", "c"},
+		},
+		{
+			name:      "depth outside of nodes",
+			doc:       `<r><o><p><q/></p></o><i>a</i></r>`,
+			configure: func(p *xmlpicker.Parser) { p.MaxDepth = 2 },
+			expected:  []string{"error: xmlpicker: depth limit reached 2", "a"},
+		},
+		{
+			name:      "children",
+			doc:       `<r><i><x/><y/><z/></i><i><x/></i></r>`,
+			configure: func(p *xmlpicker.Parser) { p.MaxChildren = 2 },
+			expected:  []string{"error: xmlpicker: maximum node child limit reached 2", "x"},
+		},
+		{
+			name:      "tokens per record",
+			doc:       `<r><i>a</i><i><x/><y/></i><i>c</i></r>`,
+			configure: func(p *xmlpicker.Parser) { p.MaxTokensPerRecord = 4 },
+			expected:  []string{"a", "error: xmlpicker: record token limit reached 4", "c"},
+		},
+		{
+			name:      "total tokens",
+			doc:       `<r><i>a</i><i>b</i></r>`,
+			configure: func(p *xmlpicker.Parser) { p.MaxTokensTotal = 3 },
+			expected: []string{
+				"error: xmlpicker: token limit reached 3",
+				"recover: xmlpicker: cannot recover, Next() returned an unrecoverable error",
+			},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.doc)), xmlpicker.PathSelector("/r/i"))
+			parser.NSFlag = test.nsFlag
+			test.configure(parser)
+			var actual []string
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					actual = append(actual, "error: "+err.Error())
+					if err := parser.Recover(); err != nil {
+						actual = append(actual, "recover: "+err.Error())
+						break
+					}
+					continue
+				}
+				var names []string
+				for _, c := range n.Children {
+					if text, ok := c.Text(); ok {
+						names = append(names, text)
+					} else {
+						names = append(names, c.StartElement.Name.Local)
+					}
+				}
+				actual = append(actual, strings.Join(names, ","))
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestParserFirstMatchOnly(t *testing.T) {
+	const doc = `<r><i>1</i><i>2</i><broken`
+	for idx, selector := range []string{"/r/i", "/r/i[#text = '1']"} {
+		name := fmt.Sprintf("%d %s", idx, selector)
+		t.Run(name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(doc))
+			parser := xmlpicker.NewParser(decoder, xmlpicker.PathSelector(selector))
+			parser.FirstMatchOnly = true
+			n, err := parser.Next()
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			text, _ := n.Children[0].Text()
+			assert.Equal(t, "1", text, name)
+			offset := decoder.InputOffset()
+			for i := 0; i < 2; i++ {
+				_, err = parser.Next()
+				assert.Equal(t, io.EOF, err, name)
+			}
+			assert.Equal(t, offset, decoder.InputOffset(), name)
+		})
+	}
+}
+
+func TestParserTrailingGarbage(t *testing.T) {
+	for idx, test := range []struct {
+		doc     string
+		records []string
+		garbage string
+		offset  int64
+		err     string
+	}{
+		{`<r><i>1</i></r>`, []string{"1"}, "", 0, ""},
+		{`<r><i>1</i></r>` + "\n\x00junk", []string{"1"}, "XML syntax error on line 2: illegal character code U+0000", 15, ""},
+		{`<r><i>1</i></r><r><i>2</i></r>&x `, []string{"1", "2"}, "XML syntax error on line 1: invalid character entity &x (no semicolon)", 30, ""},
+		{`<r><i>1</i></r><broken`, []string{"1"}, "XML syntax error on line 1: unexpected EOF", 15, ""},
+		{`<r><i>1</i>&x </r>`, []string{"1"}, "", 0, "XML syntax error on line 1: invalid character entity &x (no semicolon)"},
+	} {
+		t.Run(fmt.Sprintf("%d %q", idx, test.doc), func(t *testing.T) {
+			for _, tolerate := range []bool{false, true} {
+				parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.doc)), xmlpicker.PathSelector("/r/i"))
+				parser.TrailingGarbage = tolerate
+				var records []string
+				var err error
+				for {
+					var n *xmlpicker.Node
+					if n, err = parser.Next(); err != nil {
+						break
+					}
+					text, _ := n.Children[0].Text()
+					records = append(records, text)
+				}
+				assert.Equal(t, test.records, records)
+				expected := test.err
+				if !tolerate && expected == "" {
+					expected = test.garbage
+				}
+				if expected != "" {
+					assert.EqualError(t, err, expected)
+					continue
+				}
+				assert.Equal(t, io.EOF, err)
+				offset, garbage := parser.Garbage()
+				if test.garbage == "" {
+					assert.NoError(t, garbage)
+					continue
+				}
+				assert.EqualError(t, garbage, test.garbage)
+				assert.Equal(t, test.offset, offset)
+				_, err = parser.Next()
+				assert.Equal(t, io.EOF, err)
+			}
+		})
+	}
+}
+
+func TestParserCollectDepth(t *testing.T) {
+	const doc = `<r><i id="1"><title>T</title><detail><a><b>x</b></a>more</detail><empty/></i><i id="2"><i id="3"/></i></r>`
+	for idx, test := range []struct {
+		depth    int
+		expected []string
+	}{
+		{
+			depth: 0,
+			expected: []string{
+				`<r><i id="1"><title>T</title><detail><a><b>x</b></a>more</detail><empty></empty></i></r>`,
+				`<r><i id="2"><i id="3"></i></i></r>`,
+			},
+		},
+		{
+			depth: 1,
+			expected: []string{
+				`<r><i id="1"><title>T</title><detail>more<!--#truncated--></detail><empty></empty></i></r>`,
+				`<r><i id="2"><i id="3"></i></i></r>`,
+			},
+		},
+		{
+			depth: 2,
+			expected: []string{
+				`<r><i id="1"><title>T</title><detail><a><!--#truncated--></a>more</detail><empty></empty></i></r>`,
+				`<r><i id="2"><i id="3"></i></i></r>`,
+			},
+		},
+	} {
+		name := fmt.Sprintf("%d depth %d", idx, test.depth)
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/r/i"))
+			parser.CollectDepth = test.depth
+			var actual []string
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				s, err := exportNode(n)
+				assert.NoError(t, err, name)
+				actual = append(actual, s)
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestParserIgnore(t *testing.T) {
+	const doc = `<r><history><i id="0"/></history><i id="1"><title>T</title><history><old>x</old>y</history></i><i id="2"><meta><history/></meta></i></r>`
+	for idx, test := range []struct {
+		selector string
+		ignore   []string
+		stream   bool
+		expected []string
+	}{
+		{
+			selector: "//i",
+			ignore:   []string{"/r/history"},
+			expected: []string{
+				`<r><i id="1"><title>T</title><history><old>x</old>y</history></i></r>`,
+				`<r><i id="2"><meta><history></history></meta></i></r>`,
+			},
+		},
+		{
+			selector: "//i",
+			ignore:   []string{"history"},
+			expected: []string{
+				`<r><i id="1"><title>T</title></i></r>`,
+				`<r><i id="2"><meta></meta></i></r>`,
+			},
+		},
+		{
+			selector: "/r/i",
+			ignore:   []string{"/r/i/history", "meta"},
+			expected: []string{
+				`<r><i id="1"><title>T</title></i></r>`,
+				`<r><i id="2"></i></r>`,
+			},
+		},
+		{
+			selector: "/r/i",
+			ignore:   []string{"/r/i[@id = '1']"},
+			expected: []string{
+				`<r><i id="2"><meta><history></history></meta></i></r>`,
+			},
+		},
+		{
+			selector: "/r/i",
+			ignore:   []string{"history"},
+			stream:   true,
+			expected: []string{
+				"start /r/i attr id=1 start /r/i/title text T end title end i",
+				"start /r/i attr id=2 start /r/i/meta end meta end i",
+			},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, strings.Join(test.ignore, " "))
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector(test.selector))
+			for _, v := range test.ignore {
+				parser.Ignore = append(parser.Ignore, xmlpicker.PathSelector(v))
+			}
+			var actual []string
+			for {
+				var n *xmlpicker.Node
+				var err error
+				events := &eventRecorder{}
+				if test.stream {
+					n, err = parser.NextStream(events)
+				} else {
+					n, err = parser.Next()
+				}
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				if test.stream {
+					actual = append(actual, strings.Join(events.events, " "))
+					continue
+				}
+				s, err := exportNode(n)
+				assert.NoError(t, err, name)
+				actual = append(actual, s)
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestParserInternNames(t *testing.T) {
+	const doc = `<feed xmlns="urn:f" xmlns:x="urn:x"><entry x:id="1" type="a"><title>One</title></entry><entry x:id="2" type="b"><x:title>Two</x:title></entry></feed>`
+	for idx, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSStrip, xmlpicker.NSPrefix} {
+		name := fmt.Sprintf("%d %s", idx, nsFlag)
+		t.Run(name, func(t *testing.T) {
+			var expected, actual []string
+			for _, intern := range []bool{false, true} {
+				parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+				parser.NSFlag = nsFlag
+				parser.InternNames = intern
+				var records []string
+				for {
+					n, err := parser.Next()
+					if err == io.EOF {
+						break
+					}
+					if !assert.NoError(t, err, name) {
+						return
+					}
+					s, err := exportNode(n)
+					assert.NoError(t, err, name)
+					records = append(records, s)
+				}
+				if intern {
+					actual = records
+				} else {
+					expected = records
+				}
+			}
+			assert.Len(t, actual, 2, name)
+			assert.Equal(t, expected, actual, name)
+		})
+	}
+}
+
+func TestParserIndex(t *testing.T) {
+	for idx, test := range []struct {
+		name          string
+		selector      string
+		xml           string
+		indexChildren bool
+		expected      []string
+	}{
+		{
+			name:     "matched nodes",
+			selector: "/r/i",
+			xml:      `<r><i>a<b/></i><x/><i><b/><b/></i></r>`,
+			expected: []string{"0 i(0 0)", "1 i(0 0)"},
+		},
+		{
+			name:          "children",
+			selector:      "/r/i",
+			xml:           `<r><i>a<b/></i><x/><i><b/><b/></i></r>`,
+			indexChildren: true,
+			expected:      []string{"0 i(1 2)", "3 i(4 5)"},
+		},
+		{
+			name:          "attribute",
+			selector:      "/r/i/@id",
+			xml:           `<r><i id="1"/><i/><i id="3"/></r>`,
+			indexChildren: true,
+			expected:      []string{"0 ()", "1 ()"},
+		},
+		{
+			name:          "subtree selector",
+			selector:      "/r/i[c]",
+			xml:           `<r><i><c/></i><i><b/></i><i><c/></i></r>`,
+			indexChildren: true,
+			expected:      []string{"0 i(1)", "2 i(3)"},
+		},
+		{
+			name:          "last sibling",
+			selector:      "/r/g/i[last()]",
+			xml:           `<r><g><i><b/></i><i><c/></i></g><g><i><d/></i></g></r>`,
+			indexChildren: true,
+			expected:      []string{"0 i(1)", "2 i(3)"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			parser.IndexChildren = test.indexChildren
+			actual := make([]string, 0)
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				var children []string
+				for _, c := range n.Children {
+					children = append(children, fmt.Sprint(c.Index))
+				}
+				actual = append(actual, fmt.Sprintf("%d %s(%s)", n.Index, n.StartElement.Name.Local, strings.Join(children, " ")))
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+// BenchmarkParserRecords keeps every page of a document laid out like a MediaWiki export, as --tail does, and logs
+// the heap the pages hold on to.
+func BenchmarkParserRecords(b *testing.B) {
+	const pages = 2000
+	var doc bytes.Buffer
+	doc.WriteString(`<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" xml:lang="en"><siteinfo><sitename>Wikipedia</sitename></siteinfo>`)
+	for i := 0; i < pages; i++ {
+		fmt.Fprintf(&doc, `<page><title>Page %d</title><ns>0</ns><id>%d</id><revision><id>%d</id><parentid>%d</parentid>`+
+			`<timestamp>2017-01-01T00:00:00Z</timestamp><contributor><username>Editor</username><id>7</id></contributor>`+
+			`<comment>copyedit</comment><model>wikitext</model><format>text/x-wiki</format>`+
+			`<text xml:space="preserve" bytes="36">'''Page %d''' is an article.</text><sha1>phoiac9h4m842xq45sp7s6u21eteeq1</sha1>`+
+			`</revision></page>`, i, i, 1000+i, 999+i, i)
+	}
+	doc.WriteString(`</mediawiki>`)
+	for _, intern := range []bool{false, true} {
+		b.Run(fmt.Sprintf("intern=%v", intern), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(doc.Len()))
+			var retained int64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				parser := xmlpicker.NewParser(xml.NewDecoder(bytes.NewReader(doc.Bytes())), xmlpicker.PathSelector("/mediawiki/page"))
+				parser.InternNames = intern
+				var nodes []*xmlpicker.Node
+				for {
+					n, err := parser.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					nodes = append(nodes, n)
+				}
+				parser = nil
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(nodes)
+				retained = int64(after.HeapAlloc) - int64(before.HeapAlloc)
+			}
+			b.Logf("%d pages retain %d bytes", pages, retained)
+		})
+	}
+}
+
+// BenchmarkParserText parses an indented document whose records are mostly text and the whitespace between their
+// elements, the cost of which is in copying the text of each record.
+func BenchmarkParserText(b *testing.B) {
+	const records = 2000
+	var doc bytes.Buffer
+	doc.WriteString("<feed>\n  <title>Feed</title>\n")
+	for i := 0; i < records; i++ {
+		fmt.Fprintf(&doc, "  <entry>\n    <id>%d</id>\n    <title>Entry %d</title>\n    <summary>\n      %s\n    </summary>\n  </entry>\n",
+			i, i, strings.Repeat("Lorem ipsum dolor sit amet. ", 8))
+	}
+	doc.WriteString("</feed>\n")
+	b.ReportAllocs()
+	b.SetBytes(int64(doc.Len()))
+	for i := 0; i < b.N; i++ {
+		parser := xmlpicker.NewParser(xml.NewDecoder(bytes.NewReader(doc.Bytes())), xmlpicker.PathSelector("/feed/entry"))
+		for {
+			_, err := parser.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestParserTrace(t *testing.T) {
+	const doc = `<feed xmlns:a="urn:a"><a:entry>x<b/></a:entry><!-- c --><other/></feed>`
+	for idx, test := range []struct {
+		nsFlag   xmlpicker.NSFlag
+		expected []string
+	}{
+		{xmlpicker.NSExpand, []string{
+			"0 < feed> /feed  false false",
+			"22 <urn:a entry> /feed/entry urn:a true false",
+			"31 xml.CharData /feed/entry urn:a false true",
+			"32 < b> /feed/entry/b  false true",
+			"36 </ b> /feed/entry/b  false true",
+			"36 </urn:a entry> /feed/entry urn:a false false",
+			"46 xml.Comment /feed  false false",
+			"56 < other> /feed/other  false false",
+			"64 </ other> /feed/other  false false",
+			"64 </ feed> /feed  false false",
+		}},
+		{xmlpicker.NSPrefix, []string{
+			"0 < feed> /feed  false false",
+			"22 <a entry> /feed/entry a true false",
+			"31 xml.CharData /feed/entry a false true",
+			"32 < b> /feed/entry/b  false true",
+			"36 </ b> /feed/entry/b  false true",
+			"36 </a entry> /feed/entry a false false",
+			"46 xml.Comment /feed  false false",
+			"56 < other> /feed/other  false false",
+			"64 </ other> /feed/other  false false",
+			"64 </ feed> /feed  false false",
+		}},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.nsFlag), func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+			parser.NSFlag = test.nsFlag
+			var actual []string
+			parser.Trace = func(trace *xmlpicker.TokenTrace) {
+				var token string
+				switch t := trace.Token.(type) {
+				case xml.StartElement:
+					token = "<" + t.Name.Space + " " + t.Name.Local + ">"
+				case xml.EndElement:
+					token = "</" + t.Name.Space + " " + t.Name.Local + ">"
+				default:
+					token = fmt.Sprintf("%T", t)
+				}
+				actual = append(actual, fmt.Sprintf("%d %s %s %s %v %v", trace.Offset, token, (*xmlpicker.FormatNodePath)(trace.Node), trace.Node.StartElement.Name.Space, trace.Matched, trace.InMatch))
+			}
+			for {
+				_, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Patch replaces the element at Path with Node, or removes it when Node is nil. Path locates the element by the names
+// of its ancestors and its position among the siblings of the same name, such as /feed/entry[2], where a missing
+// position means 1.
+type Patch struct {
+	Path string
+	Node *Node
+}
+
+// NodePositions numbers the elements a Parser reads among their siblings of the same name, so that Path can tell
+// where the nodes it returns were. Set Parser.Trace to its Trace method.
+type NodePositions struct {
+	open  []nodePosition
+	ended nodePosition
+}
+
+type nodePosition struct {
+	node     *Node
+	position int
+	counts   map[string]int
+}
+
+// NewNodePositions returns an empty NodePositions, for a parser that has not read anything yet.
+func NewNodePositions() *NodePositions {
+	return &NodePositions{open: []nodePosition{{counts: make(map[string]int)}}}
+}
+
+// Trace numbers the element started by t.
+func (p *NodePositions) Trace(t *TokenTrace) {
+	switch t.Token.(type) {
+	case xml.StartElement:
+		counts := p.open[len(p.open)-1].counts
+		counts[t.Node.StartElement.Name.Local]++
+		p.open = append(p.open, nodePosition{
+			node:     t.Node,
+			position: counts[t.Node.StartElement.Name.Local],
+			counts:   make(map[string]int),
+		})
+	case xml.EndElement:
+		p.ended = p.open[len(p.open)-1]
+		p.open = p.open[:len(p.open)-1]
+	}
+}
+
+// Path returns the path with positions of node, which must be the last node returned by the parser.
+func (p *NodePositions) Path(node *Node) string {
+	var steps []string
+	for n := node; n != nil && n.Parent != nil; n = n.Parent {
+		step := n.StartElement.Name.Local
+		if i := p.position(n); i > 1 {
+			step += "[" + strconv.Itoa(i) + "]"
+		}
+		steps = append(steps, step)
+	}
+	path := ""
+	for i := len(steps) - 1; i >= 0; i-- {
+		path += "/" + steps[i]
+	}
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func (p *NodePositions) position(node *Node) int {
+	if p.ended.node == node {
+		return p.ended.position
+	}
+	for _, o := range p.open {
+		if o.node == node {
+			return o.position
+		}
+	}
+	return 0
+}
+
+// NormalizePositionPath removes the positions of 1 from path, which may be written or left out.
+func NormalizePositionPath(path string) string {
+	return strings.Replace(path, "[1]", "", -1)
+}
+
+// PatchWriter writes Patches as a patches document, the element of each patch holding the replacement node.
+type PatchWriter struct {
+	exporter *XMLExporter
+	started  bool
+}
+
+// NewPatchWriter returns a PatchWriter writing to w, Close must be called to end the document.
+func NewPatchWriter(w io.Writer) *PatchWriter {
+	return &PatchWriter{exporter: &XMLExporter{Encoder: xml.NewEncoder(w)}}
+}
+
+// Write adds p to the document.
+func (w *PatchWriter) Write(p *Patch) error {
+	if !w.started {
+		if err := w.exporter.Encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "patches"}}); err != nil {
+			return err
+		}
+		w.started = true
+	}
+	start := xml.StartElement{Name: xml.Name{Local: "patch"}, Attr: []xml.Attr{{Name: xml.Name{Local: "path"}, Value: p.Path}}}
+	if err := w.exporter.Encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if p.Node != nil {
+		if err := w.exporter.EncodeNode(p.Node); err != nil {
+			return err
+		}
+	}
+	return w.exporter.Encoder.EncodeToken(start.End())
+}
+
+// Close ends the document and flushes it.
+func (w *PatchWriter) Close() error {
+	if !w.started {
+		if err := w.exporter.Encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "patches"}}); err != nil {
+			return err
+		}
+		w.started = true
+	}
+	if err := w.exporter.Encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "patches"}}); err != nil {
+		return err
+	}
+	return w.exporter.Encoder.Flush()
+}
+
+// ReadPatches reads a patches document as written by a PatchWriter.
+func ReadPatches(r io.Reader) ([]*Patch, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = true
+	parser := NewParser(decoder, PathSelector("/patches/patch"))
+	var patches []*Patch
+	for {
+		n, err := parser.Next()
+		if err == io.EOF {
+			return patches, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		path, ok := attrValue(n, "path")
+		if !ok {
+			return nil, fmt.Errorf("xmlpicker: missing path of patch %d", len(patches)+1)
+		}
+		p := &Patch{Path: path}
+		for _, c := range n.Children {
+			if _, ok := c.Text(); ok {
+				continue
+			}
+			if p.Node != nil {
+				return nil, fmt.Errorf("xmlpicker: multiple elements in patch of %s", path)
+			}
+			p.Node = c.Detach()
+		}
+		patches = append(patches, p)
+	}
+}
+
+// ApplyPatches copies the document read from r to w, replacing or removing the elements the patches are for as it
+// goes. Everything else is copied token by token, keeping the prefixes of the original document. An error is returned
+// if an element is patched more than once or not found.
+func ApplyPatches(r io.Reader, w io.Writer, patches []*Patch) error {
+	byPath := make(map[string]*Patch, len(patches))
+	for _, p := range patches {
+		path := NormalizePositionPath(p.Path)
+		if _, ok := byPath[path]; ok {
+			return fmt.Errorf("xmlpicker: multiple patches of %s", p.Path)
+		}
+		byPath[path] = p
+	}
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = true
+	encoder := xml.NewEncoder(w)
+	type element struct {
+		path     string
+		counts   map[string]int
+		declared Namespaces
+	}
+	open := []element{{counts: make(map[string]int)}}
+	for {
+		t, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			parent := open[len(open)-1]
+			parent.counts[t.Name.Local]++
+			path := parent.path + "/" + t.Name.Local
+			if i := parent.counts[t.Name.Local]; i > 1 {
+				path += "[" + strconv.Itoa(i) + "]"
+			}
+			if p, ok := byPath[path]; ok {
+				delete(byPath, path)
+				if err := skipElement(decoder); err != nil {
+					return err
+				}
+				if p.Node != nil {
+					scope := Namespaces{"xml": xmlNamespace}
+					for _, e := range open {
+						for prefix, ns := range e.declared {
+							scope[prefix] = ns
+						}
+					}
+					x := &XMLExporter{Encoder: encoder, open: []openElement{{scope: scope}}}
+					if err := x.EncodeNode(p.Node); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			e := element{path: path, counts: make(map[string]int)}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					e.declared = inherit(e.declared, Namespaces{a.Name.Local: a.Value})
+				} else if a.Name.Space == "" && a.Name.Local == "xmlns" {
+					e.declared = inherit(e.declared, Namespaces{"": a.Value})
+				}
+			}
+			open = append(open, e)
+			if err := encoder.EncodeToken(rawStartElement(t)); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			open = open[:len(open)-1]
+			if err := encoder.EncodeToken(xml.EndElement{Name: rawName(t.Name)}); err != nil {
+				return err
+			}
+		default:
+			if err := encoder.EncodeToken(t); err != nil {
+				return err
+			}
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	for _, p := range patches {
+		if _, ok := byPath[NormalizePositionPath(p.Path)]; ok {
+			return fmt.Errorf("xmlpicker: no element at %s", p.Path)
+		}
+	}
+	return nil
+}
+
+// skipElement reads up to the end of the element whose start was just read.
+func skipElement(decoder *xml.Decoder) error {
+	depth := 1
+	for depth > 0 {
+		t, err := decoder.RawToken()
+		if err != nil {
+			return err
+		}
+		switch t.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+// rawStartElement writes the prefixes of a token read with RawToken as part of the local names, the encoder would
+// otherwise take them for namespaces.
+func rawStartElement(t xml.StartElement) xml.StartElement {
+	start := xml.StartElement{Name: rawName(t.Name), Attr: make([]xml.Attr, len(t.Attr))}
+	for i, a := range t.Attr {
+		start.Attr[i] = xml.Attr{Name: rawName(a.Name), Value: a.Value}
+	}
+	return start
+}
+
+func rawName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
@@ -0,0 +1,151 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestNodePositions(t *testing.T) {
+	for idx, test := range []struct {
+		name     string
+		xml      string
+		selector string
+		expected []string
+	}{
+		{
+			name:     "siblings",
+			xml:      `<a><b/><c/><b><d/></b></a>`,
+			selector: "/a/b",
+			expected: []string{"/a/b", "/a/b[2]"},
+		},
+		{
+			name:     "nested",
+			xml:      `<a><b><c/><c/></b><b><c/></b><b><c/><c/><c/></b></a>`,
+			selector: "/a/b/c",
+			expected: []string{"/a/b/c", "/a/b/c[2]", "/a/b[2]/c", "/a/b[3]/c", "/a/b[3]/c[2]", "/a/b[3]/c[3]"},
+		},
+		{
+			name:     "root",
+			xml:      `<a/>`,
+			selector: "/a",
+			expected: []string{"/a"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			positions := xmlpicker.NewNodePositions()
+			parser.Trace = positions.Trace
+			var actual []string
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				actual = append(actual, positions.Path(n))
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestApplyPatches(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		xml         string
+		patches     string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "replace",
+			xml:      "<feed>\n  <entry id=\"1\">one</entry>\n  <entry id=\"2\">two</entry>\n</feed>",
+			patches:  `<patches><patch path="/feed/entry[2]"><entry id="2" changed="yes">TWO</entry></patch></patches>`,
+			expected: "<feed>\n  <entry id=\"1\">one</entry>\n  <entry id=\"2\" changed=\"yes\">TWO</entry>\n</feed>",
+		},
+		{
+			name:     "remove and position 1",
+			xml:      `<feed><entry>one</entry><entry>two</entry></feed>`,
+			patches:  `<patches><patch path="/feed/entry[1]"/></patches>`,
+			expected: `<feed><entry>two</entry></feed>`,
+		},
+		{
+			name:     "prefixes kept",
+			xml:      `<f:feed xmlns:f="urn:f"><f:entry>one</f:entry><f:entry>two</f:entry></f:feed>`,
+			patches:  `<patches><patch path="/feed/entry"><f:entry xmlns:f="urn:f">ONE</f:entry></patch></patches>`,
+			expected: `<f:feed xmlns:f="urn:f"><entry xmlns="urn:f">ONE</entry><f:entry>two</f:entry></f:feed>`,
+		},
+		{
+			name:     "default namespace in scope",
+			xml:      `<feed xmlns="urn:f"><entry>one</entry></feed>`,
+			patches:  `<patches><patch path="/feed/entry"><entry xmlns="urn:f"><title>ONE</title></entry></patch></patches>`,
+			expected: `<feed xmlns="urn:f"><entry><title>ONE</title></entry></feed>`,
+		},
+		{
+			name:        "not found",
+			xml:         `<feed><entry>one</entry></feed>`,
+			patches:     `<patches><patch path="/feed/entry[2]"/></patches>`,
+			expectedErr: "xmlpicker: no element at /feed/entry[2]",
+		},
+		{
+			name:        "patched twice",
+			xml:         `<feed><entry>one</entry></feed>`,
+			patches:     `<patches><patch path="/feed/entry"/><patch path="/feed/entry[1]"/></patches>`,
+			expectedErr: "xmlpicker: multiple patches of /feed/entry[1]",
+		},
+		{
+			name:        "missing path",
+			xml:         `<feed/>`,
+			patches:     `<patches><patch/></patches>`,
+			expectedErr: "xmlpicker: missing path of patch 1",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			patches, err := xmlpicker.ReadPatches(strings.NewReader(test.patches))
+			if err == nil {
+				var b bytes.Buffer
+				err = xmlpicker.ApplyPatches(strings.NewReader(test.xml), &b, patches)
+				if err == nil {
+					assert.Equal(t, test.expected, b.String(), name)
+				}
+			}
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			assert.NoError(t, err, name)
+		})
+	}
+}
+
+func TestPatchWriter(t *testing.T) {
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(`<a><b id="1">x</b></a>`)), xmlpicker.PathSelector("/a/b"))
+	n, err := parser.Next()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var b bytes.Buffer
+	w := xmlpicker.NewPatchWriter(&b)
+	assert.NoError(t, w.Write(&xmlpicker.Patch{Path: "/a/b", Node: n}))
+	assert.NoError(t, w.Write(&xmlpicker.Patch{Path: "/a/c[2]"}))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, `<patches><patch path="/a/b"><b id="1">x</b></patch><patch path="/a/c[2]"></patch></patches>`, b.String())
+	patches, err := xmlpicker.ReadPatches(&b)
+	if assert.NoError(t, err) && assert.Len(t, patches, 2) {
+		assert.Equal(t, "/a/b", patches[0].Path)
+		assert.Equal(t, "b", patches[0].Node.StartElement.Name.Local)
+		assert.Equal(t, "/a/c[2]", patches[1].Path)
+		assert.Nil(t, patches[1].Node)
+	}
+}
@@ -0,0 +1,595 @@
+package xmlpicker
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Path is the parsed form of a path selector. It can be built by ParsePath or programmatically starting from Root or
+// Relative, e.g. Root().Child("feed").Any().Attr("type", "book").
+//
+// An anchored path must match the element names from the document root down to the node, a relative path only has to
+// match the names of the node and its closest ancestors. A path with an Attribute only matches the nodes that have
+// the attribute of that local name and selects its value rather than the node, see AttributeSelector.
+//
+// The name of a step may have a prefix, e.g. x:entry. It matches the prefix of the Name of the element, which outside
+// of NSPrefix mode is recovered from its namespace and may differ from the prefix written when several are bound to
+// it. When ResolvePrefixes is set the prefix is instead resolved against the namespaces in scope at the element and
+// the step matches the elements in that namespace whatever their prefix and the NSFlag of the Parser.
+//
+// The builder methods do not fail, an invalid step or predicate is recorded and returned by Validate, which a Parser
+// calls for the Path it is given.
+type Path struct {
+	Anchored        bool
+	Steps           []Step
+	Attribute       string
+	ResolvePrefixes bool
+
+	// err is the first error of the builder methods
+	err error
+}
+
+// Step matches a single element by its local name, "*" matches any element. A Descendant step may be separated from
+// the previous step, or the root of an anchored path, by any number of elements. Position and Attrs are evaluated when
+// the start element is read, Texts need the complete subtree of the element and are only supported on the last step of
+// a Path.
+type Step struct {
+	Name       string
+	Descendant bool
+	Position   Position
+	Attrs      []Predicate
+	Texts      []Predicate
+}
+
+// Position restricts a step to the elements from the From to the To of their siblings of the same name, or of all
+// their sibling elements for a "*" step, counted from 1. A To of 0 has no upper bound and the zero Position matches
+// any element. Last instead matches the last of the siblings, which is only known once the next of them starts or
+// their parent ends, so a Parser given the Path as its selector holds the node back until then. The nodes held under
+// nested parents are returned as the parents end, their Index keeps the document order. Last is only supported on the
+// last step of a Path that is the selector of the Parser itself, not of one within a Router or another selector.
+type Position struct {
+	From int
+	To   int
+	Last bool
+}
+
+// IsZero reports whether p does not restrict the position.
+func (p Position) IsZero() bool {
+	return p.From == 0 && p.To == 0 && !p.Last
+}
+
+// Predicate compares an operand with Value using Op, one of =, !=, <, <=, >, >= or ~= (regular expression match).
+// An empty Op tests for the presence of the operand. Numeric predicates compare numerically and do not match operands
+// that are not numbers.
+//
+// The operand of an attribute predicate is the local name of the attribute, the operand of a text predicate is "#text"
+// for the text of the element itself or a relative path of child element names.
+type Predicate struct {
+	Operand string
+	Op      string
+	Value   string
+	Numeric bool
+
+	compiled bool
+	number   float64
+	re       *regexp.Regexp
+}
+
+// NewPredicate validates and compiles a predicate.
+func NewPredicate(operand, op, value string, numeric bool) (Predicate, error) {
+	p := Predicate{Operand: operand, Op: op, Value: value, Numeric: numeric, compiled: true}
+	if strings.TrimSpace(operand) == "" {
+		return p, fmt.Errorf("xmlpicker: missing operand")
+	}
+	switch op {
+	case "", "=", "!=", "<", "<=", ">", ">=":
+	case "~=":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return p, fmt.Errorf("xmlpicker: invalid regular expression %q: %s", value, err)
+		}
+		p.re = re
+	default:
+		return p, fmt.Errorf("xmlpicker: invalid operator %q", op)
+	}
+	if numeric && op != "~=" {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return p, fmt.Errorf("xmlpicker: invalid number %q", value)
+		}
+		p.number = n
+	}
+	return p, nil
+}
+
+// Root starts building a Path anchored at the document root.
+func Root() *Path {
+	return &Path{Anchored: true}
+}
+
+// Relative starts building a Path that matches at any depth.
+func Relative() *Path {
+	return &Path{}
+}
+
+// Child returns a copy of p with a step matching elements named local.
+func (p *Path) Child(local string) *Path {
+	c := p.clone()
+	if n := len(p.Steps); n != 0 && len(p.Steps[n-1].Texts) != 0 {
+		c.fail(fmt.Errorf("xmlpicker: text predicates are only supported on the last step"))
+	}
+	c.Steps = append(c.Steps, Step{Name: local})
+	return c
+}
+
+// At returns a copy of p where the last step only matches the nth of its siblings, counted from 1.
+func (p *Path) At(n int) *Path {
+	return p.Range(n, n)
+}
+
+// Range returns a copy of p where the last step only matches the from to the to of its siblings, counted from 1, to
+// 0 has no upper bound.
+func (p *Path) Range(from, to int) *Path {
+	c := p.clone()
+	c.lastStep().Position = Position{From: from, To: to}
+	return c
+}
+
+// Last returns a copy of p where the last step only matches the last of its siblings.
+func (p *Path) Last() *Path {
+	c := p.clone()
+	c.lastStep().Position = Position{Last: true}
+	return c
+}
+
+// Any returns a copy of p with a step matching any element.
+func (p *Path) Any() *Path {
+	return p.Child("*")
+}
+
+// Descendant returns a copy of p with a step matching elements named local at any depth below the previous step.
+func (p *Path) Descendant(local string) *Path {
+	c := p.Child(local)
+	c.lastStep().Descendant = true
+	return c
+}
+
+// AttributeValue returns a copy of p selecting the value of the attribute local of the nodes it matches.
+func (p *Path) AttributeValue(local string) *Path {
+	c := p.clone()
+	c.Attribute = local
+	return c
+}
+
+// SelectsAttribute returns the local name of the attribute p selects, if any.
+func (p *Path) SelectsAttribute() (string, bool) {
+	return p.Attribute, p.Attribute != ""
+}
+
+// Attr returns a copy of p where the last step also requires the attribute local to equal value.
+func (p *Path) Attr(local, value string) *Path {
+	return p.WhereAttr(local, "=", value)
+}
+
+// WhereAttr returns a copy of p where the last step also requires the attribute predicate to hold.
+func (p *Path) WhereAttr(local, op, value string) *Path {
+	pred, err := NewPredicate(local, op, value, false)
+	c := p.clone()
+	if err != nil {
+		c.fail(err)
+		return c
+	}
+	s := c.lastStep()
+	s.Attrs = append(s.Attrs, pred)
+	return c
+}
+
+// Where returns a copy of p where the last step also requires the text predicate to hold, value may be a string or a
+// number.
+func (p *Path) Where(operand, op string, value interface{}) *Path {
+	var pred Predicate
+	var err error
+	switch v := value.(type) {
+	case string:
+		pred, err = NewPredicate(operand, op, v, false)
+	case int:
+		pred, err = NewPredicate(operand, op, strconv.Itoa(v), true)
+	case float64:
+		pred, err = NewPredicate(operand, op, strconv.FormatFloat(v, 'g', -1, 64), true)
+	default:
+		err = fmt.Errorf("xmlpicker: unsupported predicate value %T", value)
+	}
+	c := p.clone()
+	if err != nil {
+		c.fail(err)
+		return c
+	}
+	s := c.lastStep()
+	s.Texts = append(s.Texts, pred)
+	return c
+}
+
+func (p *Path) clone() *Path {
+	c := &Path{Anchored: p.Anchored, Steps: make([]Step, len(p.Steps), len(p.Steps)+1), Attribute: p.Attribute, ResolvePrefixes: p.ResolvePrefixes, err: p.err}
+	for i, s := range p.Steps {
+		c.Steps[i] = Step{
+			Name:       s.Name,
+			Descendant: s.Descendant,
+			Position:   s.Position,
+			Attrs:      append([]Predicate(nil), s.Attrs...),
+			Texts:      append([]Predicate(nil), s.Texts...),
+		}
+	}
+	return c
+}
+
+// lastStep returns the step the builder methods modify, when p has none the change is recorded as an error and
+// applied to a step that is discarded.
+func (p *Path) lastStep() *Step {
+	if len(p.Steps) == 0 {
+		p.fail(fmt.Errorf("xmlpicker: predicate added before the first step"))
+		return &Step{}
+	}
+	return &p.Steps[len(p.Steps)-1]
+}
+
+// fail records err unless an earlier error was.
+func (p *Path) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// Validate checks that p can be evaluated, including that its builder methods were given valid steps and predicates.
+func (p *Path) Validate() error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("xmlpicker: path has no steps")
+	}
+	for i, s := range p.Steps {
+		if s.Name == "" {
+			return fmt.Errorf("xmlpicker: step %d has no name", i)
+		}
+		if len(s.Texts) != 0 && i != len(p.Steps)-1 {
+			return fmt.Errorf("xmlpicker: text predicates are only supported on the last step")
+		}
+		if err := s.Position.validate(i == len(p.Steps)-1 && p.Attribute == ""); err != nil {
+			return err
+		}
+		if len(s.Texts) != 0 && p.Attribute != "" {
+			return fmt.Errorf("xmlpicker: text predicates are not supported when selecting an attribute")
+		}
+	}
+	return nil
+}
+
+// String formats p using the ParsePath syntax.
+func (p *Path) String() string {
+	var b bytes.Buffer
+	for i, s := range p.Steps {
+		if i != 0 || p.Anchored {
+			b.WriteByte('/')
+		}
+		if s.Descendant && (i != 0 || p.Anchored) {
+			b.WriteByte('/')
+		}
+		b.WriteString(s.Name)
+		b.WriteString(s.Position.format())
+		for _, pred := range s.Attrs {
+			b.WriteString(pred.format("@"))
+		}
+		for _, pred := range s.Texts {
+			b.WriteString(pred.format(""))
+		}
+	}
+	if p.Attribute != "" {
+		b.WriteString("/@" + p.Attribute)
+	}
+	return b.String()
+}
+
+// PathExplanation describes how a Path was parsed, it is meant to be written as JSON to debug selectors.
+type PathExplanation struct {
+	Normalized      string            `json:"normalized"`
+	Anchored        bool              `json:"anchored"`
+	Steps           []StepExplanation `json:"steps"`
+	Attribute       string            `json:"attribute,omitempty"`
+	ResolvePrefixes bool              `json:"resolvePrefixes,omitempty"`
+}
+
+// StepExplanation describes a Step, Wildcard is set when it matches any element.
+type StepExplanation struct {
+	Name       string                 `json:"name"`
+	Wildcard   bool                   `json:"wildcard"`
+	Descendant bool                   `json:"descendant"`
+	Position   string                 `json:"position,omitempty"`
+	Attrs      []PredicateExplanation `json:"attributePredicates,omitempty"`
+	Texts      []PredicateExplanation `json:"textPredicates,omitempty"`
+}
+
+// PredicateExplanation describes a Predicate, an empty Op tests for presence.
+type PredicateExplanation struct {
+	Operand string `json:"operand"`
+	Op      string `json:"op,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Numeric bool   `json:"numeric,omitempty"`
+}
+
+// Explain returns the normalized form of p and its steps.
+func (p *Path) Explain() *PathExplanation {
+	e := &PathExplanation{
+		Normalized:      p.String(),
+		Anchored:        p.Anchored,
+		Steps:           make([]StepExplanation, len(p.Steps)),
+		Attribute:       p.Attribute,
+		ResolvePrefixes: p.ResolvePrefixes,
+	}
+	for i, s := range p.Steps {
+		e.Steps[i] = StepExplanation{
+			Name:       s.Name,
+			Wildcard:   s.Name == "*",
+			Descendant: s.Descendant,
+			Position:   strings.Trim(s.Position.format(), "[]"),
+			Attrs:      explainPredicates(s.Attrs),
+			Texts:      explainPredicates(s.Texts),
+		}
+	}
+	return e
+}
+
+func explainPredicates(preds []Predicate) []PredicateExplanation {
+	if len(preds) == 0 {
+		return nil
+	}
+	e := make([]PredicateExplanation, len(preds))
+	for i, p := range preds {
+		e[i] = PredicateExplanation{Operand: p.Operand, Op: p.Op, Value: p.Value, Numeric: p.Numeric}
+	}
+	return e
+}
+
+// validate checks that the position can be evaluated, Last only where last is set, on the step that selects nodes.
+func (p Position) validate(last bool) error {
+	switch {
+	case p.Last && (p.From != 0 || p.To != 0):
+		return fmt.Errorf("xmlpicker: position cannot be both last() and a range")
+	case p.Last && !last:
+		return fmt.Errorf("xmlpicker: last() is only supported on the last step, when selecting elements")
+	case p.From < 0 || p.To < 0 || (p.To != 0 && p.From == 0):
+		return fmt.Errorf("xmlpicker: positions are counted from 1")
+	case p.To != 0 && p.To < p.From:
+		return fmt.Errorf("xmlpicker: position range %d:%d is empty", p.From, p.To)
+	}
+	return nil
+}
+
+func (p Position) format() string {
+	switch {
+	case p.Last:
+		return "[last()]"
+	case p.From == 0:
+		return ""
+	case p.From == p.To:
+		return "[" + strconv.Itoa(p.From) + "]"
+	case p.To == 0:
+		return "[" + strconv.Itoa(p.From) + ":]"
+	}
+	return "[" + strconv.Itoa(p.From) + ":" + strconv.Itoa(p.To) + "]"
+}
+
+func (p Predicate) format(prefix string) string {
+	if p.Op == "" {
+		return "[" + prefix + p.Operand + "]"
+	}
+	value := p.Value
+	if !p.Numeric {
+		value = "'" + value + "'"
+	}
+	return "[" + prefix + p.Operand + " " + p.Op + " " + value + "]"
+}
+
+// Matches reports whether the steps of p match node and its ancestors, text predicates are left to MatchesSubtree. A
+// Path without steps matches nothing.
+func (p *Path) Matches(node *Node) bool {
+	if len(p.Steps) == 0 {
+		return false
+	}
+	if p.Attribute != "" {
+		if _, ok := attrValue(node, p.Attribute); !ok {
+			return false
+		}
+	}
+	return p.matchSteps(len(p.Steps)-1, node)
+}
+
+// matchSteps reports whether the steps up to and including i match node and its ancestors.
+func (p *Path) matchSteps(i int, node *Node) bool {
+	if i < 0 {
+		return !p.Anchored || (node != nil && node.Parent == nil)
+	}
+	if node == nil || node.Parent == nil {
+		return false
+	}
+	if !p.Steps[i].matches(node, p.ResolvePrefixes) {
+		return false
+	}
+	if !p.Steps[i].Descendant {
+		return p.matchSteps(i-1, node.Parent)
+	}
+	for n := node.Parent; n != nil; n = n.Parent {
+		if p.matchSteps(i-1, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesSubtree reports whether the complete subtree of node satisfies the text predicates of the last step of p.
+func (p *Path) MatchesSubtree(node *Node) bool {
+	if len(p.Steps) == 0 {
+		return false
+	}
+	for _, pred := range p.Steps[len(p.Steps)-1].Texts {
+		if !pred.matchesText(node) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Step) matches(node *Node, resolvePrefixes bool) bool {
+	if !s.matchesName(node, resolvePrefixes) {
+		return false
+	}
+	if !s.matchesPosition(node) {
+		return false
+	}
+	for _, pred := range s.Attrs {
+		if !pred.matchesAttr(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesPosition reports whether node is at the Position of the step among its siblings. Last can only be told from
+// the children of the parent, when a Parser has not collected them it is left to the Parser.
+func (s *Step) matchesPosition(node *Node) bool {
+	if s.Position.IsZero() {
+		return true
+	}
+	any := s.anySibling()
+	if s.Position.Last {
+		last, ok := node.lastSibling(any)
+		return last || !ok
+	}
+	i := node.siblingPosition(any)
+	return i >= s.Position.From && (s.Position.To == 0 || i <= s.Position.To)
+}
+
+// anySibling reports whether the positions of the step count all sibling elements rather than those of the same name.
+func (s *Step) anySibling() bool {
+	return s.Name == "*" || strings.HasSuffix(s.Name, ":*")
+}
+
+func (s *Step) matchesName(node *Node, resolvePrefixes bool) bool {
+	prefix, local := "", s.Name
+	if i := strings.IndexByte(s.Name, ':'); i != -1 {
+		prefix, local = s.Name[:i], s.Name[i+1:]
+	}
+	if local != "*" && local != node.StartElement.Name.Local {
+		return false
+	}
+	if prefix == "" {
+		return true
+	}
+	name := node.Name()
+	if !resolvePrefixes {
+		return name.Prefix == prefix
+	}
+	ns, ok := node.lookupNamespace(prefix)
+	return ok && name.URI == ns
+}
+
+func (p Predicate) matchesAttr(node *Node) bool {
+	value, ok := attrValue(node, p.Operand)
+	return ok && (p.Op == "" || p.compare(value))
+}
+
+func (p Predicate) matchesText(node *Node) bool {
+	var texts []string
+	path := strings.Split(p.Operand, "/")
+	if path[len(path)-1] == "#text" {
+		path = path[:len(path)-1]
+	}
+	if len(path) == 0 {
+		if text, ok := ownText(node); ok {
+			texts = []string{text}
+		}
+	} else {
+		texts = collectTexts(node, path)
+	}
+	for _, text := range texts {
+		if p.Op == "" || p.compare(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Predicate) compare(text string) bool {
+	if !p.compiled {
+		var err error
+		if p, err = NewPredicate(p.Operand, p.Op, p.Value, p.Numeric); err != nil {
+			return false
+		}
+	}
+	if p.re != nil {
+		return p.re.MatchString(text)
+	}
+	var c int
+	if p.Numeric {
+		n, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return false
+		}
+		switch {
+		case n < p.number:
+			c = -1
+		case n > p.number:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(text, p.Value)
+	}
+	switch p.Op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// collectTexts returns the text of each descendant element of node reached by following the relative path of
+// element names.
+func collectTexts(node *Node, path []string) []string {
+	if len(path) == 0 {
+		text, _ := ownText(node)
+		return []string{text}
+	}
+	var texts []string
+	for _, c := range node.Children {
+		if _, ok := c.Text(); ok {
+			continue
+		}
+		if path[0] == "*" || path[0] == c.StartElement.Name.Local {
+			texts = append(texts, collectTexts(c, path[1:])...)
+		}
+	}
+	return texts
+}
+
+// ownText returns the concatenated text children of node, ignoring any child elements.
+func ownText(node *Node) (string, bool) {
+	var parts []string
+	for _, c := range node.Children {
+		if text, ok := c.Text(); ok {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, ""), parts != nil
+}
@@ -0,0 +1,196 @@
+package xmlpicker_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestPathBuilder(t *testing.T) {
+	for idx, test := range []struct {
+		path     *xmlpicker.Path
+		str      string
+		xml      string
+		expected []string
+	}{
+		{
+			path:     xmlpicker.Root().Child("a").Child("b"),
+			str:      "/a/b",
+			xml:      `<a><b>1</b><c>2</c><b>3</b></a>`,
+			expected: []string{"1", "3"},
+		},
+		{
+			path:     xmlpicker.Root().Any(),
+			str:      "/*",
+			xml:      `<a><b>1</b></a>`,
+			expected: []string{"1"},
+		},
+		{
+			path:     xmlpicker.Relative().Child("b"),
+			str:      "b",
+			xml:      `<a><x><b>1</b></x><b>2</b></a>`,
+			expected: []string{"1", "2"},
+		},
+		{
+			path:     xmlpicker.Root().Child("catalog").Descendant("price"),
+			str:      "/catalog//price",
+			xml:      `<catalog><price>1</price><item><price>2</price></item></catalog>`,
+			expected: []string{"1", "2"},
+		},
+		{
+			path:     xmlpicker.Root().Child("t").Child("row").At(2),
+			str:      "/t/row[2]",
+			xml:      `<t><row>1</row><row>2</row><row>3</row></t>`,
+			expected: []string{"2"},
+		},
+		{
+			path:     xmlpicker.Root().Child("t").Child("row").Range(2, 0),
+			str:      "/t/row[2:]",
+			xml:      `<t><row>1</row><row>2</row><row>3</row></t>`,
+			expected: []string{"2", "3"},
+		},
+		{
+			path:     xmlpicker.Root().Child("t").Any().Range(1, 2).Attr("id", "b"),
+			str:      "/t/*[1:2][@id = 'b']",
+			xml:      `<t><a id="b">1</a><row id="b">2</row><row id="b">3</row></t>`,
+			expected: []string{"1", "2"},
+		},
+		{
+			path:     xmlpicker.Root().Child("t").Child("row").Last(),
+			str:      "/t/row[last()]",
+			xml:      `<t><row>1</row><row>2</row><row>3</row></t>`,
+			expected: []string{"3"},
+		},
+		{
+			path:     xmlpicker.Root().Child("feed").Any().Attr("type", "book"),
+			str:      "/feed/*[@type = 'book']",
+			xml:      `<feed><entry type="book">1</entry><entry type="film">2</entry><item type="book">3</item><entry>4</entry></feed>`,
+			expected: []string{"1", "3"},
+		},
+		{
+			path:     xmlpicker.Root().Child("feed").Child("entry").WhereAttr("type", "", ""),
+			str:      "/feed/entry[@type]",
+			xml:      `<feed><entry type="book">1</entry><entry>2</entry></feed>`,
+			expected: []string{"1"},
+		},
+		{
+			path:     xmlpicker.Root().Child("feed").Child("entry").Attr("type", "book").AttributeValue("id"),
+			str:      "/feed/entry[@type = 'book']/@id",
+			xml:      `<feed><entry type="book" id="1"/><entry type="film" id="2"/><entry type="book"/></feed>`,
+			expected: []string{"1"},
+		},
+		{
+			path:     xmlpicker.Root().Child("catalog").Child("item").Where("price", ">", 100),
+			str:      "/catalog/item[price > 100]",
+			xml:      `<catalog><item><price>50</price></item><item><price>150</price></item></catalog>`,
+			expected: []string{"150"},
+		},
+		{
+			path:     xmlpicker.Root().Child("a").Child("b").Where("#text", "~=", "^x"),
+			str:      "/a/b[#text ~= '^x']",
+			xml:      `<a><b>xy</b><b>yx</b></a>`,
+			expected: []string{"xy"},
+		},
+		{
+			path:     &xmlpicker.Path{Anchored: true, Steps: []xmlpicker.Step{{Name: "a"}, {Name: "b", Texts: []xmlpicker.Predicate{{Operand: "#text", Op: "=", Value: "2", Numeric: true}}}}},
+			str:      "/a/b[#text = 2]",
+			xml:      `<a><b>1</b><b>2.0</b></a>`,
+			expected: []string{"2.0"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.str)
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, test.path.Validate(), name)
+			assert.Equal(t, test.str, test.path.String(), name)
+			parsed, err := xmlpicker.ParsePath(test.str)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, test.str, parsed.String(), name)
+			}
+			actual := make([]string, 0)
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), test.path)
+			for {
+				node, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, "%s\nXML:\n%s\n", name, test.xml) {
+					return
+				}
+				actual = append(actual, deepText(node))
+			}
+			assert.Equal(t, test.expected, actual, "%s\nXML:\n%s\n", name, test.xml)
+		})
+	}
+}
+
+func TestPathBuilderImmutable(t *testing.T) {
+	base := xmlpicker.Root().Child("a")
+	b := base.Child("b")
+	c := base.Child("c").Attr("id", "1")
+	assert.Equal(t, "/a", base.String())
+	assert.Equal(t, "/a/b", b.String())
+	assert.Equal(t, "/a/c[@id = '1']", c.String())
+}
+
+func TestPathBuilderErrors(t *testing.T) {
+	for idx, test := range []struct {
+		path        *xmlpicker.Path
+		expectedErr string
+	}{
+		{xmlpicker.Root(), "xmlpicker: path has no steps"},
+		{xmlpicker.Relative(), "xmlpicker: path has no steps"},
+		{xmlpicker.Root().Attr("id", "1"), "xmlpicker: predicate added before the first step"},
+		{xmlpicker.Root().Child("a").Where("#text", "~=", "("), "xmlpicker: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`"},
+		{xmlpicker.Root().Child("a").WhereAttr("id", "~=", "(").Child("b"), "xmlpicker: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`"},
+		{xmlpicker.Root().Child("a").Where("#text", "?", "x"), "xmlpicker: invalid operator \"?\""},
+		{xmlpicker.Root().Child("a").Where("#text", "=", true), "xmlpicker: unsupported predicate value bool"},
+		{xmlpicker.Root().Child("a").Where("#text", "=", "x").Child("b"), "xmlpicker: text predicates are only supported on the last step"},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.expectedErr)
+		t.Run(name, func(t *testing.T) {
+			assert.EqualError(t, test.path.Validate(), test.expectedErr, name)
+			assert.False(t, test.path.Matches(&xmlpicker.Node{}), name)
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(`<a><b/></a>`)), test.path)
+			_, err := parser.Next()
+			assert.EqualError(t, err, test.expectedErr, name)
+			_, err = parser.Next()
+			assert.Error(t, err, name)
+		})
+	}
+}
+
+func TestPathExplain(t *testing.T) {
+	for idx, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/a/b/", `{"normalized":"/a/b/*","anchored":true,"steps":[{"name":"a","wildcard":false,"descendant":false},{"name":"b","wildcard":false,"descendant":false},{"name":"*","wildcard":true,"descendant":false}]}`},
+		{"/a/b/*", `{"normalized":"/a/b/*","anchored":true,"steps":[{"name":"a","wildcard":false,"descendant":false},{"name":"b","wildcard":false,"descendant":false},{"name":"*","wildcard":true,"descendant":false}]}`},
+		{"b", `{"normalized":"b","anchored":false,"steps":[{"name":"b","wildcard":false,"descendant":false}]}`},
+		{"/item[price = 100][tag]", `{"normalized":"/item[price = 100][tag]","anchored":true,"steps":[{"name":"item","wildcard":false,"descendant":false,"textPredicates":[{"operand":"price","op":"=","value":"100","numeric":true},{"operand":"tag"}]}]}`},
+		{"/a/@id", `{"normalized":"/a/@id","anchored":true,"steps":[{"name":"a","wildcard":false,"descendant":false}],"attribute":"id"}`},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.path), func(t *testing.T) {
+			p, err := xmlpicker.ParsePath(test.path)
+			if assert.NoError(t, err) {
+				b, err := json.Marshal(p.Explain())
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, string(b))
+			}
+		})
+	}
+	p := xmlpicker.Root().Child("x:a")
+	p.ResolvePrefixes = true
+	b, err := json.Marshal(p.Explain())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"normalized":"/x:a","anchored":true,"steps":[{"name":"x:a","wildcard":false,"descendant":false}],"resolvePrefixes":true}`, string(b))
+	e := xmlpicker.Root().Descendant("a").Attr("id", "1").Explain()
+	assert.Equal(t, []xmlpicker.PredicateExplanation{{Operand: "id", Op: "=", Value: "1"}}, e.Steps[0].Attrs)
+	assert.True(t, e.Steps[0].Descendant)
+}
@@ -1,37 +1,276 @@
 package xmlpicker
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
+// PathSelector is like ParsePathSelector but panics if the path cannot be parsed.
 func PathSelector(path string) Selector {
+	s, err := ParsePathSelector(path)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ParsePathSelector parses path with ParsePath and returns it as a Selector.
+func ParsePathSelector(path string) (Selector, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ParsePath parses a slash separated path of element names. An empty last step or "*" matches any element, a leading
+// "/" anchors the path at the document root. A double slash separates a step from the previous one, or from the root,
+// by any number of elements, e.g. "//item" or "/catalog//price".
+//
+// Any step may have predicates on the attributes of the element, e.g. "/feed/entry[@type = 'article']", the operand is
+// "@" followed by the local name of the attribute. These are evaluated when the start element is read, without
+// buffering. The last step may also have predicates on its text content, e.g. "/catalog/item[price > 100]" or
+// "/a/b[#text ~= 'foo']". These are evaluated once the subtree of a structurally matching node is complete, the
+// operand is either "#text", for the text of the node itself, or a relative path of child element names.
+//
+// Supported operators are =, !=, <, <=, >, >= and ~= (regular expression match), an unquoted number compares
+// numerically. A predicate without an operator tests for the presence of the operand.
+//
+// A step may have a position among its siblings of the same name, or among all its sibling elements for a "*" step,
+// counted from 1: "/root/row[1]", a range "/root/row[10:20]", which includes both ends, "[10:]", "[:20]" or the last
+// with "[last()]". The last one is only known once the next sibling starts or the parent ends, the Parser holds the
+// node back until then, and is only supported on the last step when selecting elements.
+//
+// A last step of "@" followed by a name, e.g. "/feed/entry/@id", selects the value of that attribute of the matching
+// elements instead of the elements, it cannot be combined with text predicates.
+func ParsePath(path string) (*Path, error) {
 	path = strings.TrimSpace(path)
-	if path == "" {
-		path = "/"
+	parts, err := splitPath(path)
+	if err != nil {
+		return nil, err
 	}
-	parts := strings.Split(path, "/")
-	for i, v := range parts {
-		parts[i] = strings.TrimSpace(v)
+	p := &Path{Anchored: path == "" || path[0] == '/'}
+	if len(parts) > 1 && p.Anchored {
+		parts = parts[1:]
 	}
+	if last := strings.TrimSpace(parts[len(parts)-1]); strings.HasPrefix(last, "@") {
+		p.Attribute = strings.TrimSpace(last[1:])
+		if p.Attribute == "" || strings.ContainsAny(p.Attribute, "[]*@") {
+			return nil, fmt.Errorf("xmlpicker: invalid attribute step %q in %q", last, path)
+		}
+		if len(parts) == 1 {
+			return nil, fmt.Errorf("xmlpicker: attribute step without an element step in %q", path)
+		}
+		parts = parts[:len(parts)-1]
+		if strings.TrimSpace(parts[len(parts)-1]) == "" {
+			parts = append(parts, "*")
+		}
+	}
+	descendant := false
 	for i, v := range parts {
-		if i != 0 && v == "" {
-			parts[i] = "*"
+		v = strings.TrimSpace(v)
+		if v == "" && i != len(parts)-1 {
+			if descendant {
+				return nil, fmt.Errorf("xmlpicker: empty step in %q", path)
+			}
+			descendant = true
+			continue
+		}
+		step, err := parseStep(v)
+		if err != nil {
+			return nil, err
+		}
+		if step.Name == "" {
+			step.Name = "*"
+		}
+		step.Descendant, descendant = descendant, false
+		if len(step.Texts) != 0 && i != len(parts)-1 {
+			return nil, fmt.Errorf("xmlpicker: text predicates are only supported on the last step of %q", path)
+		}
+		if len(step.Texts) != 0 && p.Attribute != "" {
+			return nil, fmt.Errorf("xmlpicker: text predicates are not supported when selecting an attribute in %q", path)
+		}
+		if step.Position.Last && (i != len(parts)-1 || p.Attribute != "") {
+			return nil, fmt.Errorf("xmlpicker: last() is only supported on the last step, when selecting elements, in %q", path)
+		}
+		p.Steps = append(p.Steps, step)
+	}
+	return p, nil
+}
+
+// splitPath splits path on the slashes that are outside of predicates.
+func splitPath(path string) ([]string, error) {
+	var parts []string
+	depth := 0
+	var quote rune
+	start := 0
+	for i, r := range path {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			if depth == 0 {
+				return nil, fmt.Errorf("xmlpicker: unexpected quote at offset %d in %q", i, path)
+			}
+			quote = r
+		case r == '[':
+			depth = depth + 1
+		case r == ']':
+			if depth == 0 {
+				return nil, fmt.Errorf("xmlpicker: unexpected ] at offset %d in %q", i, path)
+			}
+			depth = depth - 1
+		case r == '/' && depth == 0:
+			parts = append(parts, path[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("xmlpicker: unterminated string in %q", path)
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("xmlpicker: unterminated [ in %q", path)
+	}
+	return append(parts, path[start:]), nil
+}
+
+func parseStep(s string) (Step, error) {
+	i := strings.IndexByte(s, '[')
+	if i == -1 {
+		return Step{Name: s}, nil
+	}
+	step := Step{Name: strings.TrimSpace(s[:i])}
+	rest := s[i:]
+	for rest != "" {
+		if rest[0] != '[' {
+			return step, fmt.Errorf("xmlpicker: unexpected %q after predicate in step %q", rest, s)
+		}
+		end := predicateEnd(rest)
+		if pos, ok, err := parsePosition(rest[1:end]); err != nil {
+			return step, err
+		} else if ok {
+			if !step.Position.IsZero() {
+				return step, fmt.Errorf("xmlpicker: more than one position in step %q", s)
+			}
+			step.Position = pos
+			rest = strings.TrimSpace(rest[end+1:])
+			continue
+		}
+		p, attr, err := parsePredicate(rest[1:end])
+		if err != nil {
+			return step, err
+		}
+		if attr {
+			step.Attrs = append(step.Attrs, p)
+		} else {
+			step.Texts = append(step.Texts, p)
 		}
+		rest = strings.TrimSpace(rest[end+1:])
 	}
-	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
-		parts[i], parts[j] = parts[j], parts[i]
+	return step, nil
+}
+
+// predicateEnd returns the index of the ] closing the predicate that s starts with, splitPath has already checked
+// that brackets and quotes are balanced.
+func predicateEnd(s string) int {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ']':
+			return i
+		}
 	}
-	return pathSelector(parts)
+	return len(s) - 1
 }
 
-type pathSelector []string
+// parsePosition parses a positional predicate, a position such as 1, a range such as 10:20, 10: or :20 or last(). ok
+// is false for the other predicates.
+func parsePosition(s string) (pos Position, ok bool, err error) {
+	s = strings.TrimSpace(s)
+	if s == "last()" {
+		return Position{Last: true}, true, nil
+	}
+	if s == "" || !strings.ContainsAny(s[:1], "0123456789:") {
+		return pos, false, nil
+	}
+	from, to := s, s
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		from, to = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	pos.From, pos.To = 1, 0
+	if from != "" {
+		if pos.From, err = strconv.Atoi(from); err != nil {
+			return pos, false, fmt.Errorf("xmlpicker: invalid position [%s]", s)
+		}
+	}
+	if to != "" {
+		if pos.To, err = strconv.Atoi(to); err != nil {
+			return pos, false, fmt.Errorf("xmlpicker: invalid position [%s]", s)
+		}
+	}
+	if pos.From < 1 || (to != "" && pos.To < 1) {
+		return pos, false, fmt.Errorf("xmlpicker: positions are counted from 1 [%s]", s)
+	}
+	if pos.To != 0 && pos.To < pos.From {
+		return pos, false, fmt.Errorf("xmlpicker: empty position range [%s]", s)
+	}
+	return pos, true, nil
+}
 
-func (s pathSelector) Matches(node *Node) bool {
-	i := 0
-	for n := node; n != nil && i < len(s); n = n.Parent {
-		p := s[i]
-		if p != "*" && p != n.StartElement.Name.Local {
-			return false
+// parsePredicate parses the predicate s, attr is set for a predicate on an attribute of the element rather than on
+// its text, the "@" is not kept in the operand.
+func parsePredicate(s string) (p Predicate, attr bool, err error) {
+	operand := s
+	var op, value string
+	if i := strings.IndexAny(s, "!<>=~"); i != -1 {
+		operand = s[:i]
+		op = s[i : i+1]
+		if i+1 < len(s) && s[i+1] == '=' {
+			op = s[i : i+2]
+		}
+		if op == "!" || op == "~" {
+			return p, false, fmt.Errorf("xmlpicker: invalid operator in predicate [%s]", s)
 		}
-		i = i + 1
+		value = strings.TrimSpace(s[i+len(op):])
+	}
+	parts := strings.Split(operand, "/")
+	for i, v := range parts {
+		parts[i] = strings.TrimSpace(v)
+		if parts[i] == "" {
+			if len(parts) == 1 {
+				return p, false, fmt.Errorf("xmlpicker: missing operand in predicate [%s]", s)
+			}
+			return p, false, fmt.Errorf("xmlpicker: invalid operand in predicate [%s]", s)
+		}
+	}
+	if attr = strings.HasPrefix(parts[0], "@"); attr {
+		parts[0] = strings.TrimSpace(parts[0][1:])
+		if len(parts) != 1 || parts[0] == "" || strings.ContainsAny(parts[0], "*@#") {
+			return p, false, fmt.Errorf("xmlpicker: invalid attribute operand in predicate [%s]", s)
+		}
+	}
+	numeric := false
+	if op != "" {
+		if n := len(value); n >= 2 && (value[0] == '\'' || value[0] == '"') && value[n-1] == value[0] {
+			value = value[1 : n-1]
+		} else if _, err := strconv.ParseFloat(value, 64); err == nil {
+			numeric = true
+		} else {
+			return p, false, fmt.Errorf("xmlpicker: invalid value in predicate [%s]", s)
+		}
+	}
+	p, err = NewPredicate(strings.Join(parts, "/"), op, value, numeric)
+	if err != nil {
+		return p, false, fmt.Errorf("%s in predicate [%s]", err, s)
 	}
-	return i == len(s)
+	return p, attr, nil
 }
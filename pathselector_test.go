@@ -88,6 +88,36 @@ func TestPathSelector(t *testing.T) {
 			xml:      `<a><b><c/></b><c/><b><c/></b><b><d/></b></a>`,
 			expected: []string{"/a/b/c", "/a/b/c"},
 		},
+		{
+			selector: "//c",
+			xml:      `<a><b><c/></b><c/><b><d><c/></d></b></a>`,
+			expected: []string{"/a/b/c", "/a/c", "/a/b/d/c"},
+		},
+		{
+			selector: "/a//c",
+			xml:      `<c><a><b><c/></b><c/></a><c/></c>`,
+			expected: []string{},
+		},
+		{
+			selector: "/a//c",
+			xml:      `<a><b><c/></b><c/><b><d><c/></d></b></a>`,
+			expected: []string{"/a/b/c", "/a/c", "/a/b/d/c"},
+		},
+		{
+			selector: "/a//d/c",
+			xml:      `<a><b><c/></b><d><c/></d><b><d><c/><e><c/></e></d></b></a>`,
+			expected: []string{"/a/d/c", "/a/b/d/c"},
+		},
+		{
+			selector: "b//c",
+			xml:      `<a><b><c/></b><c/><b><d><c/></d></b></a>`,
+			expected: []string{"/a/b/c", "/a/b/d/c"},
+		},
+		{
+			selector: "//b//",
+			xml:      `<a><b><c/><d><e/></d></b><c/></a>`,
+			expected: []string{"/a/b/c", "/a/b/d"},
+		},
 
 		{
 			selector: "/root/",
@@ -182,3 +212,406 @@ func TestPathSelector(t *testing.T) {
 		})
 	}
 }
+
+func TestPathSelectorPredicates(t *testing.T) {
+	for idx, test := range []struct {
+		selector string
+		xml      string
+		expected []string
+	}{
+		{
+			selector: "/a/b[#text = 'x']",
+			xml:      `<a><b>x</b><b>y</b><b/><b>x</b></a>`,
+			expected: []string{"x", "x"},
+		},
+		{
+			selector: "/a/b[#text != 'x']",
+			xml:      `<a><b>x</b><b>y</b><b/></a>`,
+			expected: []string{"y"},
+		},
+		{
+			selector: "/a/b[#text]",
+			xml:      `<a><b>x</b><b><c/></b><b/></a>`,
+			expected: []string{"x"},
+		},
+		{
+			selector: `/a/b[#text ~= "^f.o$"]`,
+			xml:      `<a><b>foo</b><b>fooo</b><b>fao</b></a>`,
+			expected: []string{"foo", "fao"},
+		},
+		{
+			selector: "/catalog/item[price > 100]",
+			xml:      `<catalog><item><price>99.5</price></item><item><price>100.5</price></item><item><price>abc</price></item><item/></catalog>`,
+			expected: []string{"100.5"},
+		},
+		{
+			selector: "/catalog/item[price <= 100]",
+			xml:      `<catalog><item><price>99.5</price></item><item><price>100</price></item><item><price>101</price></item></catalog>`,
+			expected: []string{"99.5", "100"},
+		},
+		{
+			selector: "/catalog/item[price >= '2']",
+			xml:      `<catalog><item><price>10</price></item><item><price>2</price></item></catalog>`,
+			expected: []string{"2"},
+		},
+		{
+			selector: "/catalog/item[price < 10][price]",
+			xml:      `<catalog><item><price>1</price></item><item/></catalog>`,
+			expected: []string{"1"},
+		},
+		{
+			selector: "/catalog/item[info/price = 5]",
+			xml:      `<catalog><item><info><price>4</price></info><info><price>5</price></info></item><item><price>5</price></item></catalog>`,
+			expected: []string{"45"},
+		},
+		{
+			selector: "/catalog/item[flag]",
+			xml:      `<catalog><item><flag/>1</item><item>2</item></catalog>`,
+			expected: []string{"1"},
+		},
+		{
+			selector: "/a/b[#text = 'a/b[c]']",
+			xml:      `<a><b>a/b[c]</b><b>x</b></a>`,
+			expected: []string{"a/b[c]"},
+		},
+		{
+			selector: "/a[#text = 'x']",
+			xml:      `<a>x</a>`,
+			expected: []string{"x"},
+		},
+		{
+			selector: "/root/row[1]",
+			xml:      `<root><row>1</row><row>2</row><row>3</row><row>4</row><row>5</row></root>`,
+			expected: []string{"1"},
+		},
+		{
+			selector: "/root/row[2:4]",
+			xml:      `<root><row>1</row><row>2</row><row>3</row><row>4</row><row>5</row></root>`,
+			expected: []string{"2", "3", "4"},
+		},
+		{
+			selector: "/root/row[4:]",
+			xml:      `<root><row>1</row><row>2</row><row>3</row><row>4</row><row>5</row></root>`,
+			expected: []string{"4", "5"},
+		},
+		{
+			selector: "/root/row[:2]",
+			xml:      `<root><row>1</row><x/><row>2</row><row>3</row></root>`,
+			expected: []string{"1", "2"},
+		},
+		{
+			selector: "/root/row[last()]",
+			xml:      `<root><row>1</row><row>2</row><row>3</row><x/></root>`,
+			expected: []string{"3"},
+		},
+		{
+			selector: "/root/a[2]",
+			xml:      `<root><a>1</a><b>2</b><a>3</a><b>4</b></root>`,
+			expected: []string{"3"},
+		},
+		{
+			selector: "/root/*[2]",
+			xml:      `<root><a>1</a><b>2</b><a>3</a><b>4</b></root>`,
+			expected: []string{"2"},
+		},
+		{
+			selector: "/root/a[last()]",
+			xml:      `<root><a>1</a><b>2</b><a>3</a><b>4</b></root>`,
+			expected: []string{"3"},
+		},
+		{
+			selector: "/root/*[last()]",
+			xml:      `<root><a>1</a><b>2</b><a>3</a><b>4</b></root>`,
+			expected: []string{"4"},
+		},
+		{
+			selector: "/t/g/row[last()]",
+			xml:      `<t><g><row>1</row><row>2</row></g><g><row>3</row></g><g/></t>`,
+			expected: []string{"2", "3"},
+		},
+		{
+			selector: "/t/g[2]/row[1]",
+			xml:      `<t><g><row>1</row><row>2</row></g><g><row>3</row><row>4</row></g></t>`,
+			expected: []string{"3"},
+		},
+		{
+			selector: "/t//row[last()]",
+			xml:      `<t><b><row>1</row><c><row>2</row><row>3</row></c></b></t>`,
+			expected: []string{"3", "1"},
+		},
+		{
+			selector: "/t/g/row[last()][#text = '5']",
+			xml:      `<t><g><row>4</row><row>5</row></g><g><row>5</row><row>6</row></g></t>`,
+			expected: []string{"5"},
+		},
+		{
+			selector: "/root/row[2][@id]",
+			xml:      `<root><row id="1">1</row><row>2</row><row id="3">3</row></root>`,
+			expected: []string{},
+		},
+		{
+			selector: "/feed/entry[@type='article']",
+			xml:      `<feed><entry type="article">1</entry><entry type="video">2</entry><entry>3</entry><entry type="article">4</entry></feed>`,
+			expected: []string{"1", "4"},
+		},
+		{
+			selector: "/feed/entry[@type]",
+			xml:      `<feed><entry type="">1</entry><entry>2</entry></feed>`,
+			expected: []string{"1"},
+		},
+		{
+			selector: "/feed/entry[@type != 'video'][@rank >= 2]",
+			xml:      `<feed><entry type="article" rank="2">1</entry><entry type="video" rank="3">2</entry><entry rank="10">3</entry><entry type="article" rank="x">4</entry></feed>`,
+			expected: []string{"1"},
+		},
+		{
+			selector: "/feed[@lang ~= '^en']/entry",
+			xml:      `<feed lang="en-GB"><entry>1</entry><entry>2</entry></feed>`,
+			expected: []string{"1", "2"},
+		},
+		{
+			selector: "/feed[@lang = 'fr']/entry",
+			xml:      `<feed lang="en"><entry>1</entry></feed>`,
+			expected: []string{},
+		},
+		{
+			selector: "//entry[@type = 'a'][#text = '2']",
+			xml:      `<feed><group><entry type="a">1</entry><entry type="a">2</entry></group><entry type="b">2</entry></feed>`,
+			expected: []string{"2"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.selector)
+		t.Run(name, func(t *testing.T) {
+			actual := make([]string, 0)
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			for {
+				node, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, "%s\nXML:\n%s\n", name, test.xml) {
+					return
+				}
+				actual = append(actual, deepText(node))
+			}
+			assert.Equal(t, test.expected, actual, "%s\nXML:\n%s\n", name, test.xml)
+		})
+	}
+}
+
+func TestPathSelectorAttribute(t *testing.T) {
+	const doc = `<feed xmlns:x="urn:x"><entry id="1"><title>One</title></entry><entry><title>Two</title></entry><entry x:id="3" type="a"/></feed>`
+	for idx, test := range []struct {
+		selector string
+		expected []string
+	}{
+		{
+			selector: "/feed/entry/@id",
+			expected: []string{"1 /feed/entry/@id", "3 /feed/entry/@id"},
+		},
+		{
+			selector: "entry/@type",
+			expected: []string{"a /feed/entry/@type"},
+		},
+		{
+			selector: "/feed/entry[@type = 'a']/@id",
+			expected: []string{"3 /feed/entry/@id"},
+		},
+		{
+			selector: "/feed/entry/title/@id",
+			expected: []string{},
+		},
+		{
+			selector: "//@id",
+			expected: []string{"1 /feed/entry/@id", "3 /feed/entry/@id"},
+		},
+		{
+			selector: "/feed//title/@id",
+			expected: []string{},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.selector)
+		t.Run(name, func(t *testing.T) {
+			actual := make([]string, 0)
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector(test.selector))
+			parser.NSFlag = xmlpicker.NSStrip
+			for {
+				node, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				text, ok := node.Text()
+				assert.True(t, ok, name)
+				assert.Nil(t, node.Parent.Children, name)
+				actual = append(actual, text+" "+node.Path())
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestPathSelectorPrefixes(t *testing.T) {
+	const doc = `<feed xmlns:a="urn:atom" xmlns:b="urn:atom"><a:entry id="1"/><b:entry id="2"/><entry xmlns="urn:atom" id="3"/><entry id="4"/></feed>`
+	for idx, test := range []struct {
+		selector        string
+		resolvePrefixes bool
+		expected        []string
+	}{
+		{
+			selector: "/feed/entry",
+			expected: []string{"1", "2", "3", "4"},
+		},
+		{
+			selector:        "/feed/a:entry",
+			resolvePrefixes: true,
+			expected:        []string{"1", "2", "3"},
+		},
+		{
+			selector:        "/feed/a:*",
+			resolvePrefixes: true,
+			expected:        []string{"1", "2", "3"},
+		},
+		{
+			selector:        "/feed/c:entry",
+			resolvePrefixes: true,
+			expected:        []string{},
+		},
+	} {
+		for _, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSStrip, xmlpicker.NSPrefix} {
+			name := fmt.Sprintf("%d %s %t %s", idx, test.selector, test.resolvePrefixes, nsFlag)
+			t.Run(name, func(t *testing.T) {
+				path, err := xmlpicker.ParsePath(test.selector)
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				path.ResolvePrefixes = test.resolvePrefixes
+				actual := make([]string, 0)
+				parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), path)
+				parser.NSFlag = nsFlag
+				for {
+					node, err := parser.Next()
+					if err == io.EOF {
+						break
+					}
+					if !assert.NoError(t, err, name) {
+						return
+					}
+					actual = append(actual, node.StartElement.Attr[len(node.StartElement.Attr)-1].Value)
+				}
+				assert.Equal(t, test.expected, actual, name)
+			})
+		}
+	}
+}
+
+func TestParsePathSelectorErrors(t *testing.T) {
+	for idx, test := range []struct {
+		selector    string
+		expectedErr string
+	}{
+		{
+			selector:    "/a[b = 'x']/c",
+			expectedErr: `xmlpicker: text predicates are only supported on the last step of "/a[b = 'x']/c"`,
+		},
+		{
+			selector:    "/a[b = 'x'",
+			expectedErr: `xmlpicker: unterminated [ in "/a[b = 'x'"`,
+		},
+		{
+			selector:    "/a[b = 'x]",
+			expectedErr: `xmlpicker: unterminated string in "/a[b = 'x]"`,
+		},
+		{
+			selector:    "/a]",
+			expectedErr: `xmlpicker: unexpected ] at offset 2 in "/a]"`,
+		},
+		{
+			selector:    "/a[b]x",
+			expectedErr: `xmlpicker: unexpected "x" after predicate in step "a[b]x"`,
+		},
+		{
+			selector:    "/a[= 'x']",
+			expectedErr: `xmlpicker: missing operand in predicate [= 'x']`,
+		},
+		{
+			selector:    "/a[b ! 'x']",
+			expectedErr: `xmlpicker: invalid operator in predicate [b ! 'x']`,
+		},
+		{
+			selector:    "/a[b = x]",
+			expectedErr: `xmlpicker: invalid value in predicate [b = x]`,
+		},
+		{
+			selector:    "/a/b[#text = 'x']/@id",
+			expectedErr: `xmlpicker: text predicates are not supported when selecting an attribute in "/a/b[#text = 'x']/@id"`,
+		},
+		{
+			selector:    "/a///b",
+			expectedErr: `xmlpicker: empty step in "/a///b"`,
+		},
+		{
+			selector:    "/a[@b/c]",
+			expectedErr: `xmlpicker: invalid attribute operand in predicate [@b/c]`,
+		},
+		{
+			selector:    "/a[@ = 'x']",
+			expectedErr: `xmlpicker: invalid attribute operand in predicate [@ = 'x']`,
+		},
+		{
+			selector:    "/a[last()]/b",
+			expectedErr: `xmlpicker: last() is only supported on the last step, when selecting elements, in "/a[last()]/b"`,
+		},
+		{
+			selector:    "/a/b[last()]/@id",
+			expectedErr: `xmlpicker: last() is only supported on the last step, when selecting elements, in "/a/b[last()]/@id"`,
+		},
+		{
+			selector:    "/a[0]",
+			expectedErr: `xmlpicker: positions are counted from 1 [0]`,
+		},
+		{
+			selector:    "/a[3:2]",
+			expectedErr: `xmlpicker: empty position range [3:2]`,
+		},
+		{
+			selector:    "/a[1x]",
+			expectedErr: `xmlpicker: invalid position [1x]`,
+		},
+		{
+			selector:    "/a[1][2]",
+			expectedErr: `xmlpicker: more than one position in step "a[1][2]"`,
+		},
+		{
+			selector:    "/@id",
+			expectedErr: `xmlpicker: attribute step without an element step in "/@id"`,
+		},
+		{
+			selector:    "/a/@",
+			expectedErr: `xmlpicker: invalid attribute step "@" in "/a/@"`,
+		},
+		{
+			selector:    "/a[b ~= '(']",
+			expectedErr: "xmlpicker: invalid regular expression \"(\": error parsing regexp: missing closing ): `(` in predicate [b ~= '(']",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.selector)
+		t.Run(name, func(t *testing.T) {
+			_, err := xmlpicker.ParsePathSelector(test.selector)
+			assert.EqualError(t, err, test.expectedErr, name)
+		})
+	}
+}
+
+func deepText(node *xmlpicker.Node) string {
+	if text, ok := node.Text(); ok {
+		return text
+	}
+	var parts []string
+	for _, c := range node.Children {
+		parts = append(parts, deepText(c))
+	}
+	return strings.Join(parts, "")
+}
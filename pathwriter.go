@@ -0,0 +1,73 @@
+package xmlpicker
+
+import "fmt"
+
+// PathWriter writes the ancestors of nodes with an XMLExporter and keeps them open between nodes, so that consecutive
+// nodes that share ancestors are written under the same elements. The namespaces declared for the open ancestors stay
+// in scope for the nodes written below them.
+type PathWriter struct {
+	Exporter *XMLExporter
+	// path holds the open ancestors, outermost first
+	path []*Node
+}
+
+// NewPathWriter returns a PathWriter that writes with e.
+func NewPathWriter(e *XMLExporter) *PathWriter {
+	return &PathWriter{Exporter: e}
+}
+
+// Path returns the open ancestors, outermost first.
+func (w *PathWriter) Path() []*Node {
+	return w.path
+}
+
+// SwitchPath ends the open elements from node from up that are not ancestors of to, or to itself, and starts those of
+// to and its ancestors, below the root, that are not open yet. from is the node last passed as to, nil when nothing is
+// open, and to is nil to end all the open elements. Ancestors are shared when they are the same *Node, as with
+// consecutive nodes read by a Parser.
+func (w *PathWriter) SwitchPath(from, to *Node) error {
+	var open *Node
+	if len(w.path) != 0 {
+		open = w.path[len(w.path)-1]
+	}
+	if from != nil && from.Parent == nil {
+		from = nil // the root is never written
+	}
+	if from != open {
+		return fmt.Errorf("xmlpicker: SwitchPath from %s is not the open path", describePath(from))
+	}
+	path := ancestors(to)
+	common := 0
+	for common < len(path) && common < len(w.path) && path[common] == w.path[common] {
+		common++
+	}
+	for len(w.path) > common {
+		if err := w.Exporter.encodeEndElement(w.path[len(w.path)-1]); err != nil {
+			return err
+		}
+		w.path = w.path[:len(w.path)-1]
+	}
+	for _, n := range path[common:] {
+		if err := w.Exporter.encodeStartElement(n); err != nil {
+			return err
+		}
+		w.path = append(w.path, n)
+	}
+	return nil
+}
+
+// Close ends the open elements.
+func (w *PathWriter) Close() error {
+	if len(w.path) == 0 {
+		return nil
+	}
+	return w.SwitchPath(w.path[len(w.path)-1], nil)
+}
+
+// describePath returns the path of node for error messages.
+func describePath(node *Node) string {
+	if node == nil {
+		return "nil"
+	}
+	return node.Path()
+}
@@ -0,0 +1,91 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestPathWriter(t *testing.T) {
+	for idx, test := range []struct {
+		name     string
+		selector string
+		xml      string
+		expected string
+	}{
+		{
+			name:     "document element",
+			xml:      `<a><b/></a>`,
+			selector: "/",
+			expected: `<a><b></b></a>`,
+		},
+		{
+			name:     "siblings",
+			xml:      `<a id="1"><b>1</b><c>2</c></a>`,
+			selector: "/*/",
+			expected: `<a id="1"><b>1</b><c>2</c></a>`,
+		},
+		{
+			name:     "differing suffix",
+			xml:      `<a><b id="1"><c>1</c><c>2</c></b><b id="2"><c>3</c></b></a>`,
+			selector: "/*/*/",
+			expected: `<a><b id="1"><c>1</c><c>2</c></b><b id="2"><c>3</c></b></a>`,
+		},
+		{
+			name:     "namespaces",
+			xml:      `<a xmlns="urn:a" xmlns:x="urn:x"><x:b x:id="1"/><x:b x:id="2"/></a>`,
+			selector: "/*/",
+			expected: `<a xmlns="urn:a" xmlns:x="urn:x"><x:b x:id="1"></x:b><x:b x:id="2"></x:b></a>`,
+		},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.name), func(t *testing.T) {
+			name := fmt.Sprintf("%d %s", idx, test.name)
+			var b bytes.Buffer
+			w := xmlpicker.NewPathWriter(&xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&b)})
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			parser.NSFlag = xmlpicker.NSPrefix
+			var from *xmlpicker.Node
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				assert.NoError(t, w.SwitchPath(from, n.Parent), name)
+				assert.NoError(t, w.Exporter.EncodeNode(n), name)
+				from = n.Parent
+			}
+			assert.NoError(t, w.Close(), name)
+			assert.Empty(t, w.Path(), name)
+			assert.NoError(t, w.Exporter.Encoder.Flush(), name)
+			assert.Equal(t, test.expected, b.String(), name)
+		})
+	}
+}
+
+func TestPathWriter_SwitchPath(t *testing.T) {
+	root := &xmlpicker.Node{}
+	a := &xmlpicker.Node{Parent: root, StartElement: xml.StartElement{Name: xml.Name{Local: "a"}}}
+	b := &xmlpicker.Node{Parent: a, StartElement: xml.StartElement{Name: xml.Name{Local: "b"}}}
+	c := &xmlpicker.Node{Parent: a, StartElement: xml.StartElement{Name: xml.Name{Local: "c"}}}
+	var buf bytes.Buffer
+	w := xmlpicker.NewPathWriter(&xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&buf)})
+	assert.NoError(t, w.SwitchPath(root, b))
+	assert.Equal(t, []*xmlpicker.Node{a, b}, w.Path())
+	assert.EqualError(t, w.SwitchPath(a, c), "xmlpicker: SwitchPath from /a is not the open path")
+	assert.NoError(t, w.SwitchPath(b, c))
+	assert.Equal(t, []*xmlpicker.Node{a, c}, w.Path())
+	assert.NoError(t, w.SwitchPath(c, a))
+	assert.Equal(t, []*xmlpicker.Node{a}, w.Path())
+	assert.NoError(t, w.SwitchPath(a, nil))
+	assert.NoError(t, w.Exporter.Encoder.Flush())
+	assert.Equal(t, `<a><b></b><c></c></a>`, buf.String())
+}
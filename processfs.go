@@ -0,0 +1,61 @@
+//go:build go1.16
+// +build go1.16
+
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// ProcessFS parses every file in fsys whose name matches glob, using the syntax of fs.Glob, and passes the nodes
+// matched by selector to proc. Files are processed one after the other in lexical order of their names. An error,
+// whether returned by the parser or by proc, stops the processing of the file it occurred in but not of the files
+// after it; the errors are returned together as FileErrors.
+func ProcessFS(fsys fs.FS, glob string, selector Selector, proc Processor) error {
+	names, err := fs.Glob(fsys, glob)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	var errs FileErrors
+	for _, name := range names {
+		if err := processFile(fsys, name, selector, proc); err != nil {
+			errs = append(errs, &FileError{Name: name, Err: err})
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+func processFile(fsys fs.FS, name string, selector Selector, proc Processor) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil {
+		return err
+	} else if info.IsDir() {
+		return nil
+	}
+	decoder := xml.NewDecoder(f)
+	decoder.Strict = true
+	parser := NewParser(decoder, selector)
+	for {
+		node, err := parser.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := proc.Process(node); err != nil {
+			return err
+		}
+	}
+}
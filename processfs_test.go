@@ -0,0 +1,59 @@
+//go:build go1.16
+// +build go1.16
+
+package xmlpicker_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestProcessFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"feeds/b.xml":      {Data: []byte(`<feed><entry>b1</entry><entry>b2</entry></feed>`)},
+		"feeds/a.xml":      {Data: []byte(`<feed><entry>a1</entry></feed>`)},
+		"feeds/broken.xml": {Data: []byte(`<feed><entry>x1</entry><entry>`)},
+		"feeds/c.xml":      {Data: []byte(`<feed><entry>c1</entry></feed>`)},
+		"feeds/notes.txt":  {Data: []byte(`not xml`)},
+	}
+	var actual []string
+	err := xmlpicker.ProcessFS(fsys, "feeds/*.xml", xmlpicker.PathSelector("/feed/entry"), xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+		actual = append(actual, deepText(node))
+		return nil
+	}))
+	assert.Equal(t, []string{"a1", "b1", "b2", "x1", "c1"}, actual)
+	if errs, ok := err.(xmlpicker.FileErrors); assert.True(t, ok, "%v", err) && assert.Len(t, errs, 1) {
+		assert.Equal(t, "feeds/broken.xml", errs[0].Name)
+		assert.Contains(t, errs[0].Error(), "unexpected EOF")
+	}
+}
+
+func TestProcessFSProcessorError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.xml": {Data: []byte(`<feed><entry>a1</entry><entry>a2</entry></feed>`)},
+		"b.xml": {Data: []byte(`<feed><entry>b1</entry></feed>`)},
+	}
+	failure := errors.New("failure")
+	var actual []string
+	err := xmlpicker.ProcessFS(fsys, "*.xml", xmlpicker.PathSelector("/feed/entry"), xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+		actual = append(actual, deepText(node))
+		if len(actual) == 1 {
+			return failure
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"a1", "b1"}, actual)
+	assert.Equal(t, xmlpicker.FileErrors{{Name: "a.xml", Err: failure}}, err)
+	assert.EqualError(t, err, "a.xml: failure")
+}
+
+func TestProcessFSBadGlob(t *testing.T) {
+	err := xmlpicker.ProcessFS(fstest.MapFS{}, "[", xmlpicker.PathSelector("/"), xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+		return nil
+	}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package xmlpicker
+
+import (
+	"bytes"
+)
+
+// Processor consumes the nodes picked out of a document.
+type Processor interface {
+	Process(node *Node) error
+}
+
+// ProcessorFunc adapts a function to the Processor interface.
+type ProcessorFunc func(node *Node) error
+
+// Process calls f(node).
+func (f ProcessorFunc) Process(node *Node) error {
+	return f(node)
+}
+
+// TeeProcessor returns a Processor that passes each node to all of procs in turn. An error does not keep the node from
+// the processors after it, the first one is returned once they all had the node.
+func TeeProcessor(procs ...Processor) Processor {
+	return ProcessorFunc(func(node *Node) error {
+		var first error
+		for _, p := range procs {
+			if err := p.Process(node); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
+
+// FileError is the error that stopped the processing of a single file.
+type FileError struct {
+	Name string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+// FileErrors collects the errors of every file that could not be processed completely.
+type FileErrors []*FileError
+
+func (e FileErrors) Error() string {
+	var buf bytes.Buffer
+	for i, err := range e {
+		if i != 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(err.Error())
+	}
+	return buf.String()
+}
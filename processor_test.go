@@ -0,0 +1,26 @@
+package xmlpicker_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestTeeProcessor(t *testing.T) {
+	var actual []string
+	failure := errors.New("failure")
+	proc := func(name string, err error) xmlpicker.Processor {
+		return xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+			actual = append(actual, name+" "+node.StartElement.Name.Local)
+			return err
+		})
+	}
+	tee := xmlpicker.TeeProcessor(proc("a", nil), proc("b", failure), proc("c", errors.New("other")), proc("d", nil))
+	node := &xmlpicker.Node{}
+	node.StartElement.Name.Local = "entry"
+	assert.Equal(t, failure, tee.Process(node))
+	assert.Equal(t, []string{"a entry", "b entry", "c entry", "d entry"}, actual)
+	assert.NoError(t, xmlpicker.TeeProcessor().Process(node))
+}
@@ -0,0 +1,116 @@
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"sort"
+)
+
+// QName is a name together with the prefix it was written with and the namespace that prefix is bound to.
+type QName struct {
+	Prefix string
+	URI    string
+	Local  string
+}
+
+// Attr is an attribute with its QName.
+type Attr struct {
+	Name  QName
+	Value string
+}
+
+// Name returns the name of the element as read by the Parser, whatever its NSFlag. For nodes that were not read by a
+// Parser the name space is resolved as a prefix if it is declared and taken as the namespace otherwise.
+func (node *Node) Name() QName {
+	if node.name.Local == node.StartElement.Name.Local && node.name.Local != "" {
+		return node.name
+	}
+	return node.guessName(node.StartElement.Name, true)
+}
+
+// Attrs returns the attributes of the element as read by the Parser, whatever its NSFlag. Attributes added after
+// parsing are named as in Name. Text nodes have no attributes.
+func (node *Node) Attrs() []Attr {
+	if _, ok := node.Text(); ok {
+		return nil
+	}
+	attrs := make([]Attr, len(node.StartElement.Attr))
+	for i, a := range node.StartElement.Attr {
+		attrs[i].Value = a.Value
+		if i < len(node.attrNames) && node.attrNames[i].Local == a.Name.Local {
+			attrs[i].Name = node.attrNames[i]
+		} else {
+			attrs[i].Name = node.guessName(a.Name, false)
+		}
+	}
+	return attrs
+}
+
+func (node *Node) guessName(name xml.Name, element bool) QName {
+	if name.Space == "" && !element {
+		return QName{Local: name.Local}
+	}
+	if ns, ok := node.lookupNamespace(name.Space); ok {
+		return QName{Prefix: name.Space, URI: ns, Local: name.Local}
+	}
+	return QName{URI: name.Space, Local: name.Local}
+}
+
+// qualify records the prefixes and namespaces of the names of node. Outside of NSPrefix mode the names are those
+// translated by the decoder and the prefixes are taken from the raw start element.
+func (p *Parser) qualify(node *Node, name xml.Name, attrs []xml.Name) {
+	raw, rawAttrs := name, attrs
+	if p.NSFlag != NSPrefix {
+		raw, rawAttrs = p.rawName, p.rawAttrs
+	}
+	node.name = p.qualifyName(node, raw, name, true)
+	if len(attrs) != 0 {
+		node.attrNames = make([]QName, len(attrs))
+		for i, a := range attrs {
+			node.attrNames[i] = p.qualifyName(node, rawAttrs[i], a, false)
+		}
+	}
+}
+
+func (p *Parser) qualifyName(node *Node, raw, name xml.Name, element bool) QName {
+	q := QName{Prefix: raw.Space, Local: name.Local}
+	switch {
+	case p.NSFlag == NSPrefix:
+		if raw.Space != "" || element {
+			q.URI, _ = node.lookupNamespace(raw.Space)
+		}
+	case name.Space != raw.Space:
+		q.URI = name.Space
+	case raw.Space != "":
+		// the decoder leaves undeclared prefixes in place
+		q.URI, _ = node.lookupNamespace(raw.Space)
+	}
+	return q
+}
+
+// prefixFor returns the prefix bound to ns in scope. The default namespace is preferred for elements, otherwise the
+// first prefix in lexical order is used when several are bound to ns.
+func prefixFor(scope Namespaces, ns string, element bool) string {
+	if v, ok := scope[""]; element && ok && v == ns {
+		return ""
+	}
+	var prefixes []string
+	for prefix, v := range scope {
+		if prefix != "" && v == ns {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return ""
+	}
+	sort.Strings(prefixes)
+	return prefixes[0]
+}
+
+func copyQNames(names []QName) []QName {
+	if names == nil {
+		return nil
+	}
+	c := make([]QName, len(names))
+	copy(c, names)
+	return c
+}
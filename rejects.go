@@ -0,0 +1,147 @@
+package xmlpicker
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// RecordError is returned by a Processor that failed on a single node, for instance because it could not be mapped,
+// did not validate or could not be encoded, rather than because of its output. A RejectingProcessor routes the node
+// elsewhere and carries on with the next one.
+type RecordError struct {
+	// Stage names the step that failed, e.g. "map", "validate" or "encode".
+	Stage string
+	Err   error
+	// Record is the value the node was mapped to, if it got that far.
+	Record interface{}
+}
+
+func (e *RecordError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+// Rejected is a node a Processor failed on with the context of the failure.
+type Rejected struct {
+	Node *Node
+	Path string
+	// File and Offset are only set when the RejectingProcessor can locate the node.
+	File   string
+	Offset int64
+	Stage  string
+	Err    error
+	Record interface{}
+}
+
+// RejectSink receives the nodes routed away by a RejectingProcessor, an error stops processing.
+type RejectSink interface {
+	Reject(r *Rejected) error
+}
+
+// RejectSinkFunc adapts a function to the RejectSink interface.
+type RejectSinkFunc func(r *Rejected) error
+
+// Reject calls f(r).
+func (f RejectSinkFunc) Reject(r *Rejected) error {
+	return f(r)
+}
+
+// RejectingProcessor passes nodes to Next and sends those it returns a RecordError for to Sink instead of stopping.
+// Any other error is returned as is.
+type RejectingProcessor struct {
+	Next Processor
+	Sink RejectSink
+	// Locate optionally sets the File and Offset of a rejected node.
+	Locate func(r *Rejected)
+}
+
+func (p *RejectingProcessor) Process(node *Node) error {
+	err := p.Next.Process(node)
+	recordErr, ok := err.(*RecordError)
+	if !ok {
+		return err
+	}
+	r := &Rejected{
+		Node:   node,
+		Path:   node.Path(),
+		Stage:  recordErr.Stage,
+		Err:    recordErr.Err,
+		Record: recordErr.Record,
+	}
+	if p.Locate != nil {
+		p.Locate(r)
+	}
+	return p.Sink.Reject(r)
+}
+
+// rejectEntry is how a Rejected is written as JSON.
+type rejectEntry struct {
+	File   string      `json:"file,omitempty"`
+	Offset *int64      `json:"offset,omitempty"`
+	Path   string      `json:"path"`
+	Stage  string      `json:"stage"`
+	Error  string      `json:"error"`
+	Record interface{} `json:"record,omitempty"`
+	XML    string      `json:"xml,omitempty"`
+}
+
+func newRejectEntry(r *Rejected) (*rejectEntry, error) {
+	e := &rejectEntry{File: r.File, Path: r.Path, Stage: r.Stage, Error: r.Err.Error(), Record: r.Record}
+	if r.File != "" {
+		offset := r.Offset
+		e.Offset = &offset
+	}
+	var b bytes.Buffer
+	x := &XMLExporter{Encoder: xml.NewEncoder(&b)}
+	if err := x.EncodeNode(r.Node.Detach()); err != nil {
+		return nil, err
+	}
+	if err := x.Encoder.Flush(); err != nil {
+		return nil, err
+	}
+	e.XML = b.String()
+	return e, nil
+}
+
+// NewRejectWriter returns a RejectSink that writes each rejected node to w as a line of JSON with the context of the
+// failure, the mapped record if there is one and the node as XML.
+func NewRejectWriter(w io.Writer) RejectSink {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return RejectSinkFunc(func(r *Rejected) error {
+		e, err := newRejectEntry(r)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(e)
+	})
+}
+
+// RejectDir is a RejectSink that writes each rejected node to its own numbered XML file in Dir, along with a JSON
+// file of the same name holding the context of the failure.
+type RejectDir struct {
+	Dir   string
+	count int
+}
+
+func (d *RejectDir) Reject(r *Rejected) error {
+	e, err := newRejectEntry(r)
+	if err != nil {
+		return err
+	}
+	d.count++
+	name := filepath.Join(d.Dir, fmt.Sprintf("%06d", d.count))
+	if err := ioutil.WriteFile(name+".xml", []byte(e.XML+"\n"), 0666); err != nil {
+		return err
+	}
+	e.XML = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name+".json", append(b, '\n'), 0666)
+}
@@ -0,0 +1,127 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+// rejectsTestProcessor rejects entries without an id and fails on entries with an empty one.
+func rejectsTestProcessor(processed *[]string) xmlpicker.Processor {
+	return xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+		for _, a := range node.StartElement.Attr {
+			if a.Name.Local != "id" {
+				continue
+			}
+			if a.Value == "" {
+				return errors.New("output failed")
+			}
+			*processed = append(*processed, a.Value)
+			return nil
+		}
+		return &xmlpicker.RecordError{Stage: "validate", Err: errors.New("missing id"), Record: map[string]interface{}{"_name": "entry"}}
+	})
+}
+
+func processRejects(doc string, proc xmlpicker.Processor) error {
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+	for {
+		n, err := parser.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := proc.Process(n); err != nil {
+			return err
+		}
+	}
+}
+
+func TestRejectingProcessor(t *testing.T) {
+	for idx, test := range []struct {
+		xml         string
+		processed   []string
+		rejected    []string
+		expectedErr string
+	}{
+		{`<feed><entry id="1"/><entry/><entry id="2"><a/></entry><entry>x</entry></feed>`, []string{"1", "2"}, []string{"/feed/entry validate missing id", "/feed/entry validate missing id"}, ""},
+		{`<feed><entry/><entry id=""/><entry id="3"/></feed>`, nil, []string{"/feed/entry validate missing id"}, "output failed"},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.xml), func(t *testing.T) {
+			var processed, rejected []string
+			proc := &xmlpicker.RejectingProcessor{
+				Next: rejectsTestProcessor(&processed),
+				Sink: xmlpicker.RejectSinkFunc(func(r *xmlpicker.Rejected) error {
+					rejected = append(rejected, fmt.Sprintf("%s %s %s", r.Path, r.Stage, r.Err))
+					return nil
+				}),
+			}
+			err := processRejects(test.xml, proc)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectedErr)
+			}
+			assert.Equal(t, test.processed, processed)
+			assert.Equal(t, test.rejected, rejected)
+		})
+	}
+}
+
+func TestRejectWriter(t *testing.T) {
+	var processed []string
+	var b bytes.Buffer
+	offset := int64(0)
+	proc := &xmlpicker.RejectingProcessor{
+		Next: rejectsTestProcessor(&processed),
+		Sink: xmlpicker.NewRejectWriter(&b),
+		Locate: func(r *xmlpicker.Rejected) {
+			offset += 10
+			r.File, r.Offset = "feed.xml", offset
+		},
+	}
+	err := processRejects(`<feed xmlns:p="urn:p"><entry id="1"/><entry p:a="&lt;"><p:b>x</p:b></entry></feed>`, proc)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, processed)
+	assert.Equal(t, `{"file":"feed.xml","offset":10,"path":"/feed/entry","stage":"validate","error":"missing id","record":{"_name":"entry"},"xml":"<entry xmlns:p=\"urn:p\" p:a=\"&lt;\"><b xmlns=\"urn:p\">x</b></entry>"}`+"\n", b.String())
+}
+
+func TestRejectDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlpicker")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	var processed []string
+	proc := &xmlpicker.RejectingProcessor{
+		Next: rejectsTestProcessor(&processed),
+		Sink: &xmlpicker.RejectDir{Dir: dir},
+	}
+	assert.NoError(t, processRejects(`<feed><entry>a</entry><entry id="1"/><entry>b</entry></feed>`, proc))
+	actual := make(map[string]string)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		assert.NoError(t, err)
+		actual[f.Name()] = string(b)
+	}
+	assert.Equal(t, map[string]string{
+		"000001.xml":  "<entry>a</entry>\n",
+		"000001.json": `{"path":"/feed/entry","stage":"validate","error":"missing id","record":{"_name":"entry"}}` + "\n",
+		"000002.xml":  "<entry>b</entry>\n",
+		"000002.json": `{"path":"/feed/entry","stage":"validate","error":"missing id","record":{"_name":"entry"}}` + "\n",
+	}, actual)
+}
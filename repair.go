@@ -0,0 +1,78 @@
+package xmlpicker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Truncation is where a document that was cut short, such as the output of a run that crashed, stops being
+// well-formed.
+type Truncation struct {
+	// Offset is the length of the complete markup, what follows it is an incomplete token.
+	Offset int64
+	// Size is the length of the document.
+	Size int64
+	// Open are the names of the elements still open at Offset, outermost first, with the prefix as written in Space.
+	Open []xml.Name
+}
+
+// FindTruncation reads a document that may have been cut short and returns where its complete markup ends and which
+// elements are still open there. Cutting the document at Offset and appending EndTags makes it well-formed again.
+// Errors before the end of the document are reported as such, they cannot be repaired.
+func FindTruncation(r io.Reader) (*Truncation, error) {
+	br := bufio.NewReader(r)
+	d := xml.NewDecoder(br)
+	d.Strict = true
+	t := &Truncation{}
+	root := false
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// only an error at the very end of the document is a truncation
+			if n, _ := io.Copy(ioutil.Discard, br); n != 0 {
+				return nil, fmt.Errorf("xmlpicker: malformed before the end of the document: %s", err)
+			}
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if root && len(t.Open) == 0 {
+				return nil, fmt.Errorf("xmlpicker: second root element <%s> at offset %d", rawName(tok.Name).Local, t.Offset)
+			}
+			root = true
+			t.Open = append(t.Open, tok.Name)
+		case xml.EndElement:
+			if n := len(t.Open); n == 0 || t.Open[n-1] != tok.Name {
+				return nil, fmt.Errorf("xmlpicker: unexpected </%s> at offset %d", rawName(tok.Name).Local, t.Offset)
+			}
+			t.Open = t.Open[:len(t.Open)-1]
+		}
+		t.Offset = d.InputOffset()
+	}
+	if !root {
+		return nil, fmt.Errorf("xmlpicker: no root element before offset %d", t.Offset)
+	}
+	t.Size = d.InputOffset()
+	return t, nil
+}
+
+// Complete reports whether the document was not truncated.
+func (t *Truncation) Complete() bool {
+	return t.Offset == t.Size && len(t.Open) == 0
+}
+
+// EndTags returns the end tags of the open elements, innermost first.
+func (t *Truncation) EndTags() []byte {
+	var b bytes.Buffer
+	for i := len(t.Open) - 1; i >= 0; i-- {
+		b.WriteString("</" + rawName(t.Open[i]).Local + ">")
+	}
+	return b.Bytes()
+}
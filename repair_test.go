@@ -0,0 +1,112 @@
+package xmlpicker_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestFindTruncation(t *testing.T) {
+	for idx, test := range []struct {
+		name        string
+		doc         string
+		repaired    string
+		complete    bool
+		expectedErr string
+	}{
+		{
+			name:     "complete",
+			doc:      "<?xml version=\"1.0\"?>\n<a><b/></a>\n",
+			repaired: "<?xml version=\"1.0\"?>\n<a><b/></a>\n",
+			complete: true,
+		},
+		{
+			name:     "open elements",
+			doc:      `<feed><entry id="1">one</entry><entry id="2">`,
+			repaired: `<feed><entry id="1">one</entry><entry id="2"></entry></feed>`,
+		},
+		{
+			name:     "in text",
+			doc:      `<a><b>hello wor`,
+			repaired: `<a><b>hello wor</b></a>`,
+		},
+		{
+			name:     "in start tag",
+			doc:      `<a><b/><c x="1`,
+			repaired: `<a><b/></a>`,
+		},
+		{
+			name:     "in end tag",
+			doc:      `<a><b>x</b`,
+			repaired: `<a><b>x</b></a>`,
+		},
+		{
+			name:     "in entity",
+			doc:      `<a><b/>x&am`,
+			repaired: `<a><b/></a>`,
+		},
+		{
+			name:     "in comment",
+			doc:      `<a><!-- x`,
+			repaired: `<a></a>`,
+		},
+		{
+			name:     "in CDATA",
+			doc:      `<a><![CDATA[x`,
+			repaired: `<a></a>`,
+		},
+		{
+			name:     "in rune",
+			doc:      "<a>h\xc3",
+			repaired: `<a></a>`,
+		},
+		{
+			name:     "prefixes",
+			doc:      `<x:a xmlns:x="urn:x"><x:b><c>`,
+			repaired: `<x:a xmlns:x="urn:x"><x:b><c></c></x:b></x:a>`,
+		},
+		{
+			name:     "after the root",
+			doc:      "<a/>\n<",
+			repaired: "<a/>\n",
+		},
+		{
+			name:        "mismatched",
+			doc:         `<a><b></a>`,
+			expectedErr: "xmlpicker: unexpected </a> at offset 6",
+		},
+		{
+			name:        "malformed",
+			doc:         `<a><b x=1/></a>`,
+			expectedErr: "xmlpicker: malformed before the end of the document: XML syntax error on line 1: unquoted or missing attribute value in element",
+		},
+		{
+			name:        "second root",
+			doc:         `<a/><b>`,
+			expectedErr: "xmlpicker: second root element <b> at offset 4",
+		},
+		{
+			name:        "no root",
+			doc:         `<?xml version="1.0"?><a`,
+			expectedErr: "xmlpicker: no root element before offset 21",
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			truncation, err := xmlpicker.FindTruncation(strings.NewReader(test.doc))
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr, name)
+				return
+			}
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.Equal(t, int64(len(test.doc)), truncation.Size, name)
+			assert.Equal(t, test.complete, truncation.Complete(), name)
+			assert.Equal(t, test.repaired, test.doc[:truncation.Offset]+string(truncation.EndTags()), name)
+		})
+	}
+}
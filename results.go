@@ -0,0 +1,63 @@
+package xmlpicker
+
+import (
+	"context"
+	"io"
+)
+
+// Result is a node matched by Stream, detached from the document so that it can be used on any goroutine, along with
+// its mapped record when the Parser has a ResultMapper.
+type Result struct {
+	Node   *Node
+	Record map[string]interface{}
+	// Start and End are the Offsets of the node.
+	Start int64
+	End   int64
+}
+
+// Stream reads the document on a new goroutine and sends a Result for each node Next returns, until the end of the
+// document, an error or the cancellation of ctx. The results channel is closed once reading stops, after which the
+// errs channel receives the error that stopped it, if any, and is closed. The Parser must not be used while streaming.
+//
+// The nodes are detached with Node.Detach, so their Path starts at the node itself and ancestors are not shared
+// between results.
+func (p *Parser) Stream(ctx context.Context) (<-chan Result, <-chan error) {
+	results := make(chan Result)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		err := p.sendResults(ctx, results)
+		close(results)
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return results, errs
+}
+
+func (p *Parser) sendResults(ctx context.Context, results chan<- Result) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		node, err := p.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r := Result{Node: node.Detach()}
+		r.Start, r.End = p.Offsets()
+		if p.ResultMapper != nil {
+			if r.Record, err = p.ResultMapper.FromNode(node); err != nil {
+				return &RecordError{Stage: "map", Err: err}
+			}
+		}
+		select {
+		case results <- r:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
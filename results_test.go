@@ -0,0 +1,62 @@
+package xmlpicker_test
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestParserStream(t *testing.T) {
+	const doc = `<feed xmlns:x="urn:x"><x:entry id="1">one</x:entry><x:entry id="2">two</x:entry><x:entry id="3">three</x:entry></feed>`
+	newParser := func(doc string) *xmlpicker.Parser {
+		parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+		parser.NSFlag = xmlpicker.NSPrefix
+		return parser
+	}
+
+	t.Run("all", func(t *testing.T) {
+		parser := newParser(doc)
+		parser.ResultMapper = xmlpicker.SimpleMapper{}
+		results, errs := parser.Stream(context.Background())
+		var actual []string
+		for r := range results {
+			xml, err := exportNode(r.Node)
+			assert.NoError(t, err)
+			actual = append(actual, fmt.Sprintf("%d-%d %s %s", r.Start, r.End, xml, r.Record["@id"]))
+		}
+		assert.NoError(t, <-errs)
+		assert.Equal(t, []string{
+			`22-51 <x:entry id="1" xmlns:x="urn:x">one</x:entry> 1`,
+			`51-80 <x:entry id="2" xmlns:x="urn:x">two</x:entry> 2`,
+			`80-111 <x:entry id="3" xmlns:x="urn:x">three</x:entry> 3`,
+		}, actual)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		results, errs := newParser(doc).Stream(ctx)
+		r := <-results
+		assert.Equal(t, "one", deepText(r.Node))
+		cancel()
+		for range results {
+		}
+		assert.Equal(t, context.Canceled, <-errs)
+		_, ok := <-errs
+		assert.False(t, ok)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		results, errs := newParser(`<feed><entry/><entry>`).Stream(context.Background())
+		count := 0
+		for range results {
+			count++
+		}
+		assert.Equal(t, 1, count)
+		assert.Equal(t, xmlpicker.ErrUnexpectedEOF, <-errs)
+	})
+}
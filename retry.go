@@ -0,0 +1,130 @@
+package xmlpicker
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryingProcessor passes nodes to Next and calls it again, with exponential backoff, when it fails with an error
+// worth retrying, such as a timeout of an output on the network.
+type RetryingProcessor struct {
+	Next Processor
+	// Attempts is the maximum number of calls for each node, values below 1 mean a single call.
+	Attempts int
+	// Backoff is the delay before the first retry, it is doubled for each retry after it up to MaxBackoff if set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable optionally reports whether an error is worth retrying, by default every error but a RecordError is.
+	Retryable func(err error) bool
+	// Sleep optionally replaces time.Sleep.
+	Sleep func(d time.Duration)
+}
+
+func (p *RetryingProcessor) Process(node *Node) error {
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := p.Next.Process(node)
+		if err == nil || attempt >= p.Attempts || !p.retryable(err) {
+			return err
+		}
+		sleep(backoff)
+		backoff *= 2
+		if p.MaxBackoff != 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+func (p *RetryingProcessor) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	_, ok := err.(*RecordError)
+	return !ok
+}
+
+// RateLimitedProcessor passes nodes to Next at no more than Rate nodes per second, waiting as needed, so that bulk
+// loads do not overwhelm the system they are written to. Process may be called from several goroutines.
+type RateLimitedProcessor struct {
+	Next Processor
+	Rate float64
+	// Now and Sleep optionally replace time.Now and time.Sleep.
+	Now   func() time.Time
+	Sleep func(d time.Duration)
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (p *RateLimitedProcessor) Process(node *Node) error {
+	p.Wait()
+	return p.Next.Process(node)
+}
+
+// Wait blocks until the next node may be passed on, for callers that limit the rate of something other than calls to
+// Next.
+func (p *RateLimitedProcessor) Wait() {
+	if p.Rate <= 0 {
+		return
+	}
+	now, sleep := p.Now, p.Sleep
+	if now == nil {
+		now = time.Now
+	}
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	// the caller is given the next slot and waits for it outside of the lock
+	p.mu.Lock()
+	t := now()
+	if t.After(p.next) {
+		p.next = t
+	}
+	wait := p.next.Sub(t)
+	p.next = p.next.Add(time.Duration(float64(time.Second) / p.Rate))
+	p.mu.Unlock()
+	if wait > 0 {
+		sleep(wait)
+	}
+}
+
+// ConcurrencyLimitedProcessor passes nodes to Next from no more than Limit goroutines at a time, the calls of the
+// others wait for one of them to return, so that parallel writers do not have more requests in flight than the system
+// they are written to accepts. A Limit below 1 does not limit the calls. Limit must not change once Process is called.
+type ConcurrencyLimitedProcessor struct {
+	Next  Processor
+	Limit int
+
+	once  sync.Once
+	slots chan struct{}
+}
+
+func (p *ConcurrencyLimitedProcessor) Process(node *Node) error {
+	p.Acquire()
+	defer p.Release()
+	return p.Next.Process(node)
+}
+
+// Acquire blocks until fewer than Limit callers hold a slot and takes one, for callers that limit the concurrency of
+// something other than calls to Next. Each Acquire must be followed by a Release.
+func (p *ConcurrencyLimitedProcessor) Acquire() {
+	if p.Limit < 1 {
+		return
+	}
+	p.once.Do(func() {
+		p.slots = make(chan struct{}, p.Limit)
+	})
+	p.slots <- struct{}{}
+}
+
+// Release frees the slot taken by Acquire.
+func (p *ConcurrencyLimitedProcessor) Release() {
+	if p.Limit < 1 {
+		return
+	}
+	<-p.slots
+}
@@ -0,0 +1,136 @@
+package xmlpicker_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestRetryingProcessor(t *testing.T) {
+	timeout := errors.New("timeout")
+	invalid := &xmlpicker.RecordError{Stage: "encode", Err: errors.New("invalid")}
+	for idx, test := range []struct {
+		failures    []error
+		attempts    int
+		calls       int
+		sleeps      []time.Duration
+		expectedErr error
+	}{
+		{nil, 3, 1, nil, nil},
+		{[]error{timeout, timeout}, 3, 3, []time.Duration{10, 20}, nil},
+		{[]error{timeout, timeout, timeout, timeout}, 4, 4, []time.Duration{10, 20, 25}, timeout},
+		{[]error{timeout}, 0, 1, nil, timeout},
+		{[]error{invalid}, 3, 1, nil, invalid},
+	} {
+		t.Run(fmt.Sprintf("%d %v", idx, test.failures), func(t *testing.T) {
+			calls := 0
+			var sleeps []time.Duration
+			p := &xmlpicker.RetryingProcessor{
+				Next: xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+					calls++
+					if calls <= len(test.failures) {
+						return test.failures[calls-1]
+					}
+					return nil
+				}),
+				Attempts:   test.attempts,
+				Backoff:    10,
+				MaxBackoff: 25,
+				Sleep: func(d time.Duration) {
+					sleeps = append(sleeps, d)
+				},
+			}
+			err := p.Process(&xmlpicker.Node{})
+			assert.Equal(t, test.expectedErr, err)
+			assert.Equal(t, test.calls, calls)
+			assert.Equal(t, test.sleeps, sleeps)
+		})
+	}
+}
+
+func TestRateLimitedProcessor(t *testing.T) {
+	now := time.Unix(0, 0)
+	var sleeps []time.Duration
+	calls := 0
+	p := &xmlpicker.RateLimitedProcessor{
+		Next: xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+			calls++
+			return nil
+		}),
+		Rate: 4,
+		Now: func() time.Time {
+			return now
+		},
+		Sleep: func(d time.Duration) {
+			sleeps = append(sleeps, d)
+			now = now.Add(d)
+		},
+	}
+	for _, elapsed := range []time.Duration{0, 100, 0, 600, 0} {
+		now = now.Add(elapsed * time.Millisecond)
+		assert.NoError(t, p.Process(&xmlpicker.Node{}))
+	}
+	assert.Equal(t, 5, calls)
+	assert.Equal(t, []time.Duration{150 * time.Millisecond, 250 * time.Millisecond, 250 * time.Millisecond}, sleeps)
+}
+
+func TestConcurrencyLimitedProcessor(t *testing.T) {
+	for idx, test := range []struct {
+		limit    int
+		expected int
+	}{
+		{limit: 2, expected: 2},
+		{limit: 1, expected: 1},
+		{limit: 0, expected: 6},
+	} {
+		name := fmt.Sprintf("%d limit %d", idx, test.limit)
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			running, max := 0, 0
+			release := make(chan struct{})
+			started := make(chan struct{}, 6)
+			p := &xmlpicker.ConcurrencyLimitedProcessor{
+				Next: xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+					mu.Lock()
+					running++
+					if running > max {
+						max = running
+					}
+					mu.Unlock()
+					started <- struct{}{}
+					<-release
+					mu.Lock()
+					running--
+					mu.Unlock()
+					return nil
+				}),
+				Limit: test.limit,
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, p.Process(&xmlpicker.Node{}), name)
+				}()
+			}
+			// the calls are let through one at a time once as many as the limit allows are running
+			for i := 0; i < 6; i++ {
+				<-started
+				if i+1 >= test.expected {
+					release <- struct{}{}
+				}
+			}
+			for i := test.expected - 1; i > 0; i-- {
+				release <- struct{}{}
+			}
+			wg.Wait()
+			assert.Equal(t, test.expected, max, name)
+		})
+	}
+}
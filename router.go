@@ -0,0 +1,59 @@
+package xmlpicker
+
+// Route is a selector and the processor of the nodes it matches.
+type Route struct {
+	Selector  Selector
+	Processor Processor
+}
+
+// Router is a Selector that matches the nodes of any of its routes, so that a single parse of a document serves
+// several selectors. Process passes each node to the routes that match it and, as a route matches a node rather than
+// the nodes within it, the nodes within it to the other routes that match them.
+type Router struct {
+	Routes []Route
+}
+
+func (r *Router) Matches(node *Node) bool {
+	for _, route := range r.Routes {
+		if route.Selector.Matches(node) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) selectors() []Selector {
+	selectors := make([]Selector, len(r.Routes))
+	for i, route := range r.Routes {
+		selectors[i] = route.Selector
+	}
+	return selectors
+}
+
+// Process passes node, which the Router matched, to its routes.
+func (r *Router) Process(node *Node) error {
+	for _, route := range r.Routes {
+		if err := route.process(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process passes node to the route if it matches, or else the nodes within it that do.
+func (route Route) process(node *Node) error {
+	if route.Selector.Matches(node) {
+		if s, ok := route.Selector.(SubtreeSelector); !ok || s.MatchesSubtree(node) {
+			return route.Processor.Process(node)
+		}
+	}
+	for _, c := range node.Children {
+		if _, ok := c.Text(); ok {
+			continue
+		}
+		if err := route.process(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestRouter(t *testing.T) {
+	const doc = `<feed><product id="1"><offer id="a"/><offer id="b"/></product><offer id="c"/><product id="2"><name>x</name></product></feed>`
+	for idx, test := range []struct {
+		selectors []string
+		expected  [][]string
+	}{
+		{[]string{"/feed/product", "/feed/offer"}, [][]string{{"1", "2"}, {"c"}}},
+		{[]string{"/feed/product", "offer"}, [][]string{{"1", "2"}, {"a", "b", "c"}}},
+		{[]string{"/feed/product[name = 'x']", "/feed/product/offer"}, [][]string{{"2"}, {"a", "b"}}},
+		{[]string{"/", "/feed/product/name"}, [][]string{{""}, {""}}},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, strings.Join(test.selectors, " ")), func(t *testing.T) {
+			router := &xmlpicker.Router{}
+			actual := make([][]string, len(test.selectors))
+			for i, s := range test.selectors {
+				selector, err := xmlpicker.ParsePathSelector(s)
+				if !assert.NoError(t, err) {
+					return
+				}
+				i := i
+				router.Routes = append(router.Routes, xmlpicker.Route{
+					Selector: selector,
+					Processor: xmlpicker.ProcessorFunc(func(node *xmlpicker.Node) error {
+						id := ""
+						for _, a := range node.StartElement.Attr {
+							if a.Name.Local == "id" {
+								id = a.Value
+							}
+						}
+						actual[i] = append(actual[i], id)
+						return nil
+					}),
+				})
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), router)
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.NoError(t, router.Process(n))
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestRouterLast(t *testing.T) {
+	for idx, selector := range []xmlpicker.Selector{
+		&xmlpicker.Router{Routes: []xmlpicker.Route{{Selector: xmlpicker.PathSelector("/r/other")}, {Selector: xmlpicker.PathSelector("/r/row[last()]")}}},
+		&xmlpicker.EveryNth{Selector: xmlpicker.PathSelector("/r/row[last()]"), N: 1},
+		&xmlpicker.After{Selector: xmlpicker.PathSelector("/r/row"), Marker: xmlpicker.PathSelector("/r/row[last()]")},
+		xmlpicker.NewCoverage(xmlpicker.PathSelector("/r/row[last()]")),
+	} {
+		t.Run(fmt.Sprintf("%d %T", idx, selector), func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(`<r><row/><row/><row/></r>`)), selector)
+			_, err := parser.Next()
+			assert.EqualError(t, err, `xmlpicker: last() is only supported when the path is the selector of the Parser, not within another selector, in "/r/row[last()]"`)
+		})
+	}
+	parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(`<r><row/><row/><row/></r>`)), xmlpicker.PathSelector("/r/row"))
+	parser.Ignore = []xmlpicker.Selector{xmlpicker.PathSelector("/r/row[last()]")}
+	_, err := parser.Next()
+	assert.EqualError(t, err, `xmlpicker: last() is only supported when the path is the selector of the Parser, not within another selector, in "/r/row[last()]"`)
+}
@@ -0,0 +1,126 @@
+package xmlpicker
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SchemaMapper maps nodes using the declarations of a Schema. Text and attribute values are converted to JSON numbers
+// and booleans as their type requires, dates and other values are kept as strings. Elements that may be repeated are
+// mapped to lists and the others to a single value, a simple type element without attributes to its value and any
+// other element to an object. Elements the schema does not declare are mapped as by SimpleMapper.
+type SchemaMapper struct {
+	Schema *Schema
+}
+
+func (m SchemaMapper) FromNode(node *Node) (map[string]interface{}, error) {
+	simple := SimpleMapper{}
+	for n := node; n != nil; n = n.Parent {
+		if n.Namespaces != nil {
+			simple.hasNS = true
+			break
+		}
+	}
+	e := m.Schema.element(node)
+	if e == nil || e.typ == nil {
+		return simple.FromNode(node)
+	}
+	out := map[string]interface{}{"_name": node.StartElement.Name.Local}
+	if node.StartElement.Name.Space != "" {
+		out["_namespace"] = node.StartElement.Name.Space
+	}
+	value := m.fromNode(simple, node, e.typ)
+	if obj, ok := value.(map[string]interface{}); ok {
+		for k, v := range obj {
+			out[k] = v
+		}
+	} else {
+		out["#text"] = value
+	}
+	return out, nil
+}
+
+// fromNode returns the value of a simple type element without attributes, or the object of any other element.
+func (m SchemaMapper) fromNode(simple SimpleMapper, node *Node, t *schemaType) interface{} {
+	if t.children == nil && len(node.StartElement.Attr) == 0 && len(node.Namespaces) == 0 {
+		text, _ := ownText(node)
+		return convertValue(text, t.value)
+	}
+	out := make(map[string]interface{})
+	if len(node.Namespaces) != 0 {
+		out["_namespaces"] = node.Namespaces
+	}
+	for _, a := range node.StartElement.Attr {
+		key := "@" + a.Name.Local
+		if a.Name.Space != "" {
+			if simple.hasNS {
+				key = "@" + a.Name.Space + ":" + a.Name.Local
+			} else {
+				key = "@" + a.Name.Local + " " + a.Name.Space
+			}
+			out[key] = a.Value
+			continue
+		}
+		if kind, ok := t.attrs[a.Name.Local]; ok {
+			out[key] = convertValue(a.Value, kind)
+		} else {
+			out[key] = a.Value
+		}
+	}
+	var texts []string
+	for _, c := range node.Children {
+		if text, ok := c.Text(); ok {
+			texts = append(texts, text)
+			continue
+		}
+		key := simple.childKey(c)
+		var value interface{}
+		e, ok := t.children[c.StartElement.Name.Local]
+		if ok && e.typ != nil {
+			value = m.fromNode(simple, c, e.typ)
+		} else {
+			value, _ = simple.fromNodeImpl(make(map[string]interface{}), c, 1)
+		}
+		if ok && !e.repeated {
+			out[key] = value
+			continue
+		}
+		values, _ := out[key].([]interface{})
+		out[key] = append(values, value)
+	}
+	if texts != nil {
+		if t.value == noValue || t.mixed {
+			out["#text"] = texts
+		} else {
+			out["#text"] = convertValue(strings.Join(texts, ""), t.value)
+		}
+	}
+	return out
+}
+
+// convertValue converts text to a JSON number or boolean as required by kind, text that is not valid for its type is
+// kept as a string.
+func convertValue(text string, kind valueKind) interface{} {
+	s := strings.TrimSpace(text)
+	switch kind {
+	case numberValue:
+		var f float64
+		if json.Unmarshal([]byte(s), &f) == nil {
+			return json.Number(s)
+		}
+		// valid in a schema but not in JSON, e.g. "+1", "007" or "1."
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case booleanValue:
+		switch s {
+		case "true", "1":
+			return true
+		case "false", "0":
+			return false
+		}
+	}
+	return text
+}
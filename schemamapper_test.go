@@ -0,0 +1,121 @@
+package xmlpicker_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+const testSchema = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+	<xs:include schemaLocation="types.xsd"/>
+	<xs:element name="feed">
+		<xs:complexType>
+			<xs:sequence>
+				<xs:element name="title" type="xs:string"/>
+				<xs:element ref="entry" minOccurs="0" maxOccurs="unbounded"/>
+			</xs:sequence>
+		</xs:complexType>
+	</xs:element>
+	<xs:element name="entry" type="entryType"/>
+	<xs:complexType name="entryType">
+		<xs:sequence>
+			<xs:element name="price" type="priceType"/>
+			<xs:element name="quantity" type="xs:int"/>
+			<xs:element name="available" type="xs:boolean"/>
+			<xs:element name="updated" type="xs:dateTime"/>
+			<xs:choice maxOccurs="unbounded">
+				<xs:element name="tag" type="xs:string"/>
+				<xs:element name="note" type="noteType"/>
+			</xs:choice>
+		</xs:sequence>
+		<xs:attribute name="id" type="xs:long"/>
+		<xs:attribute name="code" type="xs:string"/>
+	</xs:complexType>
+</xs:schema>`
+
+const testSchemaTypes = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+	<xs:simpleType name="amount">
+		<xs:restriction base="xs:decimal"><xs:minInclusive value="0"/></xs:restriction>
+	</xs:simpleType>
+	<xs:complexType name="priceType">
+		<xs:simpleContent>
+			<xs:extension base="amount">
+				<xs:attribute name="currency" type="xs:string"/>
+			</xs:extension>
+		</xs:simpleContent>
+	</xs:complexType>
+	<xs:complexType name="noteType" mixed="true">
+		<xs:sequence><xs:element name="b" type="xs:string" minOccurs="0" maxOccurs="unbounded"/></xs:sequence>
+	</xs:complexType>
+</xs:schema>`
+
+func TestSchemaMapper(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"feed.xsd": testSchema, "types.xsd": testSchemaTypes})
+	defer os.RemoveAll(dir)
+	schema, err := xmlpicker.LoadSchema(filepath.Join(dir, "feed.xsd"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for idx, test := range []struct {
+		selector string
+		xml      string
+		expected string
+	}{
+		{
+			selector: "/feed/entry",
+			xml:      `<feed><title>t</title><entry id="12345678901234567890" code="007"><price currency="EUR">+1.50</price><quantity>007</quantity><available>1</available><updated>2017-01-02T03:04:05Z</updated><tag>a</tag><note>see <b>this</b></note><tag>b</tag><extra>x</extra></entry></feed>`,
+			expected: `{"@code":"007","@id":12345678901234567890,"_name":"entry","available":true,"extra":[{"#text":["x"]}],"note":[{"#text":["see"],"b":["this"]}],"price":{"#text":1.5,"@currency":"EUR"},"quantity":7,"tag":["a","b"],"updated":"2017-01-02T03:04:05Z"}`,
+		},
+		{
+			selector: "/feed/entry",
+			xml:      `<feed><entry><quantity>many</quantity><available>maybe</available></entry></feed>`,
+			expected: `{"_name":"entry","available":"maybe","quantity":"many"}`,
+		},
+		{
+			selector: "/feed/title",
+			xml:      `<feed><title>t</title></feed>`,
+			expected: `{"#text":"t","_name":"title"}`,
+		},
+		{
+			selector: "/",
+			xml:      `<feed><title>t</title><entry><quantity>1</quantity></entry></feed>`,
+			expected: `{"_name":"feed","entry":[{"quantity":1}],"title":"t"}`,
+		},
+		{
+			selector: "/other",
+			xml:      `<other><a>1</a></other>`,
+			expected: `{"_name":"other","a":[{"#text":["1"]}]}`,
+		},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.selector), func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			mapper := xmlpicker.SchemaMapper{Schema: schema}
+			var actual []string
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				v, err := mapper.FromNode(n)
+				if !assert.NoError(t, err) {
+					return
+				}
+				b, err := json.Marshal(v)
+				assert.NoError(t, err)
+				actual = append(actual, string(b))
+			}
+			assert.Equal(t, []string{test.expected}, actual)
+		})
+	}
+}
@@ -1,79 +1,407 @@
 package xmlpicker
 
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// Mapper maps a node and its descendants to a JSON compatible value.
 type Mapper interface {
 	FromNode(node *Node) (map[string]interface{}, error)
 }
 
+// SimpleMapper maps a node to an object with its attributes prefixed by "@", its text under "#text" and its children
+// grouped by name. Elements whose child elements were left out by Parser.CollectDepth have "#truncated": true.
+//
+// With MixedContent, elements that have both text and child elements are mapped to an ordered "#content" list of
+// strings and child objects, with their "_name", instead, so that the interleaving of text and elements is kept. The
+// strings keep their surrounding whitespace when it is collected with Parser.PreserveSpace, e.g. "hello " in
+// <a>hello <b>fred</b></a>, the text of other elements is trimmed.
+//
+// Child elements matched by one of the InnerXML selectors are mapped to their content serialized as XML, under their
+// name with an "_html" suffix, e.g. "description_html": "<p>...</p>". The content of repeated elements is kept in a
+// list. The whitespace of the content is only kept as written when it is collected with Parser.PreserveSpace.
+//
+// With FlattenText, child elements that only have text, and no attributes or namespace declarations, are mapped to
+// their text, e.g. "title": "Foo" rather than "title": [{"#text": ["Foo"]}], unless they match one of the NoFlatten
+// selectors. Repeated elements are kept in a list.
+//
+// With Positions, child objects have their position among the siblings of the same name under "_pos", counted from 1
+// as in the [n] predicates of XPath.
+//
+// With InScopeNamespaces, the object of the node maps all the prefixes in scope at it, wherever they were declared,
+// to their namespace under "_xmlns", so that prefixed names and values can be resolved without the document.
 type SimpleMapper struct {
+	MixedContent      bool
+	InnerXML          []Selector
+	FlattenText       bool
+	NoFlatten         []Selector
+	Positions         bool
+	InScopeNamespaces bool
+
 	hasNS bool
+	// ordered maps every element as MixedContent maps mixed ones, for OrderedMapper
+	ordered bool
 }
 
 func (m SimpleMapper) FromNode(node *Node) (map[string]interface{}, error) {
-	m.hasNS = false
-	for n := node; n != nil; n = n.Parent {
-		if n.Namespaces != nil {
-			m.hasNS = true
-			break
-		}
+	s := m.NewStream()
+	if err := StreamNode(node, s); err != nil {
+		return nil, err
 	}
-	out := make(map[string]interface{})
-	return m.fromNodeImpl(out, node, 0)
+	return s.Value(), nil
 }
 
+// fromNodeImpl maps node into out as the element at depth, with the namespace mode of m.
 func (m SimpleMapper) fromNodeImpl(out map[string]interface{}, node *Node, depth int) (map[string]interface{}, error) {
-	if text, ok := node.Text(); ok {
-		out["#text"] = []string{text}
-		return out, nil
+	s := &SimpleStream{mapper: m, depth: depth, out: out}
+	if err := StreamNode(node, s); err != nil {
+		return nil, err
+	}
+	return s.Value(), nil
+}
+
+// NewStream returns a StreamMapper that maps the events of a node as FromNode maps the node.
+func (m SimpleMapper) NewStream() *SimpleStream {
+	return &SimpleStream{mapper: m, scan: true}
+}
+
+// SimpleStream builds the value of a SimpleMapper from the events of a node without keeping the node. Only the
+// elements matched by InnerXML are collected, until they end.
+type SimpleStream struct {
+	mapper SimpleMapper
+	// scan is set when the namespace mode is taken from the ancestors of the node, depth and out seed the first frame
+	scan   bool
+	depth  int
+	out    map[string]interface{}
+	frames []*simpleFrame
+	value  map[string]interface{}
+	// collect is the copy of the element matched by InnerXML being collected and collectDepth its depth below the
+	// matched element
+	collect      *Node
+	collectDepth int
+}
+
+// simpleFrame is an element being mapped.
+type simpleFrame struct {
+	node    *Node
+	out     map[string]interface{}
+	hasNS   bool
+	depth   int
+	items   []simpleItem
+	text    bool
+	element bool
+	// positions counts the children of the element by key
+	positions map[string]int
+}
+
+// simpleItem is a child of an element being mapped, in document order.
+type simpleItem struct {
+	key   string
+	text  string
+	value map[string]interface{}
+	// isText is set for text, flat when value can be flattened to text and collected holds an InnerXML element at
+	// position pos
+	isText    bool
+	flat      bool
+	collected *Node
+	pos       int
+}
+
+// Value returns the value of the last node that ended.
+func (s *SimpleStream) Value() map[string]interface{} {
+	return s.value
+}
+
+func (s *SimpleStream) Start(node *Node) error {
+	if s.collect != nil {
+		c := node.copyNode(s.collect)
+		c.Children = make([]*Node, 0)
+		s.collect.Children = append(s.collect.Children, c)
+		s.collect = c
+		s.collectDepth = s.collectDepth + 1
+		return nil
+	}
+	f := &simpleFrame{node: node, out: make(map[string]interface{}), depth: s.depth}
+	if n := len(s.frames); n == 0 {
+		f.hasNS = s.mapper.hasNS
+		if s.scan {
+			f.hasNS = false
+			for a := node; a != nil; a = a.Parent {
+				if a.Namespaces != nil {
+					f.hasNS = true
+					break
+				}
+			}
+		}
+		if s.out != nil {
+			f.out = s.out
+		}
+	} else {
+		parent := s.frames[n-1]
+		parent.element = true
+		f.hasNS = parent.hasNS
+		f.depth = parent.depth + 1
+		key := s.childKey(parent, node)
+		if s.mapper.Positions {
+			if parent.positions == nil {
+				parent.positions = make(map[string]int)
+			}
+			parent.positions[key] = parent.positions[key] + 1
+			f.out["_pos"] = parent.positions[key]
+		}
+		if s.mapper.isInnerXML(node) {
+			s.collect = node.copyNode(node.Parent)
+			s.collect.Children = make([]*Node, 0)
+			s.collectDepth = 0
+			parent.items = append(parent.items, simpleItem{key: key, collected: s.collect, pos: parent.positions[key]})
+			return nil
+		}
 	}
-	if depth == 0 {
-		out["_name"] = node.StartElement.Name.Local
+	if f.depth == 0 {
+		f.out["_name"] = node.StartElement.Name.Local
 		if node.StartElement.Name.Space != "" {
-			out["_namespace"] = node.StartElement.Name.Space
+			f.out["_namespace"] = node.StartElement.Name.Space
+		}
+		if s.mapper.InScopeNamespaces {
+			xmlns := node.InScopeNamespaces()
+			delete(xmlns, "xml")
+			f.out["_xmlns"] = xmlns
 		}
 	}
 	if node.Namespaces != nil {
-		m.hasNS = true
-		out["_namespaces"] = node.Namespaces
+		f.hasNS = true
+		f.out["_namespaces"] = node.Namespaces
 	}
-	for _, a := range node.StartElement.Attr {
-		var key string
-		if a.Name.Space == "" {
-			key = "@" + a.Name.Local
-		} else if m.hasNS {
-			key = "@" + a.Name.Space + ":" + a.Name.Local
+	s.frames = append(s.frames, f)
+	return nil
+}
+
+func (s *SimpleStream) Attr(a xml.Attr) error {
+	if s.collect != nil || len(s.frames) == 0 {
+		return nil
+	}
+	f := s.frames[len(s.frames)-1]
+	var key string
+	if a.Name.Space == "" {
+		key = "@" + a.Name.Local
+	} else if f.hasNS {
+		key = "@" + a.Name.Space + ":" + a.Name.Local
+	} else {
+		key = "@" + a.Name.Local + " " + a.Name.Space
+	}
+	f.out[key] = a.Value
+	return nil
+}
+
+func (s *SimpleStream) Text(text string) error {
+	if s.collect != nil {
+		c := &Node{Parent: s.collect}
+		c.SetText(text)
+		s.collect.Children = append(s.collect.Children, c)
+		return nil
+	}
+	if len(s.frames) == 0 {
+		s.value = map[string]interface{}{"#text": []string{strings.TrimSpace(text)}}
+		return nil
+	}
+	f := s.frames[len(s.frames)-1]
+	f.text = true
+	f.items = append(f.items, simpleItem{text: text, isText: true})
+	return nil
+}
+
+func (s *SimpleStream) End(node *Node) error {
+	if s.collect != nil {
+		s.collect.Truncated = node.Truncated
+		if s.collectDepth == 0 {
+			s.collect = nil
 		} else {
-			key = "@" + a.Name.Local + " " + a.Name.Space
+			s.collect = s.collect.Parent
+			s.collectDepth = s.collectDepth - 1
 		}
-		out[key] = a.Value
+		return nil
 	}
-	for _, c := range node.Children {
+	f := s.frames[len(s.frames)-1]
+	s.frames = s.frames[:len(s.frames)-1]
+	if err := s.finish(f); err != nil {
+		return err
+	}
+	if len(s.frames) == 0 {
+		s.value = f.out
+		return nil
+	}
+	parent := s.frames[len(s.frames)-1]
+	parent.items = append(parent.items, simpleItem{key: s.childKey(parent, node), value: f.out, flat: s.flat(f)})
+	return nil
+}
+
+// childKey returns the key of the child node of f.
+func (s *SimpleStream) childKey(f *simpleFrame, node *Node) string {
+	m := s.mapper
+	m.hasNS = f.hasNS
+	return m.childKey(node)
+}
+
+// flat reports whether FlattenText applies to the element of f.
+func (s *SimpleStream) flat(f *simpleFrame) bool {
+	node := f.node
+	if !s.mapper.FlattenText || len(node.StartElement.Attr) != 0 || len(node.Namespaces) != 0 || len(f.items) == 0 || node.Truncated {
+		return false
+	}
+	for _, item := range f.items {
+		if !item.isText {
+			return false
+		}
+	}
+	for _, sel := range s.mapper.NoFlatten {
+		if sel.Matches(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// finish adds the children of the element of f to its object.
+func (s *SimpleStream) finish(f *simpleFrame) error {
+	if f.node.Truncated {
+		f.out["#truncated"] = true
+	}
+	if s.mapper.ordered || s.mapper.MixedContent && f.text && f.element {
+		return s.finishMixed(f)
+	}
+	var flattened map[string]bool
+	for _, item := range f.items {
 		var key string
 		var value interface{}
-		if text, ok := c.Text(); ok {
+		if item.isText {
 			key = "#text"
-			value = text
-		} else {
-			if c.StartElement.Name.Space == "" {
-				key = c.StartElement.Name.Local
-			} else if m.hasNS {
-				key = c.StartElement.Name.Space + ":" + c.StartElement.Name.Local
-			} else {
-				key = c.StartElement.Name.Local + " " + c.StartElement.Name.Space
+			value = strings.TrimSpace(item.text)
+		} else if item.collected != nil {
+			if err := addInnerXML(f.out, item.key, item.collected); err != nil {
+				return err
 			}
-			var err error
-			value, err = m.fromNodeImpl(make(map[string]interface{}), c, depth+1)
-			if err != nil {
-				return nil, err
+			continue
+		} else if item.flat {
+			key = item.key
+			value = flatText(item.value)
+			if flattened == nil {
+				flattened = make(map[string]bool)
 			}
+			flattened[key] = true
+		} else {
+			key = item.key
+			value = item.value
 		}
 		var values []interface{}
-		if prev, ok := out[key]; ok {
+		if prev, ok := f.out[key]; ok {
 			values = prev.([]interface{})
 		} else {
 			values = make([]interface{}, 0)
-			out[key] = values
+			f.out[key] = values
+		}
+		f.out[key] = append(values, value)
+	}
+	for key := range flattened {
+		if values := f.out[key].([]interface{}); len(values) == 1 {
+			if s, ok := values[0].(string); ok {
+				f.out[key] = s
+			}
+		}
+	}
+	return nil
+}
+
+// flatText returns the text of the object of an element that only has text.
+func flatText(out map[string]interface{}) string {
+	var b bytes.Buffer
+	for _, v := range out["#text"].([]interface{}) {
+		b.WriteString(v.(string))
+	}
+	return b.String()
+}
+
+// finishMixed maps the children of the element of f to an ordered "#content" list.
+func (s *SimpleStream) finishMixed(f *simpleFrame) error {
+	content := make([]interface{}, 0, len(f.items))
+	for _, item := range f.items {
+		if item.isText {
+			if f.element {
+				content = append(content, item.text)
+			} else {
+				content = append(content, strings.TrimSpace(item.text))
+			}
+			continue
+		}
+		value := item.value
+		if item.collected != nil {
+			m := s.mapper
+			m.hasNS = f.hasNS
+			var err error
+			if value, err = m.fromNodeImpl(make(map[string]interface{}), item.collected, f.depth+1); err != nil {
+				return err
+			}
+			if s.mapper.Positions {
+				value["_pos"] = item.pos
+			}
+		}
+		value["_name"] = item.key
+		content = append(content, value)
+	}
+	f.out["#content"] = content
+	return nil
+}
+
+func (m SimpleMapper) childKey(c *Node) string {
+	if c.StartElement.Name.Space == "" {
+		return c.StartElement.Name.Local
+	} else if m.hasNS {
+		return c.StartElement.Name.Space + ":" + c.StartElement.Name.Local
+	}
+	return c.StartElement.Name.Local + " " + c.StartElement.Name.Space
+}
+
+func (m SimpleMapper) isInnerXML(node *Node) bool {
+	for _, s := range m.InnerXML {
+		if s.Matches(node) {
+			return true
 		}
-		out[key] = append(values, value)
 	}
-	return out, nil
+	return false
+}
+
+// addInnerXML adds the content of node serialized as XML under key with an "_html" suffix, the content of repeated
+// elements is added to a list.
+func addInnerXML(out map[string]interface{}, key string, node *Node) error {
+	key = key + "_html"
+	s, err := innerXML(node)
+	if err != nil {
+		return err
+	}
+	switch prev := out[key].(type) {
+	case nil:
+		out[key] = s
+	case string:
+		out[key] = []interface{}{prev, s}
+	default:
+		out[key] = append(prev.([]interface{}), s)
+	}
+	return nil
+}
+
+// innerXML returns the children of node serialized as XML, the namespaces declared by its ancestors are in scope.
+func innerXML(node *Node) (string, error) {
+	var b bytes.Buffer
+	e := &XMLExporter{Encoder: xml.NewEncoder(&b)}
+	for _, c := range node.Children {
+		// each child declares the namespaces it inherits
+		if err := e.EncodeNode(c.Detach()); err != nil {
+			return "", err
+		}
+	}
+	if err := e.Encoder.Flush(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
@@ -15,12 +15,20 @@ import (
 
 func TestSimpleMapper(t *testing.T) {
 	for idx, test := range []struct {
-		name        string
-		selector    string
-		xml         string
-		nsFlag      xmlpicker.NSFlag
-		expected    string
-		expectedErr string
+		name          string
+		selector      string
+		xml           string
+		nsFlag        xmlpicker.NSFlag
+		preserveSpace bool
+		mixed         bool
+		innerXML      []string
+		flatten       bool
+		noFlatten     []string
+		positions     bool
+		xmlns         bool
+		depth         int
+		expected      string
+		expectedErr   string
 	}{
 		{
 			name:     "control",
@@ -76,6 +84,117 @@ func TestSimpleMapper(t *testing.T) {
 			selector: "/",
 			expected: `{"#text":["hello","and"],"_name":"a","b":[{"#text":["fred"]},{"#text":["wilma"]}]}`,
 		},
+		{
+			name:          "mixed text and children with preserved space",
+			xml:           `<a> hello <b> fred </b> and <b>wilma</b></a>`,
+			selector:      "/",
+			preserveSpace: true,
+			expected:      `{"#text":["hello","and"],"_name":"a","b":[{"#text":["fred"]},{"#text":["wilma"]}]}`,
+		},
+		{
+			name:          "mixed content",
+			xml:           `<a id="1">hello <b>fred</b> and <b>wilma <i>flintstone</i></b><c> <d> x </d></c></a>`,
+			selector:      "/",
+			preserveSpace: true,
+			mixed:         true,
+			expected:      `{"#content":["hello ",{"#text":["fred"],"_name":"b"}," and ",{"#content":["wilma ",{"#text":["flintstone"],"_name":"i"}],"_name":"b"},{"_name":"c","d":[{"#text":["x"]}]}],"@id":"1","_name":"a"}`,
+		},
+		{
+			name:     "mixed content without preserved space",
+			xml:      `<a>hello <b>fred</b> and <b>wilma</b></a>`,
+			selector: "/",
+			mixed:    true,
+			expected: `{"#content":["hello",{"#text":["fred"],"_name":"b"},"and",{"#text":["wilma"],"_name":"b"}],"_name":"a"}`,
+		},
+		{
+			name:     "mixed content without mixed elements",
+			xml:      `<a><b>fred</b><b>wilma</b></a>`,
+			selector: "/",
+			mixed:    true,
+			expected: `{"_name":"a","b":[{"#text":["fred"]},{"#text":["wilma"]}]}`,
+		},
+
+		{
+			name:          "inner xml",
+			xml:           `<a><title> t </title><description><p>hello <b>fred</b> &amp; wilma</p> <p/></description><description>more</description></a>`,
+			selector:      "/",
+			preserveSpace: true,
+			innerXML:      []string{"description"},
+			expected:      `{"_name":"a","description_html":["<p>hello <b>fred</b> &amp; wilma</p><p></p>","more"],"title":[{"#text":["t"]}]}`,
+		},
+		{
+			name:          "inner xml of a single element",
+			xml:           `<a><description>hello <b>fred</b></description></a>`,
+			selector:      "/",
+			preserveSpace: true,
+			innerXML:      []string{"description"},
+			expected:      `{"_name":"a","description_html":"hello <b>fred</b>"}`,
+		},
+		{
+			name:     "inner xml with namespaces",
+			xml:      `<a xmlns:x="urn:x"><body><x:p x:id="1">x</x:p></body></a>`,
+			selector: "/",
+			nsFlag:   xmlpicker.NSPrefix,
+			innerXML: []string{"/a/body"},
+			expected: `{"_name":"a","_namespaces":{"x":"urn:x"},"body_html":"<x:p x:id=\"1\" xmlns:x=\"urn:x\">x</x:p>"}`,
+		},
+
+		{
+			name:     "flatten text",
+			xml:      `<a><title>Foo</title><tag>x</tag><tag>y</tag><b id="1">z</b><c/><d><e>f</e></d></a>`,
+			selector: "/",
+			flatten:  true,
+			expected: `{"_name":"a","b":[{"#text":["z"],"@id":"1"}],"c":[{}],"d":[{"e":"f"}],"tag":["x","y"],"title":"Foo"}`,
+		},
+		{
+			name:      "flatten text with opt-outs",
+			xml:       `<a><title>Foo</title><d><title>Bar</title></d></a>`,
+			selector:  "/",
+			flatten:   true,
+			noFlatten: []string{"d/title"},
+			expected:  `{"_name":"a","d":[{"title":[{"#text":["Bar"]}]}],"title":"Foo"}`,
+		},
+		{
+			name:     "truncated",
+			xml:      `<a><title>Foo</title><d><e>f</e>g</d></a>`,
+			selector: "/",
+			flatten:  true,
+			depth:    1,
+			expected: `{"_name":"a","d":[{"#text":["g"],"#truncated":true}],"title":"Foo"}`,
+		},
+
+		{
+			name:      "positions",
+			xml:       `<a><b/>x<c><d/></c><b id="2"/></a>`,
+			selector:  "/",
+			positions: true,
+			expected:  `{"#text":["x"],"_name":"a","b":[{"_pos":1},{"@id":"2","_pos":2}],"c":[{"_pos":1,"d":[{"_pos":1}]}]}`,
+		},
+		{
+			name:      "positions in mixed content",
+			xml:       `<a>x<b>y</b>z<b/><c><p/></c></a>`,
+			selector:  "/",
+			mixed:     true,
+			innerXML:  []string{"c"},
+			positions: true,
+			expected:  `{"#content":["x",{"#text":["y"],"_name":"b","_pos":1},"z",{"_name":"b","_pos":2},{"_name":"c","_pos":1,"p":[{"_pos":1}]}],"_name":"a"}`,
+		},
+
+		{
+			name:     "in scope namespaces",
+			xml:      `<a xmlns="urn:a" xmlns:x="urn:x"><b xmlns:y="urn:y"><c x:id="1"/></b></a>`,
+			selector: "/a/b/c",
+			nsFlag:   xmlpicker.NSPrefix,
+			xmlns:    true,
+			expected: `{"@x:id":"1","_name":"c","_namespaces":{},"_xmlns":{"":"urn:a","x":"urn:x","y":"urn:y"}}`,
+		},
+		{
+			name:     "in scope namespaces",
+			xml:      `<a xmlns="urn:a" xmlns:x="urn:x"><b xmlns:y="urn:y"><c x:id="1"/></b></a>`,
+			selector: "/a/b/c",
+			xmlns:    true,
+			expected: `{"@id urn:x":"1","_name":"c","_namespace":"urn:a","_xmlns":{"":"urn:a","x":"urn:x","y":"urn:y"}}`,
+		},
 
 		// TODO Add test coverage to show how namespaces are handled
 	} {
@@ -84,10 +203,18 @@ func TestSimpleMapper(t *testing.T) {
 			var b bytes.Buffer
 			e := json.NewEncoder(&b)
 			e.SetEscapeHTML(false)
-			mapper := xmlpicker.SimpleMapper{}
+			mapper := xmlpicker.SimpleMapper{MixedContent: test.mixed, FlattenText: test.flatten, Positions: test.positions, InScopeNamespaces: test.xmlns}
+			for _, v := range test.noFlatten {
+				mapper.NoFlatten = append(mapper.NoFlatten, xmlpicker.PathSelector(v))
+			}
+			for _, v := range test.innerXML {
+				mapper.InnerXML = append(mapper.InnerXML, xmlpicker.PathSelector(v))
+			}
 			var actualErr error
 			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
 			parser.NSFlag = test.nsFlag
+			parser.PreserveSpace = test.preserveSpace
+			parser.CollectDepth = test.depth
 			for {
 				n, err := parser.Next()
 				if err == io.EOF {
@@ -0,0 +1,76 @@
+package xmlpicker
+
+// StatefulSelector is implemented by selectors whose Matches depends on the nodes they were given before, such as
+// EveryNth and After.
+//
+// A Parser calls Matches once for each start element that is not within a node it matched, in document order and on
+// the goroutine calling Next, so Matches may count or remember what it is given without locking. The Parser calls
+// Reset when it is created, so a selector used for several documents starts afresh with each of them. A Router
+// evaluates the selectors of its routes again as it processes nodes, stateful selectors should not be routes.
+type StatefulSelector interface {
+	Selector
+	Reset()
+}
+
+// ResetSelector resets s if it is a StatefulSelector.
+func ResetSelector(s Selector) {
+	if r, ok := s.(StatefulSelector); ok {
+		r.Reset()
+	}
+}
+
+// EveryNth matches every Nth node of those Selector matches, the Nth, the 2Nth and so on, e.g. to sample every 100th
+// record. Only Matches of Selector is used, the text predicates of a SubtreeSelector are not applied.
+type EveryNth struct {
+	Selector Selector
+	N        int
+
+	count int
+}
+
+func (s *EveryNth) Matches(node *Node) bool {
+	if !s.Selector.Matches(node) {
+		return false
+	}
+	s.count++
+	return s.N <= 1 || s.count%s.N == 0
+}
+
+func (s *EveryNth) selectors() []Selector {
+	return []Selector{s.Selector}
+}
+
+// Reset forgets the nodes counted so far.
+func (s *EveryNth) Reset() {
+	s.count = 0
+	ResetSelector(s.Selector)
+}
+
+// After matches the nodes Selector matches once a node that Marker matches has been seen, not including that node,
+// e.g. the records after the one with a given id with a Marker of /feed/entry[@id = 'X']. Only Matches of the
+// selectors is used, the text predicates of a SubtreeSelector are not applied.
+type After struct {
+	Selector Selector
+	Marker   Selector
+
+	seen bool
+}
+
+func (s *After) Matches(node *Node) bool {
+	if !s.seen {
+		s.seen = s.Marker.Matches(node)
+		return false
+	}
+	return s.Selector.Matches(node)
+}
+
+func (s *After) selectors() []Selector {
+	return []Selector{s.Selector, s.Marker}
+}
+
+// Reset waits for the marker again.
+func (s *After) Reset() {
+	s.seen = false
+	ResetSelector(s.Selector)
+	ResetSelector(s.Marker)
+}
@@ -0,0 +1,81 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestStatefulSelectors(t *testing.T) {
+	const doc = `<feed><entry id="1"/><entry id="2"/><other/><entry id="3"/><entry id="4"/><entry id="5"/></feed>`
+	for idx, test := range []struct {
+		name     string
+		selector xmlpicker.Selector
+		expected []string
+	}{
+		{
+			name:     "every 2nd",
+			selector: &xmlpicker.EveryNth{Selector: xmlpicker.PathSelector("/feed/entry"), N: 2},
+			expected: []string{"2", "4"},
+		},
+		{
+			name:     "every 1st",
+			selector: &xmlpicker.EveryNth{Selector: xmlpicker.PathSelector("/feed/entry"), N: 1},
+			expected: []string{"1", "2", "3", "4", "5"},
+		},
+		{
+			name:     "after",
+			selector: &xmlpicker.After{Selector: xmlpicker.PathSelector("/feed/entry"), Marker: xmlpicker.PathSelector("/feed/entry[@id = '2']")},
+			expected: []string{"3", "4", "5"},
+		},
+		{
+			name:     "after missing marker",
+			selector: &xmlpicker.After{Selector: xmlpicker.PathSelector("/feed/entry"), Marker: xmlpicker.PathSelector("/feed/entry[@id = '9']")},
+			expected: []string{},
+		},
+		{
+			name: "every 2nd after",
+			selector: &xmlpicker.EveryNth{
+				Selector: &xmlpicker.After{Selector: xmlpicker.PathSelector("/feed/entry"), Marker: xmlpicker.PathSelector("/feed/other")},
+				N:        2,
+			},
+			expected: []string{"4"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			// the same selector gives the same nodes for each document it is used for
+			for i := 0; i < 2; i++ {
+				actual := make([]string, 0)
+				parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), test.selector)
+				for {
+					node, err := parser.Next()
+					if err == io.EOF {
+						break
+					}
+					if !assert.NoError(t, err, name) {
+						return
+					}
+					actual = append(actual, node.StartElement.Attr[0].Value)
+				}
+				assert.Equal(t, test.expected, actual, "%s document %d", name, i)
+			}
+		})
+	}
+}
+
+func TestCoverageReset(t *testing.T) {
+	coverage := xmlpicker.NewCoverage(&xmlpicker.EveryNth{Selector: xmlpicker.PathSelector("/feed/entry"), N: 2})
+	for i := 0; i < 2; i++ {
+		parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(`<feed><entry/><entry/><entry/></feed>`)), coverage)
+		_, err := parser.Next()
+		assert.Equal(t, io.EOF, err)
+	}
+	assert.Equal(t, 8, coverage.Elements)
+	assert.Equal(t, []int{2}, coverage.Matched)
+}
@@ -0,0 +1,43 @@
+package xmlpicker
+
+import "encoding/xml"
+
+// StreamMapper receives a node and its descendants as events, in document order, so that it can be mapped without
+// keeping the node in memory. Start is called with each element, whose ancestors are available but not its children,
+// and is followed by an Attr call for each of its attributes. Text receives each text node and End is called with the
+// element once its content has been sent.
+type StreamMapper interface {
+	Start(node *Node) error
+	Attr(attr xml.Attr) error
+	Text(text string) error
+	End(node *Node) error
+}
+
+// StreamNode sends node and its descendants to m as events, as Parser.NextStream does while reading them.
+func StreamNode(node *Node, m StreamMapper) error {
+	if text, ok := node.Text(); ok {
+		return m.Text(text)
+	}
+	if err := streamStart(node, m); err != nil {
+		return err
+	}
+	for _, c := range node.Children {
+		if err := StreamNode(c, m); err != nil {
+			return err
+		}
+	}
+	return m.End(node)
+}
+
+// streamStart sends the start element of node and its attributes to m.
+func streamStart(node *Node, m StreamMapper) error {
+	if err := m.Start(node); err != nil {
+		return err
+	}
+	for _, a := range node.StartElement.Attr {
+		if err := m.Attr(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+// eventRecorder is a StreamMapper that records its events, it fails on the start of an element named fail.
+type eventRecorder struct {
+	events []string
+}
+
+func (r *eventRecorder) Start(node *xmlpicker.Node) error {
+	if node.StartElement.Name.Local == "fail" {
+		return errors.New("failed")
+	}
+	r.events = append(r.events, "start "+node.Path())
+	return nil
+}
+
+func (r *eventRecorder) Attr(attr xml.Attr) error {
+	r.events = append(r.events, "attr "+attr.Name.Local+"="+attr.Value)
+	return nil
+}
+
+func (r *eventRecorder) Text(text string) error {
+	r.events = append(r.events, "text "+text)
+	return nil
+}
+
+func (r *eventRecorder) End(node *xmlpicker.Node) error {
+	r.events = append(r.events, "end "+node.StartElement.Name.Local)
+	return nil
+}
+
+func TestParserNextStream(t *testing.T) {
+	for idx, test := range []struct {
+		name     string
+		selector string
+		xml      string
+		expected []string
+	}{
+		{
+			name:     "events",
+			selector: "/a/b",
+			xml:      `<a><b id="1">x<c k="v">y</c><d/></b><b id="2"/></a>`,
+			expected: []string{
+				"start /a/b", "attr id=1", "text x", "start /a/b/c", "attr k=v", "text y", "end c", "start /a/b/d", "end d", "end b",
+				"node b 0",
+				"start /a/b", "attr id=2", "end b",
+				"node b 0",
+			},
+		},
+		{
+			name:     "attribute",
+			selector: "/a/b/@id",
+			xml:      `<a><b id="1"><c/></b></a>`,
+			expected: []string{"text 1", "node  0"},
+		},
+		{
+			name:     "recover from mapper errors",
+			selector: "/a/b",
+			xml:      `<a><b id="1"><fail><c/></fail></b><b id="2"/></a>`,
+			expected: []string{
+				"start /a/b", "attr id=1", "error failed",
+				"start /a/b", "attr id=2", "end b",
+				"node b 0",
+			},
+		},
+		{
+			name:     "text predicates",
+			selector: "/a/b[c = 'x']",
+			xml:      `<a><b><c>x</c></b></a>`,
+			expected: []string{"error xmlpicker: text predicates need the complete node and cannot be streamed"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			r := &eventRecorder{}
+			for {
+				n, err := parser.NextStream(r)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					r.events = append(r.events, "error "+err.Error())
+					if err.Error() != "failed" {
+						break
+					}
+					assert.NoError(t, parser.Recover(), name)
+					continue
+				}
+				r.events = append(r.events, fmt.Sprintf("node %s %d", n.StartElement.Name.Local, len(n.Children)))
+			}
+			assert.Equal(t, test.expected, r.events, name)
+		})
+	}
+}
+
+func TestSimpleStream(t *testing.T) {
+	for idx, test := range []struct {
+		name     string
+		xml      string
+		nsFlag   xmlpicker.NSFlag
+		mapper   xmlpicker.SimpleMapper
+		depth    int
+		selector string
+	}{
+		{
+			name:     "nested",
+			xml:      `<a><b id="1">x<c>y</c><c>z</c><d><e f="g"/></d></b></a>`,
+			selector: "/a/b",
+		},
+		{
+			name:     "mixed content",
+			xml:      `<a><b>x<c>y</c>z<d><e/></d></b></a>`,
+			selector: "/a/b",
+			mapper:   xmlpicker.SimpleMapper{MixedContent: true, InnerXML: []xmlpicker.Selector{xmlpicker.PathSelector("d")}},
+		},
+		{
+			name:     "inner xml",
+			xml:      `<a xmlns:x="urn:x"><b><body><x:p x:id="1">x</x:p><p>y</p></body><body>z</body></b></a>`,
+			nsFlag:   xmlpicker.NSPrefix,
+			selector: "/a/b",
+			mapper:   xmlpicker.SimpleMapper{InnerXML: []xmlpicker.Selector{xmlpicker.PathSelector("body")}},
+		},
+		{
+			name:     "flatten text",
+			xml:      `<a><b><title>Foo</title><tag>x</tag><tag>y</tag><c id="1">z</c><d><title>Bar</title></d></b></a>`,
+			selector: "/a/b",
+			mapper:   xmlpicker.SimpleMapper{FlattenText: true, NoFlatten: []xmlpicker.Selector{xmlpicker.PathSelector("d/title")}},
+		},
+		{
+			name:     "namespaces",
+			xml:      `<a xmlns="urn:a" xmlns:x="urn:x"><b x:id="1"><x:c>y</x:c></b></a>`,
+			nsFlag:   xmlpicker.NSExpand,
+			selector: "/a/b",
+		},
+		{
+			name:     "truncated",
+			xml:      `<a><b><c><d>x</d>y</c></b></a>`,
+			selector: "/a/b",
+			depth:    1,
+			mapper:   xmlpicker.SimpleMapper{FlattenText: true},
+		},
+		{
+			name:     "positions",
+			xml:      `<a><b>x<c>y</c><d/><c/>z<e><f/></e></b></a>`,
+			selector: "/a/b",
+			mapper:   xmlpicker.SimpleMapper{Positions: true, MixedContent: true, InnerXML: []xmlpicker.Selector{xmlpicker.PathSelector("e")}},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.name)
+		t.Run(name, func(t *testing.T) {
+			var expected, actual []map[string]interface{}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			parser.NSFlag = test.nsFlag
+			parser.CollectDepth = test.depth
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				v, err := test.mapper.FromNode(n)
+				assert.NoError(t, err, name)
+				expected = append(expected, v)
+			}
+			parser = xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.xml)), xmlpicker.PathSelector(test.selector))
+			parser.NSFlag = test.nsFlag
+			parser.CollectDepth = test.depth
+			s := test.mapper.NewStream()
+			for {
+				_, err := parser.NextStream(s)
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				actual = append(actual, s.Value())
+			}
+			assert.NotEmpty(t, expected, name)
+			assert.Equal(t, expected, actual, name)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Structure is the element structure of one or more nodes, elements with the same name at the same path are merged
+// into one along with their attributes and text. The Structure returned by NewStructure is a root whose children are
+// the nodes that were added.
+type Structure struct {
+	Name string
+	// Count is the number of elements that were merged.
+	Count int
+	// Repeated is set when the element occurs more than once within an element of its parent.
+	Repeated bool
+	Text     bool
+	Attrs    []string
+	// Children are in the order they were first seen.
+	Children []*Structure
+	children map[string]*Structure
+}
+
+func NewStructure() *Structure {
+	return &Structure{}
+}
+
+// Add merges the structure of node into the children of s.
+func (s *Structure) Add(node *Node) {
+	s.addChildren([]*Node{node})
+}
+
+func (s *Structure) addChildren(nodes []*Node) {
+	seen := make(map[string]bool)
+	for _, n := range nodes {
+		if _, ok := n.Text(); ok {
+			s.Text = true
+			continue
+		}
+		name := n.StartElement.Name.Local
+		c, ok := s.children[name]
+		if !ok {
+			if s.children == nil {
+				s.children = make(map[string]*Structure)
+			}
+			c = &Structure{Name: name}
+			s.children[name] = c
+			s.Children = append(s.Children, c)
+		}
+		if seen[name] {
+			c.Repeated = true
+		}
+		seen[name] = true
+		c.Count++
+		c.addAttrs(n)
+		c.addChildren(n.Children)
+	}
+}
+
+func (s *Structure) addAttrs(node *Node) {
+	for _, a := range node.StartElement.Attr {
+		i := sort.SearchStrings(s.Attrs, a.Name.Local)
+		if i < len(s.Attrs) && s.Attrs[i] == a.Name.Local {
+			continue
+		}
+		s.Attrs = append(s.Attrs, "")
+		copy(s.Attrs[i+1:], s.Attrs[i:])
+		s.Attrs[i] = a.Name.Local
+	}
+}
+
+// lines returns the name, attributes and text of the element for a label, quoted for the output format.
+func (s *Structure) lines(quote *strings.Replacer) []string {
+	lines := []string{quote.Replace(s.Name)}
+	for _, a := range s.Attrs {
+		lines = append(lines, quote.Replace("@"+a))
+	}
+	if s.Text {
+		lines = append(lines, "#text")
+	}
+	return lines
+}
+
+// walk calls f for each element below s with its id and the id of its parent, -1 for the children of s.
+func (s *Structure) walk(f func(id, parent int, e *Structure) error) error {
+	id := 0
+	var walk func(parent int, e *Structure) error
+	walk = func(parent int, e *Structure) error {
+		for _, c := range e.Children {
+			cid := id
+			id++
+			if err := f(cid, parent, c); err != nil {
+				return err
+			}
+			if err := walk(cid, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(-1, s)
+}
+
+// WriteDOT writes the structure below s as a Graphviz digraph, edges to elements that may be repeated are labelled *.
+func (s *Structure) WriteDOT(w io.Writer) error {
+	if _, err := io.WriteString(w, "digraph structure {\n\tnode [shape=box];\n"); err != nil {
+		return err
+	}
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	err := s.walk(func(id, parent int, e *Structure) error {
+		// \l ends left aligned lines
+		if _, err := fmt.Fprintf(w, "\tn%d [label=\"%s\\l\"];\n", id, strings.Join(e.lines(quote), "\\l")); err != nil {
+			return err
+		}
+		if parent == -1 {
+			return nil
+		}
+		label := ""
+		if e.Repeated {
+			label = ` [label="*"]`
+		}
+		_, err := fmt.Fprintf(w, "\tn%d -> n%d%s;\n", parent, id, label)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// WriteMermaid writes the structure below s as a Mermaid flowchart, edges to elements that may be repeated are
+// labelled *.
+func (s *Structure) WriteMermaid(w io.Writer) error {
+	if _, err := io.WriteString(w, "graph TD\n"); err != nil {
+		return err
+	}
+	quote := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+	return s.walk(func(id, parent int, e *Structure) error {
+		if _, err := fmt.Fprintf(w, "\tn%d[\"%s\"]\n", id, strings.Join(e.lines(quote), "<br/>")); err != nil {
+			return err
+		}
+		if parent == -1 {
+			return nil
+		}
+		arrow := "-->"
+		if e.Repeated {
+			arrow = "-->|*|"
+		}
+		_, err := fmt.Fprintf(w, "\tn%d %s n%d\n", parent, arrow, id)
+		return err
+	})
+}
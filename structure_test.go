@@ -0,0 +1,72 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestStructure(t *testing.T) {
+	const doc = `<feed><entry id="1"><title>a</title><link href="x"/><link href="y" rel="z"/></entry><entry type="b"><title>b</title><author><name>n</name></author></entry></feed>`
+	for idx, test := range []struct {
+		format   string
+		expected string
+	}{
+		{"dot", `digraph structure {
+	node [shape=box];
+	n0 [label="entry\l@id\l@type\l"];
+	n1 [label="title\l#text\l"];
+	n0 -> n1;
+	n2 [label="link\l@href\l@rel\l"];
+	n0 -> n2 [label="*"];
+	n3 [label="author\l"];
+	n0 -> n3;
+	n4 [label="name\l#text\l"];
+	n3 -> n4;
+}
+`},
+		{"mermaid", `graph TD
+	n0["entry<br/>@id<br/>@type"]
+	n1["title<br/>#text"]
+	n0 --> n1
+	n2["link<br/>@href<br/>@rel"]
+	n0 -->|*| n2
+	n3["author"]
+	n0 --> n3
+	n4["name<br/>#text"]
+	n3 --> n4
+`},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.format), func(t *testing.T) {
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/feed/entry"))
+			s := xmlpicker.NewStructure()
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				s.Add(n)
+			}
+			if assert.Len(t, s.Children, 1) {
+				assert.Equal(t, 2, s.Children[0].Count)
+				assert.False(t, s.Children[0].Repeated)
+			}
+			var b bytes.Buffer
+			if test.format == "dot" {
+				assert.NoError(t, s.WriteDOT(&b))
+			} else {
+				assert.NoError(t, s.WriteMermaid(&b))
+			}
+			assert.Equal(t, test.expected, b.String())
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package xmlpicker
+
+import (
+	"io"
+	"time"
+)
+
+// ThrottledReader reads from R at no more than BytesPerSecond on average, sleeping before a read once the previous
+// ones got ahead of that rate, so that long conversions on shared storage leave bandwidth to other workloads.
+type ThrottledReader struct {
+	R              io.Reader
+	BytesPerSecond int64
+	// due is when the bytes read so far are within the rate
+	due time.Time
+}
+
+func NewThrottledReader(r io.Reader, bytesPerSecond int64) *ThrottledReader {
+	return &ThrottledReader{R: r, BytesPerSecond: bytesPerSecond}
+}
+
+func (t *ThrottledReader) Read(p []byte) (int, error) {
+	if t.BytesPerSecond <= 0 {
+		return t.R.Read(p)
+	}
+	// a read is no more than a tenth of a second worth of bytes, so that the rate is even rather than bursts
+	if max := t.BytesPerSecond / 10; max > 0 && int64(len(p)) > max {
+		p = p[:max]
+	}
+	now := time.Now()
+	if t.due.Before(now) {
+		t.due = now
+	}
+	if wait := t.due.Sub(now); wait > 0 {
+		time.Sleep(wait)
+	}
+	n, err := t.R.Read(p)
+	t.due = t.due.Add(time.Duration(int64(n) * int64(time.Second) / t.BytesPerSecond))
+	return n, err
+}
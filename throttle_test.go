@@ -0,0 +1,36 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestThrottledReader(t *testing.T) {
+	for idx, test := range []struct {
+		size           int
+		bytesPerSecond int64
+		min            time.Duration
+	}{
+		{1000, 0, 0},
+		{1000, 1 << 20, 0},
+		{3000, 10000, 200 * time.Millisecond},
+		{50, 100, 400 * time.Millisecond},
+	} {
+		t.Run(fmt.Sprintf("%d %d bytes at %d", idx, test.size, test.bytesPerSecond), func(t *testing.T) {
+			data := bytes.Repeat([]byte("x"), test.size)
+			start := time.Now()
+			actual, err := ioutil.ReadAll(xmlpicker.NewThrottledReader(bytes.NewReader(data), test.bytesPerSecond))
+			elapsed := time.Since(start)
+			assert.NoError(t, err)
+			assert.Equal(t, data, actual)
+			assert.True(t, elapsed >= test.min, "%s should be at least %s", elapsed, test.min)
+			assert.True(t, elapsed < test.min+time.Second, "%s should be less than %s", elapsed, test.min+time.Second)
+		})
+	}
+}
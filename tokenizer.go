@@ -0,0 +1,770 @@
+package xmlpicker
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenReader is the source of the tokens of a Parser, implemented by xml.Decoder and Tokenizer. Token returns the
+// tokens with their namespaces translated as xml.Decoder.Token does and RawToken returns them as written.
+type TokenReader interface {
+	Token() (xml.Token, error)
+	RawToken() (xml.Token, error)
+	InputOffset() int64
+}
+
+// tokenizerBufferSize is the size of the reads of a Tokenizer, its buffer grows to hold tokens that are larger.
+const tokenizerBufferSize = 64 << 10
+
+// xmlnsPrefix and xmlPrefix are the prefixes that are bound without being declared.
+const (
+	xmlnsPrefix = "xmlns"
+	xmlPrefix   = "xml"
+)
+
+// NewTokenizer returns a Tokenizer reading r.
+func NewTokenizer(r io.Reader) *Tokenizer {
+	return &Tokenizer{r: r, names: make(map[string]string)}
+}
+
+// Tokenizer is a faster alternative to xml.Decoder for well-formed UTF-8 documents. It finds the boundaries of
+// tokens with bytes.IndexByte, which is vectorized on the common architectures, rather than reading the input a byte
+// at a time, and returns the same tokens and offsets as a strict xml.Decoder without a CharsetReader. As with
+// xml.Decoder the data of the tokens it returns is only valid until the next call.
+//
+// Unlike xml.Decoder it is always strict: it has no AutoClose or HTML leniency and a Parser ignores its own AutoClose
+// when reading from a Tokenizer.
+type Tokenizer struct {
+	// Entity maps the names of entities to their replacement text, besides the predefined ones, as for xml.Decoder.
+	Entity map[string]string
+
+	r io.Reader
+	// buf holds the input from offset, pos is the position of the next token in it
+	buf    []byte
+	pos    int
+	offset int64
+	// lines is the number of newlines before buf, for the line numbers of syntax errors
+	lines int
+	eof   bool
+	// readErr is the error of the reader other than io.EOF, err the error every call returns once one occurred
+	readErr error
+	err     error
+	// closing is set after the start element of an empty element tag, which is followed by its end element
+	closing bool
+	closeAs xml.Name
+	// text holds the text of a token once its entities are replaced
+	text []byte
+	// names interns element and attribute names
+	names map[string]string
+	// stack and bindings are the raw names of the open elements and the namespace bindings they replaced, for Token
+	stack    []xml.Name
+	bindings []nsBinding
+	ns       map[string]string
+}
+
+// nsBinding records the binding of a prefix before an element declared it, depth is the size of the stack then.
+type nsBinding struct {
+	depth  int
+	prefix string
+	value  string
+	bound  bool
+}
+
+// InputOffset returns the offset of the end of the token last returned and the start of the next one.
+func (t *Tokenizer) InputOffset() int64 {
+	return t.offset + int64(t.pos)
+}
+
+// Token returns the next token with the names of elements and attributes translated to their namespace, and checks
+// that end elements match their start element, as xml.Decoder.Token does.
+func (t *Tokenizer) Token() (xml.Token, error) {
+	tok, err := t.RawToken()
+	if err == io.EOF && len(t.stack) != 0 {
+		return nil, t.fail(t.syntaxError(t.pos, "unexpected EOF"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case xml.StartElement:
+		depth := len(t.stack)
+		for _, a := range tok.Attr {
+			if a.Name.Space == xmlnsPrefix {
+				t.bind(depth, a.Name.Local, a.Value)
+			} else if a.Name.Space == "" && a.Name.Local == xmlnsPrefix {
+				t.bind(depth, "", a.Value)
+			}
+		}
+		t.stack = append(t.stack, tok.Name)
+		t.translate(&tok.Name, true)
+		for i := range tok.Attr {
+			t.translate(&tok.Attr[i].Name, false)
+		}
+		return tok, nil
+	case xml.EndElement:
+		if len(t.stack) == 0 {
+			return nil, t.fail(t.syntaxError(t.pos, "unexpected end element </"+tok.Name.Local+">"))
+		}
+		start := t.stack[len(t.stack)-1]
+		if start.Local != tok.Name.Local {
+			return nil, t.fail(t.syntaxError(t.pos, "element <"+start.Local+"> closed by </"+tok.Name.Local+">"))
+		}
+		if start.Space != tok.Name.Space {
+			return nil, t.fail(t.syntaxError(t.pos, "element <"+start.Local+"> in space "+start.Space+" closed by </"+tok.Name.Local+"> in space "+tok.Name.Space))
+		}
+		t.translate(&tok.Name, true)
+		t.stack = t.stack[:len(t.stack)-1]
+		t.unbind(len(t.stack))
+		return tok, nil
+	}
+	return tok, nil
+}
+
+// bind binds prefix to value for the element opened at depth.
+func (t *Tokenizer) bind(depth int, prefix, value string) {
+	if t.ns == nil {
+		t.ns = make(map[string]string)
+	}
+	previous, bound := t.ns[prefix]
+	t.bindings = append(t.bindings, nsBinding{depth: depth, prefix: prefix, value: previous, bound: bound})
+	t.ns[prefix] = value
+}
+
+// unbind restores the bindings replaced by the element closed at depth.
+func (t *Tokenizer) unbind(depth int) {
+	for len(t.bindings) != 0 && t.bindings[len(t.bindings)-1].depth == depth {
+		b := t.bindings[len(t.bindings)-1]
+		if b.bound {
+			t.ns[b.prefix] = b.value
+		} else {
+			delete(t.ns, b.prefix)
+		}
+		t.bindings = t.bindings[:len(t.bindings)-1]
+	}
+}
+
+// translate replaces the prefix of a name with its namespace, as xml.Decoder does.
+func (t *Tokenizer) translate(n *xml.Name, isElementName bool) {
+	switch {
+	case n.Space == xmlnsPrefix:
+		return
+	case n.Space == "" && !isElementName:
+		return
+	case n.Space == xmlPrefix:
+		n.Space = xmlNamespace
+		return
+	case n.Space == "" && n.Local == xmlnsPrefix:
+		return
+	}
+	if v, ok := t.ns[n.Space]; ok {
+		n.Space = v
+	}
+}
+
+// RawToken returns the next token without translating namespaces or checking that end elements match their start
+// element, as xml.Decoder.RawToken does.
+func (t *Tokenizer) RawToken() (xml.Token, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if t.closing {
+		t.closing = false
+		return xml.EndElement{Name: t.closeAs}, nil
+	}
+	t.compact()
+	if !t.ensure(t.pos) {
+		return nil, t.fail(t.endOfInput(io.EOF))
+	}
+	if t.buf[t.pos] != '<' {
+		return t.charData()
+	}
+	if !t.ensure(t.pos + 1) {
+		return nil, t.fail(t.endOfInput(t.syntaxError(t.pos+1, "unexpected EOF")))
+	}
+	switch t.buf[t.pos+1] {
+	case '/':
+		return t.endElement()
+	case '?':
+		return t.procInst()
+	case '!':
+		return t.markupDeclaration()
+	}
+	return t.startElement()
+}
+
+// compact drops the input before the next token once it takes up half of the buffer.
+func (t *Tokenizer) compact() {
+	if t.pos == 0 || t.pos < cap(t.buf)/2 {
+		return
+	}
+	t.lines += bytes.Count(t.buf[:t.pos], []byte{'\n'})
+	n := copy(t.buf, t.buf[t.pos:])
+	t.buf = t.buf[:n]
+	t.offset += int64(t.pos)
+	t.pos = 0
+}
+
+// ensure reads until buf holds the byte at i and reports whether it does. The buffer grows rather than moves, so
+// positions in it stay valid for the whole token.
+func (t *Tokenizer) ensure(i int) bool {
+	for i >= len(t.buf) {
+		if t.eof {
+			return false
+		}
+		if len(t.buf) == cap(t.buf) {
+			buf := make([]byte, len(t.buf), 2*cap(t.buf)+tokenizerBufferSize)
+			copy(buf, t.buf)
+			t.buf = buf
+		}
+		n, err := t.r.Read(t.buf[len(t.buf):cap(t.buf)])
+		t.buf = t.buf[:len(t.buf)+n]
+		if err != nil {
+			t.eof = true
+			if err != io.EOF {
+				t.readErr = err
+			}
+		}
+	}
+	return true
+}
+
+// indexByte returns the position of the first c in buf from i, reading as needed, or -1 at the end of the input.
+func (t *Tokenizer) indexByte(i int, c byte) int {
+	for {
+		if j := bytes.IndexByte(t.buf[i:], c); j != -1 {
+			return i + j
+		}
+		n := len(t.buf)
+		if !t.ensure(n) {
+			return -1
+		}
+		i = n
+	}
+}
+
+// endOfInput returns the error of the reader, if reading stopped because of one, or else err.
+func (t *Tokenizer) endOfInput(err error) error {
+	if t.readErr != nil {
+		return t.readErr
+	}
+	return err
+}
+
+// fail records err, which every later call returns.
+func (t *Tokenizer) fail(err error) error {
+	t.err = err
+	return err
+}
+
+// line returns the line of the current position.
+func (t *Tokenizer) line() int {
+	return 1 + t.lines + bytes.Count(t.buf[:t.pos], []byte{'\n'})
+}
+
+// syntaxError returns an xml.SyntaxError for the line of position i.
+func (t *Tokenizer) syntaxError(i int, msg string) error {
+	if i > len(t.buf) {
+		i = len(t.buf)
+	}
+	return &xml.SyntaxError{Msg: msg, Line: 1 + t.lines + bytes.Count(t.buf[:i], []byte{'\n'})}
+}
+
+// unexpectedEOF fails with the error for input that ends within a token.
+func (t *Tokenizer) unexpectedEOF() (xml.Token, error) {
+	return nil, t.fail(t.endOfInput(t.syntaxError(len(t.buf), "unexpected EOF")))
+}
+
+// charData returns the text up to the next markup.
+func (t *Tokenizer) charData() (xml.Token, error) {
+	start := t.pos
+	end := t.indexByte(start, '<')
+	if end == -1 {
+		if t.readErr != nil {
+			return nil, t.fail(t.readErr)
+		}
+		end = len(t.buf)
+	}
+	text, err := t.decodeText(start, end, true)
+	if err != nil {
+		return nil, t.fail(err)
+	}
+	t.pos = end
+	return xml.CharData(text), nil
+}
+
+// decodeText checks the characters of buf[start:end], rewrites its line ends to \n and, when entities is set, replaces
+// its entity and character references.
+func (t *Tokenizer) decodeText(start, end int, entities bool) ([]byte, error) {
+	raw := t.buf[start:end]
+	plain := true
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c >= 0x20 && c < utf8.RuneSelf && c != '&' {
+			continue
+		}
+		if c == '\t' || c == '\n' || c == '&' && !entities {
+			continue
+		}
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(raw[i:])
+			if r == utf8.RuneError && size == 1 {
+				return nil, t.syntaxError(start+i, "invalid UTF-8")
+			}
+			if !isInCharacterRange(r) {
+				return nil, t.syntaxError(start+i, fmt.Sprintf("illegal character code %U", r))
+			}
+			i += size - 1
+			continue
+		}
+		if c != '&' && c != '\r' {
+			return nil, t.syntaxError(start+i, fmt.Sprintf("illegal character code %U", rune(c)))
+		}
+		plain = false
+	}
+	if entities && bytes.Contains(raw, []byte("]]>")) {
+		return nil, t.syntaxError(start+bytes.Index(raw, []byte("]]>")), "unescaped ]]> not in CDATA section")
+	}
+	if plain {
+		return raw, nil
+	}
+	text := t.text[:0]
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '\r':
+			text = append(text, '\n')
+			if i+1 < len(raw) && raw[i+1] == '\n' {
+				i++
+			}
+		case c == '&' && entities:
+			j := bytes.IndexByte(raw[i:], ';')
+			if j == -1 {
+				return nil, t.syntaxError(start+i, "invalid character entity "+invalidEntity(raw[i:]))
+			}
+			replacement, ok := t.entity(raw[i+1 : i+j])
+			if !ok {
+				return nil, t.syntaxError(start+i, "invalid character entity "+string(raw[i:i+j+1]))
+			}
+			text = append(text, replacement...)
+			i += j
+		default:
+			text = append(text, c)
+		}
+	}
+	t.text = text
+	return text, nil
+}
+
+// invalidEntity returns the start of an unterminated reference for an error message.
+func invalidEntity(b []byte) string {
+	i := 1
+	for i < len(b) && i < 32 && (isNameByte(b[i]) || b[i] == '#') {
+		i++
+	}
+	return string(b[:i]) + " (no semicolon)"
+}
+
+// entity returns the replacement text of the entity or character reference name.
+func (t *Tokenizer) entity(name []byte) (string, bool) {
+	if len(name) > 1 && name[0] == '#' {
+		base, digits := 10, name[1:]
+		if digits[0] == 'x' {
+			base, digits = 16, digits[1:]
+		}
+		n, err := strconv.ParseUint(string(digits), base, 64)
+		if err != nil || n > unicode.MaxRune {
+			return "", false
+		}
+		return string(rune(n)), true
+	}
+	switch string(name) {
+	case "lt":
+		return "<", true
+	case "gt":
+		return ">", true
+	case "amp":
+		return "&", true
+	case "apos":
+		return "'", true
+	case "quot":
+		return `"`, true
+	}
+	if !isXMLName(name) {
+		return "", false
+	}
+	s, ok := t.Entity[string(name)]
+	return s, ok
+}
+
+// startElement returns the start element of a tag, an empty element tag is followed by its end element.
+func (t *Tokenizer) startElement() (xml.Token, error) {
+	i := t.pos + 1
+	name, i, err := t.name(i)
+	if err != nil {
+		return nil, err
+	}
+	attrs := []xml.Attr{}
+	for {
+		i = t.space(i)
+		if !t.ensure(i) {
+			return t.unexpectedEOF()
+		}
+		switch t.buf[i] {
+		case '>':
+			t.pos = i + 1
+			return xml.StartElement{Name: name, Attr: attrs}, nil
+		case '/':
+			if !t.ensure(i + 1) {
+				return t.unexpectedEOF()
+			}
+			if t.buf[i+1] != '>' {
+				return nil, t.fail(t.syntaxError(i+1, "expected /> in element"))
+			}
+			t.pos = i + 2
+			t.closing, t.closeAs = true, name
+			return xml.StartElement{Name: name, Attr: attrs}, nil
+		}
+		var a xml.Attr
+		if a.Name, i, err = t.name(i); err != nil {
+			return nil, err
+		}
+		i = t.space(i)
+		if !t.ensure(i) {
+			return t.unexpectedEOF()
+		}
+		if t.buf[i] != '=' {
+			return nil, t.fail(t.syntaxError(i, "attribute name without = in element"))
+		}
+		i = t.space(i + 1)
+		if !t.ensure(i) {
+			return t.unexpectedEOF()
+		}
+		quote := t.buf[i]
+		if quote != '"' && quote != '\'' {
+			return nil, t.fail(t.syntaxError(i, "unquoted or missing attribute value in element"))
+		}
+		end := t.indexByte(i+1, quote)
+		if end == -1 {
+			return t.unexpectedEOF()
+		}
+		if lt := bytes.IndexByte(t.buf[i+1:end], '<'); lt != -1 {
+			return nil, t.fail(t.syntaxError(i+1+lt, "unescaped < inside quoted string"))
+		}
+		value, err := t.decodeText(i+1, end, true)
+		if err != nil {
+			return nil, t.fail(err)
+		}
+		a.Value = string(value)
+		attrs = append(attrs, a)
+		i = end + 1
+	}
+}
+
+// endElement returns the end element of a tag.
+func (t *Tokenizer) endElement() (xml.Token, error) {
+	i := t.pos + 2
+	if !t.ensure(i) {
+		return t.unexpectedEOF()
+	}
+	if !isNameStartByte(t.buf[i]) {
+		return nil, t.fail(t.syntaxError(i, "expected element name after </"))
+	}
+	name, i, err := t.name(i)
+	if err != nil {
+		return nil, err
+	}
+	i = t.space(i)
+	if !t.ensure(i) {
+		return t.unexpectedEOF()
+	}
+	if t.buf[i] != '>' {
+		return nil, t.fail(t.syntaxError(i, "invalid characters between </"+name.Local+" and >"))
+	}
+	t.pos = i + 1
+	return xml.EndElement{Name: name}, nil
+}
+
+// procInst returns a processing instruction, checking the version and encoding of the XML declaration.
+func (t *Tokenizer) procInst() (xml.Token, error) {
+	i := t.pos + 2
+	end := i
+	for t.ensure(end) && isNameByte(t.buf[end]) {
+		end++
+	}
+	if end == i {
+		if !t.ensure(end) {
+			return t.unexpectedEOF()
+		}
+		return nil, t.fail(t.syntaxError(i, "expected target name after <?"))
+	}
+	target := string(t.buf[i:end])
+	i = t.space(end)
+	end = i
+	for {
+		if end = t.indexByte(end, '>'); end == -1 {
+			return t.unexpectedEOF()
+		}
+		if end > i && t.buf[end-1] == '?' {
+			break
+		}
+		end++
+	}
+	inst := t.buf[i : end-1]
+	if target == xmlPrefix {
+		content := string(inst)
+		if v := procInstParam("version", content); v != "" && v != "1.0" {
+			return nil, t.fail(fmt.Errorf("xml: unsupported version %q; only version 1.0 is supported", v))
+		}
+		if enc := procInstParam("encoding", content); enc != "" && !strings.EqualFold(enc, "utf-8") {
+			return nil, t.fail(fmt.Errorf("xmlpicker: encoding %q declared but a Tokenizer only reads UTF-8", enc))
+		}
+	}
+	t.pos = end + 1
+	return xml.ProcInst{Target: target, Inst: append([]byte{}, inst...)}, nil
+}
+
+// procInstParam returns the value of param in the instruction of an XML declaration, as encoding/xml parses it.
+func procInstParam(param, s string) string {
+	param = param + "="
+	idx := strings.Index(s, param)
+	if idx == -1 {
+		return ""
+	}
+	v := s[idx+len(param):]
+	if v == "" {
+		return ""
+	}
+	if v[0] != '\'' && v[0] != '"' {
+		return ""
+	}
+	idx = strings.IndexRune(v[1:], rune(v[0]))
+	if idx == -1 {
+		return ""
+	}
+	return v[1 : idx+1]
+}
+
+// markupDeclaration returns the comment, CDATA section or directive that starts with <!.
+func (t *Tokenizer) markupDeclaration() (xml.Token, error) {
+	i := t.pos + 2
+	if !t.ensure(i) {
+		return t.unexpectedEOF()
+	}
+	switch t.buf[i] {
+	case '-':
+		if !t.ensure(i + 1) {
+			return t.unexpectedEOF()
+		}
+		if t.buf[i+1] != '-' {
+			return nil, t.fail(t.syntaxError(i+1, "invalid sequence <!- not part of <!--"))
+		}
+		start := i + 2
+		end := start
+		for {
+			if end = t.indexByte(end, '-'); end == -1 || !t.ensure(end+1) {
+				return t.unexpectedEOF()
+			}
+			if t.buf[end+1] == '-' {
+				break
+			}
+			end++
+		}
+		if !t.ensure(end + 2) {
+			return t.unexpectedEOF()
+		}
+		if t.buf[end+2] != '>' {
+			return nil, t.fail(t.syntaxError(end+2, `invalid sequence "--" not allowed in comments`))
+		}
+		t.pos = end + 3
+		return xml.Comment(t.buf[start:end]), nil
+	case '[':
+		const cdata = "[CDATA["
+		for j := 0; j < len(cdata); j++ {
+			if !t.ensure(i + j) {
+				return t.unexpectedEOF()
+			}
+			if t.buf[i+j] != cdata[j] {
+				return nil, t.fail(t.syntaxError(i+j, "invalid <![ sequence"))
+			}
+		}
+		start := i + len(cdata)
+		end := start
+		for {
+			if end = t.indexByte(end, '>'); end == -1 {
+				return t.unexpectedEOF()
+			}
+			if end-start >= 2 && t.buf[end-1] == ']' && t.buf[end-2] == ']' {
+				break
+			}
+			end++
+		}
+		text, err := t.decodeText(start, end-2, false)
+		if err != nil {
+			return nil, t.fail(err)
+		}
+		t.pos = end + 1
+		return xml.CharData(text), nil
+	}
+	return t.directive(i)
+}
+
+// directive returns a directive such as a DOCTYPE, whose nested declarations are kept, quoted angle brackets left
+// alone and comments replaced by a space, as xml.Decoder does.
+func (t *Tokenizer) directive(i int) (xml.Token, error) {
+	// like xml.Decoder, the first byte is taken as it is
+	data := []byte{t.buf[i]}
+	var quote byte
+	depth := 0
+	for i++; ; i++ {
+		if !t.ensure(i) {
+			return t.unexpectedEOF()
+		}
+		c := t.buf[i]
+		if quote == 0 && c == '>' && depth == 0 {
+			break
+		}
+		switch {
+		case c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '>':
+			depth--
+		case c == '<':
+			const comment = "<!--"
+			j := 1
+			for ; j < len(comment); j++ {
+				if !t.ensure(i + j) {
+					return t.unexpectedEOF()
+				}
+				if t.buf[i+j] != comment[j] {
+					break
+				}
+			}
+			if j < len(comment) {
+				depth++
+				break
+			}
+			end := i + len(comment)
+			for {
+				if end = t.indexByte(end, '>'); end == -1 {
+					return t.unexpectedEOF()
+				}
+				if end-i >= len(comment)+2 && t.buf[end-1] == '-' && t.buf[end-2] == '-' {
+					break
+				}
+				end++
+			}
+			data = append(data, ' ')
+			i = end
+			continue
+		}
+		data = append(data, c)
+	}
+	t.pos = i + 1
+	return xml.Directive(data), nil
+}
+
+// space returns the position of the first byte from i that is not white space.
+func (t *Tokenizer) space(i int) int {
+	for t.ensure(i) {
+		switch t.buf[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// name reads the name at i, split at its colon as in xml.Decoder.RawToken, and returns the position after it. Names
+// with more than one colon are rejected.
+func (t *Tokenizer) name(i int) (xml.Name, int, error) {
+	start := i
+	ascii := true
+	for t.ensure(i) {
+		c := t.buf[i]
+		if c >= utf8.RuneSelf {
+			ascii = false
+		} else if !isNameByte(c) {
+			break
+		}
+		i++
+	}
+	if i == start {
+		if !t.ensure(i) {
+			_, err := t.unexpectedEOF()
+			return xml.Name{}, i, err
+		}
+		return xml.Name{}, i, t.fail(t.syntaxError(i, "expected name"))
+	}
+	b := t.buf[start:i]
+	if !isNameStartByte(b[0]) || !ascii && !isXMLName(b) {
+		return xml.Name{}, i, t.fail(t.syntaxError(start, "invalid XML name: "+string(b)))
+	}
+	if bytes.Count(b, []byte{':'}) > 1 {
+		return xml.Name{}, i, t.fail(t.syntaxError(start, "invalid XML name: "+string(b)))
+	}
+	if colon := bytes.IndexByte(b, ':'); colon > 0 && colon < len(b)-1 {
+		return xml.Name{Space: t.intern(b[:colon]), Local: t.intern(b[colon+1:])}, i, nil
+	}
+	return xml.Name{Local: t.intern(b)}, i, nil
+}
+
+// intern returns a string for b, shared with earlier names of the same bytes.
+func (t *Tokenizer) intern(b []byte) string {
+	if s, ok := t.names[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(t.names) < 1<<12 {
+		t.names[s] = s
+	}
+	return s
+}
+
+// isNameByte reports whether c is an ASCII byte allowed in names.
+func isNameByte(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == ':' || c == '.' || c == '-'
+}
+
+// isNameStartByte reports whether c may start a name, non-ASCII bytes are checked by isXMLName.
+func isNameStartByte(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || c == '_' || c == ':' || c >= utf8.RuneSelf
+}
+
+// isXMLName reports whether b is a name made of letters, digits and the punctuation names allow.
+func isXMLName(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for i, r := range string(b) {
+		if r == utf8.RuneError {
+			return false
+		}
+		if unicode.IsLetter(r) || r == '_' || r == ':' {
+			continue
+		}
+		if i == 0 || !unicode.IsDigit(r) && r != '.' && r != '-' && !unicode.Is(unicode.Mn, r) && !unicode.Is(unicode.Mc, r) && r != '·' {
+			return false
+		}
+	}
+	return true
+}
+
+// isInCharacterRange reports whether r is a character XML allows.
+func isInCharacterRange(r rune) bool {
+	return r == 0x09 ||
+		r == 0x0A ||
+		r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
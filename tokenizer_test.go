@@ -0,0 +1,175 @@
+package xmlpicker_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+// tokenizerDocs are read by both xml.Decoder and Tokenizer, the tokens, offsets and whether they fail must agree.
+var tokenizerDocs = []string{
+	`<a/>`,
+	`<a></a>`,
+	`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<!DOCTYPE a [<!ENTITY e "x"> <!-- c > --> <!ATTLIST a b CDATA "'>'">]>` + "\n<a>t</a>\n",
+	`<a b="1" c='2' d = "3"><b/><c x="&lt;&amp;&#65;&#x42;"/></a>`,
+	`<a>one &amp; two &lt;three&gt; &quot;&apos; &#233;&#x1F600;</a>`,
+	"<a>\r\nline\rline\r\n</a>",
+	`<a b="` + "x\r\ny\tz" + `"/>`,
+	`<a><![CDATA[<not> &markup; ]] ]>]]><![CDATA[]]></a>`,
+	`<a><!----><!-- comment - with - dashes --></a>`,
+	`<?target some instruction?><?empty?><a/>`,
+	`<feed xmlns="urn:feed" xmlns:x="urn:x" xml:lang="en"><x:entry x:id="1" id="2"><title xmlns="">t</title></x:entry><entry/></feed>`,
+	`<a xmlns:x="urn:1"><x:b xmlns:x="urn:2"><x:c/></x:b><x:d/></a>`,
+	`<x:a><y:b/></x:a>`,
+	`<a:b:c/>`,
+	`<é ü="ö">ünïcödé 世界</é>`,
+	`<a x="1"y="2"/>`,
+	`<a>` + strings.Repeat("<b c=\"d\">text &amp; more</b>", 5000) + `</a>`,
+	`<a>` + strings.Repeat("x", 200000) + `</a>`,
+	"\ufeff<a/>",
+	`text before<a/>text after`,
+	"",
+	// invalid documents
+	`<a>`,
+	`<a></b>`,
+	`</a>`,
+	`<a b=1/>`,
+	`<a b/>`,
+	`<a b="<"/>`,
+	`<a>&unknown;</a>`,
+	`<a>&amp</a>`,
+	`<a>&#xZZ;</a>`,
+	`<a>]]></a>`,
+	"<a>\x01</a>",
+	"<a>\xff</a>",
+	`<a><!-- -- --></a>`,
+	`<a><![CDAT[x]]></a>`,
+	`<?xml version="1.1"?><a/>`,
+	`<?xml version="1.0" encoding="ISO-8859-1"?><a/>`,
+	`<1a/>`,
+	`<a/ >`,
+	`<a></a b>`,
+	`<a><!-- unterminated`,
+	`<a b="unterminated`,
+	`<x:a></y:a>`,
+}
+
+func TestTokenizer(t *testing.T) {
+	for idx, doc := range tokenizerDocs {
+		name := doc
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		t.Run(fmt.Sprintf("%d %s", idx, name), func(t *testing.T) {
+			for _, raw := range []bool{false, true} {
+				for _, oneByte := range []bool{false, true} {
+					var r io.Reader = strings.NewReader(doc)
+					if oneByte {
+						r = iotest.OneByteReader(r)
+					}
+					expected, expectedErr := readTokens(xml.NewDecoder(strings.NewReader(doc)), raw)
+					actual, actualErr := readTokens(xmlpicker.NewTokenizer(r), raw)
+					desc := fmt.Sprintf("raw=%v oneByte=%v", raw, oneByte)
+					assert.Equal(t, expected, actual, desc)
+					if expectedErr == io.EOF {
+						assert.Equal(t, io.EOF, actualErr, desc)
+					} else {
+						assert.Error(t, actualErr, desc)
+						assert.NotEqual(t, io.EOF, actualErr, "%s: %s", desc, expectedErr)
+					}
+				}
+			}
+		})
+	}
+}
+
+// readTokens returns the tokens of r, each followed by the offset after it, and the error that ends them.
+func readTokens(r xmlpicker.TokenReader, raw bool) ([]string, error) {
+	var tokens []string
+	for {
+		var t xml.Token
+		var err error
+		if raw {
+			t, err = r.RawToken()
+		} else {
+			t, err = r.Token()
+		}
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, fmt.Sprintf("%#v %d", xml.CopyToken(t), r.InputOffset()))
+	}
+}
+
+func TestTokenizer_Parser(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<feed xmlns="urn:feed" xmlns:x="urn:x">
+  <x:entry id="1"><title>One &amp; only</title><x:link href="a"/></x:entry>
+  <!-- skipped -->
+  <x:entry id="2"><title><![CDATA[Two]]></title></x:entry>
+</feed>`
+	for _, nsFlag := range []xmlpicker.NSFlag{xmlpicker.NSExpand, xmlpicker.NSPrefix, xmlpicker.NSStrip} {
+		t.Run(nsFlag.String(), func(t *testing.T) {
+			parse := func(parser *xmlpicker.Parser) []string {
+				parser.NSFlag = nsFlag
+				var records []string
+				for {
+					n, err := parser.Next()
+					if err == io.EOF {
+						return records
+					}
+					if !assert.NoError(t, err) {
+						return records
+					}
+					xml, err := exportNode(n)
+					assert.NoError(t, err)
+					start, end := parser.Offsets()
+					records = append(records, fmt.Sprintf("%d-%d %s", start, end, xml))
+				}
+			}
+			selector := xmlpicker.PathSelector("/feed/entry")
+			expected := parse(xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), selector))
+			actual := parse(xmlpicker.NewTokenParser(xmlpicker.NewTokenizer(strings.NewReader(doc)), selector))
+			assert.Len(t, expected, 2)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func BenchmarkTokenizer(b *testing.B) {
+	var doc bytes.Buffer
+	doc.WriteString(`<feed xmlns="urn:feed">`)
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&doc, `<entry id="%d" updated="2017-01-01T00:00:00Z"><title>Entry %d &amp; more</title>`+
+			`<link rel="alternate" href="http://example.com/%d"/><summary>Some text that goes on for a while, as summaries do.</summary></entry>`, i, i, i)
+	}
+	doc.WriteString(`</feed>`)
+	for _, name := range []string{"xml.Decoder", "Tokenizer"} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(doc.Len()))
+			for i := 0; i < b.N; i++ {
+				var r xmlpicker.TokenReader
+				if name == "Tokenizer" {
+					r = xmlpicker.NewTokenizer(bytes.NewReader(doc.Bytes()))
+				} else {
+					r = xml.NewDecoder(bytes.NewReader(doc.Bytes()))
+				}
+				for {
+					if _, err := r.Token(); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Segment is a source segment aligned with its translation, as found in XLIFF files and TMX translation memories.
+type Segment struct {
+	ID         string `json:"id"`
+	SourceLang string `json:"source_lang"`
+	Source     string `json:"source"`
+	TargetLang string `json:"target_lang"`
+	Target     string `json:"target"`
+}
+
+// TranslationUnitSelector matches the translation units of XLIFF and TMX documents, whatever their namespace: the
+// trans-unit elements of XLIFF 1.x, the unit elements of XLIFF 2.x and the tu elements of TMX, along with the TMX
+// header that holds the source language of the tu elements that follow it.
+type TranslationUnitSelector struct {
+	XLIFF bool
+	TMX   bool
+}
+
+func (s TranslationUnitSelector) Matches(node *Node) bool {
+	if node.Parent == nil {
+		return false
+	}
+	name := node.StartElement.Name.Local
+	parent := node.Parent.StartElement.Name.Local
+	if s.XLIFF && (name == "trans-unit" || name == "unit" && parent == "file") {
+		return true
+	}
+	return s.TMX && (name == "header" && parent == "tmx" || name == "tu" && parent == "body")
+}
+
+// SegmentExtractor returns the aligned segments of the nodes matched by a TranslationUnitSelector. Inline elements
+// are left out of the text of the segments and, as the Parser trims text, the text around them is joined with
+// spaces.
+type SegmentExtractor struct {
+	// SourceLang is the language of the source of TMX units. When it is empty the srclang of the tu, or else of the
+	// header, is used unless it is *all*, in which case the first tuv is the source.
+	SourceLang string
+	// header is the srclang of the last TMX header
+	header string
+}
+
+// Segments returns the segments of a trans-unit, a unit with a segment for each of its segment elements, or a tu
+// with a segment for each tuv besides that of the source. A TMX header has no segments.
+func (x *SegmentExtractor) Segments(node *Node) ([]Segment, error) {
+	switch node.StartElement.Name.Local {
+	case "header":
+		x.header, _ = attrValue(node, "srclang")
+		return nil, nil
+	case "trans-unit":
+		return xliff1Segments(node), nil
+	case "unit":
+		return xliff2Segments(node), nil
+	case "tu":
+		return x.tmxSegments(node)
+	}
+	return nil, fmt.Errorf("xmlpicker: %s is not a translation unit", node.Path())
+}
+
+// xliff1Segments returns the segment of an XLIFF 1.x trans-unit, whose languages are given by its file.
+func xliff1Segments(node *Node) []Segment {
+	s := Segment{}
+	s.ID, _ = attrValue(node, "id")
+	for n := node.Parent; n != nil; n = n.Parent {
+		if n.StartElement.Name.Local == "file" {
+			s.SourceLang, _ = attrValue(n, "source-language")
+			s.TargetLang, _ = attrValue(n, "target-language")
+			break
+		}
+	}
+	if source := childElement(node, "source"); source != nil {
+		s.Source = segmentText(source)
+		if lang, ok := source.ownLang(); ok {
+			s.SourceLang = lang
+		}
+	}
+	if target := childElement(node, "target"); target != nil {
+		s.Target = segmentText(target)
+		if lang, ok := target.ownLang(); ok {
+			s.TargetLang = lang
+		}
+	}
+	return []Segment{s}
+}
+
+// xliff2Segments returns the segments of an XLIFF 2.x unit, whose languages are given by the xliff element. The
+// segments of units with several of them have the id of the unit followed by that, or the number, of the segment.
+func xliff2Segments(node *Node) []Segment {
+	id, _ := attrValue(node, "id")
+	var sourceLang, targetLang string
+	for n := node.Parent; n != nil; n = n.Parent {
+		if n.StartElement.Name.Local == "xliff" {
+			sourceLang, _ = attrValue(n, "srcLang")
+			targetLang, _ = attrValue(n, "trgLang")
+			break
+		}
+	}
+	var segments []*Node
+	for _, c := range node.Children {
+		if c.StartElement.Name.Local == "segment" {
+			segments = append(segments, c)
+		}
+	}
+	result := make([]Segment, 0, len(segments))
+	for i, segment := range segments {
+		s := Segment{ID: id, SourceLang: sourceLang, TargetLang: targetLang}
+		if len(segments) > 1 {
+			segmentID, ok := attrValue(segment, "id")
+			if !ok {
+				segmentID = strconv.Itoa(i + 1)
+			}
+			s.ID = id + "/" + segmentID
+		}
+		if source := childElement(segment, "source"); source != nil {
+			s.Source = segmentText(source)
+		}
+		if target := childElement(segment, "target"); target != nil {
+			s.Target = segmentText(target)
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// tmxSegments returns a segment for each tuv of a TMX tu that is not in the source language.
+func (x *SegmentExtractor) tmxSegments(node *Node) ([]Segment, error) {
+	id, _ := attrValue(node, "tuid")
+	sourceLang := x.SourceLang
+	if sourceLang == "" {
+		var ok bool
+		if sourceLang, ok = attrValue(node, "srclang"); !ok {
+			sourceLang = x.header
+		}
+	}
+	if sourceLang == "*all*" {
+		sourceLang = ""
+	}
+	var tuvs []*Node
+	var langs []string
+	source := -1
+	for _, c := range node.Children {
+		if c.StartElement.Name.Local != "tuv" {
+			continue
+		}
+		// TMX 1.1 uses lang rather than xml:lang
+		lang, ok := c.ownLang()
+		if !ok {
+			lang, _ = attrValue(c, "lang")
+		}
+		if source == -1 && (sourceLang == "" || strings.EqualFold(lang, sourceLang)) {
+			source = len(tuvs)
+		}
+		tuvs = append(tuvs, c)
+		langs = append(langs, lang)
+	}
+	if source == -1 {
+		return nil, fmt.Errorf("xmlpicker: no tuv in the source language %s at %s", sourceLang, node.Path())
+	}
+	sourceText := segmentText(childElement(tuvs[source], "seg"))
+	result := make([]Segment, 0, len(tuvs)-1)
+	for i, tuv := range tuvs {
+		if i == source {
+			continue
+		}
+		result = append(result, Segment{
+			ID:         id,
+			SourceLang: langs[source],
+			Source:     sourceText,
+			TargetLang: langs[i],
+			Target:     segmentText(childElement(tuv, "seg")),
+		})
+	}
+	return result, nil
+}
+
+// childElement returns the first child element of node with the local name, or nil.
+func childElement(node *Node, local string) *Node {
+	for _, c := range node.Children {
+		if c.StartElement.Name.Local == local {
+			if _, ok := c.Text(); !ok {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// segmentText returns the text of node and its descendants joined with spaces, or "" if node is nil.
+func segmentText(node *Node) string {
+	if node == nil {
+		return ""
+	}
+	var parts []string
+	var collect func(n *Node)
+	collect = func(n *Node) {
+		if text, ok := n.Text(); ok {
+			parts = append(parts, text)
+			return
+		}
+		for _, c := range n.Children {
+			collect(c)
+		}
+	}
+	collect(node)
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,121 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestSegmentExtractor(t *testing.T) {
+	for idx, test := range []struct {
+		name       string
+		doc        string
+		sourceLang string
+		expected   []xmlpicker.Segment
+		err        string
+	}{
+		{
+			name: "xliff 1.2",
+			doc: `<xliff version="1.2" xmlns="urn:oasis:names:tc:xliff:document:1.2">
+  <file source-language="en" target-language="fr" datatype="plaintext" original="a.txt">
+    <body>
+      <trans-unit id="1"><source>Hello <g id="b">world</g></source><target>Bonjour <g id="b">le monde</g></target></trans-unit>
+      <group><trans-unit id="2"><source>Bye</source><target xml:lang="fr-CA">Salut</target></trans-unit></group>
+      <trans-unit id="3"><source>Untranslated</source></trans-unit>
+    </body>
+  </file>
+</xliff>`,
+			expected: []xmlpicker.Segment{
+				{ID: "1", SourceLang: "en", Source: "Hello world", TargetLang: "fr", Target: "Bonjour le monde"},
+				{ID: "2", SourceLang: "en", Source: "Bye", TargetLang: "fr-CA", Target: "Salut"},
+				{ID: "3", SourceLang: "en", Source: "Untranslated", TargetLang: "fr"},
+			},
+		},
+		{
+			name: "xliff 2.0",
+			doc: `<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="de">
+  <file id="f1">
+    <unit id="u1"><segment><source>One</source><target>Eins</target></segment></unit>
+    <unit id="u2">
+      <segment id="s1"><source>Two.</source><target>Zwei.</target></segment>
+      <ignorable><source> </source></ignorable>
+      <segment><source>Three.</source><target>Drei.</target></segment>
+    </unit>
+  </file>
+</xliff>`,
+			expected: []xmlpicker.Segment{
+				{ID: "u1", SourceLang: "en", Source: "One", TargetLang: "de", Target: "Eins"},
+				{ID: "u2/s1", SourceLang: "en", Source: "Two.", TargetLang: "de", Target: "Zwei."},
+				{ID: "u2/2", SourceLang: "en", Source: "Three.", TargetLang: "de", Target: "Drei."},
+			},
+		},
+		{
+			name: "tmx",
+			doc: `<tmx version="1.4">
+  <header srclang="en-US" datatype="plaintext" segtype="sentence" adminlang="en" o-tmf="x" creationtool="x" creationtoolversion="1"/>
+  <body>
+    <tu tuid="1"><tuv xml:lang="fr-FR"><seg>Bonjour</seg></tuv><tuv xml:lang="en-us"><seg>Hello</seg></tuv><tuv xml:lang="de-DE"><seg>Hallo</seg></tuv></tu>
+    <tu tuid="2" srclang="de-DE"><tuv lang="de-DE"><seg>Tschüss</seg></tuv><tuv lang="en-US"><seg>Bye <bpt i="1">&lt;b&gt;</bpt>now<ept i="1">&lt;/b&gt;</ept></seg></tuv></tu>
+  </body>
+</tmx>`,
+			expected: []xmlpicker.Segment{
+				{ID: "1", SourceLang: "en-us", Source: "Hello", TargetLang: "fr-FR", Target: "Bonjour"},
+				{ID: "1", SourceLang: "en-us", Source: "Hello", TargetLang: "de-DE", Target: "Hallo"},
+				{ID: "2", SourceLang: "de-DE", Source: "Tschüss", TargetLang: "en-US", Target: "Bye <b> now </b>"},
+			},
+		},
+		{
+			name: "tmx all",
+			doc: `<tmx version="1.4"><header srclang="*all*"/><body>
+  <tu><tuv xml:lang="it"><seg>Ciao</seg></tuv><tuv xml:lang="es"><seg>Hola</seg></tuv></tu>
+</body></tmx>`,
+			expected: []xmlpicker.Segment{
+				{SourceLang: "it", Source: "Ciao", TargetLang: "es", Target: "Hola"},
+			},
+		},
+		{
+			name:       "tmx source lang",
+			doc:        `<tmx><header srclang="it"/><body><tu><tuv xml:lang="it"><seg>Ciao</seg></tuv><tuv xml:lang="es"><seg>Hola</seg></tuv></tu></body></tmx>`,
+			sourceLang: "es",
+			expected: []xmlpicker.Segment{
+				{SourceLang: "es", Source: "Hola", TargetLang: "it", Target: "Ciao"},
+			},
+		},
+		{
+			name: "tmx missing source",
+			doc:  `<tmx><header srclang="en"/><body><tu><tuv xml:lang="es"><seg>Hola</seg></tuv></tu></body></tmx>`,
+			err:  "xmlpicker: no tuv in the source language en at /tmx/body/tu",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.name), func(t *testing.T) {
+			selector := xmlpicker.TranslationUnitSelector{XLIFF: true, TMX: true}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(test.doc)), selector)
+			parser.NSFlag = xmlpicker.NSStrip
+			x := &xmlpicker.SegmentExtractor{SourceLang: test.sourceLang}
+			var actual []xmlpicker.Segment
+			var err error
+			for {
+				var node *xmlpicker.Node
+				if node, err = parser.Next(); err != nil {
+					break
+				}
+				var segments []xmlpicker.Segment
+				if segments, err = x.Segments(node); err != nil {
+					break
+				}
+				actual = append(actual, segments...)
+			}
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package xmlpicker
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// charClass is how a character is written in text and attribute values.
+type charClass int
+
+const (
+	// charRaw is written as is.
+	charRaw charClass = iota
+	// charRef is written as a character reference.
+	charRef
+	// charRestricted is a control character that is invalid in XML 1.0 and only allowed as a character reference in
+	// XML 1.1.
+	charRestricted
+	// charInvalid is not allowed at all.
+	charInvalid
+)
+
+// classifyChar returns how r, decoded from size bytes, is written in the XML version. XML 1.1 also needs references
+// for the C1 control characters and for NEL and LINE SEPARATOR, which its parsers would otherwise turn into line
+// feeds, and refMarker is always written as a reference so that refWriter can tell it from a marker.
+func classifyChar(r rune, size int, xml11 bool) charClass {
+	switch {
+	case r == utf8.RuneError && size == 1:
+		return charInvalid
+	case r == 0x09 || r == 0x0A || r == 0x0D:
+		return charRaw
+	case r >= 0x01 && r <= 0x1F:
+		if xml11 {
+			return charRestricted
+		}
+		return charInvalid
+	case xml11 && (r >= 0x7F && r <= 0x9F || r == 0x2028 || r == refMarker):
+		return charRef
+	case r >= 0x20 && r <= 0xD7FF || r >= 0xE000 && r <= 0xFFFD || r >= 0x10000 && r <= 0x10FFFF:
+		return charRaw
+	}
+	return charInvalid
+}
+
+// refMarker, a noncharacter, followed by the hexadecimal code of a character and a semicolon marks a character
+// reference in the output of xml.Encoder, which would escape the ampersand of the reference itself.
+const refMarker = '\uFDD0'
+
+func writeRefMarker(b *bytes.Buffer, r rune) {
+	b.WriteRune(refMarker)
+	b.WriteString(strconv.FormatInt(int64(r), 16))
+	b.WriteByte(';')
+}
+
+// refWriter replaces the marked character references in what xml.Encoder writes, once enabled for XML 1.1 output.
+type refWriter struct {
+	w       io.Writer
+	enabled bool
+	// pending is the start of a marked reference split across writes
+	pending []byte
+}
+
+var refMarkerBytes = []byte(string(refMarker))
+
+func (r *refWriter) Write(b []byte) (int, error) {
+	if !r.enabled {
+		return r.w.Write(b)
+	}
+	data := b
+	if len(r.pending) != 0 {
+		data = append(r.pending, b...)
+		r.pending = nil
+	}
+	var out bytes.Buffer
+	for {
+		i := bytes.Index(data, refMarkerBytes)
+		if i == -1 {
+			break
+		}
+		end := bytes.IndexByte(data[i:], ';')
+		if end == -1 {
+			r.pending = append([]byte(nil), data[i:]...)
+			data = data[:i]
+			break
+		}
+		out.Write(data[:i])
+		out.WriteString("&#x")
+		out.Write(data[i+len(refMarkerBytes) : i+end])
+		out.WriteByte(';')
+		data = data[i+end+1:]
+	}
+	if r.pending == nil {
+		// keep the start of a marker split across writes
+		for k := len(refMarkerBytes) - 1; k > 0; k-- {
+			if bytes.HasSuffix(data, refMarkerBytes[:k]) {
+				r.pending = append([]byte(nil), data[len(data)-k:]...)
+				data = data[:len(data)-k]
+				break
+			}
+		}
+	}
+	out.Write(data)
+	if _, err := r.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
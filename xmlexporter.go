@@ -1,20 +1,111 @@
 package xmlpicker
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
+// XMLExporter writes nodes to an xml.Encoder, declaring the namespaces they need whatever the NSFlag of the Parser
+// that read them.
 type XMLExporter struct {
 	Encoder *xml.Encoder
-	hasNS   bool
+	// Prefixes optionally maps namespaces to the prefix they are written with, whatever prefix the input used, so
+	// that every exported node uses the same prefixes.
+	Prefixes map[string]string
+	// InvalidChars is what happens to the characters of text and attribute values that XML does not allow.
+	InvalidChars InvalidCharPolicy
+	// Version is the XML version written, 1.0 when empty. XML 1.1 output, which allows control characters as
+	// character references, needs an XMLExporter created by NewXMLExporter.
+	Version string
+	open    []openElement
+	// refs writes the character references xml.Encoder cannot write
+	refs *refWriter
 }
 
+// NewXMLExporter returns an XMLExporter whose Encoder writes to w, and which can write XML 1.1.
+func NewXMLExporter(w io.Writer) *XMLExporter {
+	refs := &refWriter{w: w}
+	return &XMLExporter{Encoder: xml.NewEncoder(refs), refs: refs}
+}
+
+// EncodeDeclaration writes the XML declaration of Version, it must be written first.
+func (e *XMLExporter) EncodeDeclaration() error {
+	version := e.Version
+	if version == "" {
+		version = "1.0"
+	}
+	if _, err := e.xml11(); err != nil {
+		return err
+	}
+	return e.Encoder.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="` + version + `" encoding="UTF-8"`)})
+}
+
+// xml11 reports whether Version is 1.1.
+func (e *XMLExporter) xml11() (bool, error) {
+	switch e.Version {
+	case "", "1.0":
+		return false, nil
+	case "1.1":
+		if e.refs == nil {
+			return false, fmt.Errorf("xmlpicker: XML 1.1 output needs an XMLExporter created by NewXMLExporter")
+		}
+		e.refs.enabled = true
+		return true, nil
+	}
+	return false, fmt.Errorf("xmlpicker: unsupported XML version %q", e.Version)
+}
+
+// InvalidCharPolicy is what an XMLExporter does with the characters that XML does not allow in text and attribute
+// values, such as most control characters, and with invalid UTF-8.
+type InvalidCharPolicy int
+
+const (
+	// InvalidCharReplace replaces them by U+FFFD, as xml.Encoder does.
+	InvalidCharReplace InvalidCharPolicy = iota
+	// InvalidCharStrip leaves them out.
+	InvalidCharStrip
+	// InvalidCharEscape writes them as character references where the XML version written allows it and replaces
+	// them otherwise. XML 1.0 has no references for them, XML 1.1 has references for the control characters.
+	InvalidCharEscape
+	// InvalidCharError stops with an error that gives the path of the node and the offset of the character.
+	InvalidCharError
+)
+
+func (p InvalidCharPolicy) String() string {
+	switch p {
+	case InvalidCharReplace:
+		return "InvalidCharReplace"
+	case InvalidCharStrip:
+		return "InvalidCharStrip"
+	case InvalidCharEscape:
+		return "InvalidCharEscape"
+	case InvalidCharError:
+		return "InvalidCharError"
+	default:
+		return fmt.Sprintf("!INVALIDCHARPOLICY(%d)", p)
+	}
+}
+
+// openElement is an element that has been started but not ended yet.
+type openElement struct {
+	name xml.Name
+	// scope holds the namespaces declared by expandNames for the element and its ancestors, it is the scope of the
+	// parent when the element declares none
+	scope Namespaces
+	// hasNS is set when the element or one of its ancestors has Namespaces, its names then hold prefixes
+	hasNS bool
+}
+
+// EncodeNode writes node and its descendants. Truncated elements end with a #truncated comment.
 func (e *XMLExporter) EncodeNode(node *Node) error {
 	if text, ok := node.Text(); ok {
-		return e.encodeText(text)
+		return e.encodeText(node, text)
 	}
 	if err := e.encodeStartElement(node); err != nil {
 		return err
@@ -24,58 +115,234 @@ func (e *XMLExporter) EncodeNode(node *Node) error {
 			return err
 		}
 	}
+	if node.Truncated {
+		if err := e.Encoder.EncodeToken(xml.Comment("#truncated")); err != nil {
+			return err
+		}
+	}
 	return e.encodeEndElement(node)
 }
 
+// StartPath writes the start elements of node and its ancestors, below the root, so that nodes can be written in
+// their original position. EndPath ends them.
+// StartPath writes the start elements of node and its ancestors, below the root, so that nodes can be written in
+// their original position. EndPath ends them. Use a PathWriter to keep the ancestors open between nodes.
 func (e *XMLExporter) StartPath(node *Node) error {
-	e.hasNS = false
-	if node.Parent == nil {
-		return nil
-	}
-	if err := e.StartPath(node.Parent); err != nil {
-		return err
+	for _, n := range ancestors(node) {
+		if err := e.encodeStartElement(n); err != nil {
+			return err
+		}
 	}
-	return e.encodeStartElement(node)
+	return nil
 }
 
+// EndPath writes the end elements of node and its ancestors, below the root.
 func (e *XMLExporter) EndPath(node *Node) error {
-	if node.Parent == nil {
-		return nil
+	for n := node; n != nil && n.Parent != nil; n = n.Parent {
+		if err := e.encodeEndElement(n); err != nil {
+			return err
+		}
 	}
-	if err := e.encodeEndElement(node); err != nil {
-		return err
+	return nil
+}
+
+// ancestors returns node and its ancestors below the root, outermost first.
+func ancestors(node *Node) []*Node {
+	var path []*Node
+	for n := node; n != nil && n.Parent != nil; n = n.Parent {
+		path = append(path, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
 	}
-	return e.EndPath(node.Parent)
+	return path
+}
+
+// hasNS reports whether the names of node hold prefixes, that is when node or one of its ancestors has Namespaces.
+// The open elements are used when there are some, the ancestors of node otherwise.
+func (e *XMLExporter) hasNS(node *Node) bool {
+	if len(e.open) != 0 {
+		return node.Namespaces != nil || e.open[len(e.open)-1].hasNS
+	}
+	for n := node; n != nil; n = n.Parent {
+		if n.Namespaces != nil {
+			return true
+		}
+	}
+	return false
 }
 
 func (e *XMLExporter) encodeStartElement(node *Node) error {
-	if node.Namespaces != nil {
-		e.hasNS = true
+	hasNS := e.hasNS(node)
+	var token xml.StartElement
+	scope := e.scope()
+	if hasNS && len(e.Prefixes) == 0 {
+		attr, err := e.fixAttributes(node)
+		if err != nil {
+			return err
+		}
+		token = xml.StartElement{Name: node.StartElement.Name, Attr: attr}
+		if err := e.fixElementName(&token.Name, node); err != nil {
+			return err
+		}
+	} else {
+		var declared Namespaces
+		var err error
+		if token, declared, err = e.expandNames(node, scope, hasNS); err != nil {
+			return err
+		}
+		if declared != nil {
+			scope = inherit(declared, scope)
+		}
 	}
-	attr, err := e.fixAttributes(node)
-	if err != nil {
-		return err
+	for i := range token.Attr {
+		var err error
+		if token.Attr[i].Value, err = e.fixChars(node, token.Attr[i].Value, "attribute "+token.Attr[i].Name.Local); err != nil {
+			return err
+		}
 	}
-	token := xml.StartElement{Name: node.StartElement.Name, Attr: attr}
-	if err := e.fixElementName(&token.Name, node); err != nil {
+	if err := e.Encoder.EncodeToken(token); err != nil {
 		return err
 	}
-	return e.Encoder.EncodeToken(token)
+	e.open = append(e.open, openElement{name: token.Name, scope: scope, hasNS: hasNS})
+	return nil
 }
 
 func (e *XMLExporter) encodeEndElement(node *Node) error {
-	token := xml.EndElement{Name: node.StartElement.Name}
-	if err := e.fixElementName(&token.Name, node); err != nil {
-		return err
+	if len(e.open) == 0 {
+		token := xml.EndElement{Name: node.StartElement.Name}
+		if e.hasNS(node) {
+			if err := e.fixElementName(&token.Name, node); err != nil {
+				return err
+			}
+		}
+		return e.Encoder.EncodeToken(token)
 	}
-	return e.Encoder.EncodeToken(token)
+	o := e.open[len(e.open)-1]
+	e.open = e.open[:len(e.open)-1]
+	return e.Encoder.EncodeToken(xml.EndElement{Name: o.name})
 }
 
-func (e *XMLExporter) fixAttributes(node *Node) ([]xml.Attr, error) {
-	if !e.hasNS {
-		return node.StartElement.Attr, nil
+// expandNames declares the namespaces of node instead of using its Namespaces, as needed in NSExpand mode or when
+// Prefixes are set. Elements use the default namespace unless Prefixes has one for it and attributes use a prefix from
+// prefixFor. The namespaces it declares are returned, nil when there are none.
+func (e *XMLExporter) expandNames(node *Node, scope Namespaces, hasNS bool) (xml.StartElement, Namespaces, error) {
+	token := xml.StartElement{Name: xml.Name{Local: node.StartElement.Name.Local}}
+	var declared Namespaces
+	declare := func(prefix, ns string) {
+		if declared == nil {
+			declared = make(Namespaces)
+		}
+		declared[prefix] = ns
+		name := "xmlns"
+		if prefix != "" {
+			name = name + ":" + prefix
+		}
+		token.Attr = append(token.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: ns})
+	}
+	ns := node.StartElement.Name.Space
+	if hasNS {
+		// names hold prefixes
+		ns = node.Name().URI
+		if ns == "" && node.StartElement.Name.Space != "" {
+			return token, nil, fmt.Errorf("xmlpicker: undeclared prefix %s at %s", node.StartElement.Name.Space, node.Path())
+		}
+	}
+	if prefix, ok := e.Prefixes[ns]; ok && ns != "" {
+		token.Name.Local = prefix + ":" + token.Name.Local
+		if scope[prefix] != ns {
+			declare(prefix, ns)
+		}
+	} else if scope[""] != ns {
+		declare("", ns)
+	}
+	var attrs []Attr
+	for i, a := range node.StartElement.Attr {
+		if a.Name.Space == "" {
+			token.Attr = append(token.Attr, a)
+			continue
+		}
+		if attrs == nil {
+			attrs = node.Attrs()
+		}
+		ns := a.Name.Space
+		if ns == "xml" {
+			// the prefix as written, which needs no declaration
+			ns = xmlNamespace
+		} else if hasNS {
+			ns = attrs[i].Name.URI
+			if ns == "" {
+				return token, nil, fmt.Errorf("xmlpicker: undeclared prefix %s at %s", a.Name.Space, node.Path())
+			}
+		}
+		prefix, ok := e.prefixFor(scope, declared, ns, attrs[i].Name.Prefix)
+		if !ok {
+			declare(prefix, ns)
+		}
+		token.Attr = append(token.Attr, xml.Attr{Name: xml.Name{Local: prefix + ":" + a.Name.Local}, Value: a.Value})
+	}
+	return token, declared, nil
+}
+
+// xmlScope is the scope outside of the open elements, it is shared and never changed.
+var xmlScope = Namespaces{"xml": xmlNamespace}
+
+// scope returns the namespaces declared by the exporter for the open elements, which must not be changed.
+func (e *XMLExporter) scope() Namespaces {
+	if len(e.open) == 0 {
+		return xmlScope
+	}
+	return e.open[len(e.open)-1].scope
+}
+
+// prefixFor returns the prefix for an attribute in namespace ns and whether it is already declared. The prefix from
+// Prefixes is used if there is one, then a prefix that is already bound to ns, then the original prefix of the
+// attribute if it is free or the first free one of ns1, ns2...
+func (e *XMLExporter) prefixFor(scope, declared Namespaces, ns, original string) (string, bool) {
+	if ns == xmlNamespace {
+		return "xml", true
+	}
+	if prefix, ok := e.Prefixes[ns]; ok {
+		v, ok := declared[prefix]
+		if !ok {
+			v = scope[prefix]
+		}
+		return prefix, v == ns
+	}
+	if prefix := prefixFor(declared, ns, false); prefix != "" {
+		return prefix, true
+	}
+	if prefix := prefixFor(scope, ns, false); prefix != "" {
+		if _, ok := declared[prefix]; !ok {
+			return prefix, true
+		}
+	}
+	free := func(prefix string) bool {
+		if _, ok := scope[prefix]; ok {
+			return false
+		}
+		if _, ok := declared[prefix]; ok {
+			return false
+		}
+		for _, reserved := range e.Prefixes {
+			if prefix == reserved {
+				return false
+			}
+		}
+		return true
 	}
-	attr := make([]xml.Attr, 0, len(node.Namespaces)+len(node.StartElement.Attr))
+	if original != "" && !strings.HasPrefix(strings.ToLower(original), "xml") && free(original) {
+		return original, false
+	}
+	for i := 1; ; i++ {
+		if prefix := "ns" + strconv.Itoa(i); free(prefix) {
+			return prefix, false
+		}
+	}
+}
+
+func (e *XMLExporter) fixAttributes(node *Node) ([]xml.Attr, error) {
+	attr := make([]xml.Attr, 0, len(node.StartElement.Attr))
 	for _, a := range node.StartElement.Attr {
 		if a.Name.Space != "" {
 			if err := e.validatePrefix(node, a.Name.Space); err != nil {
@@ -86,10 +353,16 @@ func (e *XMLExporter) fixAttributes(node *Node) ([]xml.Attr, error) {
 		}
 		attr = append(attr, a)
 	}
-	if len(node.Namespaces) != 0 {
-		ks := make([]string, 0, len(node.Namespaces))
-		for k, v := range node.Namespaces {
-			if prev, ok := node.Parent.LookupPrefix(k); ok && prev == v {
+	namespaces := node.Namespaces
+	// the root only has the namespaces of the ancestors of a section, see NewSectionParser, they are declared again
+	replay := node.Parent != nil && node.Parent.Parent == nil && len(node.Parent.Namespaces) != 0
+	if replay {
+		namespaces = inherit(namespaces.copy(), node.Parent.Namespaces)
+	}
+	if len(namespaces) != 0 {
+		ks := make([]string, 0, len(namespaces))
+		for k, v := range namespaces {
+			if prev, ok := node.Parent.LookupPrefix(k); ok && prev == v && !replay {
 				continue // prefix:ns combination already in place
 			}
 			ks = append(ks, k)
@@ -104,41 +377,95 @@ func (e *XMLExporter) fixAttributes(node *Node) ([]xml.Attr, error) {
 			}
 			attr = append(attr, xml.Attr{
 				Name:  xml.Name{Local: name},
-				Value: node.Namespaces[k],
+				Value: namespaces[k],
 			})
 		}
 	}
 	return attr, nil
 }
 
+// fixElementName writes the prefix of name, which holds one, as part of its local name.
 func (e *XMLExporter) fixElementName(name *xml.Name, node *Node) error {
 	if name.Space != "" {
-		if e.hasNS && name.Space != "" {
-			if err := e.validatePrefix(node, name.Space); err != nil {
-				return err
-			}
-			name.Local = name.Space + ":" + name.Local
-			name.Space = ""
-		}
-		if name.Space == node.Parent.StartElement.Name.Space {
-			name.Space = ""
+		if err := e.validatePrefix(node, name.Space); err != nil {
+			return err
 		}
+		name.Local = name.Space + ":" + name.Local
+		name.Space = ""
 	}
 	return nil
 }
 
 func (e *XMLExporter) validatePrefix(node *Node, prefix string) error {
-	if !e.hasNS || prefix == "" || prefix == "xml" {
+	if prefix == "" || prefix == "xml" {
 		return nil
 	}
 	if _, ok := node.LookupPrefix(prefix); !ok {
-		return fmt.Errorf("xmlpicker: undeclared prefix %s at %s", prefix, (*FormatNodePath)(node))
+		return fmt.Errorf("xmlpicker: undeclared prefix %s at %s", prefix, node.Path())
 	}
 	return nil
 }
 
-func (e *XMLExporter) encodeText(text string) error {
+func (e *XMLExporter) encodeText(node *Node, text string) error {
+	if node.Parent != nil {
+		node = node.Parent // errors give the path of the element of the text
+	}
+	text, err := e.fixChars(node, text, "text")
+	if err != nil {
+		return err
+	}
 	text = strings.Replace(text, "\n", "&#10;", -1)
 	text = strings.Replace(text, "\r", "&#13;", -1)
 	return e.Encoder.EncodeToken(xml.CharData([]byte(text)))
 }
+
+// fixChars applies InvalidChars to the characters of s, the text or attribute value of node described by where, that
+// the XML version written does not allow. In XML 1.1 the characters that are only allowed as character references
+// are marked for refs to write them as such.
+func (e *XMLExporter) fixChars(node *Node, s, where string) (string, error) {
+	xml11, err := e.xml11()
+	if err != nil {
+		return "", err
+	}
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if classifyChar(r, size, xml11) != charRaw {
+			break
+		}
+		i = i + size
+	}
+	if i == len(s) {
+		return s, nil
+	}
+	var b bytes.Buffer
+	b.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch classifyChar(r, size, xml11) {
+		case charRaw:
+			b.WriteString(s[i : i+size])
+		case charRef:
+			writeRefMarker(&b, r)
+		case charRestricted:
+			if e.InvalidChars == InvalidCharEscape {
+				writeRefMarker(&b, r)
+				break
+			}
+			fallthrough
+		default:
+			switch e.InvalidChars {
+			case InvalidCharStrip:
+			case InvalidCharError:
+				if r == utf8.RuneError {
+					return "", fmt.Errorf("xmlpicker: invalid UTF-8 in %s at %s, offset %d", where, node.Path(), i)
+				}
+				return "", fmt.Errorf("xmlpicker: invalid character %U in %s at %s, offset %d", r, where, node.Path(), i)
+			default:
+				b.WriteRune(utf8.RuneError)
+			}
+		}
+		i = i + size
+	}
+	return b.String(), nil
+}
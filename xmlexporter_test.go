@@ -141,7 +141,7 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 			scenarios: []scenario{
 				{
 					nsFlag:   xmlpicker.NSExpand,
-					expected: `<a foo="1" xmlns:x="http://example.com/x" x:bar="2"></a>`,
+					expected: `<a foo="1" xmlns:a="http://example.com/x" a:bar="2"></a>`,
 				},
 				{
 					nsFlag:   xmlpicker.NSStrip,
@@ -153,6 +153,25 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "xml prefix on undeclared ancestor",
+			xml:      `<a xml:lang="en"><b xml:lang="fr">x</b></a>`,
+			selector: "/a/b",
+			scenarios: []scenario{
+				{
+					nsFlag:   xmlpicker.NSExpand,
+					expected: `<a xml:lang="en"><b xml:lang="fr">x</b></a>`,
+				},
+				{
+					nsFlag:   xmlpicker.NSStrip,
+					expected: `<a lang="en"><b lang="fr">x</b></a>`,
+				},
+				{
+					nsFlag:   xmlpicker.NSPrefix,
+					expected: `<a xml:lang="en"><b xml:lang="fr">x</b></a>`,
+				},
+			},
+		},
 		{
 			name: "namespaces",
 			xml: `
@@ -165,8 +184,8 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 				{
 					nsFlag: xmlpicker.NSExpand,
 					expected: `` +
-						`<a xmlns="http://example.com/y" foo="1" xmlns:x="http://example.com/x" x:bar="2"><b id="123" foo="3" x:bar="4">first</b></a>` +
-						`<a xmlns="http://example.com/y" foo="1" xmlns:x="http://example.com/x" x:bar="2"><b id="456" foo="5">second</b></a>`,
+						`<a xmlns="http://example.com/y" foo="1" xmlns:a="http://example.com/x" a:bar="2"><b id="123" foo="3" a:bar="4">first</b></a>` +
+						`<a xmlns="http://example.com/y" foo="1" xmlns:a="http://example.com/x" a:bar="2"><b id="456" foo="5">second</b></a>`,
 				},
 				{
 					nsFlag: xmlpicker.NSStrip,
@@ -227,7 +246,7 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 					nsFlag: xmlpicker.NSExpand,
 					expected: `` +
 						`<a><b id="123" xmlns:a="a" a:foo="1">first</b></a>` +
-						`<a><b id="456" xmlns:x="http://example.com/x" x:foo="2">second</b></a>` +
+						`<a><b id="456" xmlns:b="http://example.com/x" b:foo="2">second</b></a>` +
 						`<a><b id="789" xmlns:c="c" c:foo="3">third</b></a>`,
 				},
 				{
@@ -430,9 +449,9 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 				{
 					nsFlag: xmlpicker.NSExpand,
 					expected: `` +
-						`<Beers><table xmlns="http://www.w3.org/1999/xhtml"><tr><td><brandName>Huntsman</brandName></td></tr></table></Beers>` +
-						`<Beers><table xmlns="http://www.w3.org/1999/xhtml"><tr><td><origin>Bath, UK</origin></td></tr></table></Beers>` +
-						`<Beers><table xmlns="http://www.w3.org/1999/xhtml"><tr><td><details><class>Bitter</class><hop>Fuggles</hop><pro>Wonderful hop, light alcohol, good summer beer</pro><con>Fragile; excessive variance pub to pub</con></details></td></tr></table></Beers>`,
+						`<Beers><table xmlns="http://www.w3.org/1999/xhtml"><tr><td><brandName xmlns="">Huntsman</brandName></td></tr></table></Beers>` +
+						`<Beers><table xmlns="http://www.w3.org/1999/xhtml"><tr><td><origin xmlns="">Bath, UK</origin></td></tr></table></Beers>` +
+						`<Beers><table xmlns="http://www.w3.org/1999/xhtml"><tr><td><details xmlns=""><class>Bitter</class><hop>Fuggles</hop><pro>Wonderful hop, light alcohol, good summer beer</pro><con>Fragile; excessive variance pub to pub</con></details></td></tr></table></Beers>`,
 				},
 				{
 					nsFlag: xmlpicker.NSStrip,
@@ -465,7 +484,7 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 					nsFlag: xmlpicker.NSExpand,
 					expected: `` +
 						`<x xmlns="http://www.w3.org"><good a="1" b="2"></good></x>` +
-						`<x xmlns="http://www.w3.org"><good a="1" xmlns:www.w3.org="http://www.w3.org" www.w3.org:a="2"></good></x>`,
+						`<x xmlns="http://www.w3.org"><good a="1" xmlns:n1="http://www.w3.org" n1:a="2"></good></x>`,
 				},
 				{
 					nsFlag: xmlpicker.NSStrip,
@@ -481,6 +500,25 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "prefix reused for another namespace",
+			xml:      `<a xmlns:p="urn:1" p:y="0"><b xmlns:p="urn:2" p:x="1"/></a>`,
+			selector: "/a/b",
+			scenarios: []scenario{
+				{
+					nsFlag:   xmlpicker.NSExpand,
+					expected: `<a xmlns:p="urn:1" p:y="0"><b xmlns:ns1="urn:2" ns1:x="1"></b></a>`,
+				},
+				{
+					nsFlag:   xmlpicker.NSStrip,
+					expected: `<a y="0"><b x="1"></b></a>`,
+				},
+				{
+					nsFlag:   xmlpicker.NSPrefix,
+					expected: `<a p:y="0" xmlns:p="urn:1"><b p:x="1" xmlns:p="urn:2"></b></a>`,
+				},
+			},
+		},
 
 		// Real world XML example copied from https://www.xml.com/pub/a/1999/01/namespaces.html
 		{
@@ -573,3 +611,162 @@ func TestXMLExporter_Namespaces(t *testing.T) {
 		})
 	}
 }
+
+func TestXMLExporter_AllocatesPrefixes(t *testing.T) {
+	root := &xmlpicker.Node{}
+	a := &xmlpicker.Node{Parent: root, StartElement: xml.StartElement{
+		Name: xml.Name{Local: "a"},
+		Attr: []xml.Attr{{Name: xml.Name{Space: "urn:a", Local: "x"}, Value: "1"}},
+	}}
+	b := &xmlpicker.Node{Parent: a, StartElement: xml.StartElement{
+		Name: xml.Name{Space: "urn:c", Local: "b"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Space: "urn:b", Local: "y"}, Value: "2"},
+			{Name: xml.Name{Space: "urn:a", Local: "z"}, Value: "3"},
+		},
+	}}
+	var buf bytes.Buffer
+	e := xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&buf)}
+	assert.NoError(t, e.StartPath(a))
+	assert.NoError(t, e.EncodeNode(b))
+	assert.NoError(t, e.EndPath(a))
+	assert.NoError(t, e.Encoder.Flush())
+	assert.Equal(t, `<a xmlns:ns1="urn:a" ns1:x="1"><b xmlns="urn:c" xmlns:ns2="urn:b" ns2:y="2" ns1:z="3"></b></a>`, buf.String())
+}
+
+func TestXMLExporter_Prefixes(t *testing.T) {
+	const doc = `
+		<book xmlns='urn:loc.gov:books' xmlns:isbn='urn:ISBN:0-395-36341-6'>
+		  <title>Cheaper by the Dozen</title>
+		  <isbn:number isbn:type="10">1568491379</isbn:number>
+		  <notes xmlns:b='urn:loc.gov:books' b:lang="en" xmlns:ns1="urn:other" ns1:x="1"/>
+		</book>`
+	for idx, test := range []struct {
+		nsFlag   xmlpicker.NSFlag
+		expected string
+	}{
+		{
+			nsFlag: xmlpicker.NSExpand,
+			expected: `` +
+				`<bk:book xmlns:bk="urn:loc.gov:books"><bk:title>Cheaper by the Dozen</bk:title></bk:book>` +
+				`<bk:book xmlns:bk="urn:loc.gov:books"><isbn:number xmlns:isbn="urn:ISBN:0-395-36341-6" isbn:type="10">1568491379</isbn:number></bk:book>` +
+				`<bk:book xmlns:bk="urn:loc.gov:books"><bk:notes bk:lang="en" xmlns:ns2="urn:other" ns2:x="1"></bk:notes></bk:book>`,
+		},
+		{
+			nsFlag: xmlpicker.NSStrip,
+			expected: `` +
+				`<book><title>Cheaper by the Dozen</title></book>` +
+				`<book><number type="10">1568491379</number></book>` +
+				`<book><notes lang="en" x="1"></notes></book>`,
+		},
+		{
+			nsFlag: xmlpicker.NSPrefix,
+			expected: `` +
+				`<bk:book xmlns:bk="urn:loc.gov:books"><bk:title>Cheaper by the Dozen</bk:title></bk:book>` +
+				`<bk:book xmlns:bk="urn:loc.gov:books"><isbn:number xmlns:isbn="urn:ISBN:0-395-36341-6" isbn:type="10">1568491379</isbn:number></bk:book>` +
+				`<bk:book xmlns:bk="urn:loc.gov:books"><bk:notes bk:lang="en" xmlns:ns2="urn:other" ns2:x="1"></bk:notes></bk:book>`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.nsFlag)
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			e := xmlpicker.XMLExporter{
+				Encoder:  xml.NewEncoder(&b),
+				Prefixes: map[string]string{"urn:loc.gov:books": "bk", "urn:ISBN:0-395-36341-6": "isbn", "urn:unused": "ns1"},
+			}
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), xmlpicker.PathSelector("/book/*"))
+			parser.NSFlag = test.nsFlag
+			for {
+				n, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				assert.NoError(t, e.StartPath(n.Parent), name)
+				assert.NoError(t, e.EncodeNode(n), name)
+				assert.NoError(t, e.EndPath(n.Parent), name)
+			}
+			assert.NoError(t, e.Encoder.Flush(), name)
+			assert.Equal(t, test.expected, b.String(), name)
+		})
+	}
+}
+
+func TestXMLExporter_InvalidChars(t *testing.T) {
+	root := &xmlpicker.Node{}
+	a := &xmlpicker.Node{Parent: root, StartElement: xml.StartElement{
+		Name: xml.Name{Local: "a"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "x"}, Value: "1\x002"}},
+	}}
+	text := &xmlpicker.Node{Parent: a}
+	text.SetText("t\x01u\xffvé")
+	a.Children = []*xmlpicker.Node{text}
+	for idx, test := range []struct {
+		policy      xmlpicker.InvalidCharPolicy
+		expected    string
+		expectedErr string
+	}{
+		{policy: xmlpicker.InvalidCharReplace, expected: "<a x=\"1�2\">t�u�vé</a>"},
+		{policy: xmlpicker.InvalidCharStrip, expected: "<a x=\"12\">tuvé</a>"},
+		{policy: xmlpicker.InvalidCharEscape, expected: "<a x=\"1�2\">t�u�vé</a>"},
+		{policy: xmlpicker.InvalidCharError, expectedErr: "xmlpicker: invalid character U+0000 in attribute x at /a, offset 1"},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.policy), func(t *testing.T) {
+			var b bytes.Buffer
+			e := xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&b), InvalidChars: test.policy}
+			err := e.EncodeNode(a)
+			if test.expectedErr != "" {
+				assert.EqualError(t, err, test.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, e.Encoder.Flush())
+			assert.Equal(t, test.expected, b.String())
+		})
+	}
+	a.StartElement.Attr = nil
+	e := xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&bytes.Buffer{}), InvalidChars: xmlpicker.InvalidCharError}
+	assert.EqualError(t, e.EncodeNode(a), "xmlpicker: invalid character U+0001 in text at /a, offset 1")
+	text.SetText("u\xff")
+	assert.EqualError(t, e.EncodeNode(a), "xmlpicker: invalid UTF-8 in text at /a, offset 1")
+}
+
+func TestXMLExporter_XML11(t *testing.T) {
+	root := &xmlpicker.Node{}
+	for idx, test := range []struct {
+		text     string
+		attr     string
+		policy   xmlpicker.InvalidCharPolicy
+		expected string
+	}{
+		{text: "a\x01b\u0085c", attr: "\x1f", policy: xmlpicker.InvalidCharEscape, expected: `<a x="&#x1f;">a&#x1;b&#x85;c</a>`},
+		{text: "a\x01b\u0085c", attr: "\x1f", policy: xmlpicker.InvalidCharReplace, expected: `<a x="�">a�b&#x85;c</a>`},
+		{text: "\x00\u2028\ufdd0", policy: xmlpicker.InvalidCharEscape, expected: `<a x="">�&#x2028;&#xfdd0;</a>`},
+		// the marker of the reference is split by the 4096 byte buffer of the encoder
+		{text: strings.Repeat("a", 4049) + "\x02", policy: xmlpicker.InvalidCharEscape, expected: `<a x="">` + strings.Repeat("a", 4049) + `&#x2;</a>`},
+	} {
+		t.Run(fmt.Sprintf("%d %s", idx, test.policy), func(t *testing.T) {
+			a := &xmlpicker.Node{Parent: root, StartElement: xml.StartElement{
+				Name: xml.Name{Local: "a"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "x"}, Value: test.attr}},
+			}}
+			text := &xmlpicker.Node{Parent: a}
+			text.SetText(test.text)
+			a.Children = []*xmlpicker.Node{text}
+			var b bytes.Buffer
+			e := xmlpicker.NewXMLExporter(&b)
+			e.Version = "1.1"
+			e.InvalidChars = test.policy
+			assert.NoError(t, e.EncodeDeclaration())
+			assert.NoError(t, e.EncodeNode(a))
+			assert.NoError(t, e.Encoder.Flush())
+			assert.Equal(t, `<?xml version="1.1" encoding="UTF-8"?>`+test.expected, b.String())
+		})
+	}
+	e := xmlpicker.XMLExporter{Encoder: xml.NewEncoder(&bytes.Buffer{}), Version: "1.1"}
+	assert.EqualError(t, e.EncodeDeclaration(), "xmlpicker: XML 1.1 output needs an XMLExporter created by NewXMLExporter")
+	e.Version = "2.0"
+	assert.EqualError(t, e.EncodeDeclaration(), `xmlpicker: unsupported XML version "2.0"`)
+}
@@ -0,0 +1,146 @@
+// Package xmlpickertest helps the applications embedding xmlpicker test their selectors and mappers: it builds Node
+// trees literally, compares the output of a mapper with the expected JSON and runs tables of selector tests.
+package xmlpickertest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+// Attr returns an attribute for Element, name may have a prefix as in x:id.
+func Attr(name, value string) xml.Attr {
+	return xml.Attr{Name: splitName(name), Value: value}
+}
+
+// Text returns a text node for Element.
+func Text(text string) *xmlpicker.Node {
+	n := &xmlpicker.Node{}
+	n.SetText(text)
+	return n
+}
+
+// Element returns an element named name, which may have a prefix as in x:title, with the content given in order as
+// xml.Attr for its attributes, *xmlpicker.Node for its children and string for its text. The xmlns attributes are
+// also recorded in Node.Namespaces, as a Parser does in NSPrefix mode. It panics on content of another type.
+func Element(name string, content ...interface{}) *xmlpicker.Node {
+	n := &xmlpicker.Node{StartElement: xml.StartElement{Name: splitName(name)}}
+	for _, c := range content {
+		switch c := c.(type) {
+		case xml.Attr:
+			n.StartElement.Attr = append(n.StartElement.Attr, c)
+			if prefix, ok := declaredPrefix(c.Name); ok {
+				if n.Namespaces == nil {
+					n.Namespaces = xmlpicker.Namespaces{}
+				}
+				n.Namespaces[prefix] = c.Value
+			}
+		case *xmlpicker.Node:
+			c.Parent = n
+			n.Children = append(n.Children, c)
+		case string:
+			t := Text(c)
+			t.Parent = n
+			n.Children = append(n.Children, t)
+		default:
+			panic(fmt.Sprintf("xmlpickertest: invalid content %T of element %s", c, name))
+		}
+	}
+	return n
+}
+
+// Document gives root the empty parent that the document elements returned by a Parser have, so that it is seen as
+// the document element by selectors, and returns root.
+func Document(root *xmlpicker.Node) *xmlpicker.Node {
+	root.Parent = &xmlpicker.Node{}
+	return root
+}
+
+func splitName(name string) xml.Name {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return xml.Name{Space: name[:i], Local: name[i+1:]}
+	}
+	return xml.Name{Local: name}
+}
+
+func declaredPrefix(name xml.Name) (string, bool) {
+	switch {
+	case name.Space == "" && name.Local == "xmlns":
+		return "", true
+	case name.Space == "xmlns":
+		return name.Local, true
+	}
+	return "", false
+}
+
+// AssertMapped asserts that mapper maps node to the object given as JSON, and shows a diff when it does not.
+func AssertMapped(t assert.TestingT, mapper xmlpicker.Mapper, node *xmlpicker.Node, expected string, msgAndArgs ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	actual, err := mapper.FromNode(node)
+	if !assert.NoError(t, err, msgAndArgs...) {
+		return false
+	}
+	b, err := json.MarshalIndent(actual, "", "  ")
+	if !assert.NoError(t, err, msgAndArgs...) {
+		return false
+	}
+	return assert.JSONEq(t, expected, string(b), msgAndArgs...)
+}
+
+// SelectorCase declares the paths of the nodes Selector matches in XML. Paths are written like /feed/entry[2] where a
+// missing position means 1, as in the files of the test-selectors command.
+type SelectorCase struct {
+	Name     string
+	Selector xmlpicker.Selector
+	NSFlag   xmlpicker.NSFlag
+	XML      string
+	Expected []string
+}
+
+// SelectedPaths returns the paths of the nodes selector matches in doc, parsed strictly with nsFlag.
+func SelectedPaths(selector xmlpicker.Selector, nsFlag xmlpicker.NSFlag, doc string) ([]string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(doc))
+	decoder.Strict = true
+	parser := xmlpicker.NewParser(decoder, selector)
+	parser.NSFlag = nsFlag
+	positions := xmlpicker.NewNodePositions()
+	parser.Trace = positions.Trace
+	paths := []string{}
+	for {
+		n, err := parser.Next()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, positions.Path(n))
+	}
+}
+
+// RunSelectorCases runs each case as a subtest named after its index and Name.
+func RunSelectorCases(t *testing.T, cases []SelectorCase) {
+	t.Helper()
+	for idx, c := range cases {
+		c := c
+		t.Run(fmt.Sprintf("%d %s", idx, c.Name), func(t *testing.T) {
+			actual, err := SelectedPaths(c.Selector, c.NSFlag, c.XML)
+			if !assert.NoError(t, err) {
+				return
+			}
+			expected := make([]string, len(c.Expected))
+			for i, p := range c.Expected {
+				expected[i] = xmlpicker.NormalizePositionPath(p)
+			}
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package xmlpickertest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+	"github.com/t11e/xmlpicker/xmlpickertest"
+)
+
+func TestElement(t *testing.T) {
+	e := xmlpickertest.Element
+	entry := e("entry", xmlpickertest.Attr("id", "1"), xmlpickertest.Attr("xmlns:x", "urn:x"),
+		e("x:title", "one"),
+		xmlpickertest.Text(" "),
+	)
+	root := xmlpickertest.Document(e("feed", entry))
+	assert.Equal(t, "feed", root.StartElement.Name.Local)
+	assert.Equal(t, root, entry.Parent)
+	assert.Equal(t, xmlpicker.Namespaces{"x": "urn:x"}, entry.Namespaces)
+	if assert.Len(t, entry.Children, 2) {
+		title := entry.Children[0]
+		assert.Equal(t, "x", title.StartElement.Name.Space)
+		assert.Equal(t, "title", title.StartElement.Name.Local)
+		text, ok := title.Children[0].Text()
+		assert.True(t, ok)
+		assert.Equal(t, "one", text)
+	}
+	assert.True(t, xmlpicker.PathSelector("/feed/entry").Matches(entry))
+}
+
+func TestAssertMapped(t *testing.T) {
+	e := xmlpickertest.Element
+	entry := e("entry", xmlpickertest.Attr("id", "1"), e("title", "one"))
+	xmlpickertest.AssertMapped(t, xmlpicker.SimpleMapper{}, entry, `{"@id": "1", "_name": "entry", "title": [{"#text": ["one"]}]}`)
+
+	mock := &mockT{}
+	assert.False(t, xmlpickertest.AssertMapped(mock, xmlpicker.SimpleMapper{}, entry, `{"@id": "2"}`))
+	assert.True(t, mock.failed)
+}
+
+type mockT struct {
+	failed bool
+}
+
+func (t *mockT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
+
+func TestRunSelectorCases(t *testing.T) {
+	xmlpickertest.RunSelectorCases(t, []xmlpickertest.SelectorCase{
+		{
+			Name:     "entries",
+			Selector: xmlpicker.PathSelector("/feed/entry"),
+			XML:      `<feed><entry/><other/><entry/></feed>`,
+			Expected: []string{"/feed/entry", "/feed/entry[2]"},
+		},
+		{
+			Name:     "prefixed",
+			Selector: xmlpicker.PathSelector("/feed/x:entry"),
+			NSFlag:   xmlpicker.NSPrefix,
+			XML:      `<feed xmlns:x="urn:x"><x:entry/></feed>`,
+			Expected: []string{"/feed/entry[1]"},
+		},
+	})
+}
@@ -0,0 +1,459 @@
+package xmlpicker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseXPath compiles a subset of XPath 1.0 location paths into a Path.
+//
+// Supported are the child and descendant axes (including the // abbreviation), name tests and the * wildcard, and
+// predicates made of comparisons joined by "and". A comparison tests an attribute (@name), the text of the element
+// (text() or .) or a relative path of child elements against a string or number literal using =, !=, <, <=, > or >=,
+// or uses contains() or starts-with(). A predicate without a comparison tests for the presence of its operand. The
+// last step may select an attribute of the elements matched by the previous steps (@name).
+// The positional predicates [n] and [last()] are compiled to the Position of their step when they come before its
+// other predicates, e.g. /catalog/item[1][@type = 'book'] but not /catalog/item[@type = 'book'][1], and not on the
+// descendant axis, whose positions are not counted among siblings.
+// Relative location paths are evaluated from the document root. Anything else, such as other axes, other positional
+// predicates, namespace prefixes or "or", is rejected with an error.
+func ParseXPath(expr string) (*Path, error) {
+	x := &xpathParser{expr: expr}
+	if err := x.tokenize(); err != nil {
+		return nil, err
+	}
+	p, err := x.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%s in xpath %q", err, expr)
+	}
+	return p, nil
+}
+
+type xpathToken struct {
+	kind  xpathTokenKind
+	text  string
+	value string
+	pos   int
+}
+
+type xpathTokenKind int
+
+const (
+	xpathEOF xpathTokenKind = iota
+	xpathName
+	xpathString
+	xpathNumber
+	xpathSymbol
+)
+
+type xpathParser struct {
+	expr   string
+	tokens []xpathToken
+	i      int
+}
+
+var xpathSymbols = []string{"//", "::", "!=", "<=", ">=", "..", "/", "[", "]", "(", ")", "@", ",", "=", "<", ">", "*", ".", "|", "$", "+", "-"}
+
+func (x *xpathParser) tokenize() error {
+	s := x.expr
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i = i + size
+			continue
+		case r == '\'' || r == '"':
+			end := strings.IndexRune(s[i+1:], r)
+			if end == -1 {
+				return x.errorf(i, "unterminated string")
+			}
+			x.tokens = append(x.tokens, xpathToken{kind: xpathString, text: s[i : i+end+2], value: s[i+1 : i+1+end], pos: i})
+			i = i + end + 2
+			continue
+		case r >= '0' && r <= '9' || (r == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9'):
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j = j + 1
+			}
+			x.tokens = append(x.tokens, xpathToken{kind: xpathNumber, text: s[i:j], value: s[i:j], pos: i})
+			i = j
+			continue
+		case isNameStart(r):
+			j := i + size
+			for j < len(s) {
+				r, size := utf8.DecodeRuneInString(s[j:])
+				if !isNameChar(r) && !(r == ':' && !strings.HasPrefix(s[j:], "::")) {
+					break
+				}
+				j = j + size
+			}
+			x.tokens = append(x.tokens, xpathToken{kind: xpathName, text: s[i:j], value: s[i:j], pos: i})
+			i = j
+			continue
+		}
+		matched := false
+		for _, sym := range xpathSymbols {
+			if strings.HasPrefix(s[i:], sym) {
+				x.tokens = append(x.tokens, xpathToken{kind: xpathSymbol, text: sym, value: sym, pos: i})
+				i = i + len(sym)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return x.errorf(i, "unexpected %q", r)
+		}
+	}
+	x.tokens = append(x.tokens, xpathToken{kind: xpathEOF, pos: len(s)})
+	return nil
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r)
+}
+
+func (x *xpathParser) errorf(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("xmlpicker: invalid xpath %q at offset %d: %s", x.expr, pos, fmt.Sprintf(format, args...))
+}
+
+func (x *xpathParser) unsupported(t xpathToken, what string) error {
+	return fmt.Errorf("xmlpicker: unsupported xpath %q at offset %d: %s", x.expr, t.pos, what)
+}
+
+func (x *xpathParser) peek() xpathToken {
+	return x.tokens[x.i]
+}
+
+func (x *xpathParser) next() xpathToken {
+	t := x.tokens[x.i]
+	if t.kind != xpathEOF {
+		x.i = x.i + 1
+	}
+	return t
+}
+
+func (x *xpathParser) accept(sym string) bool {
+	if t := x.peek(); t.kind == xpathSymbol && t.text == sym {
+		x.i = x.i + 1
+		return true
+	}
+	return false
+}
+
+func (x *xpathParser) expect(sym string) error {
+	if !x.accept(sym) {
+		return x.unexpected(x.peek(), sym)
+	}
+	return nil
+}
+
+func (x *xpathParser) unexpected(t xpathToken, expected string) error {
+	if t.kind == xpathEOF {
+		return x.errorf(t.pos, "expected %s", expected)
+	}
+	return x.errorf(t.pos, "expected %s, found %q", expected, t.text)
+}
+
+func (x *xpathParser) parsePath() (*Path, error) {
+	p := Root()
+	descendant := false
+	if x.accept("//") {
+		descendant = true
+	} else if x.accept("/") && x.peek().kind == xpathEOF {
+		return p.Any(), nil
+	}
+	for {
+		if t := x.peek(); t.kind == xpathSymbol && t.text == "@" {
+			return x.parseAttributeStep(p, descendant)
+		}
+		step, err := x.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		if descendant {
+			step.Descendant = true
+		}
+		p.Steps = append(p.Steps, step)
+		switch {
+		case x.accept("//"):
+			descendant = true
+		case x.accept("/"):
+			descendant = false
+		default:
+			if t := x.peek(); t.kind == xpathSymbol && t.text == "|" {
+				return nil, x.unsupported(t, "unions")
+			} else if t.kind != xpathEOF {
+				return nil, x.unexpected(t, "/ or end of expression")
+			}
+			return p, nil
+		}
+	}
+}
+
+// parseAttributeStep parses the @name step that ends p.
+func (x *xpathParser) parseAttributeStep(p *Path, descendant bool) (*Path, error) {
+	t := x.next()
+	if descendant {
+		return nil, x.unsupported(t, "selecting attributes of any descendant")
+	}
+	if len(p.Steps) == 0 {
+		return nil, x.unsupported(t, "selecting attributes of the root")
+	}
+	n := x.next()
+	switch {
+	case n.kind == xpathSymbol && n.text == "*":
+		return nil, x.unsupported(n, "attribute wildcards")
+	case n.kind != xpathName:
+		return nil, x.unexpected(n, "attribute name")
+	case strings.Contains(n.text, ":"):
+		return nil, x.unsupported(n, "namespace prefixes")
+	}
+	if t := x.peek(); t.kind != xpathEOF {
+		return nil, x.unsupported(t, "steps after an attribute")
+	}
+	p.Attribute = n.text
+	return p, nil
+}
+
+func (x *xpathParser) parseStep() (Step, error) {
+	t := x.next()
+	var step Step
+	// axis is set for the descendant axis, on which positions are not counted among siblings
+	axis := false
+	if t.kind == xpathSymbol {
+		switch t.text {
+		case "@":
+			return step, x.unsupported(t, "selecting attributes")
+		case ".", "..":
+			return step, x.unsupported(t, "abbreviated step "+t.text)
+		case "*":
+			step.Name = "*"
+		default:
+			return step, x.unexpected(t, "step")
+		}
+	} else if t.kind == xpathName {
+		if x.accept("::") {
+			switch t.text {
+			case "child":
+			case "descendant":
+				step.Descendant = true
+				axis = true
+			default:
+				return step, x.unsupported(t, t.text+" axis")
+			}
+			t = x.next()
+		}
+		name, err := x.parseNodeTest(t)
+		if err != nil {
+			return step, err
+		}
+		step.Name = name
+	} else {
+		return step, x.unexpected(t, "step")
+	}
+	for first := true; x.accept("["); first = false {
+		if t := x.peek(); t.kind == xpathNumber || t.text == "last" && x.tokens[x.i+1].text == "(" {
+			if err := x.parsePosition(&step, axis, first); err != nil {
+				return step, err
+			}
+		} else if err := x.parsePredicate(&step); err != nil {
+			return step, err
+		}
+		if err := x.expect("]"); err != nil {
+			return step, err
+		}
+	}
+	return step, nil
+}
+
+// parsePosition parses the [n] or [last()] predicate of step, which only selects by the position among the siblings
+// of the step when it is the first predicate of a step that is not on the descendant axis.
+func (x *xpathParser) parsePosition(step *Step, axis bool, first bool) error {
+	t := x.next()
+	switch {
+	case axis:
+		return x.unsupported(t, "positional predicates on the descendant axis")
+	case !first:
+		return x.unsupported(t, "positional predicates after other predicates")
+	}
+	if t.kind == xpathNumber {
+		n, err := strconv.Atoi(t.text)
+		if err != nil || n < 1 {
+			return x.unsupported(t, "positions other than whole numbers from 1")
+		}
+		step.Position = Position{From: n, To: n}
+	} else {
+		x.next()
+		if err := x.expect(")"); err != nil {
+			return err
+		}
+		step.Position = Position{Last: true}
+	}
+	if t := x.peek(); t.kind != xpathSymbol || t.text != "]" {
+		return x.unsupported(t, "positional predicates within expressions")
+	}
+	return nil
+}
+
+func (x *xpathParser) parseNodeTest(t xpathToken) (string, error) {
+	switch {
+	case t.kind == xpathSymbol && t.text == "*":
+		return "*", nil
+	case t.kind != xpathName:
+		return "", x.unexpected(t, "node test")
+	case strings.Contains(t.text, ":"):
+		return "", x.unsupported(t, "namespace prefixes")
+	}
+	if x.accept("(") {
+		if t.text == "node" {
+			if err := x.expect(")"); err != nil {
+				return "", err
+			}
+			return "*", nil
+		}
+		return "", x.unsupported(t, t.text+"() node test")
+	}
+	return t.text, nil
+}
+
+func (x *xpathParser) parsePredicate(step *Step) error {
+	for {
+		if err := x.parseComparison(step); err != nil {
+			return err
+		}
+		t := x.peek()
+		if t.kind != xpathName {
+			return nil
+		}
+		switch t.text {
+		case "and":
+			x.next()
+		case "or":
+			return x.unsupported(t, "or")
+		default:
+			return x.unexpected(t, "] or and")
+		}
+	}
+}
+
+func (x *xpathParser) parseComparison(step *Step) error {
+	t := x.peek()
+	if t.kind == xpathNumber {
+		return x.unsupported(t, "positional predicates")
+	}
+	if t.kind == xpathName && (t.text == "contains" || t.text == "starts-with") && x.tokens[x.i+1].text == "(" {
+		x.next()
+		x.next()
+		attr, operand, err := x.parseOperand()
+		if err != nil {
+			return err
+		}
+		if err := x.expect(","); err != nil {
+			return err
+		}
+		lit := x.next()
+		if lit.kind != xpathString {
+			return x.unexpected(lit, "string literal")
+		}
+		if err := x.expect(")"); err != nil {
+			return err
+		}
+		pattern := regexp.QuoteMeta(lit.value)
+		if t.text == "starts-with" {
+			pattern = "^" + pattern
+		}
+		return x.addPredicate(step, attr, operand, "~=", pattern, false)
+	}
+	attr, operand, err := x.parseOperand()
+	if err != nil {
+		return err
+	}
+	op := x.peek()
+	if op.kind != xpathSymbol {
+		return x.addPredicate(step, attr, operand, "", "", false)
+	}
+	switch op.text {
+	case "=", "!=", "<", "<=", ">", ">=":
+		x.next()
+	case "]":
+		return x.addPredicate(step, attr, operand, "", "", false)
+	default:
+		return x.unsupported(op, fmt.Sprintf("operator %q", op.text))
+	}
+	lit := x.next()
+	switch lit.kind {
+	case xpathString:
+		return x.addPredicate(step, attr, operand, op.text, lit.value, false)
+	case xpathNumber:
+		return x.addPredicate(step, attr, operand, op.text, lit.value, true)
+	}
+	return x.unsupported(lit, "comparisons with anything but a literal")
+}
+
+// parseOperand returns the attribute name or the text operand of a comparison.
+func (x *xpathParser) parseOperand() (bool, string, error) {
+	t := x.next()
+	switch {
+	case t.kind == xpathSymbol && t.text == "@":
+		n := x.next()
+		if n.kind != xpathName {
+			return false, "", x.unexpected(n, "attribute name")
+		}
+		if strings.Contains(n.text, ":") {
+			return false, "", x.unsupported(n, "namespace prefixes")
+		}
+		return true, n.text, nil
+	case t.kind == xpathSymbol && t.text == ".":
+		return false, "#text", nil
+	case t.kind == xpathName && t.text == "text" && x.accept("("):
+		return false, "#text", x.expect(")")
+	case t.kind == xpathName || (t.kind == xpathSymbol && t.text == "*"):
+		if x.peek().text == "(" {
+			return false, "", x.unsupported(t, t.text+"() function")
+		}
+		if strings.Contains(t.text, ":") {
+			return false, "", x.unsupported(t, "namespace prefixes")
+		}
+		parts := []string{t.text}
+		for x.accept("/") {
+			n := x.next()
+			if n.kind == xpathName && n.text == "text" && x.accept("(") {
+				if err := x.expect(")"); err != nil {
+					return false, "", err
+				}
+				break
+			}
+			if n.kind != xpathName && !(n.kind == xpathSymbol && n.text == "*") {
+				return false, "", x.unexpected(n, "element name")
+			}
+			parts = append(parts, n.text)
+		}
+		return false, strings.Join(parts, "/"), nil
+	}
+	return false, "", x.unsupported(t, "predicate expression")
+}
+
+func (x *xpathParser) addPredicate(step *Step, attr bool, operand, op, value string, numeric bool) error {
+	p, err := NewPredicate(operand, op, value, numeric)
+	if err != nil {
+		return fmt.Errorf("%s in xpath %q", err, x.expr)
+	}
+	if attr {
+		step.Attrs = append(step.Attrs, p)
+	} else {
+		step.Texts = append(step.Texts, p)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package xmlpicker_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/t11e/xmlpicker"
+)
+
+func TestParseXPath(t *testing.T) {
+	const doc = `<catalog><item id="1" type="book"><title>Go</title><price>10</price></item><group><item id="2" type="film"><title>Gopher</title><price>200</price></item></group><item id="3"><title>XML</title><price>30</price></item></catalog>`
+	for idx, test := range []struct {
+		xpath    string
+		path     string
+		expected []string
+	}{
+		{
+			xpath:    "/catalog/item",
+			path:     "/catalog/item",
+			expected: []string{"1", "3"},
+		},
+		{
+			xpath:    "catalog/item",
+			path:     "/catalog/item",
+			expected: []string{"1", "3"},
+		},
+		{
+			xpath:    "//item",
+			path:     "//item",
+			expected: []string{"1", "2", "3"},
+		},
+		{
+			xpath:    "/catalog//item",
+			path:     "/catalog//item",
+			expected: []string{"1", "2", "3"},
+		},
+		{
+			xpath:    "/child::catalog/descendant::item",
+			path:     "/catalog//item",
+			expected: []string{"1", "2", "3"},
+		},
+		{
+			xpath:    "/*/*/item",
+			path:     "/*/*/item",
+			expected: []string{"2"},
+		},
+		{
+			xpath:    "/catalog/node()",
+			path:     "/catalog/*",
+			expected: []string{"1", "", "3"},
+		},
+		{
+			xpath:    "/",
+			path:     "/*",
+			expected: []string{""},
+		},
+		{
+			xpath:    "//item[@type]",
+			path:     "//item[@type]",
+			expected: []string{"1", "2"},
+		},
+		{
+			xpath:    `//item[@type="film"]`,
+			path:     "//item[@type = 'film']",
+			expected: []string{"2"},
+		},
+		{
+			xpath:    "//item[@id >= 2 and @id != '3']",
+			path:     "//item[@id >= 2][@id != '3']",
+			expected: []string{"2"},
+		},
+		{
+			xpath:    "//item[price > 20]",
+			path:     "//item[price > 20]",
+			expected: []string{"2", "3"},
+		},
+		{
+			xpath:    "//item[title/text() = 'XML']",
+			path:     "//item[title = 'XML']",
+			expected: []string{"3"},
+		},
+		{
+			xpath:    "//title[text() = 'Go']",
+			path:     "//title[#text = 'Go']",
+			expected: []string{""},
+		},
+		{
+			xpath:    "//title[. != 'Go']",
+			path:     "//title[#text != 'Go']",
+			expected: []string{"", ""},
+		},
+		{
+			xpath:    "//item[contains(title, 'ph')]",
+			path:     "//item[title ~= 'ph']",
+			expected: []string{"2"},
+		},
+		{
+			xpath:    "//item[starts-with(@type, 'b')]",
+			path:     "//item[@type ~= '^b']",
+			expected: []string{"1"},
+		},
+		{
+			xpath:    "/catalog/item[2]",
+			path:     "/catalog/item[2]",
+			expected: []string{"3"},
+		},
+		{
+			xpath:    "//item[1]",
+			path:     "//item[1]",
+			expected: []string{"1", "2"},
+		},
+		{
+			xpath:    "/catalog/item[last()]",
+			path:     "/catalog/item[last()]",
+			expected: []string{"3"},
+		},
+		{
+			xpath:    "/catalog/*[2]/item[1][@type = 'film']",
+			path:     "/catalog/*[2]/item[1][@type = 'film']",
+			expected: []string{"2"},
+		},
+		{
+			xpath:    "/catalog/item[1]/@type",
+			path:     "/catalog/item[1]/@type",
+			expected: []string{"book"},
+		},
+		{
+			xpath:    "/catalog/item/@type",
+			path:     "/catalog/item/@type",
+			expected: []string{"book"},
+		},
+		{
+			xpath:    "//item[@id != '1']/@type",
+			path:     "//item[@id != '1']/@type",
+			expected: []string{"film"},
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.xpath)
+		t.Run(name, func(t *testing.T) {
+			path, err := xmlpicker.ParseXPath(test.xpath)
+			if !assert.NoError(t, err, name) {
+				return
+			}
+			assert.Equal(t, test.path, path.String(), name)
+			actual := make([]string, 0)
+			parser := xmlpicker.NewParser(xml.NewDecoder(strings.NewReader(doc)), path)
+			for {
+				node, err := parser.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err, name) {
+					return
+				}
+				if text, ok := node.Text(); ok {
+					actual = append(actual, text)
+					continue
+				}
+				id := ""
+				for _, a := range node.StartElement.Attr {
+					if a.Name.Local == "id" {
+						id = a.Value
+					}
+				}
+				actual = append(actual, id)
+			}
+			assert.Equal(t, test.expected, actual, name)
+		})
+	}
+}
+
+func TestParseXPathErrors(t *testing.T) {
+	for idx, test := range []struct {
+		xpath       string
+		expectedErr string
+	}{
+		{
+			xpath:       "/a/@id/b",
+			expectedErr: `xmlpicker: unsupported xpath "/a/@id/b" at offset 6: steps after an attribute`,
+		},
+		{
+			xpath:       "/a//@id",
+			expectedErr: `xmlpicker: unsupported xpath "/a//@id" at offset 4: selecting attributes of any descendant`,
+		},
+		{
+			xpath:       "/a/parent::b",
+			expectedErr: `xmlpicker: unsupported xpath "/a/parent::b" at offset 3: parent axis`,
+		},
+		{
+			xpath:       "/a/b[@x][1]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/b[@x][1]" at offset 9: positional predicates after other predicates`,
+		},
+		{
+			xpath:       "/a/descendant::b[1]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/descendant::b[1]" at offset 17: positional predicates on the descendant axis`,
+		},
+		{
+			xpath:       "/a/b[0]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/b[0]" at offset 5: positions other than whole numbers from 1`,
+		},
+		{
+			xpath:       "/a/b[1.5]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/b[1.5]" at offset 5: positions other than whole numbers from 1`,
+		},
+		{
+			xpath:       "/a/b[1 and @x]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/b[1 and @x]" at offset 7: positional predicates within expressions`,
+		},
+		{
+			xpath:       "/a/b[last()]/c",
+			expectedErr: `xmlpicker: last() is only supported on the last step, when selecting elements in xpath "/a/b[last()]/c"`,
+		},
+		{
+			xpath:       "/a/x:b",
+			expectedErr: `xmlpicker: unsupported xpath "/a/x:b" at offset 3: namespace prefixes`,
+		},
+		{
+			xpath:       "/a | /b",
+			expectedErr: `xmlpicker: unsupported xpath "/a | /b" at offset 3: unions`,
+		},
+		{
+			xpath:       "/a/b[@x = 1 or @y = 2]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/b[@x = 1 or @y = 2]" at offset 12: or`,
+		},
+		{
+			xpath:       "/a/text()",
+			expectedErr: `xmlpicker: unsupported xpath "/a/text()" at offset 3: text() node test`,
+		},
+		{
+			xpath:       "/a/b[count(c) > 1]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/b[count(c) > 1]" at offset 5: count() function`,
+		},
+		{
+			xpath:       "/a/b[c = d]",
+			expectedErr: `xmlpicker: unsupported xpath "/a/b[c = d]" at offset 9: comparisons with anything but a literal`,
+		},
+		{
+			xpath:       "/a/b[c = 'x'",
+			expectedErr: `xmlpicker: invalid xpath "/a/b[c = 'x'" at offset 12: expected ]`,
+		},
+		{
+			xpath:       "/a/b[c = 'x]",
+			expectedErr: `xmlpicker: invalid xpath "/a/b[c = 'x]" at offset 9: unterminated string`,
+		},
+		{
+			xpath:       "/a[b = 'x']/c",
+			expectedErr: `xmlpicker: text predicates are only supported on the last step in xpath "/a[b = 'x']/c"`,
+		},
+	} {
+		name := fmt.Sprintf("%d %s", idx, test.xpath)
+		t.Run(name, func(t *testing.T) {
+			_, err := xmlpicker.ParseXPath(test.xpath)
+			assert.EqualError(t, err, test.expectedErr, name)
+		})
+	}
+}
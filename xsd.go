@@ -0,0 +1,360 @@
+package xmlpicker
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Schema holds the element declarations of an XML schema, as far as they are needed to map documents to JSON: the
+// type of text and attribute values and whether elements may be repeated. Names are matched by their local part, the
+// target namespace and the prefixes of type names are ignored.
+type Schema struct {
+	elements     map[string]*xsdElement
+	complexTypes map[string]*xsdComplexType
+	simpleTypes  map[string]*xsdSimpleType
+	resolved     map[*xsdComplexType]*schemaType
+	roots        map[string]*schemaElement
+}
+
+// schemaType is a resolved complex type, or a simple type when children is nil and value is set.
+type schemaType struct {
+	// name is the name of a complex type, if it has one
+	name     string
+	value    valueKind
+	mixed    bool
+	attrs    map[string]valueKind
+	children map[string]*schemaElement
+}
+
+type schemaElement struct {
+	repeated bool
+	// typ is nil for elements of any type
+	typ *schemaType
+}
+
+type valueKind int
+
+const (
+	stringValue valueKind = iota
+	numberValue
+	booleanValue
+	noValue
+)
+
+type xsdSchema struct {
+	Includes     []xsdInclude     `xml:"include"`
+	Imports      []xsdInclude     `xml:"import"`
+	Elements     []xsdElement     `xml:"element"`
+	ComplexTypes []xsdComplexType `xml:"complexType"`
+	SimpleTypes  []xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdInclude struct {
+	SchemaLocation string `xml:"schemaLocation,attr"`
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	MaxOccurs   string          `xml:"maxOccurs,attr"`
+	ComplexType *xsdComplexType `xml:"complexType"`
+	SimpleType  *xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdComplexType struct {
+	Name           string         `xml:"name,attr"`
+	Mixed          bool           `xml:"mixed,attr"`
+	Sequence       *xsdGroup      `xml:"sequence"`
+	Choice         *xsdGroup      `xml:"choice"`
+	All            *xsdGroup      `xml:"all"`
+	Attributes     []xsdAttribute `xml:"attribute"`
+	SimpleContent  *xsdContent    `xml:"simpleContent"`
+	ComplexContent *xsdContent    `xml:"complexContent"`
+}
+
+type xsdGroup struct {
+	MaxOccurs string       `xml:"maxOccurs,attr"`
+	Elements  []xsdElement `xml:"element"`
+	Sequences []xsdGroup   `xml:"sequence"`
+	Choices   []xsdGroup   `xml:"choice"`
+}
+
+type xsdContent struct {
+	Mixed       bool           `xml:"mixed,attr"`
+	Extension   *xsdDerivation `xml:"extension"`
+	Restriction *xsdDerivation `xml:"restriction"`
+}
+
+type xsdDerivation struct {
+	Base       string         `xml:"base,attr"`
+	Sequence   *xsdGroup      `xml:"sequence"`
+	Choice     *xsdGroup      `xml:"choice"`
+	All        *xsdGroup      `xml:"all"`
+	Attributes []xsdAttribute `xml:"attribute"`
+}
+
+type xsdAttribute struct {
+	Name       string         `xml:"name,attr"`
+	Type       string         `xml:"type,attr"`
+	SimpleType *xsdSimpleType `xml:"simpleType"`
+}
+
+type xsdSimpleType struct {
+	Name        string `xml:"name,attr"`
+	Restriction *struct {
+		Base string `xml:"base,attr"`
+	} `xml:"restriction"`
+}
+
+// LoadSchema reads the XML schema files, and the local files they include or import, into a single Schema.
+func LoadSchema(filenames ...string) (*Schema, error) {
+	s := &Schema{
+		elements:     make(map[string]*xsdElement),
+		complexTypes: make(map[string]*xsdComplexType),
+		simpleTypes:  make(map[string]*xsdSimpleType),
+		resolved:     make(map[*xsdComplexType]*schemaType),
+		roots:        make(map[string]*schemaElement),
+	}
+	loaded := make(map[string]bool)
+	for _, filename := range filenames {
+		if err := s.load(filename, loaded); err != nil {
+			return nil, err
+		}
+	}
+	// everything is resolved up front so that a Schema can be used concurrently
+	for name, decl := range s.elements {
+		s.roots[name] = s.resolveElement(decl, false)
+	}
+	return s, nil
+}
+
+func (s *Schema) load(filename string, loaded map[string]bool) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if loaded[abs] {
+		return nil
+	}
+	loaded[abs] = true
+	f, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var doc xsdSchema
+	if err := xml.NewDecoder(f).Decode(&doc); err != nil {
+		return fmt.Errorf("xmlpicker: invalid schema %s: %s", filename, err)
+	}
+	for i := range doc.Elements {
+		if _, ok := s.elements[doc.Elements[i].Name]; !ok {
+			s.elements[doc.Elements[i].Name] = &doc.Elements[i]
+		}
+	}
+	for i := range doc.ComplexTypes {
+		if _, ok := s.complexTypes[doc.ComplexTypes[i].Name]; !ok {
+			s.complexTypes[doc.ComplexTypes[i].Name] = &doc.ComplexTypes[i]
+		}
+	}
+	for i := range doc.SimpleTypes {
+		if _, ok := s.simpleTypes[doc.SimpleTypes[i].Name]; !ok {
+			s.simpleTypes[doc.SimpleTypes[i].Name] = &doc.SimpleTypes[i]
+		}
+	}
+	for _, inc := range append(doc.Includes, doc.Imports...) {
+		if inc.SchemaLocation == "" {
+			continue
+		}
+		if path, ok := localPath(resolveLocal(filepath.Dir(abs), inc.SchemaLocation)); ok {
+			if err := s.load(path, loaded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// element returns the declaration of node, found by following the declarations from the document element, or the
+// global declaration of its name.
+func (s *Schema) element(node *Node) *schemaElement {
+	var path []*Node
+	for n := node; n != nil && n.Parent != nil; n = n.Parent {
+		path = append(path, n)
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	if e, ok := s.roots[path[len(path)-1].StartElement.Name.Local]; ok {
+		for i := len(path) - 2; i >= 0 && e != nil; i-- {
+			if e.typ == nil {
+				e = nil
+				break
+			}
+			e = e.typ.children[path[i].StartElement.Name.Local]
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return s.roots[node.StartElement.Name.Local]
+}
+
+func (s *Schema) resolveElement(decl *xsdElement, repeated bool) *schemaElement {
+	e := &schemaElement{repeated: repeated || isRepeated(decl.MaxOccurs)}
+	if decl.Ref != "" {
+		ref, ok := s.elements[localName(decl.Ref)]
+		if !ok {
+			return e
+		}
+		decl = ref
+	}
+	switch {
+	case decl.ComplexType != nil:
+		e.typ = s.resolveComplexType(decl.ComplexType)
+	case decl.SimpleType != nil:
+		e.typ = &schemaType{value: s.simpleTypeKind(decl.SimpleType)}
+	case decl.Type != "":
+		e.typ = s.resolveType(decl.Type)
+	}
+	return e
+}
+
+// resolveType returns the named complex type, or a simple type for any other name.
+func (s *Schema) resolveType(name string) *schemaType {
+	if ct, ok := s.complexTypes[localName(name)]; ok {
+		return s.resolveComplexType(ct)
+	}
+	if localName(name) == "anyType" {
+		return nil
+	}
+	return &schemaType{value: s.valueKind(name)}
+}
+
+func (s *Schema) resolveComplexType(ct *xsdComplexType) *schemaType {
+	if t, ok := s.resolved[ct]; ok {
+		return t
+	}
+	// registered before the content is resolved as types may be recursive
+	t := &schemaType{name: ct.Name, value: noValue, mixed: ct.Mixed, attrs: make(map[string]valueKind), children: make(map[string]*schemaElement)}
+	s.resolved[ct] = t
+	s.addAttributes(t, ct.Attributes)
+	s.addGroups(t, false, ct.Sequence, ct.Choice, ct.All)
+	for _, c := range []*xsdContent{ct.SimpleContent, ct.ComplexContent} {
+		if c == nil {
+			continue
+		}
+		t.mixed = t.mixed || c.Mixed
+		for _, d := range []*xsdDerivation{c.Extension, c.Restriction} {
+			if d == nil {
+				continue
+			}
+			if base := s.resolveType(d.Base); base != nil {
+				if c == ct.SimpleContent {
+					t.value = base.value
+				}
+				for k, v := range base.attrs {
+					t.attrs[k] = v
+				}
+				if c == ct.ComplexContent && d == c.Extension {
+					for k, v := range base.children {
+						t.children[k] = v
+					}
+				}
+				t.mixed = t.mixed || base.mixed
+			}
+			s.addAttributes(t, d.Attributes)
+			s.addGroups(t, false, d.Sequence, d.Choice, d.All)
+		}
+	}
+	return t
+}
+
+func (s *Schema) addAttributes(t *schemaType, attrs []xsdAttribute) {
+	for _, a := range attrs {
+		if a.Name == "" {
+			continue
+		}
+		if a.SimpleType != nil {
+			t.attrs[a.Name] = s.simpleTypeKind(a.SimpleType)
+		} else {
+			t.attrs[a.Name] = s.valueKind(a.Type)
+		}
+	}
+}
+
+// addGroups adds the elements of model groups, they are repeated if any enclosing group may be repeated.
+func (s *Schema) addGroups(t *schemaType, repeated bool, groups ...*xsdGroup) {
+	for _, g := range groups {
+		if g == nil {
+			continue
+		}
+		r := repeated || isRepeated(g.MaxOccurs)
+		for i := range g.Elements {
+			decl := &g.Elements[i]
+			name := decl.Name
+			if decl.Ref != "" {
+				name = localName(decl.Ref)
+			}
+			if prev, ok := t.children[name]; ok {
+				// declared twice in the content model, e.g. in a sequence
+				c := *prev
+				c.repeated = true
+				t.children[name] = &c
+				continue
+			}
+			t.children[name] = s.resolveElement(decl, r)
+		}
+		for i := range g.Sequences {
+			s.addGroups(t, r, &g.Sequences[i])
+		}
+		for i := range g.Choices {
+			s.addGroups(t, r, &g.Choices[i])
+		}
+	}
+}
+
+func (s *Schema) simpleTypeKind(st *xsdSimpleType) valueKind {
+	if st.Restriction == nil {
+		// lists and unions
+		return stringValue
+	}
+	return s.valueKind(st.Restriction.Base)
+}
+
+// valueKind follows the restrictions of a simple type to the built-in type it is derived from.
+func (s *Schema) valueKind(name string) valueKind {
+	for i := 0; i < 32; i++ {
+		st, ok := s.simpleTypes[localName(name)]
+		if !ok {
+			break
+		}
+		if st.Restriction == nil {
+			return stringValue
+		}
+		name = st.Restriction.Base
+	}
+	switch localName(name) {
+	case "boolean":
+		return booleanValue
+	case "decimal", "float", "double", "integer", "int", "long", "short", "byte", "nonNegativeInteger",
+		"positiveInteger", "nonPositiveInteger", "negativeInteger", "unsignedLong", "unsignedInt", "unsignedShort",
+		"unsignedByte":
+		return numberValue
+	}
+	return stringValue
+}
+
+func isRepeated(maxOccurs string) bool {
+	return maxOccurs != "" && maxOccurs != "0" && maxOccurs != "1"
+}
+
+func localName(qname string) string {
+	if i := strings.IndexByte(qname, ':'); i != -1 {
+		return qname[i+1:]
+	}
+	return qname
+}